@@ -3,6 +3,7 @@ module github.com/hari134/pratilipi
 go 1.22.1
 
 require (
+	github.com/golang-jwt/jwt/v4 v4.5.0
 	github.com/segmentio/kafka-go v0.4.47
 	github.com/uptrace/bun v1.2.3
 )
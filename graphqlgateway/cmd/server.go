@@ -9,20 +9,14 @@ import (
 	"github.com/99designs/gqlgen/graphql/handler"
 	"github.com/99designs/gqlgen/graphql/playground"
 	"github.com/hari134/pratilipi/graphqlgateway/graph"
+	"github.com/hari134/pratilipi/pkg/auth"
 )
 
-const defaultPort = "8080"
-
-// Define the key used for storing claims in context
-type ClaimsCtxKey struct{}
-
-// Define the structure to hold the token validation response
-type ValidateTokenResponse struct {
-	Valid  bool   `json:"valid"`
-	UserID int64  `json:"user_id"`
-	Email  string `json:"email"`
-	Role   string `json:"role"`
-}
+const (
+	defaultPort           = "8080"
+	defaultJWKSURL        = "http://userservice:8080/.well-known/jwks.json"
+	defaultRevocationsURL = "http://userservice:8080/token-revocations"
+)
 
 func main() {
 	port := os.Getenv("PORT")
@@ -30,7 +24,19 @@ func main() {
 		port = defaultPort
 	}
 
-	srv := handler.NewDefaultServer(graph.NewExecutableSchema(graph.Config{Resolvers: &graph.Resolver{}}))
+	jwksURL := os.Getenv("JWKS_URL")
+	if jwksURL == "" {
+		jwksURL = defaultJWKSURL
+	}
+	revocationsURL := os.Getenv("TOKEN_REVOCATIONS_URL")
+	if revocationsURL == "" {
+		revocationsURL = defaultRevocationsURL
+	}
+
+	resolver := &graph.Resolver{
+		Verifier: auth.NewVerifier(jwksURL).CheckRevocations(revocationsURL),
+	}
+	srv := handler.NewDefaultServer(graph.NewExecutableSchema(graph.Config{Resolvers: resolver}))
 
 	// Add the JWT authentication middleware to the server
 	http.Handle("/query", AuthMiddleware(srv))
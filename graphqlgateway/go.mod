@@ -6,12 +6,14 @@ toolchain go1.22.8
 
 require (
 	github.com/99designs/gqlgen v0.17.54
+	github.com/hari134/pratilipi v0.0.0-20241005131941-36f47998ef28
 	github.com/vektah/gqlparser/v2 v2.5.17
 )
 
 require (
 	github.com/agnivade/levenshtein v1.1.1 // indirect
 	github.com/cpuguy83/go-md2man/v2 v2.0.4 // indirect
+	github.com/golang-jwt/jwt/v4 v4.5.0 // indirect
 	github.com/google/uuid v1.6.0 // indirect
 	github.com/gorilla/websocket v1.5.0 // indirect
 	github.com/hashicorp/golang-lru/v2 v2.0.7 // indirect
@@ -0,0 +1,169 @@
+package graph
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/hari134/pratilipi/graphqlgateway/graph/model"
+)
+
+// serviceRequest sends a request to a backing service, forwarding the caller's
+// Authorization header so the service can check the token's permissions itself.
+func serviceRequest(ctx context.Context, method, url string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
+	if err != nil {
+		return nil, err
+	}
+	if token, ok := ctx.Value("authtoken").(string); ok && token != "" {
+		req.Header.Set("Authorization", token)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return http.DefaultClient.Do(req)
+}
+
+// serviceError turns a non-2xx response into an error carrying the service's message.
+func serviceError(resp *http.Response) error {
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(body)))
+}
+
+// sendAddress sends an address book request for the caller and decodes the resulting address.
+func (r *mutationResolver) sendAddress(ctx context.Context, method, url string, input interface{}) (*model.Address, error) {
+	if _, err := r.verifyClaims(ctx, ""); err != nil {
+		return nil, err
+	}
+
+	var body io.Reader
+	if input != nil {
+		reqBody, err := json.Marshal(input)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal request body: %v", err)
+		}
+		body = bytes.NewBuffer(reqBody)
+	}
+	resp, err := serviceRequest(ctx, method, url, body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request to User Service: %v", err)
+	}
+	defer resp.Body.Close()
+	if err := serviceError(resp); err != nil {
+		return nil, err
+	}
+
+	var address model.Address
+	if err := json.NewDecoder(resp.Body).Decode(&address); err != nil {
+		return nil, fmt.Errorf("failed to decode address: %v", err)
+	}
+	return &address, nil
+}
+
+// sendJSON sends input, if any, as a JSON request to a backing service and
+// decodes the response into out, if given.
+func sendJSON(ctx context.Context, method, url string, input, out interface{}) error {
+	var body io.Reader
+	if input != nil {
+		reqBody, err := json.Marshal(input)
+		if err != nil {
+			return fmt.Errorf("failed to marshal request body: %v", err)
+		}
+		body = bytes.NewBuffer(reqBody)
+	}
+	resp, err := serviceRequest(ctx, method, url, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if err := serviceError(resp); err != nil {
+		return err
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode response: %v", err)
+	}
+	return nil
+}
+
+// adminUserURL returns the User Service URL of an admin action on a user.
+func adminUserURL(id, action string) (string, error) {
+	userID, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return "", fmt.Errorf("invalid user ID: %v", err)
+	}
+	return fmt.Sprintf("http://userservice:8080/users/%d/%s", userID, action), nil
+}
+
+// saveCategory sends a category to the Product Service to be created or updated.
+func (r *mutationResolver) saveCategory(ctx context.Context, method, endpoint string, input model.CategoryInput) (*model.Category, error) {
+	if _, err := r.verifyClaims(ctx, "product:write"); err != nil {
+		return nil, err
+	}
+
+	body := struct {
+		Name     string `json:"name"`
+		Slug     string `json:"slug,omitempty"`
+		ParentID int64  `json:"parent_id,omitempty"`
+		Position int    `json:"position"`
+	}{Name: input.Name}
+	if input.Slug != nil {
+		body.Slug = *input.Slug
+	}
+	if input.ParentID != nil {
+		parentID, err := strconv.ParseInt(*input.ParentID, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid parent category ID")
+		}
+		body.ParentID = parentID
+	}
+	if input.Position != nil {
+		body.Position = *input.Position
+	}
+
+	var category restCategory
+	if err := sendJSON(ctx, method, endpoint, body, &category); err != nil {
+		return nil, fmt.Errorf("failed to save category: %v", err)
+	}
+	return category.model(), nil
+}
+
+// sendVariant sends a variant change to the Product Service and returns the variant.
+func (r *mutationResolver) sendVariant(ctx context.Context, method, url string, input interface{}) (*model.ProductVariant, error) {
+	if _, err := r.verifyClaims(ctx, "product:write"); err != nil {
+		return nil, err
+	}
+
+	var variant restVariant
+	if err := sendJSON(ctx, method, url, input, &variant); err != nil {
+		return nil, fmt.Errorf("failed to save variant: %v", err)
+	}
+	return variant.model(), nil
+}
+
+// variantURL returns the Product Service URL of a product's variants or, with
+// a variant ID, of one variant.
+func variantURL(productID, variantID string) (string, error) {
+	pid, err := strconv.ParseInt(productID, 10, 64)
+	if err != nil {
+		return "", fmt.Errorf("invalid product ID: %v", err)
+	}
+	if variantID == "" {
+		return fmt.Sprintf("http://productservice:8080/products/%d/variants", pid), nil
+	}
+	vid, err := strconv.ParseInt(variantID, 10, 64)
+	if err != nil {
+		return "", fmt.Errorf("invalid variant ID: %v", err)
+	}
+	return fmt.Sprintf("http://productservice:8080/products/%d/variants/%d", pid, vid), nil
+}
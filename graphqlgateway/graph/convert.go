@@ -0,0 +1,183 @@
+package graph
+
+import (
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/hari134/pratilipi/graphqlgateway/graph/model"
+)
+
+// shippingAddress returns nil for orders placed before orders had an address.
+func shippingAddress(a *model.ShippingAddress) *model.ShippingAddress {
+	if a == nil || a.AddressID == 0 && a.Line1 == "" && a.City == "" {
+		return nil
+	}
+	return a
+}
+
+// restProduct is a product as the Product Service returns it.
+type restProduct struct {
+	ProductID      int64          `json:"productID"`
+	Name           string         `json:"name"`
+	Description    string         `json:"description"`
+	Price          float64        `json:"price"`
+	InventoryCount int            `json:"inventoryCount"`
+	CreatedAt      time.Time      `json:"createdAt"`
+	UpdatedAt      time.Time      `json:"updatedAt"`
+	Categories     []restCategory `json:"categories"`
+	Variants       []restVariant  `json:"variants"`
+	Images         []restImage    `json:"images"`
+}
+
+func (p restProduct) model() *model.Product {
+	product := &model.Product{
+		ProductID:      strconv.FormatInt(p.ProductID, 10),
+		Name:           p.Name,
+		Description:    p.Description,
+		Price:          p.Price,
+		InventoryCount: p.InventoryCount,
+		CreatedAt:      p.CreatedAt.Format(time.RFC3339),
+		UpdatedAt:      p.UpdatedAt.Format(time.RFC3339),
+		Categories:     categories(p.Categories),
+		Variants:       make([]*model.ProductVariant, len(p.Variants)),
+		Images:         make([]*model.ProductImage, len(p.Images)),
+	}
+	for i, v := range p.Variants {
+		product.Variants[i] = v.model()
+	}
+	for i, img := range p.Images {
+		product.Images[i] = img.model()
+	}
+	return product
+}
+
+// restCategory is a category as the Product Service returns it.
+type restCategory struct {
+	CategoryID int64          `json:"category_id"`
+	ParentID   int64          `json:"parent_id"`
+	Name       string         `json:"name"`
+	Slug       string         `json:"slug"`
+	Position   int            `json:"position"`
+	Children   []restCategory `json:"children"`
+}
+
+func (c restCategory) model() *model.Category {
+	category := &model.Category{
+		CategoryID: strconv.FormatInt(c.CategoryID, 10),
+		Name:       c.Name,
+		Slug:       c.Slug,
+		Position:   c.Position,
+		Children:   categories(c.Children),
+	}
+	if c.ParentID != 0 {
+		parentID := strconv.FormatInt(c.ParentID, 10)
+		category.ParentID = &parentID
+	}
+	return category
+}
+
+func categories(cs []restCategory) []*model.Category {
+	out := make([]*model.Category, len(cs))
+	for i, c := range cs {
+		out[i] = c.model()
+	}
+	return out
+}
+
+// restImage is a product image as the Product Service returns it.
+type restImage struct {
+	ImageID      int64  `json:"image_id"`
+	URL          string `json:"url"`
+	ThumbnailURL string `json:"thumbnail_url"`
+	AltText      string `json:"alt_text"`
+	Width        int    `json:"width"`
+	Height       int    `json:"height"`
+	Position     int    `json:"position"`
+	ContentType  string `json:"content_type"`
+}
+
+func (img restImage) model() *model.ProductImage {
+	return &model.ProductImage{
+		ImageID:      strconv.FormatInt(img.ImageID, 10),
+		URL:          img.URL,
+		ThumbnailURL: img.ThumbnailURL,
+		AltText:      img.AltText,
+		Width:        img.Width,
+		Height:       img.Height,
+		Position:     img.Position,
+		ContentType:  img.ContentType,
+	}
+}
+
+// restVariant is a product variant as the Product Service returns it.
+type restVariant struct {
+	VariantID      int64             `json:"variant_id"`
+	ProductID      int64             `json:"product_id"`
+	SKU            string            `json:"sku"`
+	Attributes     map[string]string `json:"attributes"`
+	Price          float64           `json:"price"`
+	InventoryCount int               `json:"inventory_count"`
+}
+
+func (v restVariant) model() *model.ProductVariant {
+	variant := &model.ProductVariant{
+		VariantID:      strconv.FormatInt(v.VariantID, 10),
+		ProductID:      strconv.FormatInt(v.ProductID, 10),
+		SKU:            v.SKU,
+		Attributes:     make([]*model.VariantAttribute, 0, len(v.Attributes)),
+		Price:          v.Price,
+		InventoryCount: v.InventoryCount,
+	}
+	for name, value := range v.Attributes {
+		variant.Attributes = append(variant.Attributes, &model.VariantAttribute{Name: name, Value: value})
+	}
+	sort.Slice(variant.Attributes, func(i, j int) bool { return variant.Attributes[i].Name < variant.Attributes[j].Name })
+	return variant
+}
+
+// variantRequest is a ProductVariantInput in the Product Service's shape.
+type variantRequest struct {
+	SKU            string            `json:"sku"`
+	Attributes     map[string]string `json:"attributes"`
+	Price          float64           `json:"price"`
+	InventoryCount int               `json:"inventory_count"`
+	Position       int               `json:"position"`
+}
+
+func newVariantRequest(input *model.ProductVariantInput) variantRequest {
+	req := variantRequest{SKU: input.SKU, Attributes: map[string]string{}, Price: input.Price}
+	for _, a := range input.Attributes {
+		req.Attributes[a.Name] = a.Value
+	}
+	if input.InventoryCount != nil {
+		req.InventoryCount = *input.InventoryCount
+	}
+	if input.Position != nil {
+		req.Position = *input.Position
+	}
+	return req
+}
+
+// orderItem converts an order item as the Order Service returns it.
+func orderItem(productID, variantID int64, sku string, quantity int) *model.OrderItem {
+	item := &model.OrderItem{ProductID: strconv.FormatInt(productID, 10), Quantity: quantity}
+	if variantID != 0 {
+		id := strconv.FormatInt(variantID, 10)
+		item.VariantID, item.SKU = &id, &sku
+	}
+	return item
+}
+
+// parseIDs converts GraphQL IDs to the numeric IDs the services use.
+func parseIDs(ids []string) ([]int64, error) {
+	out := make([]int64, 0, len(ids))
+	for _, id := range ids {
+		n, err := strconv.ParseInt(id, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, n)
+	}
+	return out, nil
+}
@@ -0,0 +1,315 @@
+// Package model holds the GraphQL models. They are maintained by hand and autobound
+// by gqlgen, so their JSON tags can match the REST payloads of the backing services.
+
+package model
+
+type Mutation struct {
+}
+
+
+type Order struct {
+    OrderID         string           `json:"orderID"`
+    UserID          string           `json:"userID"`
+    Items           []*OrderItem     `json:"items"`
+    TotalPrice      float64          `json:"totalPrice"`
+    Status          string           `json:"status"`
+    PlacedAt        string           `json:"placedAt"` // Should be a string representing a timestamp
+    ShippingAddress *ShippingAddress `json:"shippingAddress"` // Nil for orders placed without an address
+}
+
+
+type OrderInput struct {
+	UserID    string            `json:"user_id"`
+	AddressID *int64            `json:"address_id,omitempty"` // The user's default address if nil
+	Items     []*OrderItemInput `json:"items"`
+}
+
+type OrderItem struct {
+    ProductID string `json:"productID"` // Should be a string to match the GraphQL ID type
+    VariantID *string `json:"variantID"` // Nil for products without variants
+    SKU       *string `json:"sku"`
+    Quantity  int    `json:"quantity"`
+}
+
+type OrderItemInput struct {
+	ProductID int64 `json:"product_id"`
+	VariantID *int64 `json:"variant_id,omitempty"` // Required for products with variants
+	Quantity  int    `json:"quantity"`
+	PriceAtOrder int `json:"price_at_order"`
+}
+
+type Product struct {
+	ProductID      string  `json:"productID"`       // ProductID should be a string for GraphQL ID type
+	Name           string  `json:"name"`
+	Description    string  `json:"description"`
+	Price          float64 `json:"price"`
+	InventoryCount int     `json:"inventoryCount"`
+	CreatedAt      string  `json:"createdAt"`       // Time is returned as string
+	UpdatedAt      string  `json:"updatedAt"`       // Time is returned as string
+	Categories     []*Category `json:"categories"`
+	Variants       []*ProductVariant `json:"variants"`
+	Images         []*ProductImage `json:"images"` // Main image first
+}
+
+type ProductInput struct {
+	Name           string  `json:"name"`
+	Price          float64 `json:"price"`
+	InventoryCount int     `json:"InventoryCount"`
+	Description string `json:"description"`
+	CategoryIDs []string `json:"-"` // Sent to the Product Service as numbers
+	Variants    []*ProductVariantInput `json:"-"` // Sent to the Product Service in its own shape
+}
+
+type Query struct {
+}
+
+type RegisterInput struct {
+	Name     string `json:"name"`
+	Email    string `json:"email"`
+	PhoneNo  string   `json:"phone_no"`
+	Password string `json:"password"`
+}
+
+type User struct {
+	UserID string `json:"userID"`
+	Name   string `json:"name"`
+	Email  string `json:"email"`
+	PhoneNo string `json:"phoneNo"`
+}
+
+// ShippingAddress is the copy of an address stored with an order.
+type ShippingAddress struct {
+	AddressID     int64  `json:"addressID"`
+	RecipientName string `json:"recipientName"`
+	PhoneNo       string `json:"phoneNo"`
+	Line1         string `json:"line1"`
+	Line2         string `json:"line2"`
+	City          string `json:"city"`
+	State         string `json:"state"`
+	PostalCode    string `json:"postalCode"`
+	Country       string `json:"country"`
+}
+
+// Address is an entry of the caller's address book. The JSON tags match the User Service.
+type Address struct {
+	AddressID     int64  `json:"address_id"`
+	Label         string `json:"label"`
+	RecipientName string `json:"recipient_name"`
+	PhoneNo       string `json:"phone_no"`
+	Line1         string `json:"line1"`
+	Line2         string `json:"line2"`
+	City          string `json:"city"`
+	State         string `json:"state"`
+	PostalCode    string `json:"postal_code"`
+	Country       string `json:"country"`
+	IsDefault     bool   `json:"is_default"`
+}
+
+// AddressInput is sent to the User Service as is.
+type AddressInput struct {
+	Label         *string `json:"label,omitempty"`
+	RecipientName string  `json:"recipient_name"`
+	PhoneNo       *string `json:"phone_no,omitempty"`
+	Line1         string  `json:"line1"`
+	Line2         *string `json:"line2,omitempty"`
+	City          string  `json:"city"`
+	State         *string `json:"state,omitempty"`
+	PostalCode    *string `json:"postal_code,omitempty"`
+	Country       string  `json:"country"`
+	IsDefault     *bool   `json:"is_default,omitempty"`
+}
+
+// Session is one of the caller's logins. The JSON tags match the User Service.
+type Session struct {
+	SessionID  string `json:"session_id"`
+	DeviceName string `json:"device_name"`
+	UserAgent  string `json:"user_agent"`
+	IP         string `json:"ip"`
+	CreatedAt  string `json:"created_at"`
+	LastSeenAt string `json:"last_seen_at"`
+	Current    bool   `json:"current"`
+}
+
+// AdminUser is a user as shown to admins. The JSON tags match the User Service.
+type AdminUser struct {
+	UserID                int64    `json:"user_id"`
+	Name                  string   `json:"name"`
+	Email                 string   `json:"email"`
+	PhoneNo               string   `json:"phone_no"`
+	Roles                 []string `json:"roles"`
+	EmailVerified         bool     `json:"email_verified"`
+	TwoFactorEnabled      bool     `json:"two_factor_enabled"`
+	DisabledAt            *string  `json:"disabled_at"`
+	DisabledReason        *string  `json:"disabled_reason"`
+	PasswordResetRequired bool     `json:"password_reset_required"`
+	CreatedAt             string   `json:"created_at"`
+}
+
+// AdminUserPage is one page of the users matching an AdminUserFilter.
+type AdminUserPage struct {
+	Users []*AdminUser `json:"users"`
+	Total int          `json:"total"`
+}
+
+// AdminUserFilter is sent to the User Service as query parameters.
+type AdminUserFilter struct {
+	Email    *string `json:"email"`
+	Name     *string `json:"name"`
+	Role     *string `json:"role"`
+	Status   *string `json:"status"`
+	Verified *bool   `json:"verified"`
+	Limit    *int    `json:"limit"`
+	Offset   *int    `json:"offset"`
+}
+
+// AuditLogEntry is an entry of the User Service's audit log. The JSON tags
+// match the User Service; IDs that do not apply are left out.
+type AuditLogEntry struct {
+	AuditID        int64   `json:"audit_id"`
+	Action         string  `json:"action"`
+	Outcome        string  `json:"outcome"`
+	ActorID        *int64  `json:"actor_id"`
+	ImpersonatorID *int64  `json:"impersonator_id"`
+	ActorClientID  *string `json:"actor_client_id"`
+	TargetUserID   *int64  `json:"target_user_id"`
+	Detail         *string `json:"detail"`
+	IP             *string `json:"ip"`
+	UserAgent      *string `json:"user_agent"`
+	CreatedAt      string  `json:"created_at"`
+}
+
+// AuditLogPage is one page of the entries matching an AuditLogFilter.
+type AuditLogPage struct {
+	Entries []*AuditLogEntry `json:"entries"`
+	Total   int              `json:"total"`
+}
+
+// AuditLogFilter is sent to the User Service as query parameters.
+type AuditLogFilter struct {
+	UserID       *string `json:"userID"`
+	ActorID      *string `json:"actorID"`
+	TargetUserID *string `json:"targetUserID"`
+	Action       *string `json:"action"`
+	Outcome      *string `json:"outcome"`
+	IP           *string `json:"ip"`
+	Since        *string `json:"since"`
+	Until        *string `json:"until"`
+	Limit        *int    `json:"limit"`
+	Offset       *int    `json:"offset"`
+}
+
+// ProductSearchResult is one page of the products matching a ProductSearchInput.
+type ProductSearchResult struct {
+	Products []*Product     `json:"products"`
+	Total    int            `json:"total"`
+	Facets   *ProductFacets `json:"facets"`
+}
+
+// ProductFacets count the matching products by price range and availability.
+// The JSON tags match the Product Service.
+type ProductFacets struct {
+	Price        []*PriceBucket     `json:"price"`
+	Availability *StockAvailability `json:"availability"`
+}
+
+// PriceBucket counts the products priced from Min up to, but not including, Max.
+type PriceBucket struct {
+	Min   float64  `json:"min"`
+	Max   *float64 `json:"max"`
+	Count int      `json:"count"`
+}
+
+// StockAvailability counts the products with and without inventory.
+type StockAvailability struct {
+	InStock    int `json:"in_stock"`
+	OutOfStock int `json:"out_of_stock"`
+}
+
+// ProductSearchInput is sent to the Product Service as query parameters.
+type ProductSearchInput struct {
+	Query    *string  `json:"query"`
+	MinPrice *float64 `json:"minPrice"`
+	MaxPrice *float64 `json:"maxPrice"`
+	InStock  *bool    `json:"inStock"`
+	Sort     *string  `json:"sort"`
+	Limit    *int     `json:"limit"`
+	Offset   *int     `json:"offset"`
+}
+
+// Impersonation is a token to act as a user.
+type Impersonation struct {
+	Token     string `json:"token"`
+	ExpiresIn int64  `json:"expires_in"`
+}
+
+// Category is a node of the product category tree.
+type Category struct {
+	CategoryID string      `json:"categoryID"`
+	ParentID   *string     `json:"parentID"` // Unset for root categories
+	Name       string      `json:"name"`
+	Slug       string      `json:"slug"`
+	Position   int         `json:"position"`
+	Children   []*Category `json:"children"`
+}
+
+// CategoryProductsPage is one page of the products in a category.
+type CategoryProductsPage struct {
+	Category *Category  `json:"category"`
+	Products []*Product `json:"products"`
+	Total    int        `json:"total"`
+}
+
+// CategoryInput creates or updates a category. The Product Service derives
+// the slug from the name when it is left out.
+type CategoryInput struct {
+	Name     string  `json:"name"`
+	Slug     *string `json:"slug"`
+	ParentID *string `json:"parentID"`
+	Position *int    `json:"position"`
+}
+
+// ProductVariant is a version of a product, such as a size and color, with its
+// own SKU, price and inventory.
+type ProductVariant struct {
+	VariantID      string              `json:"variantID"`
+	ProductID      string              `json:"productID"`
+	SKU            string              `json:"sku"`
+	Attributes     []*VariantAttribute `json:"attributes"` // Sorted by name
+	Price          float64             `json:"price"`
+	InventoryCount int                 `json:"inventoryCount"`
+}
+
+// VariantAttribute is one attribute value of a variant, e.g. color: red.
+type VariantAttribute struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// ProductImage is an uploaded picture of a product. The URLs point at the
+// Product Service's blob store.
+type ProductImage struct {
+	ImageID      string `json:"imageID"`
+	URL          string `json:"url"`
+	ThumbnailURL string `json:"thumbnailURL"`
+	AltText      string `json:"altText"`
+	Width        int    `json:"width"`
+	Height       int    `json:"height"`
+	Position     int    `json:"position"`
+	ContentType  string `json:"contentType"`
+}
+
+// ProductVariantInput creates or updates a variant. InventoryCount is only
+// used on creation; setVariantInventory changes it later.
+type ProductVariantInput struct {
+	SKU            string                   `json:"sku"`
+	Attributes     []*VariantAttributeInput `json:"attributes"`
+	Price          float64                  `json:"price"`
+	InventoryCount *int                     `json:"inventoryCount"`
+	Position       *int                     `json:"position"`
+}
+
+// VariantAttributeInput is one attribute value of a variant to create or update.
+type VariantAttributeInput struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
@@ -1,7 +1,11 @@
 package graph
 
+import "github.com/hari134/pratilipi/pkg/auth"
+
 // This file will not be regenerated automatically.
 //
 // It serves as dependency injection for your app, add any dependencies you require here.
 
-type Resolver struct{}
+type Resolver struct {
+	Verifier *auth.Verifier // Verifies access tokens against the User Service JWKS
+}
@@ -6,65 +6,41 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"net/url"
 	"strconv"
-	"time"
 
 	"github.com/hari134/pratilipi/graphqlgateway/graph/model"
+	"github.com/hari134/pratilipi/pkg/auth"
 )
 
-type ClaimsCtxKey struct{}
-
-// Define the structure to hold the token validation response
-type ValidateTokenResponse struct {
-	Valid  bool   `json:"valid"`
-	UserID int64  `json:"user_id"`
-	Email  string `json:"email"`
-	Role   string `json:"role"`
-}
-
-// VerifyClaims checks if the token is valid by calling the userservice validate-token API.
-func verifyClaims(ctx context.Context, role string) (ValidateTokenResponse, error) {
+// verifyClaims verifies the request's token against the User Service's published
+// signing keys and checks that it grants the permission the operation needs. An
+// empty permission accepts any valid token.
+func (r *Resolver) verifyClaims(ctx context.Context, permission string) (*auth.Claims, error) {
 	// Extract the token from the context
 	token, ok := ctx.Value("authtoken").(string)
 	if !ok || token == "" {
-		return ValidateTokenResponse{}, fmt.Errorf("unauthorized: token not provided")
-	}
-
-	// Call the validate-token API to check if the token is valid
-	validateURL := "http://userservice:8080/validate-token"
-	reqBody, _ := json.Marshal(map[string]string{
-		"token": token,
-	})
-
-	resp, err := http.Post(validateURL, "application/json", bytes.NewBuffer(reqBody))
-	if err != nil || resp.StatusCode != http.StatusOK {
-		return ValidateTokenResponse{}, fmt.Errorf("unauthorized: invalid token")
+		return nil, fmt.Errorf("unauthorized: token not provided")
 	}
-	defer resp.Body.Close()
 
-	// Decode the response from the userservice
-	var validateResp ValidateTokenResponse
-	if err := json.NewDecoder(resp.Body).Decode(&validateResp); err != nil || !validateResp.Valid {
-		return ValidateTokenResponse{}, fmt.Errorf("unauthorized: invalid token")
-	}
-	if validateResp.Role == "admin" {
-		return validateResp, nil
+	claims, err := r.Verifier.Parse(token)
+	if err != nil {
+		return nil, fmt.Errorf("unauthorized: invalid token")
 	}
-	fmt.Println(validateResp.Role)
-	if validateResp.Role != role {
-		return ValidateTokenResponse{}, fmt.Errorf("unauthorized: role does not pemit this operation")
+	if permission != "" && !claims.HasPermission(permission) {
+		return nil, fmt.Errorf("forbidden: missing permission %s", permission)
 	}
-	return validateResp, nil
+	return claims, nil
 }
 
 // Users is the resolver for the users query.
 func (r *queryResolver) Users(ctx context.Context) ([]*model.User, error) {
-	_, err := verifyClaims(ctx, "user")
+	_, err := r.verifyClaims(ctx, "user:read")
 	if err != nil {
 		return nil, err
 	}
 
-	resp, err := http.Get("http://userservice:8080/users")
+	resp, err := serviceRequest(ctx, http.MethodGet, "http://userservice:8080/users", nil)
 	if err != nil {
 		return nil, err
 	}
@@ -96,16 +72,20 @@ func (r *queryResolver) Users(ctx context.Context) ([]*model.User, error) {
 
 // User is the resolver for the user query.
 func (r *queryResolver) User(ctx context.Context, id string) (*model.User, error) {
-	_, err := verifyClaims(ctx, "user")
+	// Users may read their own profile; the User Service checks user:read for others
+	_, err := r.verifyClaims(ctx, "")
 	if err != nil {
 		return nil, err
 	}
 
-	resp, err := http.Get(fmt.Sprintf("http://userservice:8080/users/%s", id))
+	resp, err := serviceRequest(ctx, http.MethodGet, fmt.Sprintf("http://userservice:8080/users/%s", url.PathEscape(id)), nil)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
+	if err := serviceError(resp); err != nil {
+		return nil, err
+	}
 
 	var user struct {
 		UserID int64  `json:"userID"`
@@ -129,27 +109,18 @@ func (r *queryResolver) User(ctx context.Context, id string) (*model.User, error
 
 // Products is the resolver for the products query.
 func (r *queryResolver) Products(ctx context.Context) ([]*model.Product, error) {
-	_, err := verifyClaims(ctx, "user")
+	_, err := r.verifyClaims(ctx, "product:read")
 	if err != nil {
 		return nil, err
 	}
 
-	resp, err := http.Get("http://productservice:8080/products")
+	resp, err := serviceRequest(ctx, http.MethodGet, "http://productservice:8080/products", nil)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
 
-	var products []struct {
-		ProductID      int64     `json:"productID"`
-		Name           string    `json:"name"`
-		Description    string    `json:"description"`
-		Price          float64   `json:"price"`
-		InventoryCount int       `json:"inventoryCount"`
-		CreatedAt      time.Time `json:"createdAt"`
-		UpdatedAt      time.Time `json:"updatedAt"`
-	}
-
+	var products []restProduct
 	err = json.NewDecoder(resp.Body).Decode(&products)
 	if err != nil {
 		return nil, err
@@ -157,16 +128,7 @@ func (r *queryResolver) Products(ctx context.Context) ([]*model.Product, error)
 
 	var gqlProducts []*model.Product
 	for _, product := range products {
-		gqlProduct := &model.Product{
-			ProductID:      strconv.FormatInt(product.ProductID, 10),
-			Name:           product.Name,
-			Description:    product.Description,
-			Price:          product.Price,
-			InventoryCount: product.InventoryCount,
-			CreatedAt:      product.CreatedAt.Format(time.RFC3339),
-			UpdatedAt:      product.UpdatedAt.Format(time.RFC3339),
-		}
-		gqlProducts = append(gqlProducts, gqlProduct)
+		gqlProducts = append(gqlProducts, product.model())
 	}
 
 	return gqlProducts, nil
@@ -174,7 +136,7 @@ func (r *queryResolver) Products(ctx context.Context) ([]*model.Product, error)
 
 // Product is the resolver for the product query.
 func (r *queryResolver) Product(ctx context.Context, id string) (*model.Product, error) {
-	_, err := verifyClaims(ctx, "user")
+	_, err := r.verifyClaims(ctx, "product:read")
 	if err != nil {
 		return nil, err
 	}
@@ -184,63 +146,55 @@ func (r *queryResolver) Product(ctx context.Context, id string) (*model.Product,
 		return nil, fmt.Errorf("invalid product ID")
 	}
 	fmt.Println(productID)
-	resp, err := http.Get(fmt.Sprintf("http://productservice:8080/products/%d", productID))
+	resp, err := serviceRequest(ctx, http.MethodGet, fmt.Sprintf("http://productservice:8080/products/%d", productID), nil)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
-	var product struct {
-		ProductID      int64     `json:"productID"`
-		Name           string    `json:"name"`
-		Description    string    `json:"description"`
-		Price          float64   `json:"price"`
-		InventoryCount int       `json:"inventoryCount"`
-		CreatedAt      time.Time `json:"createdAt"`
-		UpdatedAt      time.Time `json:"updatedAt"`
-	}
+	var product restProduct
 	err = json.NewDecoder(resp.Body).Decode(&product)
 	if err != nil {
 		return nil, err
 	}
 
-	gqlProduct := &model.Product{
-		ProductID:      strconv.FormatInt(product.ProductID, 10),
-		Name:           product.Name,
-		Description:    product.Description,
-		Price:          product.Price,
-		InventoryCount: product.InventoryCount,
-		CreatedAt:      product.CreatedAt.Format(time.RFC3339),
-		UpdatedAt:      product.UpdatedAt.Format(time.RFC3339),
-	}
+	gqlProduct := product.model()
 
 	return gqlProduct, nil
 }
 
 func (r *queryResolver) Orders(ctx context.Context) ([]*model.Order, error) {
-	// Verify claims for user role
-	_, err := verifyClaims(ctx, "user")
+	// Users get their own orders; the Order Service returns everyone's for order:read
+	_, err := r.verifyClaims(ctx, "")
 	if err != nil {
 		return nil, err
 	}
 
 	// Fetch orders from the external service
-	resp, err := http.Get("http://orderservice:8080/orders")
+	resp, err := serviceRequest(ctx, http.MethodGet, "http://orderservice:8080/orders", nil)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
+	if err := serviceError(resp); err != nil {
+		return nil, err
+	}
 
-	// Structure to hold the API response
+	// Structure to hold the API response, which wraps each order with its items
 	var ordersWithItems []struct {
-		OrderID    int64   `json:"OrderID"`
-		UserID     int64   `json:"UserID"`
-		TotalPrice float64 `json:"TotalPrice"`
-		Status     string  `json:"Status"`
-		PlacedAt   string  `json:"PlacedAt"`
-		UpdatedAt  string  `json:"UpdatedAt"`
+		Order struct {
+			OrderID         int64                  `json:"OrderID"`
+			UserID          int64                  `json:"UserID"`
+			TotalPrice      float64                `json:"TotalPrice"`
+			Status          string                 `json:"Status"`
+			PlacedAt        string                 `json:"PlacedAt"`
+			UpdatedAt       string                 `json:"UpdatedAt"`
+			ShippingAddress *model.ShippingAddress `json:"ShippingAddress"`
+		} `json:"Order"`
 		OrderItems []struct {
-			ProductID int64 `json:"ProductID"`
-			Quantity  int   `json:"Quantity"`
+			ProductID int64  `json:"ProductID"`
+			VariantID int64  `json:"VariantID"`
+			SKU       string `json:"SKU"`
+			Quantity  int    `json:"Quantity"`
 		} `json:"OrderItems"`
 	}
 
@@ -254,21 +208,18 @@ func (r *queryResolver) Orders(ctx context.Context) ([]*model.Order, error) {
 	var orders []*model.Order
 	for _, apiOrder := range ordersWithItems {
 		order := &model.Order{
-			OrderID:    strconv.FormatInt(apiOrder.OrderID, 10), // Convert int64 to string
-			UserID:     strconv.FormatInt(apiOrder.UserID, 10),  // Convert int64 to string
-			TotalPrice: apiOrder.TotalPrice,
-			Status:     apiOrder.Status,
-			PlacedAt:   apiOrder.PlacedAt,
+			OrderID:    strconv.FormatInt(apiOrder.Order.OrderID, 10), // Convert int64 to string
+			UserID:     strconv.FormatInt(apiOrder.Order.UserID, 10),  // Convert int64 to string
+			TotalPrice: apiOrder.Order.TotalPrice,
+			Status:     apiOrder.Order.Status,
+			PlacedAt:   apiOrder.Order.PlacedAt,
 			Items:      []*model.OrderItem{}, // Initialize the items slice
+			ShippingAddress: shippingAddress(apiOrder.Order.ShippingAddress),
 		}
 
 		// Map order items
 		for _, apiItem := range apiOrder.OrderItems {
-			gqlItem := &model.OrderItem{
-				ProductID: strconv.FormatInt(apiItem.ProductID, 10), // Convert int64 to string
-				Quantity:  apiItem.Quantity,
-			}
-			order.Items = append(order.Items, gqlItem)
+			order.Items = append(order.Items, orderItem(apiItem.ProductID, apiItem.VariantID, apiItem.SKU, apiItem.Quantity))
 		}
 
 		orders = append(orders, order)
@@ -278,12 +229,21 @@ func (r *queryResolver) Orders(ctx context.Context) ([]*model.Order, error) {
 }
 
 func (r *queryResolver) Order(ctx context.Context, id string) (*model.Order, error) {
+	// The Order Service only returns other users' orders for order:read
+	_, err := r.verifyClaims(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+
 	// Call the external orderservice API
-	resp, err := http.Get(fmt.Sprintf("http://orderservice:8080/orders/%s", id))
+	resp, err := serviceRequest(ctx, http.MethodGet, fmt.Sprintf("http://orderservice:8080/orders/%s", url.PathEscape(id)), nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch order: %v", err)
 	}
 	defer resp.Body.Close()
+	if err := serviceError(resp); err != nil {
+		return nil, fmt.Errorf("failed to fetch order: %v", err)
+	}
 
 	// Structure to hold the API response
 	var orderWithItems struct {
@@ -295,9 +255,12 @@ func (r *queryResolver) Order(ctx context.Context, id string) (*model.Order, err
 		UpdatedAt  string  `json:"UpdatedAt"`
 		OrderItems []struct {
 			ProductID    int64   `json:"ProductID"`
+			VariantID    int64   `json:"VariantID"`
+			SKU          string  `json:"SKU"`
 			Quantity     int     `json:"Quantity"`
 			PriceAtOrder float64 `json:"PriceAtOrder"`
 		} `json:"OrderItems"`
+		ShippingAddress *model.ShippingAddress `json:"ShippingAddress"`
 	}
 
 	// Decode the API response
@@ -314,29 +277,214 @@ func (r *queryResolver) Order(ctx context.Context, id string) (*model.Order, err
 		Status:     orderWithItems.Status,
 		PlacedAt:   orderWithItems.PlacedAt,
 		Items:      []*model.OrderItem{}, // Initialize the slice
+		ShippingAddress: shippingAddress(orderWithItems.ShippingAddress),
 	}
 
 	// Map the OrderItems to GraphQL model
 	for _, item := range orderWithItems.OrderItems {
-		gqlItem := &model.OrderItem{
-			ProductID: strconv.FormatInt(item.ProductID, 10), // Convert int64 to string
-			Quantity:  item.Quantity,
-		}
-		order.Items = append(order.Items, gqlItem)
+		order.Items = append(order.Items, orderItem(item.ProductID, item.VariantID, item.SKU, item.Quantity))
 	}
 
 	return order, nil
 }
 
+// Addresses is the resolver for the addresses query.
+func (r *queryResolver) Addresses(ctx context.Context) ([]*model.Address, error) {
+	if _, err := r.verifyClaims(ctx, ""); err != nil {
+		return nil, err
+	}
+
+	resp, err := serviceRequest(ctx, http.MethodGet, "http://userservice:8080/addresses", nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch addresses: %v", err)
+	}
+	defer resp.Body.Close()
+	if err := serviceError(resp); err != nil {
+		return nil, fmt.Errorf("failed to fetch addresses: %v", err)
+	}
+
+	addresses := []*model.Address{}
+	if err := json.NewDecoder(resp.Body).Decode(&addresses); err != nil {
+		return nil, fmt.Errorf("failed to decode addresses: %v", err)
+	}
+	return addresses, nil
+}
+
+// Sessions is the resolver for the sessions query.
+func (r *queryResolver) Sessions(ctx context.Context) ([]*model.Session, error) {
+	if _, err := r.verifyClaims(ctx, ""); err != nil {
+		return nil, err
+	}
+
+	sessions := []*model.Session{}
+	if err := sendJSON(ctx, http.MethodGet, "http://userservice:8080/sessions", nil, &sessions); err != nil {
+		return nil, fmt.Errorf("failed to fetch sessions: %v", err)
+	}
+	return sessions, nil
+}
+
+// AdminUsers is the resolver for the adminUsers query.
+func (r *queryResolver) AdminUsers(ctx context.Context, filter *model.AdminUserFilter) (*model.AdminUserPage, error) {
+	if _, err := r.verifyClaims(ctx, "user:admin"); err != nil {
+		return nil, err
+	}
+
+	params := url.Values{}
+	if filter != nil {
+		for name, value := range map[string]*string{"email": filter.Email, "name": filter.Name, "role": filter.Role, "status": filter.Status} {
+			if value != nil {
+				params.Set(name, *value)
+			}
+		}
+		if filter.Verified != nil {
+			params.Set("verified", strconv.FormatBool(*filter.Verified))
+		}
+		if filter.Limit != nil {
+			params.Set("limit", strconv.Itoa(*filter.Limit))
+		}
+		if filter.Offset != nil {
+			params.Set("offset", strconv.Itoa(*filter.Offset))
+		}
+	}
+
+	var page model.AdminUserPage
+	if err := sendJSON(ctx, http.MethodGet, "http://userservice:8080/admin/users?"+params.Encode(), nil, &page); err != nil {
+		return nil, fmt.Errorf("failed to list users: %v", err)
+	}
+	return &page, nil
+}
+
+func (r *queryResolver) AuditLog(ctx context.Context, filter *model.AuditLogFilter) (*model.AuditLogPage, error) {
+	if _, err := r.verifyClaims(ctx, "audit:read"); err != nil {
+		return nil, err
+	}
+
+	params := url.Values{}
+	if filter != nil {
+		for name, value := range map[string]*string{
+			"user_id": filter.UserID, "actor_id": filter.ActorID, "target_user_id": filter.TargetUserID,
+			"action": filter.Action, "outcome": filter.Outcome, "ip": filter.IP, "since": filter.Since, "until": filter.Until,
+		} {
+			if value != nil {
+				params.Set(name, *value)
+			}
+		}
+		if filter.Limit != nil {
+			params.Set("limit", strconv.Itoa(*filter.Limit))
+		}
+		if filter.Offset != nil {
+			params.Set("offset", strconv.Itoa(*filter.Offset))
+		}
+	}
+
+	var page model.AuditLogPage
+	if err := sendJSON(ctx, http.MethodGet, "http://userservice:8080/admin/audit-log?"+params.Encode(), nil, &page); err != nil {
+		return nil, fmt.Errorf("failed to list audit log: %v", err)
+	}
+	return &page, nil
+}
+
+func (r *queryResolver) SearchProducts(ctx context.Context, input *model.ProductSearchInput) (*model.ProductSearchResult, error) {
+	if _, err := r.verifyClaims(ctx, "product:read"); err != nil {
+		return nil, err
+	}
+
+	params := url.Values{}
+	if input != nil {
+		if input.Query != nil {
+			params.Set("q", *input.Query)
+		}
+		if input.MinPrice != nil {
+			params.Set("min_price", strconv.FormatFloat(*input.MinPrice, 'f', -1, 64))
+		}
+		if input.MaxPrice != nil {
+			params.Set("max_price", strconv.FormatFloat(*input.MaxPrice, 'f', -1, 64))
+		}
+		if input.InStock != nil {
+			params.Set("in_stock", strconv.FormatBool(*input.InStock))
+		}
+		if input.Sort != nil {
+			params.Set("sort", *input.Sort)
+		}
+		if input.Limit != nil {
+			params.Set("limit", strconv.Itoa(*input.Limit))
+		}
+		if input.Offset != nil {
+			params.Set("offset", strconv.Itoa(*input.Offset))
+		}
+	}
+
+	var result struct {
+		Products []restProduct       `json:"products"`
+		Total    int                 `json:"total"`
+		Facets   model.ProductFacets `json:"facets"`
+	}
+	if err := sendJSON(ctx, http.MethodGet, "http://productservice:8080/products/search?"+params.Encode(), nil, &result); err != nil {
+		return nil, fmt.Errorf("failed to search products: %v", err)
+	}
+
+	products := make([]*model.Product, len(result.Products))
+	for i, product := range result.Products {
+		products[i] = product.model()
+	}
+	return &model.ProductSearchResult{Products: products, Total: result.Total, Facets: &result.Facets}, nil
+}
+
+// Categories is the resolver for the categories field.
+func (r *queryResolver) Categories(ctx context.Context) ([]*model.Category, error) {
+	if _, err := r.verifyClaims(ctx, "product:read"); err != nil {
+		return nil, err
+	}
+
+	var tree []restCategory
+	if err := sendJSON(ctx, http.MethodGet, "http://productservice:8080/categories", nil, &tree); err != nil {
+		return nil, fmt.Errorf("failed to list categories: %v", err)
+	}
+	return categories(tree), nil
+}
+
+// CategoryProducts is the resolver for the categoryProducts field.
+func (r *queryResolver) CategoryProducts(ctx context.Context, slug string, includeDescendants *bool, limit *int, offset *int) (*model.CategoryProductsPage, error) {
+	if _, err := r.verifyClaims(ctx, "product:read"); err != nil {
+		return nil, err
+	}
+
+	params := url.Values{}
+	if includeDescendants != nil {
+		params.Set("include_descendants", strconv.FormatBool(*includeDescendants))
+	}
+	if limit != nil {
+		params.Set("limit", strconv.Itoa(*limit))
+	}
+	if offset != nil {
+		params.Set("offset", strconv.Itoa(*offset))
+	}
+
+	var page struct {
+		Category restCategory  `json:"category"`
+		Products []restProduct `json:"products"`
+		Total    int           `json:"total"`
+	}
+	endpoint := fmt.Sprintf("http://productservice:8080/categories/%s/products?%s", url.PathEscape(slug), params.Encode())
+	if err := sendJSON(ctx, http.MethodGet, endpoint, nil, &page); err != nil {
+		return nil, fmt.Errorf("failed to list category products: %v", err)
+	}
+
+	products := make([]*model.Product, len(page.Products))
+	for i, product := range page.Products {
+		products[i] = product.model()
+	}
+	return &model.CategoryProductsPage{Category: page.Category.model(), Products: products, Total: page.Total}, nil
+}
+
 // Mutation resolvers
 
 func (r *mutationResolver) RegisterUser(ctx context.Context, input model.RegisterInput) (*model.User, error) {
-	// Marshal the input (name, phone_no, email, password, role) into JSON
+	// Marshal the input (name, phone_no, email, password) into JSON; new users always get the default role
 	reqBody, err := json.Marshal(input)
 	if err != nil {
 		return nil, fmt.Errorf("could not marshal input: %v", err)
 	}
-	fmt.Println(input.Role)
 	// Send the POST request to the user service for registering a new user
 	resp, err := http.Post("http://userservice:8080/create-user", "application/json", bytes.NewBuffer(reqBody))
 	if err != nil {
@@ -351,7 +499,6 @@ func (r *mutationResolver) RegisterUser(ctx context.Context, input model.Registe
 		Email        string `json:"Email"`
 		PhoneNo      string `json:"PhoneNo"`
 		PasswordHash string `json:"PasswordHash"`
-		Role         string `json:"Role"`
 		CreatedAt    string `json:"CreatedAt"`
 		UpdatedAt    string `json:"UpdatedAt"`
 	}
@@ -374,52 +521,48 @@ func (r *mutationResolver) RegisterUser(ctx context.Context, input model.Registe
 }
 
 func (r *mutationResolver) CreateProduct(ctx context.Context, input model.ProductInput) (*model.Product, error) {
-	_, err := verifyClaims(ctx, "admin")
+	_, err := r.verifyClaims(ctx, "product:write")
 	if err != nil {
 		return nil, err
 	}
 
-	reqBody, err := json.Marshal(input)
+	categoryIDs, err := parseIDs(input.CategoryIDs)
+	if err != nil {
+		return nil, fmt.Errorf("invalid category ID")
+	}
+	productVariants := make([]variantRequest, len(input.Variants))
+	for i, v := range input.Variants {
+		productVariants[i] = newVariantRequest(v)
+	}
+	reqBody, err := json.Marshal(struct {
+		model.ProductInput
+		CategoryIDs []int64          `json:"category_ids,omitempty"`
+		Variants    []variantRequest `json:"variants,omitempty"`
+	}{input, categoryIDs, productVariants})
 	if err != nil {
 		return nil, err
 	}
 
-	// Send the request to create the product
-	resp, err := http.Post("http://productservice:8080/products", "application/json", bytes.NewBuffer(reqBody))
+	// The Product Service records the token's user as the creator
+	resp, err := serviceRequest(ctx, http.MethodPost, "http://productservice:8080/products", bytes.NewBuffer(reqBody))
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
 
-	var product struct {
-		ProductID      int64     `json:"productID"`
-		Name           string    `json:"name"`
-		Description    string    `json:"description"`
-		Price          float64   `json:"price"`
-		InventoryCount int       `json:"inventoryCount"`
-		CreatedAt      time.Time `json:"createdAt"`
-		UpdatedAt      time.Time `json:"updatedAt"`
-	}
+	var product restProduct
 	err = json.NewDecoder(resp.Body).Decode(&product)
 	if err != nil {
 		return nil, err
 	}
 
-	gqlProduct := &model.Product{
-		ProductID:      strconv.FormatInt(product.ProductID, 10),
-		Name:           product.Name,
-		Description:    product.Description,
-		Price:          product.Price,
-		InventoryCount: product.InventoryCount,
-		CreatedAt:      product.CreatedAt.Format(time.RFC3339),
-		UpdatedAt:      product.UpdatedAt.Format(time.RFC3339),
-	}
+	gqlProduct := product.model()
 	return gqlProduct, nil
 }
 
 // PlaceOrder is the resolver for the placeOrder mutation.
 func (r *mutationResolver) PlaceOrder(ctx context.Context, input model.OrderInput) (*model.Order, error) {
-	claims, err := verifyClaims(ctx, "user")
+	claims, err := r.verifyClaims(ctx, "order:write")
 	if err != nil {
 		return nil, fmt.Errorf("failed to get claims: %v", err)
 	}
@@ -431,12 +574,15 @@ func (r *mutationResolver) PlaceOrder(ctx context.Context, input model.OrderInpu
 		return nil, fmt.Errorf("failed to marshal request body: %v", err)
 	}
 
-	resp, err := http.Post("http://orderservice:8080/orders", "application/json", bytes.NewBuffer(reqBody))
+	resp, err := serviceRequest(ctx, http.MethodPost, "http://orderservice:8080/orders", bytes.NewBuffer(reqBody))
 	if err != nil {
 		return nil, fmt.Errorf("failed to send request to Order Service: %v", err)
 	}
 	defer resp.Body.Close()
 	fmt.Println(resp.StatusCode)
+	if err := serviceError(resp); err != nil {
+		return nil, fmt.Errorf("failed to place order: %v", err)
+	}
 	var order struct {
 		OrderID    int64              `json:"OrderID"`
 		UserID     int64 `json:"UserID"`
@@ -444,6 +590,7 @@ func (r *mutationResolver) PlaceOrder(ctx context.Context, input model.OrderInpu
 		TotalPrice float64            `json:"TotalPrice"`
 		Status     string             `json:"Status"`
 		PlacedAt   string             `json:"PlacedAt"` // Should be a string representing a timestamp
+		ShippingAddress *model.ShippingAddress `json:"ShippingAddress"`
 	}
 	err = json.NewDecoder(resp.Body).Decode(&order)
 	if err != nil {
@@ -455,10 +602,246 @@ func (r *mutationResolver) PlaceOrder(ctx context.Context, input model.OrderInpu
 		Items : order.Items,
 		TotalPrice: order.TotalPrice,
 		PlacedAt: order.PlacedAt,
+		ShippingAddress: shippingAddress(order.ShippingAddress),
 	}
 	return &gqlOrder, nil
 }
 
+// CreateAddress is the resolver for the createAddress field.
+func (r *mutationResolver) CreateAddress(ctx context.Context, input model.AddressInput) (*model.Address, error) {
+	return r.sendAddress(ctx, http.MethodPost, "http://userservice:8080/addresses", input)
+}
+
+// UpdateAddress is the resolver for the updateAddress field.
+func (r *mutationResolver) UpdateAddress(ctx context.Context, id string, input model.AddressInput) (*model.Address, error) {
+	addressID, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid address ID: %v", err)
+	}
+	return r.sendAddress(ctx, http.MethodPut, fmt.Sprintf("http://userservice:8080/addresses/%d", addressID), input)
+}
+
+// DeleteAddress is the resolver for the deleteAddress field.
+func (r *mutationResolver) DeleteAddress(ctx context.Context, id string) (bool, error) {
+	if _, err := r.verifyClaims(ctx, ""); err != nil {
+		return false, err
+	}
+	addressID, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return false, fmt.Errorf("invalid address ID: %v", err)
+	}
+
+	resp, err := serviceRequest(ctx, http.MethodDelete, fmt.Sprintf("http://userservice:8080/addresses/%d", addressID), nil)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete address: %v", err)
+	}
+	defer resp.Body.Close()
+	if err := serviceError(resp); err != nil {
+		return false, fmt.Errorf("failed to delete address: %v", err)
+	}
+	return true, nil
+}
+
+// SetDefaultAddress is the resolver for the setDefaultAddress field.
+func (r *mutationResolver) SetDefaultAddress(ctx context.Context, id string) (*model.Address, error) {
+	addressID, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid address ID: %v", err)
+	}
+	return r.sendAddress(ctx, http.MethodPost, fmt.Sprintf("http://userservice:8080/addresses/%d/default", addressID), nil)
+}
+
+// RevokeSession is the resolver for the revokeSession field.
+func (r *mutationResolver) RevokeSession(ctx context.Context, id string) (bool, error) {
+	if _, err := r.verifyClaims(ctx, ""); err != nil {
+		return false, err
+	}
+
+	endpoint := "http://userservice:8080/sessions/" + url.PathEscape(id)
+	if err := sendJSON(ctx, http.MethodDelete, endpoint, nil, nil); err != nil {
+		return false, fmt.Errorf("failed to end session: %v", err)
+	}
+	return true, nil
+}
+
+// RevokeOtherSessions is the resolver for the revokeOtherSessions field.
+func (r *mutationResolver) RevokeOtherSessions(ctx context.Context) (int, error) {
+	if _, err := r.verifyClaims(ctx, ""); err != nil {
+		return 0, err
+	}
+
+	var result struct {
+		Revoked int `json:"revoked"`
+	}
+	if err := sendJSON(ctx, http.MethodPost, "http://userservice:8080/sessions/revoke-others", nil, &result); err != nil {
+		return 0, fmt.Errorf("failed to end sessions: %v", err)
+	}
+	return result.Revoked, nil
+}
+
+// DisableUser is the resolver for the disableUser field.
+func (r *mutationResolver) DisableUser(ctx context.Context, id string, reason *string) (*model.AdminUser, error) {
+	if _, err := r.verifyClaims(ctx, "user:admin"); err != nil {
+		return nil, err
+	}
+	endpoint, err := adminUserURL(id, "disable")
+	if err != nil {
+		return nil, err
+	}
+
+	input := map[string]string{}
+	if reason != nil {
+		input["reason"] = *reason
+	}
+	var user model.AdminUser
+	if err := sendJSON(ctx, http.MethodPost, endpoint, input, &user); err != nil {
+		return nil, fmt.Errorf("failed to disable user: %v", err)
+	}
+	return &user, nil
+}
+
+// EnableUser is the resolver for the enableUser field.
+func (r *mutationResolver) EnableUser(ctx context.Context, id string) (*model.AdminUser, error) {
+	if _, err := r.verifyClaims(ctx, "user:admin"); err != nil {
+		return nil, err
+	}
+	endpoint, err := adminUserURL(id, "enable")
+	if err != nil {
+		return nil, err
+	}
+
+	var user model.AdminUser
+	if err := sendJSON(ctx, http.MethodPost, endpoint, nil, &user); err != nil {
+		return nil, fmt.Errorf("failed to enable user: %v", err)
+	}
+	return &user, nil
+}
+
+// SetUserRoles is the resolver for the setUserRoles field.
+func (r *mutationResolver) SetUserRoles(ctx context.Context, id string, roles []string) ([]string, error) {
+	if _, err := r.verifyClaims(ctx, "user:admin"); err != nil {
+		return nil, err
+	}
+	endpoint, err := adminUserURL(id, "roles")
+	if err != nil {
+		return nil, err
+	}
+
+	var result struct {
+		Roles []string `json:"roles"`
+	}
+	if err := sendJSON(ctx, http.MethodPut, endpoint, map[string][]string{"roles": roles}, &result); err != nil {
+		return nil, fmt.Errorf("failed to set roles: %v", err)
+	}
+	return result.Roles, nil
+}
+
+// ForcePasswordReset is the resolver for the forcePasswordReset field.
+func (r *mutationResolver) ForcePasswordReset(ctx context.Context, id string) (bool, error) {
+	if _, err := r.verifyClaims(ctx, "user:admin"); err != nil {
+		return false, err
+	}
+	endpoint, err := adminUserURL(id, "force-password-reset")
+	if err != nil {
+		return false, err
+	}
+
+	if err := sendJSON(ctx, http.MethodPost, endpoint, nil, nil); err != nil {
+		return false, fmt.Errorf("failed to force password reset: %v", err)
+	}
+	return true, nil
+}
+
+// ImpersonateUser is the resolver for the impersonateUser field.
+func (r *mutationResolver) ImpersonateUser(ctx context.Context, id string, reason string) (*model.Impersonation, error) {
+	if _, err := r.verifyClaims(ctx, "user:impersonate"); err != nil {
+		return nil, err
+	}
+	endpoint, err := adminUserURL(id, "impersonate")
+	if err != nil {
+		return nil, err
+	}
+
+	var impersonation model.Impersonation
+	if err := sendJSON(ctx, http.MethodPost, endpoint, map[string]string{"reason": reason}, &impersonation); err != nil {
+		return nil, fmt.Errorf("failed to impersonate user: %v", err)
+	}
+	return &impersonation, nil
+}
+
+// CreateCategory is the resolver for the createCategory field.
+func (r *mutationResolver) CreateCategory(ctx context.Context, input model.CategoryInput) (*model.Category, error) {
+	return r.saveCategory(ctx, http.MethodPost, "http://productservice:8080/categories", input)
+}
+
+// UpdateCategory is the resolver for the updateCategory field.
+func (r *mutationResolver) UpdateCategory(ctx context.Context, id string, input model.CategoryInput) (*model.Category, error) {
+	categoryID, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid category ID")
+	}
+	return r.saveCategory(ctx, http.MethodPut, fmt.Sprintf("http://productservice:8080/categories/%d", categoryID), input)
+}
+
+// DeleteCategory is the resolver for the deleteCategory field.
+func (r *mutationResolver) DeleteCategory(ctx context.Context, id string) (bool, error) {
+	if _, err := r.verifyClaims(ctx, "product:write"); err != nil {
+		return false, err
+	}
+
+	categoryID, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return false, fmt.Errorf("invalid category ID")
+	}
+	if err := sendJSON(ctx, http.MethodDelete, fmt.Sprintf("http://productservice:8080/categories/%d", categoryID), nil, nil); err != nil {
+		return false, fmt.Errorf("failed to delete category: %v", err)
+	}
+	return true, nil
+}
+
+// CreateProductVariant is the resolver for the createProductVariant field.
+func (r *mutationResolver) CreateProductVariant(ctx context.Context, productID string, input model.ProductVariantInput) (*model.ProductVariant, error) {
+	endpoint, err := variantURL(productID, "")
+	if err != nil {
+		return nil, err
+	}
+	return r.sendVariant(ctx, http.MethodPost, endpoint, newVariantRequest(&input))
+}
+
+// UpdateProductVariant is the resolver for the updateProductVariant field.
+func (r *mutationResolver) UpdateProductVariant(ctx context.Context, productID string, id string, input model.ProductVariantInput) (*model.ProductVariant, error) {
+	endpoint, err := variantURL(productID, id)
+	if err != nil {
+		return nil, err
+	}
+	return r.sendVariant(ctx, http.MethodPut, endpoint, newVariantRequest(&input))
+}
+
+// DeleteProductVariant is the resolver for the deleteProductVariant field.
+func (r *mutationResolver) DeleteProductVariant(ctx context.Context, productID string, id string) (bool, error) {
+	if _, err := r.verifyClaims(ctx, "product:write"); err != nil {
+		return false, err
+	}
+	endpoint, err := variantURL(productID, id)
+	if err != nil {
+		return false, err
+	}
+
+	if err := sendJSON(ctx, http.MethodDelete, endpoint, nil, nil); err != nil {
+		return false, fmt.Errorf("failed to delete variant: %v", err)
+	}
+	return true, nil
+}
+
+// SetVariantInventory is the resolver for the setVariantInventory field.
+func (r *mutationResolver) SetVariantInventory(ctx context.Context, productID string, id string, inventoryCount int) (*model.ProductVariant, error) {
+	endpoint, err := variantURL(productID, id)
+	if err != nil {
+		return nil, err
+	}
+	return r.sendVariant(ctx, http.MethodPut, endpoint+"/inventory", map[string]int{"inventory_count": inventoryCount})
+}
+
 // Mutation returns MutationResolver implementation.
 func (r *Resolver) Mutation() MutationResolver { return &mutationResolver{r} }
 
@@ -467,3 +850,4 @@ func (r *Resolver) Query() QueryResolver { return &queryResolver{r} }
 
 type mutationResolver struct{ *Resolver }
 type queryResolver struct{ *Resolver }
+
@@ -0,0 +1,142 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// errReservationLapsed is returned when confirming a reservation that expired
+// or was released.
+var errReservationLapsed = errors.New("stock reservation no longer held")
+
+// insufficientStockError is returned when the Product Service cannot hold an
+// item because not enough of it is available to sell. It carries the Product
+// Service's explanation.
+type insufficientStockError struct {
+	msg string
+}
+
+func (e *insufficientStockError) Error() string {
+	return e.msg
+}
+
+var productServiceClient = &http.Client{Timeout: 5 * time.Second}
+
+// reservationItem is an item of a stock reservation in the Product Service.
+type reservationItem struct {
+	ProductID int64 `json:"product_id"`
+	VariantID int64 `json:"variant_id,omitempty"`
+	Quantity  int   `json:"quantity"`
+}
+
+// reservation is the part of a Product Service reservation the service uses.
+type reservation struct {
+	ReservationID int64  `json:"reservation_id"`
+	Status        string `json:"status"`
+}
+
+// reserveStock holds the order's items in the Product Service under the order
+// ID and returns the reservation's ID. It returns an insufficientStockError if
+// an item is not available to sell.
+func (h *OrderHandler) reserveStock(ctx context.Context, orderID int64, items []*OrderItemData) (int64, error) {
+	req := struct {
+		ReferenceID string            `json:"reference_id"`
+		Items       []reservationItem `json:"items"`
+	}{ReferenceID: fmt.Sprint(orderID)}
+	for _, item := range items {
+		req.Items = append(req.Items, reservationItem{ProductID: item.ProductID, VariantID: item.VariantID, Quantity: item.Quantity})
+	}
+
+	var res reservation
+	status, msg, err := h.inventoryRequest(ctx, http.MethodPost, "/reservations", req, &res)
+	switch {
+	case err != nil:
+		return 0, err
+	case status == http.StatusConflict:
+		return 0, &insufficientStockError{msg: msg}
+	case status != http.StatusCreated:
+		return 0, fmt.Errorf("reserving stock: product service returned %d: %s", status, msg)
+	}
+	return res.ReservationID, nil
+}
+
+// confirmReservation has the Product Service take the reserved stock. A
+// reservation that was already confirmed, e.g. by an earlier attempt whose
+// response was lost, counts as confirmed; one that expired or was released
+// gives errReservationLapsed.
+func (h *OrderHandler) confirmReservation(ctx context.Context, reservationID int64) error {
+	path := fmt.Sprintf("/reservations/%d", reservationID)
+	status, msg, err := h.inventoryRequest(ctx, http.MethodPost, path+"/confirm", nil, nil)
+	if err != nil {
+		return err
+	}
+	if status == http.StatusOK {
+		return nil
+	}
+	if status != http.StatusConflict {
+		return fmt.Errorf("confirming reservation %d: product service returned %d: %s", reservationID, status, msg)
+	}
+
+	var res reservation
+	status, msg, err = h.inventoryRequest(ctx, http.MethodGet, path, nil, &res)
+	if err != nil {
+		return err
+	}
+	if status != http.StatusOK {
+		return fmt.Errorf("reading reservation %d: product service returned %d: %s", reservationID, status, msg)
+	}
+	if res.Status == "confirmed" {
+		return nil
+	}
+	return errReservationLapsed
+}
+
+// releaseReservation gives the reserved stock back, for orders that could not
+// be stored after their stock was reserved.
+func (h *OrderHandler) releaseReservation(ctx context.Context, reservationID int64) error {
+	status, msg, err := h.inventoryRequest(ctx, http.MethodPost, fmt.Sprintf("/reservations/%d/release", reservationID), nil, nil)
+	if err == nil && status != http.StatusOK {
+		err = fmt.Errorf("releasing reservation %d: product service returned %d: %s", reservationID, status, msg)
+	}
+	return err
+}
+
+// inventoryRequest calls the Product Service's reservation API with a service
+// token, sending body as JSON if it is not nil. On success the response is
+// decoded into out; otherwise its text is returned as the message.
+func (h *OrderHandler) inventoryRequest(ctx context.Context, method, path string, body, out interface{}) (int, string, error) {
+	var reader io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return 0, "", err
+		}
+		reader = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, h.ProductServiceURL+path, reader)
+	if err != nil {
+		return 0, "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if err := h.Inventory.Authorize(req); err != nil {
+		return 0, "", err
+	}
+
+	resp, err := productServiceClient.Do(req)
+	if err != nil {
+		return 0, "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 || out == nil {
+		text, err := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return resp.StatusCode, strings.TrimSpace(string(text)), err
+	}
+	return resp.StatusCode, "", json.NewDecoder(resp.Body).Decode(out)
+}
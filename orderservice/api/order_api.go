@@ -2,7 +2,9 @@ package api
 
 import (
 	"context"
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
@@ -12,42 +14,60 @@ import (
 	"github.com/gorilla/mux"
 	"github.com/hari134/pratilipi/orderservice/models"
 	"github.com/hari134/pratilipi/orderservice/producer"
+	"github.com/hari134/pratilipi/pkg/audit"
+	"github.com/hari134/pratilipi/pkg/auth"
 	"github.com/hari134/pratilipi/pkg/db"
 	"github.com/hari134/pratilipi/pkg/messaging"
+	"github.com/hari134/pratilipi/pkg/validation"
+	"github.com/uptrace/bun"
 )
 
+// errAlreadyPaid is returned when recording the payment of a paid order.
+var errAlreadyPaid = errors.New("order already paid")
+
 // OrderHandler handles order-related API requests.
 type OrderHandler struct {
-	DB       *db.DB
-	Producer *producer.ProducerManager
+	DB                *db.DB
+	Producer          *producer.ProducerManager
+	UserServiceURL    string                  // Base URL for looking up shipping addresses
+	ProductServiceURL string                  // Base URL for reserving stock
+	Inventory         *auth.ClientCredentials // Service client with the inventory:reserve scope; without one, stock is not reserved
 }
 
 // OrderRequest represents the payload for placing an order.
 type OrderRequest struct {
-	UserID string          `json:"user_id"`
-	Items  []*OrderItemData `json:"items"`
+	UserID    string           `json:"user_id" validate:"required" normalize:"trim"`
+	AddressID int64            `json:"address_id,omitempty" validate:"min=0"` // Address book entry to ship to; the user's default if omitted
+	Items     []*OrderItemData `json:"items" validate:"required,max=100"`
 }
 
 // OrderItemData represents an individual item in the order request.
+// VariantID is required for products with variants and must be left out otherwise.
 type OrderItemData struct {
-	ProductID    int64   `json:"product_id"`
-	Quantity     int     `json:"quantity"`
-	PriceAtOrder float64 `json:"price_at_order"`
+	ProductID    int64   `json:"product_id" validate:"gt=0"`
+	VariantID    int64   `json:"variant_id,omitempty" validate:"min=0"`
+	Quantity     int     `json:"quantity" validate:"min=1"`
+	PriceAtOrder float64 `json:"price_at_order" validate:"min=0"`
 }
 
 // PlaceOrderHandler handles the HTTP POST request to place an order.
 func (h *OrderHandler) PlaceOrderHandler(w http.ResponseWriter, r *http.Request) {
 	var orderReq OrderRequest
 
-	// Decode the incoming request body into OrderRequest struct
-	if err := json.NewDecoder(r.Body).Decode(&orderReq); err != nil {
-		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+	// Decode and validate the incoming request body into OrderRequest struct
+	if !validation.Decode(w, r, &orderReq) {
+		return
+	}
+	userId, err := strconv.ParseInt(orderReq.UserID, 10, 64)
+	if err != nil || userId <= 0 {
+		validation.WriteErrors(w, validation.Errors{"user_id": "must be a user ID"})
 		return
 	}
 	// Validate that the user exists in the users table
 	ctx := context.Background()
 
-	// Validate that products exist and check stock
+	// Validate that products and variants exist and check stock
+	skus := map[int64]string{} // SKUs of the ordered variants, copied to the order items
 	for _, item := range orderReq.Items {
 		var product models.Product
 		err := h.DB.NewSelect().Model(&product).Where("product_id = ?", item.ProductID).Scan(ctx)
@@ -56,6 +76,35 @@ func (h *OrderHandler) PlaceOrderHandler(w http.ResponseWriter, r *http.Request)
 			return
 		}
 
+		if item.VariantID != 0 {
+			var variant models.ProductVariant
+			err := h.DB.NewSelect().Model(&variant).
+				Where("variant_id = ?", item.VariantID).
+				Where("product_id = ?", item.ProductID).
+				Scan(ctx)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("Variant %d of product %d not found", item.VariantID, item.ProductID), http.StatusNotFound)
+				return
+			}
+			if variant.InventoryCount < item.Quantity {
+				http.Error(w, fmt.Sprintf("Insufficient stock for variant %s. Available: %d, Requested: %d",
+					variant.SKU, variant.InventoryCount, item.Quantity), http.StatusBadRequest)
+				return
+			}
+			skus[variant.VariantID] = variant.SKU
+			continue
+		}
+		hasVariants, err := h.DB.NewSelect().Model((*models.ProductVariant)(nil)).Where("product_id = ?", item.ProductID).Exists(ctx)
+		if err != nil {
+			log.Printf("Failed to look up variants: %v", err)
+			http.Error(w, "Failed to look up product variants", http.StatusInternalServerError)
+			return
+		}
+		if hasVariants {
+			http.Error(w, fmt.Sprintf("Product %d has variants; choose one with variant_id", item.ProductID), http.StatusBadRequest)
+			return
+		}
+
 		// Check if enough stock is available
 		if product.InventoryCount < item.Quantity {
 			fmt.Printf("Insufficient stock for product %d. Available: %d, Requested: %d",
@@ -65,69 +114,133 @@ func (h *OrderHandler) PlaceOrderHandler(w http.ResponseWriter, r *http.Request)
 			return
 		}
 	}
-	userId, err := strconv.ParseInt(orderReq.UserID, 10, 64)
+	// Users can only order for themselves; service tokens may order on a user's behalf
+	if claims, ok := auth.ClaimsFromContext(r.Context()); ok && !claims.IsService() && claims.UserID != userId {
+		http.Error(w, "You can only place orders for yourself", http.StatusForbidden)
+		return
+	}
+	// Copy the shipping address, so later edits of the address book do not change the order
+	shippingAddress, err := h.fetchShippingAddress(r, userId, orderReq.AddressID)
 	if err != nil {
-		panic(err)
+		if errors.Is(err, errAddressNotFound) {
+			if orderReq.AddressID == 0 {
+				http.Error(w, "No address_id given and the user has no default address", http.StatusBadRequest)
+			} else {
+				http.Error(w, fmt.Sprintf("Address %d not found", orderReq.AddressID), http.StatusBadRequest)
+			}
+			return
+		}
+		log.Printf("Failed to fetch shipping address: %v", err)
+		http.Error(w, "Failed to fetch shipping address", http.StatusBadGateway)
+		return
+	}
+	// Orders are created by the user placing them unless another actor is named
+	actorID := audit.ActorFromRequest(r)
+	if actorID == 0 {
+		actorID = userId
 	}
 	// Create the order in the orders table
 	order := &models.Order{
-		UserID:     userId,
-		TotalPrice: calculateTotalPrice(orderReq.Items), // Calculate total price from items
-		Status:     "placed",
-		PlacedAt:   time.Now(),
-		UpdatedAt:  time.Now(),
+		UserID:          userId,
+		TotalPrice:      calculateTotalPrice(orderReq.Items), // Calculate total price from items
+		Status:          "placed",
+		PlacedAt:        time.Now(),
+		UpdatedAt:       time.Now(),
+		ShippingAddress: shippingAddress,
+		Audit:           db.Audit{CreatedBy: actorID, UpdatedBy: actorID},
 	}
 
-	_, err = h.DB.NewInsert().Model(order).Exec(ctx)
-	if err != nil {
-		log.Printf("Failed to create order: %v", err)
-		http.Error(w, "Failed to create order", http.StatusInternalServerError)
-		return
-	}
-
-	// Create order items in the order_items table
+	// The order, its items and the stock reservation are stored together, so an
+	// order never exists without the stock it needs being held
 	var eventItems []messaging.OrderItem
 	var orderItemsArr []models.OrderItem
-	for _, item := range orderReq.Items {
-		orderItem := &models.OrderItem{
-			OrderID:      order.OrderID,
-			ProductID:    item.ProductID,
-			Quantity:     item.Quantity,
-			PriceAtOrder: item.PriceAtOrder,
+	err = h.DB.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		if _, err := tx.NewInsert().Model(order).Exec(ctx); err != nil {
+			return fmt.Errorf("creating order: %w", err)
 		}
 
-		_, err := h.DB.NewInsert().Model(orderItem).Exec(ctx)
-		if err != nil {
-			log.Printf("Failed to create order item: %v", err)
-			http.Error(w, "Failed to create order items", http.StatusInternalServerError)
-			return
+		// Create order items in the order_items table
+		for _, item := range orderReq.Items {
+			orderItem := &models.OrderItem{
+				OrderID:      order.OrderID,
+				ProductID:    item.ProductID,
+				VariantID:    item.VariantID,
+				SKU:          skus[item.VariantID],
+				Quantity:     item.Quantity,
+				PriceAtOrder: item.PriceAtOrder,
+			}
+			if _, err := tx.NewInsert().Model(orderItem).Exec(ctx); err != nil {
+				return fmt.Errorf("creating order item: %w", err)
+			}
+			orderItemsArr = append(orderItemsArr, *orderItem)
+			// Collect items for the event
+			eventItems = append(eventItems, messaging.OrderItem{
+				ProductID: item.ProductID,
+				VariantID: item.VariantID,
+				Quantity:  item.Quantity,
+			})
+			if h.Inventory != nil {
+				// The replica follows the Product Service once the reservation is confirmed
+				continue
+			}
+
+			_, err := tx.NewUpdate().
+				Model((*models.Product)(nil)).
+				Set("inventory_count = inventory_count - ?", item.Quantity).
+				Where("product_id = ?", item.ProductID).
+				Exec(ctx)
+			if err != nil {
+				return fmt.Errorf("updating product stock: %w", err)
+			}
+			if item.VariantID != 0 {
+				_, err = tx.NewUpdate().
+					Model((*models.ProductVariant)(nil)).
+					Set("inventory_count = inventory_count - ?", item.Quantity).
+					Where("variant_id = ?", item.VariantID).
+					Exec(ctx)
+				if err != nil {
+					return fmt.Errorf("updating variant stock: %w", err)
+				}
+			}
 		}
-		orderItemsArr = append(orderItemsArr,*orderItem)
-		// Collect items for the event
-		eventItems = append(eventItems, messaging.OrderItem{
-			ProductID: item.ProductID,
-			Quantity:  item.Quantity,
-		})
-
-		product := &models.Product{
-			ProductID: item.ProductID,
-		}
-		_, err = h.DB.NewUpdate().
-			Model(product).
-			Set("inventory_count = inventory_count - ?", item.Quantity).
-			Where("product_id = ?", item.ProductID).
-			Exec(ctx)
+
+		// Hold the stock in the Product Service until the order is paid for
+		if h.Inventory == nil {
+			return nil
+		}
+		reservationID, err := h.reserveStock(ctx, order.OrderID, orderReq.Items)
 		if err != nil {
-			log.Printf("Failed to update product stock: %v", err)
-			http.Error(w, "Failed to update product stock", http.StatusInternalServerError)
+			return err
+		}
+		order.ReservationID = reservationID
+		_, err = tx.NewUpdate().Model(order).Column("reservation_id").WherePK().Exec(ctx)
+		return err
+	})
+	if err != nil {
+		if order.ReservationID != 0 {
+			if err := h.releaseReservation(ctx, order.ReservationID); err != nil {
+				log.Printf("Failed to release stock reservation %d of unsaved order %d, it expires by itself: %v", order.ReservationID, order.OrderID, err)
+			}
+		}
+		var insufficient *insufficientStockError
+		if errors.As(err, &insufficient) {
+			http.Error(w, insufficient.Error(), http.StatusConflict)
 			return
 		}
+		log.Printf("Failed to place order: %v", err)
+		http.Error(w, "Failed to create order", http.StatusInternalServerError)
+		return
 	}
 
 	orderPlacedEvent := &messaging.OrderPlaced{
-		OrderID: order.OrderID,
-		UserID:  order.UserID,
-		Items:   eventItems,
+		OrderID:       order.OrderID,
+		UserID:        order.UserID,
+		Items:         eventItems,
+		ReservationID: order.ReservationID,
+	}
+	if shippingAddress.Country != "" {
+		// Lets the Product Service take stock from the nearest warehouse
+		orderPlacedEvent.ShipTo = &messaging.ShippingDestination{Country: shippingAddress.Country, PostalCode: shippingAddress.PostalCode}
 	}
 	err = h.Producer.EmitOrderPlacedEvent(orderPlacedEvent)
 	if err != nil {
@@ -142,13 +255,41 @@ func (h *OrderHandler) PlaceOrderHandler(w http.ResponseWriter, r *http.Request)
 	json.NewEncoder(w).Encode(order)
 }
 
-// GetAllOrdersHandler handles the HTTP GET request to retrieve all orders with their items.
+// orderOwner returns the user whose orders the caller may read, or 0 when the
+// caller holds "order:read" and may read every order. Users read their own
+// orders; service tokens without the permission are refused.
+func orderOwner(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	claims, ok := auth.ClaimsFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Authorization required", http.StatusUnauthorized)
+		return 0, false
+	}
+	if claims.HasPermission("order:read") {
+		return 0, true
+	}
+	if claims.IsService() {
+		http.Error(w, "Missing permission order:read", http.StatusForbidden)
+		return 0, false
+	}
+	return claims.UserID, true
+}
+
+// GetAllOrdersHandler handles the HTTP GET request to retrieve the caller's
+// orders with their items, or all orders for callers with "order:read".
 func (h *OrderHandler) GetAllOrdersHandler(w http.ResponseWriter, r *http.Request) {
+	ownerID, ok := orderOwner(w, r)
+	if !ok {
+		return
+	}
 	ctx := context.Background()
 
-	// Fetch all orders first
+	// Fetch the orders first
 	var orders []models.Order
-	err := h.DB.NewSelect().Model(&orders).Order("placed_at DESC").Scan(ctx)
+	query := h.DB.NewSelect().Model(&orders).Order("placed_at DESC")
+	if ownerID != 0 {
+		query = query.Where("user_id = ?", ownerID)
+	}
+	err := query.Scan(ctx)
 	if err != nil {
 		log.Printf("Failed to retrieve orders: %v", err)
 		http.Error(w, "Failed to retrieve orders", http.StatusInternalServerError)
@@ -179,16 +320,24 @@ func (h *OrderHandler) GetAllOrdersHandler(w http.ResponseWriter, r *http.Reques
 }
 
 // GetOrderByIDHandler handles the HTTP GET request to retrieve a specific order by its ID with its items.
+// Orders of other users are reported as not found unless the caller holds "order:read".
 func (h *OrderHandler) GetOrderByIDHandler(w http.ResponseWriter, r *http.Request) {
+	ownerID, ok := orderOwner(w, r)
+	if !ok {
+		return
+	}
 	ctx := context.Background()
 	vars := mux.Vars(r)
 	orderID := vars["order_id"]
 
 	var order models.Order
-	err := h.DB.NewSelect().
+	query := h.DB.NewSelect().
 		Model(&order).
-		Where("order_id = ?", orderID).
-		Scan(ctx)
+		Where("order_id = ?", orderID)
+	if ownerID != 0 {
+		query = query.Where("user_id = ?", ownerID)
+	}
+	err := query.Scan(ctx)
 	if err != nil {
 		log.Printf("Failed to retrieve order with ID %s: %v", orderID, err)
 		http.Error(w, "Order not found", http.StatusNotFound)
@@ -212,6 +361,62 @@ func (h *OrderHandler) GetOrderByIDHandler(w http.ResponseWriter, r *http.Reques
 	json.NewEncoder(w).Encode(order)
 }
 
+// PayOrderHandler records the payment of a placed order, e.g. for a payment
+// provider, and confirms its stock reservation so the Product Service takes
+// the stock. An order whose reservation lapsed cannot be paid for and has to
+// be placed again.
+func (h *OrderHandler) PayOrderHandler(w http.ResponseWriter, r *http.Request) {
+	orderID, err := strconv.ParseInt(mux.Vars(r)["order_id"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid order ID", http.StatusBadRequest)
+		return
+	}
+
+	// The order stays locked while the reservation is confirmed, so it is paid for only once
+	var order models.Order
+	ctx := context.Background()
+	err = h.DB.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		err := tx.NewSelect().Model(&order).Where("order_id = ?", orderID).For("UPDATE").Scan(ctx)
+		if err != nil {
+			return err
+		}
+		if !order.PaidAt.IsZero() {
+			return errAlreadyPaid
+		}
+		if order.ReservationID != 0 {
+			if err := h.confirmReservation(ctx, order.ReservationID); err != nil {
+				return err
+			}
+		}
+		order.Status = "paid"
+		order.PaidAt = time.Now()
+		order.UpdatedAt = order.PaidAt
+		if actorID := audit.ActorFromRequest(r); actorID != 0 {
+			order.UpdatedBy = actorID
+		}
+		_, err = tx.NewUpdate().Model(&order).Column("status", "paid_at", "updated_at", "updated_by").WherePK().Exec(ctx)
+		return err
+	})
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		http.Error(w, "Order not found", http.StatusNotFound)
+		return
+	case errors.Is(err, errAlreadyPaid):
+		http.Error(w, "The order is already paid", http.StatusConflict)
+		return
+	case errors.Is(err, errReservationLapsed):
+		http.Error(w, "The order's stock reservation has lapsed; place the order again", http.StatusConflict)
+		return
+	case err != nil:
+		log.Printf("Failed to record payment of order %d: %v", orderID, err)
+		http.Error(w, "Failed to record payment", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(order)
+}
+
 // calculateTotalPrice calculates the total price of the order based on the items.
 func calculateTotalPrice(items []*OrderItemData) float64 {
 	var totalPrice float64
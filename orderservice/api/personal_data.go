@@ -0,0 +1,70 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/hari134/pratilipi/orderservice/models"
+)
+
+// PersonalData is everything the Order Service holds about one user.
+type PersonalData struct {
+	User   *models.User   `json:"user"`
+	Orders []models.Order `json:"orders"`
+}
+
+// GetPersonalDataHandler returns the user's replica row and all of their orders,
+// including deleted ones, for the User Service's data export.
+func (h *OrderHandler) GetPersonalDataHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.ParseInt(mux.Vars(r)["user_id"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	ctx := context.Background()
+	data := PersonalData{Orders: []models.Order{}}
+
+	var user models.User
+	err = h.DB.NewSelect().Model(&user).Where("user_id = ?", userID).Scan(ctx)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		log.Printf("Failed to retrieve user %d: %v", userID, err)
+		http.Error(w, "Failed to retrieve user", http.StatusInternalServerError)
+		return
+	}
+	if err == nil {
+		data.User = &user
+	}
+
+	err = h.DB.NewSelect().
+		Model(&data.Orders).
+		WhereAllWithDeleted().
+		Where("user_id = ?", userID).
+		Order("placed_at").
+		Scan(ctx)
+	if err != nil {
+		log.Printf("Failed to retrieve orders of user %d: %v", userID, err)
+		http.Error(w, "Failed to retrieve orders", http.StatusInternalServerError)
+		return
+	}
+	for i := range data.Orders {
+		err := h.DB.NewSelect().
+			Model(&data.Orders[i].OrderItems).
+			Where("order_id = ?", data.Orders[i].OrderID).
+			Scan(ctx)
+		if err != nil {
+			log.Printf("Failed to retrieve items for order %d: %v", data.Orders[i].OrderID, err)
+			http.Error(w, "Failed to retrieve order items", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(data)
+}
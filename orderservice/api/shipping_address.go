@@ -0,0 +1,61 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/hari134/pratilipi/orderservice/models"
+)
+
+// errAddressNotFound is returned when the User Service has no such address for the user.
+var errAddressNotFound = errors.New("shipping address not found")
+
+var userServiceClient = &http.Client{Timeout: 5 * time.Second}
+
+// fetchShippingAddress copies an address from the user's address book, or their
+// default address if addressID is 0. The caller's token is forwarded, so the
+// User Service lets users read only their own addresses and services only with
+// the "address:read" permission.
+func (h *OrderHandler) fetchShippingAddress(r *http.Request, userID, addressID int64) (models.ShippingAddress, error) {
+	id := "default"
+	if addressID != 0 {
+		id = fmt.Sprint(addressID)
+	}
+	url := fmt.Sprintf("%s/users/%d/addresses/%s", h.UserServiceURL, userID, id)
+	req, err := http.NewRequestWithContext(r.Context(), http.MethodGet, url, nil)
+	if err != nil {
+		return models.ShippingAddress{}, err
+	}
+	req.Header.Set("Authorization", r.Header.Get("Authorization"))
+
+	resp, err := userServiceClient.Do(req)
+	if err != nil {
+		return models.ShippingAddress{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return models.ShippingAddress{}, errAddressNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		return models.ShippingAddress{}, fmt.Errorf("user service returned %s", resp.Status)
+	}
+
+	var address struct {
+		AddressID     int64  `json:"address_id"`
+		RecipientName string `json:"recipient_name"`
+		PhoneNo       string `json:"phone_no"`
+		Line1         string `json:"line1"`
+		Line2         string `json:"line2"`
+		City          string `json:"city"`
+		State         string `json:"state"`
+		PostalCode    string `json:"postal_code"`
+		Country       string `json:"country"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&address); err != nil {
+		return models.ShippingAddress{}, err
+	}
+	return models.ShippingAddress(address), nil
+}
@@ -1,10 +1,13 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"log"
 	"net/http"
 	"os"
 	"strconv"
+	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/hari134/pratilipi/orderservice/api"
@@ -12,6 +15,8 @@ import (
 	"github.com/hari134/pratilipi/pkg/messaging" // Import your message types
 	"github.com/hari134/pratilipi/orderservice/migrations"
 	"github.com/hari134/pratilipi/orderservice/producer"
+	"github.com/hari134/pratilipi/orderservice/replica"
+	"github.com/hari134/pratilipi/pkg/auth"
 	"github.com/hari134/pratilipi/pkg/db"
 	"github.com/hari134/pratilipi/pkg/kafka"
 )
@@ -43,38 +48,123 @@ func main() {
 
 	producerManager := producer.NewProducerManager(kafkaProducer)
 
+	// The User Service is asked for shipping addresses and, when reconciling, for users
+	userServiceURL := os.Getenv("USER_SERVICE_URL")
+	if userServiceURL == "" {
+		userServiceURL = "http://userservice:8080"
+	}
+
+	// Stock is reserved in the Product Service when an order is placed and taken when it is paid for
+	productServiceURL := os.Getenv("PRODUCT_SERVICE_URL")
+	if productServiceURL == "" {
+		productServiceURL = "http://productservice:8080"
+	}
+
 	orderAPIHandler := &api.OrderHandler{
-		DB:       dbInstance,
-		Producer: producerManager,
+		DB:                dbInstance,
+		Producer:          producerManager,
+		UserServiceURL:    userServiceURL,
+		ProductServiceURL: productServiceURL,
+		Inventory:         auth.ClientCredentialsFromEnv("inventory:reserve"),
 	}
 
 	migrations.RunMigrations(dbInstance)
 
+	// "orderservice reconcile-users [-repair]" compares the users replica with the User Service and exits
+	reconciler := &replica.Reconciler{
+		DB:          dbInstance,
+		UsersURL:    userServiceURL + "/users",
+		Credentials: auth.ClientCredentialsFromEnv("user:read"),
+	}
+	if len(os.Args) > 1 && os.Args[1] == "reconcile-users" {
+		reconcileUsers(reconciler, os.Args[2:])
+		return
+	}
+	// USER_RECONCILE_INTERVAL additionally reports drift periodically while serving
+	if interval, err := time.ParseDuration(os.Getenv("USER_RECONCILE_INTERVAL")); err == nil && interval > 0 && reconciler.Credentials != nil {
+		go func() {
+			for range time.Tick(interval) {
+				report, err := reconciler.Users(context.Background(), false)
+				if err != nil {
+					log.Printf("User reconciliation failed: %v", err)
+					continue
+				}
+				log.Printf("User reconciliation: %+v", *report)
+			}
+		}()
+	}
+
 	kafkaConsumerConfig := kafka.NewKafkaConfig().
 		SetBrokers("kafka:9092").
 		SetGroupID("orderservice-group").
-		SetGroupTopics("user-registered", "product-created","inventory-updated") // Multiple topics
+		SetGroupTopics("user-registered", "user-profile-updated", "user-erased", "product-created", "product-deleted", "product-restored", "product-variant-updated", "product-variant-deleted", "inventory-updated") // Multiple topics
 
 	kafkaConsumer := kafka.NewKafkaConsumer(kafkaConsumerConfig)
 
 	consumerManager := consumer.NewConsumerManager(kafkaConsumer, dbInstance)
 
 	kafkaConsumer.RegisterType("user-registered", &messaging.UserRegistered{})
+	kafkaConsumer.RegisterType("user-profile-updated", &messaging.UserProfileUpdated{})
+	kafkaConsumer.RegisterType("user-erased", &messaging.UserErased{})
 	kafkaConsumer.RegisterType("product-created", &messaging.ProductCreated{})
+	kafkaConsumer.RegisterType("product-deleted", &messaging.ProductDeleted{})
+	kafkaConsumer.RegisterType("product-restored", &messaging.ProductRestored{})
+	kafkaConsumer.RegisterType("product-variant-updated", &messaging.ProductVariantUpdated{})
+	kafkaConsumer.RegisterType("product-variant-deleted", &messaging.ProductVariantDeleted{})
+	kafkaConsumer.RegisterType("inventory-updated", &messaging.ProductInventoryUpdated{})
+
 
+	go consumerManager.StartConsumers("user-registered", "user-profile-updated", "user-erased", "product-created", "product-deleted", "product-restored", "product-variant-updated", "product-variant-deleted", "inventory-updated")
 
-	go consumerManager.StartConsumers("user-registered","product-created")
+	// Every route needs a user or service token; tokens are verified against the User Service's JWKS
+	// and its list of revoked tokens
+	jwksURL := os.Getenv("JWKS_URL")
+	if jwksURL == "" {
+		jwksURL = "http://userservice:8080/.well-known/jwks.json"
+	}
+	revocationsURL := os.Getenv("TOKEN_REVOCATIONS_URL")
+	if revocationsURL == "" {
+		revocationsURL = "http://userservice:8080/token-revocations"
+	}
+	verifier := auth.NewVerifier(jwksURL).CheckRevocations(revocationsURL)
+	require := func(permission string, h http.HandlerFunc) http.Handler {
+		return auth.Require(verifier, permission, h)
+	}
 
 	// Set up HTTP routes
 	r := mux.NewRouter()
-	r.HandleFunc("/orders", orderAPIHandler.PlaceOrderHandler).Methods("POST")
-	r.HandleFunc("/orders", orderAPIHandler.GetAllOrdersHandler).Methods("GET")            // Get all orders
-	r.HandleFunc("/orders/{order_id}", orderAPIHandler.GetOrderByIDHandler).Methods("GET") // Get order by ID
+	r.Handle("/orders", require("order:write", orderAPIHandler.PlaceOrderHandler)).Methods("POST")
+	// Users read their own orders; order:read reads everyone's
+	authenticate := auth.Authenticate(verifier)
+	r.Handle("/orders", authenticate(http.HandlerFunc(orderAPIHandler.GetAllOrdersHandler))).Methods("GET")            // Get orders
+	r.Handle("/orders/{order_id}", authenticate(http.HandlerFunc(orderAPIHandler.GetOrderByIDHandler))).Methods("GET") // Get order by ID
+	r.Handle("/orders/{order_id}/payment", require("order:pay", orderAPIHandler.PayOrderHandler)).Methods("POST")
+	r.Handle("/users/{user_id}/personal-data", require("user:privacy", orderAPIHandler.GetPersonalDataHandler)).Methods("GET")
 
 	// Start HTTP server
 	log.Fatal(http.ListenAndServe(":"+serverPort, r))
 }
 
+// reconcileUsers runs a single reconciliation of the users replica. It exits
+// with status 1 if missing or changed users remain, so it can be scheduled and alerted on.
+func reconcileUsers(reconciler *replica.Reconciler, args []string) {
+	flags := flag.NewFlagSet("reconcile-users", flag.ExitOnError)
+	repair := flags.Bool("repair", false, "rewrite missing and changed users from the User Service")
+	flags.Parse(args)
+
+	if reconciler.Credentials == nil {
+		log.Fatal("SERVICE_CLIENT_ID and SERVICE_CLIENT_SECRET must be set to reconcile users")
+	}
+	report, err := reconciler.Users(context.Background(), *repair)
+	if err != nil {
+		log.Fatalf("User reconciliation failed: %v", err)
+	}
+	log.Printf("User reconciliation: %+v", *report)
+	if report.Unresolved() > 0 {
+		os.Exit(1)
+	}
+}
+
 func stringToInt(s string, defaultVal int) int {
 	if i, err := strconv.Atoi(s); err == nil {
 		return i
@@ -6,6 +6,7 @@ import (
 	"strconv"
 
 	"github.com/hari134/pratilipi/orderservice/models"
+	"github.com/hari134/pratilipi/orderservice/replica"
 	"github.com/hari134/pratilipi/pkg/db"
 	"github.com/hari134/pratilipi/pkg/messaging"
 )
@@ -25,11 +26,18 @@ func NewConsumerManager(consumer messaging.Consumer, dbInstance *db.DB) *Consume
 }
 
 // StartConsumers subscribes to the topics and processes different types of events.
-func (cm *ConsumerManager) StartConsumers(userRegisteredTopic string, productCreatedTopic string) {
-	// Subscribe to both topics with a unified handler
+func (cm *ConsumerManager) StartConsumers(userRegisteredTopic, userProfileUpdatedTopic, userErasedTopic, productCreatedTopic, productDeletedTopic, productRestoredTopic, variantUpdatedTopic, variantDeletedTopic, inventoryUpdatedTopic string) {
+	// Subscribe to all topics with a unified handler
 	handlers := map[string]func(event interface{}) error{
-		userRegisteredTopic: cm.handleUserRegisteredEvent,
-		productCreatedTopic: cm.handleProductCreatedEvent,
+		userRegisteredTopic:     cm.handleUserRegisteredEvent,
+		userProfileUpdatedTopic: cm.handleUserProfileUpdatedEvent,
+		userErasedTopic:         cm.handleUserErasedEvent,
+		productCreatedTopic:     cm.handleProductCreatedEvent,
+		productDeletedTopic:     cm.handleProductDeletedEvent,
+		productRestoredTopic:    cm.handleProductRestoredEvent,
+		variantUpdatedTopic:     cm.handleProductVariantUpdatedEvent,
+		variantDeletedTopic:     cm.handleProductVariantDeletedEvent,
+		inventoryUpdatedTopic:   cm.handleInventoryUpdatedEvent,
 	}
 
 	err := cm.consumer.Subscribe(handlers)
@@ -59,7 +67,8 @@ func (cm *ConsumerManager) handleUserRegisteredEvent(event interface{}) error {
 		PhoneNo: userRegistered.PhoneNo,
 	}
 
-	_, err = cm.DB.NewInsert().Model(user).Exec(ctx)
+	// A redelivered event must not fail or overwrite a newer profile
+	_, err = cm.DB.NewInsert().Model(user).On("CONFLICT (user_id) DO NOTHING").Exec(ctx)
 	if err != nil {
 		log.Printf("Failed to insert user: %v", err)
 		return err
@@ -69,6 +78,69 @@ func (cm *ConsumerManager) handleUserRegisteredEvent(event interface{}) error {
 	return nil
 }
 
+// handleUserProfileUpdatedEvent handles events from the "User Profile Updated" topic.
+// Events carry the whole profile, so the replica row is created if it is missing.
+func (cm *ConsumerManager) handleUserProfileUpdatedEvent(event interface{}) error {
+	log.Printf("Processing UserProfileUpdated event: %+v", event)
+
+	profileUpdated, ok := event.(*messaging.UserProfileUpdated)
+	if !ok {
+		log.Printf("Unexpected event type for UserProfileUpdated event")
+		return nil
+	}
+
+	ctx := context.Background()
+	userIdInt, err := strconv.ParseInt(profileUpdated.UserID, 10, 64)
+	if err != nil {
+		return err
+	}
+	user := &models.User{
+		UserID:    userIdInt,
+		Email:     profileUpdated.Email,
+		PhoneNo:   profileUpdated.PhoneNo,
+		UpdatedAt: profileUpdated.UpdatedAt,
+	}
+
+	applied, err := replica.UpsertUser(ctx, cm.DB, user)
+	if err != nil {
+		log.Printf("Failed to update user %d: %v", userIdInt, err)
+		return err
+	}
+	if !applied {
+		log.Printf("Ignoring outdated profile of user %d", userIdInt)
+		return nil
+	}
+
+	log.Printf("User %d updated successfully", userIdInt)
+	return nil
+}
+
+// handleUserErasedEvent handles events from the "User Erased" topic by blanking
+// the replica's personal data. Orders are kept for accounting.
+func (cm *ConsumerManager) handleUserErasedEvent(event interface{}) error {
+	log.Printf("Processing UserErased event: %+v", event)
+
+	userErased, ok := event.(*messaging.UserErased)
+	if !ok {
+		log.Printf("Unexpected event type for UserErased event")
+		return nil
+	}
+
+	ctx := context.Background()
+	userIdInt, err := strconv.ParseInt(userErased.UserID, 10, 64)
+	if err != nil {
+		return err
+	}
+
+	if err := replica.EraseUser(ctx, cm.DB, userIdInt, userErased.ErasedAt); err != nil {
+		log.Printf("Failed to erase user %d: %v", userIdInt, err)
+		return err
+	}
+
+	log.Printf("User %d erased", userIdInt)
+	return nil
+}
+
 // handleProductCreatedEvent handles events from the "Product Created" topic.
 func (cm *ConsumerManager) handleProductCreatedEvent(event interface{}) error {
 	log.Printf("Processing ProductCreated event: %+v", event)
@@ -95,7 +167,193 @@ func (cm *ConsumerManager) handleProductCreatedEvent(event interface{}) error {
 		log.Printf("Failed to insert product: %v", err)
 		return err
 	}
+	for _, v := range productCreated.Variants {
+		variant, err := variantReplica(v)
+		if err != nil {
+			return err
+		}
+		if _, err := replica.UpsertVariant(ctx, cm.DB, variant); err != nil {
+			log.Printf("Failed to insert variant %s: %v", v.SKU, err)
+			return err
+		}
+	}
 
 	log.Printf("Product %s inserted successfully", productCreated.Name)
 	return nil
 }
+
+// handleProductDeletedEvent handles events from the "Product Deleted" topic by
+// soft-deleting the local replica, which makes the product unavailable for new orders.
+func (cm *ConsumerManager) handleProductDeletedEvent(event interface{}) error {
+	log.Printf("Processing ProductDeleted event: %+v", event)
+
+	productDeleted, ok := event.(*messaging.ProductDeleted)
+	if !ok {
+		log.Printf("Unexpected event type for ProductDeleted event")
+		return nil
+	}
+
+	ctx := context.Background()
+	productIdInt, err := strconv.ParseInt(productDeleted.ProductID, 10, 64)
+	if err != nil {
+		return err
+	}
+
+	_, err = cm.DB.NewDelete().
+		Model((*models.Product)(nil)).
+		Where("product_id = ?", productIdInt).
+		Exec(ctx)
+	if err != nil {
+		log.Printf("Failed to mark product %d unavailable: %v", productIdInt, err)
+		return err
+	}
+
+	log.Printf("Product %d marked unavailable", productIdInt)
+	return nil
+}
+
+// handleProductRestoredEvent handles events from the "Product Restored" topic.
+func (cm *ConsumerManager) handleProductRestoredEvent(event interface{}) error {
+	log.Printf("Processing ProductRestored event: %+v", event)
+
+	productRestored, ok := event.(*messaging.ProductRestored)
+	if !ok {
+		log.Printf("Unexpected event type for ProductRestored event")
+		return nil
+	}
+
+	ctx := context.Background()
+	productIdInt, err := strconv.ParseInt(productRestored.ProductID, 10, 64)
+	if err != nil {
+		return err
+	}
+
+	_, err = cm.DB.NewUpdate().
+		Model((*models.Product)(nil)).
+		Set("deleted_at = NULL").
+		WhereDeleted().
+		Where("product_id = ?", productIdInt).
+		Exec(ctx)
+	if err != nil {
+		log.Printf("Failed to restore product %d: %v", productIdInt, err)
+		return err
+	}
+
+	log.Printf("Product %d available again", productIdInt)
+	return nil
+}
+
+// handleProductVariantUpdatedEvent handles events from the "Product Variant Updated" topic.
+// Events carry the whole variant, so the replica row is created if it is missing.
+func (cm *ConsumerManager) handleProductVariantUpdatedEvent(event interface{}) error {
+	log.Printf("Processing ProductVariantUpdated event: %+v", event)
+
+	variantUpdated, ok := event.(*messaging.ProductVariantUpdated)
+	if !ok {
+		log.Printf("Unexpected event type for ProductVariantUpdated event")
+		return nil
+	}
+
+	ctx := context.Background()
+	variant, err := variantReplica(variantUpdated.ProductVariant)
+	if err != nil {
+		return err
+	}
+	variant.UpdatedAt = variantUpdated.UpdatedAt
+
+	applied, err := replica.UpsertVariant(ctx, cm.DB, variant)
+	if err != nil {
+		log.Printf("Failed to update variant %d: %v", variant.VariantID, err)
+		return err
+	}
+	if !applied {
+		log.Printf("Ignoring outdated or deleted variant %d", variant.VariantID)
+		return nil
+	}
+
+	log.Printf("Variant %d updated successfully", variant.VariantID)
+	return nil
+}
+
+// handleProductVariantDeletedEvent handles events from the "Product Variant Deleted"
+// topic by marking the replica deleted, which makes the variant unavailable for new orders.
+func (cm *ConsumerManager) handleProductVariantDeletedEvent(event interface{}) error {
+	log.Printf("Processing ProductVariantDeleted event: %+v", event)
+
+	variantDeleted, ok := event.(*messaging.ProductVariantDeleted)
+	if !ok {
+		log.Printf("Unexpected event type for ProductVariantDeleted event")
+		return nil
+	}
+
+	ctx := context.Background()
+	variantIdInt, err := strconv.ParseInt(variantDeleted.VariantID, 10, 64)
+	if err != nil {
+		return err
+	}
+
+	if err := replica.DeleteVariant(ctx, cm.DB, variantIdInt, variantDeleted.DeletedAt); err != nil {
+		log.Printf("Failed to mark variant %d unavailable: %v", variantIdInt, err)
+		return err
+	}
+
+	log.Printf("Variant %d marked unavailable", variantIdInt)
+	return nil
+}
+
+// handleInventoryUpdatedEvent handles events from the "Inventory Updated" topic by
+// copying the total inventory of the product or variant to the replica, so
+// stock changes of variants are seen as well as their other updates. The
+// per-warehouse counts are not needed to accept orders.
+func (cm *ConsumerManager) handleInventoryUpdatedEvent(event interface{}) error {
+	log.Printf("Processing ProductInventoryUpdated event: %+v", event)
+
+	inventoryUpdated, ok := event.(*messaging.ProductInventoryUpdated)
+	if !ok {
+		log.Printf("Unexpected event type for ProductInventoryUpdated event")
+		return nil
+	}
+
+	ctx := context.Background()
+	var err error
+	if inventoryUpdated.VariantID != "" {
+		var variantIdInt int64
+		if variantIdInt, err = strconv.ParseInt(inventoryUpdated.VariantID, 10, 64); err != nil {
+			return err
+		}
+		err = replica.SetVariantInventory(ctx, cm.DB, variantIdInt, inventoryUpdated.InventoryCount)
+	} else {
+		var productIdInt int64
+		if productIdInt, err = strconv.ParseInt(inventoryUpdated.ProductID, 10, 64); err != nil {
+			return err
+		}
+		err = replica.SetProductInventory(ctx, cm.DB, productIdInt, inventoryUpdated.InventoryCount)
+	}
+	if err != nil {
+		log.Printf("Failed to update inventory of product %s variant %s: %v", inventoryUpdated.ProductID, inventoryUpdated.VariantID, err)
+		return err
+	}
+
+	log.Printf("Inventory of product %s variant %s is now %d", inventoryUpdated.ProductID, inventoryUpdated.VariantID, inventoryUpdated.InventoryCount)
+	return nil
+}
+
+// variantReplica converts a variant carried by product events to its replica row.
+func variantReplica(v messaging.ProductVariant) (*models.ProductVariant, error) {
+	variantID, err := strconv.ParseInt(v.VariantID, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	productID, err := strconv.ParseInt(v.ProductID, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	return &models.ProductVariant{
+		VariantID:      variantID,
+		ProductID:      productID,
+		SKU:            v.SKU,
+		Attributes:     v.Attributes,
+		Price:          v.Price,
+		InventoryCount: v.InventoryCount,
+	}, nil
+}
@@ -0,0 +1,10 @@
+ALTER TABLE orders
+    ADD COLUMN deleted_at TIMESTAMP,   -- Set when the order is soft-deleted
+    ADD COLUMN created_by INT,         -- User who created the order
+    ADD COLUMN updated_by INT;         -- User who last updated the order
+
+
+--bun:split
+
+ALTER TABLE products
+    ADD COLUMN deleted_at TIMESTAMP;   -- Set when the product is deleted in the Product Service
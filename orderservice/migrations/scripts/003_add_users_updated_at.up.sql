@@ -0,0 +1,2 @@
+ALTER TABLE users
+    ADD COLUMN updated_at TIMESTAMP;   -- updated_at of the newest profile applied from the User Service
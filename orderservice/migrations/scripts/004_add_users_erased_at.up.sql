@@ -0,0 +1,2 @@
+ALTER TABLE users
+    ADD COLUMN erased_at TIMESTAMP;    -- Set when the user was erased; email and phone are blanked and no longer updated
@@ -0,0 +1,12 @@
+-- Copy of the address the order is shipped to, taken from the User Service when
+-- the order is placed, so later edits of the address book do not change it
+ALTER TABLE orders
+    ADD COLUMN shipping_address_id INT,              -- Address book entry the copy was taken from
+    ADD COLUMN shipping_recipient_name VARCHAR(100),
+    ADD COLUMN shipping_phone_no VARCHAR(20),
+    ADD COLUMN shipping_line1 VARCHAR(200),
+    ADD COLUMN shipping_line2 VARCHAR(200),
+    ADD COLUMN shipping_city VARCHAR(100),
+    ADD COLUMN shipping_state VARCHAR(100),
+    ADD COLUMN shipping_postal_code VARCHAR(20),
+    ADD COLUMN shipping_country CHAR(2);
@@ -0,0 +1,22 @@
+CREATE TABLE product_variants (
+    variant_id INT PRIMARY KEY,             -- Variant ID (received from the Product Service)
+    product_id INT NOT NULL,                -- Product the variant belongs to
+    sku VARCHAR(64) NOT NULL,               -- Stock keeping unit
+    attributes JSONB NOT NULL DEFAULT '{}', -- Attribute values, e.g. {"color": "red", "size": "m"}
+    price DECIMAL(10, 2) NOT NULL,          -- Variant price
+    inventory_count INT NOT NULL,           -- Inventory count for the variant
+    updated_at TIMESTAMP,                   -- updated_at of the newest variant applied from the Product Service
+    deleted_at TIMESTAMP                    -- Set when the variant is deleted in the Product Service
+);
+
+
+--bun:split
+
+CREATE INDEX product_variants_product_id_idx ON product_variants (product_id);
+
+
+--bun:split
+
+ALTER TABLE order_items
+    ADD COLUMN variant_id INT,              -- Ordered variant; NULL for products without variants
+    ADD COLUMN sku VARCHAR(64);             -- SKU of the variant at the time of the order
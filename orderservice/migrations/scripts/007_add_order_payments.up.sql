@@ -0,0 +1,5 @@
+-- Orders hold a stock reservation in the Product Service from placement until
+-- they are paid for, when the reservation is confirmed and the stock taken
+ALTER TABLE orders
+    ADD COLUMN reservation_id BIGINT,       -- Stock reservation in the Product Service; NULL if none was made
+    ADD COLUMN paid_at TIMESTAMP;           -- When the payment was recorded
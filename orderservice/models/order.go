@@ -2,6 +2,8 @@ package models
 
 import (
 	"time"
+
+	"github.com/hari134/pratilipi/pkg/db"
 	"github.com/uptrace/bun"
 )
 
@@ -13,12 +15,31 @@ type Order struct {
     OrderID    int64     `bun:"order_id,pk,autoincrement"`  // Primary key
     UserID     int64     `bun:"user_id,notnull"`            // Reference to the user who placed the order
     TotalPrice float64   `bun:"total_price,notnull"`        // Total price of the order
-    Status     string    `bun:"status,notnull"`             // Order status: placed, shipped, completed, etc.
+    Status     string    `bun:"status,notnull"`             // Order status: placed, paid, shipped, completed, etc.
     PlacedAt   time.Time `bun:"placed_at,default:current_timestamp"`  // Timestamp when the order was placed
     UpdatedAt  time.Time `bun:"updated_at,default:current_timestamp"` // Timestamp for the last update
+    ShippingAddress ShippingAddress `bun:"embed:shipping_"`          // Copy of the delivery address
+    ReservationID int64     `bun:"reservation_id,nullzero"`     // Stock reservation held until payment, if any
+    PaidAt     time.Time `bun:"paid_at,nullzero"`                  // When the payment was recorded
+    db.SoftDelete                                                    // deleted_at, hidden from default queries
+    db.Audit                                                         // created_by and updated_by
     OrderItems []OrderItem   `bun:"-"`
 }
 
+// ShippingAddress is the copy of an address book entry stored with an order.
+// It is taken when the order is placed and never follows later edits.
+type ShippingAddress struct {
+    AddressID     int64  `bun:"address_id,nullzero"`     // Address book entry in the User Service
+    RecipientName string `bun:"recipient_name,nullzero"` // Person to deliver to
+    PhoneNo       string `bun:"phone_no,nullzero"`       // Contact number for the courier
+    Line1         string `bun:"line1,nullzero"`          // Street and house number
+    Line2         string `bun:"line2,nullzero"`          // Apartment, floor, landmark
+    City          string `bun:"city,nullzero"`
+    State         string `bun:"state,nullzero"`
+    PostalCode    string `bun:"postal_code,nullzero"`
+    Country       string `bun:"country,nullzero"`        // ISO 3166-1 alpha-2 code
+}
+
 
 type OrderItem struct {
     bun.BaseModel `bun:"table:order_items"`     // Map struct to "order_items" table
@@ -26,6 +47,8 @@ type OrderItem struct {
     OrderItemID   int64   `bun:"order_item_id,pk,autoincrement"`      // Primary key
     OrderID       int64   `bun:"order_id,notnull"`                   // Reference to the order
     ProductID     int64   `bun:"product_id,notnull"`                 // Reference to the product
+    VariantID     int64   `bun:"variant_id,nullzero"`                // Ordered variant; unset for products without variants
+    SKU           string  `bun:"sku,nullzero"`                       // SKU of the variant at the time of the order
     Quantity      int     `bun:"quantity,notnull"`                   // Quantity of the product ordered
     PriceAtOrder  float64 `bun:"price_at_order,notnull"`             // Product price at the time of the order
 }
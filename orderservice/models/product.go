@@ -1,6 +1,7 @@
 package models
 
 import (
+    "github.com/hari134/pratilipi/pkg/db"
     "github.com/uptrace/bun"
 )
 
@@ -10,4 +11,5 @@ type Product struct {
     ProductID      int64     `bun:"product_id,pk"`                    // Product ID (received from the Product Service)
     Price          float64   `bun:"price,notnull"`                    // Product price
     InventoryCount int       `bun:"inventory_count,notnull"`          // Inventory count for the product
+    db.SoftDelete                                                     // Set when the product is deleted in the Product Service
 }
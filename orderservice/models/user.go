@@ -12,4 +12,6 @@ type User struct {
     Email     string    `bun:"email,notnull"`                        // Email of the user (received from the User Service)
     PhoneNo   string    `bun:"phone_no"`                             // Phone number of the user (optional, received from the User Service)
     CreatedAt time.Time `bun:"created_at,default:current_timestamp"` // Timestamp when the user was added
+    UpdatedAt time.Time `bun:"updated_at,nullzero"`                  // Profile version from the User Service; older updates are ignored
+    ErasedAt  time.Time `bun:"erased_at,nullzero"`                   // Set when the user was erased in the User Service
 }
@@ -0,0 +1,23 @@
+package models
+
+import (
+	"time"
+
+	"github.com/hari134/pratilipi/pkg/db"
+	"github.com/uptrace/bun"
+)
+
+// ProductVariant is the replica of a product variant, such as a size or color,
+// owned by the Product Service.
+type ProductVariant struct {
+	bun.BaseModel `bun:"table:product_variants"`
+
+	VariantID      int64             `bun:"variant_id,pk"`                 // Variant ID (received from the Product Service)
+	ProductID      int64             `bun:"product_id,notnull"`            // Product the variant belongs to
+	SKU            string            `bun:"sku,notnull"`                   // Stock keeping unit
+	Attributes     map[string]string `bun:"attributes,type:jsonb,notnull"` // Attribute values, e.g. {"color": "red", "size": "m"}
+	Price          float64           `bun:"price,notnull"`                 // Variant price
+	InventoryCount int               `bun:"inventory_count,notnull"`       // Inventory count for the variant
+	UpdatedAt      time.Time         `bun:"updated_at,nullzero"`           // Variant version from the Product Service; older updates are ignored
+	db.SoftDelete                    // Set when the variant is deleted in the Product Service
+}
@@ -0,0 +1,139 @@
+package replica
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/hari134/pratilipi/orderservice/models"
+	"github.com/hari134/pratilipi/pkg/auth"
+	"github.com/uptrace/bun"
+)
+
+// Report counts the differences a reconciliation found.
+type Report struct {
+	Checked  int // Users known to the User Service
+	Missing  int // Users without a replica row
+	Changed  int // Replica rows whose email or phone number differ
+	Unknown  int // Replica rows of users the User Service no longer lists, except erased ones
+	Repaired int // Missing or changed rows that were fixed
+}
+
+// Unresolved returns the number of missing or changed rows that were not repaired.
+// Unknown rows are not counted, as they are never repaired.
+func (r *Report) Unresolved() int {
+	return r.Missing + r.Changed - r.Repaired
+}
+
+// upstreamUser is a user as listed by the User Service's GET /users.
+type upstreamUser struct {
+	UserID    int64
+	Email     string
+	PhoneNo   string
+	UpdatedAt time.Time
+}
+
+// Reconciler compares the users replica with the User Service, which stays the
+// source of truth, to detect drift from lost or misapplied events.
+type Reconciler struct {
+	DB          *bun.DB
+	UsersURL    string                  // e.g. http://userservice:8080/users
+	Credentials *auth.ClientCredentials // Service client with the user:read scope
+	HTTPClient  *http.Client
+}
+
+// Users compares every user and logs each difference. With repair set, missing
+// and changed rows are rewritten from the User Service. Rows of users the User
+// Service no longer lists are only reported, since orders still refer to them.
+func (rc *Reconciler) Users(ctx context.Context, repair bool) (*Report, error) {
+	upstream, err := rc.fetchUsers(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var replicas []models.User
+	if err := rc.DB.NewSelect().Model(&replicas).Scan(ctx); err != nil {
+		return nil, err
+	}
+	byID := make(map[int64]models.User, len(replicas))
+	for _, u := range replicas {
+		byID[u.UserID] = u
+	}
+
+	report := &Report{Checked: len(upstream)}
+	for _, u := range upstream {
+		replica, ok := byID[u.UserID]
+		delete(byID, u.UserID)
+		switch {
+		case !ok:
+			report.Missing++
+			log.Printf("User %d is missing from the replica", u.UserID)
+		case replica.Email != u.Email || replica.PhoneNo != u.PhoneNo:
+			report.Changed++
+			log.Printf("User %d differs: replica has %q/%q, User Service has %q/%q",
+				u.UserID, replica.Email, replica.PhoneNo, u.Email, u.PhoneNo)
+		default:
+			continue
+		}
+
+		if !repair {
+			continue
+		}
+		applied, err := UpsertUser(ctx, rc.DB, &models.User{
+			UserID:    u.UserID,
+			Email:     u.Email,
+			PhoneNo:   u.PhoneNo,
+			UpdatedAt: u.UpdatedAt,
+		})
+		if err != nil {
+			return report, err
+		}
+		if applied {
+			report.Repaired++
+		} else {
+			log.Printf("User %d not repaired, the replica already has a newer profile", u.UserID)
+		}
+	}
+
+	for id, u := range byID {
+		if !u.ErasedAt.IsZero() {
+			continue
+		}
+		report.Unknown++
+		log.Printf("User %d is in the replica but not in the User Service", id)
+	}
+	return report, nil
+}
+
+// fetchUsers lists all users from the User Service with a service token.
+func (rc *Reconciler) fetchUsers(ctx context.Context) ([]upstreamUser, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rc.UsersURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := rc.Credentials.Authorize(req); err != nil {
+		return nil, fmt.Errorf("failed to get a service token: %w", err)
+	}
+
+	client := rc.HTTPClient
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("user service returned %s", resp.Status)
+	}
+
+	var users []upstreamUser
+	if err := json.NewDecoder(resp.Body).Decode(&users); err != nil {
+		return nil, err
+	}
+	return users, nil
+}
@@ -0,0 +1,65 @@
+// Package replica maintains the Order Service's copies of users owned by the User
+// Service and of product variants owned by the Product Service.
+package replica
+
+import (
+	"context"
+	"time"
+
+	"github.com/hari134/pratilipi/orderservice/models"
+	"github.com/uptrace/bun"
+)
+
+// UpsertUser inserts the user or updates the replica's email and phone number.
+// Updates are ordered by UpdatedAt: a profile older than the one already applied
+// is ignored, so redelivered or reordered events cannot bring back stale data.
+// Erased users are never updated again. It reports whether the row was written.
+func UpsertUser(ctx context.Context, db bun.IDB, user *models.User) (bool, error) {
+	res, err := db.NewInsert().
+		Model(user).
+		On("CONFLICT (user_id) DO UPDATE").
+		Set("email = EXCLUDED.email").
+		Set("phone_no = EXCLUDED.phone_no").
+		Set("updated_at = EXCLUDED.updated_at").
+		Where("?TableAlias.erased_at IS NULL").
+		Where("?TableAlias.updated_at IS NULL OR ?TableAlias.updated_at < EXCLUDED.updated_at").
+		Exec(ctx)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+// EraseUser blanks the user's email and phone number and marks the row erased.
+// A row is created if the user is not known yet, so a late UserRegistered event
+// cannot bring the data back. Orders of the user are kept, but their shipping
+// addresses lose the recipient, phone number and street; the city, state,
+// postal code and country stay for accounting. Erasing again is harmless.
+func EraseUser(ctx context.Context, db bun.IDB, userID int64, erasedAt time.Time) error {
+	_, err := db.NewInsert().
+		Model(&models.User{UserID: userID, ErasedAt: erasedAt, UpdatedAt: erasedAt}).
+		On("CONFLICT (user_id) DO UPDATE").
+		Set("email = ''").
+		Set("phone_no = NULL").
+		Set("erased_at = EXCLUDED.erased_at").
+		Set("updated_at = EXCLUDED.updated_at").
+		Exec(ctx)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.NewUpdate().
+		Model((*models.Order)(nil)).
+		Set("shipping_recipient_name = NULL").
+		Set("shipping_phone_no = NULL").
+		Set("shipping_line1 = NULL").
+		Set("shipping_line2 = NULL").
+		WhereAllWithDeleted().
+		Where("user_id = ?", userID).
+		Exec(ctx)
+	return err
+}
@@ -0,0 +1,73 @@
+package replica
+
+import (
+	"context"
+	"time"
+
+	"github.com/hari134/pratilipi/orderservice/models"
+	"github.com/uptrace/bun"
+)
+
+// UpsertVariant inserts the variant or updates the replica's copy. Like
+// UpsertUser, updates older than the one already applied are ignored, and
+// deleted variants are never updated again. It reports whether the row was written.
+func UpsertVariant(ctx context.Context, db bun.IDB, variant *models.ProductVariant) (bool, error) {
+	if variant.Attributes == nil {
+		variant.Attributes = map[string]string{}
+	}
+	res, err := db.NewInsert().
+		Model(variant).
+		On("CONFLICT (variant_id) DO UPDATE").
+		Set("sku = EXCLUDED.sku").
+		Set("attributes = EXCLUDED.attributes").
+		Set("price = EXCLUDED.price").
+		Set("inventory_count = EXCLUDED.inventory_count").
+		Set("updated_at = EXCLUDED.updated_at").
+		Where("?TableAlias.deleted_at IS NULL").
+		Where("?TableAlias.updated_at IS NULL OR ?TableAlias.updated_at < EXCLUDED.updated_at").
+		Exec(ctx)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+// DeleteVariant marks the variant deleted, which makes it unavailable for new
+// orders. Order items keep referring to it.
+func DeleteVariant(ctx context.Context, db bun.IDB, variantID int64, deletedAt time.Time) error {
+	_, err := db.NewUpdate().
+		Model((*models.ProductVariant)(nil)).
+		Set("deleted_at = ?", deletedAt).
+		Where("variant_id = ?", variantID).
+		Exec(ctx)
+	return err
+}
+
+// SetVariantInventory copies the variant's total inventory from an
+// inventory-updated event. Deleted variants are left alone.
+func SetVariantInventory(ctx context.Context, db bun.IDB, variantID int64, count int) error {
+	_, err := db.NewUpdate().
+		Model((*models.ProductVariant)(nil)).
+		Set("inventory_count = ?", count).
+		Where("variant_id = ?", variantID).
+		Where("deleted_at IS NULL").
+		Exec(ctx)
+	return err
+}
+
+// SetProductInventory copies the total inventory of a product without variants
+// from an inventory-updated event. Soft-deleted products are updated too, so
+// the count is right if the product is restored.
+func SetProductInventory(ctx context.Context, db bun.IDB, productID int64, count int) error {
+	_, err := db.NewUpdate().
+		Model((*models.Product)(nil)).
+		Set("inventory_count = ?", count).
+		WhereAllWithDeleted().
+		Where("product_id = ?", productID).
+		Exec(ctx)
+	return err
+}
@@ -0,0 +1,33 @@
+package audit
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/hari134/pratilipi/pkg/auth"
+)
+
+// ActorHeader carries the ID of the user on whose behalf a service token makes a request.
+const ActorHeader = "X-Actor-ID"
+
+// ActorFromRequest returns the acting user ID from the request, or 0 when it is unknown.
+// For user tokens this is the token's user, or the admin when they impersonate
+// the user. Only service tokens may name another user in ActorHeader, since the
+// header is otherwise trivial to forge.
+func ActorFromRequest(r *http.Request) int64 {
+	claims, ok := auth.ClaimsFromContext(r.Context())
+	if !ok {
+		return 0
+	}
+	if claims.IsImpersonation() {
+		return claims.Act.UserID
+	}
+	if !claims.IsService() {
+		return claims.UserID
+	}
+	actorID, err := strconv.ParseInt(r.Header.Get(ActorHeader), 10, 64)
+	if err != nil {
+		return 0
+	}
+	return actorID
+}
@@ -0,0 +1,79 @@
+package auth
+
+import (
+	"strings"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// TokenUseID is the token_use of OpenID Connect ID tokens. They tell a relying
+// party who signed in and are never accepted as access tokens.
+const TokenUseID = "id"
+
+// Claims are the claims carried by access tokens issued by the User Service.
+// User tokens carry a UserID and the permissions of the user's roles; service
+// tokens from the client credentials grant carry a ClientID and a Scope instead.
+type Claims struct {
+	UserID        int64    `json:"user_id"`
+	Email         string   `json:"email"`
+	EmailVerified bool     `json:"email_verified"`
+	Roles         []string `json:"roles"`
+	Permissions   []string `json:"permissions"`
+	AMR           []string `json:"amr,omitempty"`       // Authentication methods used at login, e.g. "pwd" and "otp"
+	SessionID     string   `json:"sid,omitempty"`       // Login session the token was issued in
+	ClientID      string   `json:"client_id,omitempty"` // API client a service token was issued to
+	Scope         string   `json:"scope,omitempty"`     // Space-separated permissions granted to a service token
+	Act           *Actor   `json:"act,omitempty"`       // Set when an admin acts as the user
+	TokenUse      string   `json:"token_use,omitempty"` // TokenUseID for ID tokens, empty for access tokens
+	jwt.RegisteredClaims
+}
+
+// Actor is the party actually behind a token issued to act as another user,
+// following the "act" claim of RFC 8693.
+type Actor struct {
+	UserID int64  `json:"user_id"`
+	Email  string `json:"email"`
+}
+
+// HasPermission reports whether the token grants the given permission, such as
+// "product:write", to a user through their roles or to an API client through its scope.
+func (c *Claims) HasPermission(permission string) bool {
+	for _, p := range c.Permissions {
+		if p == permission {
+			return true
+		}
+	}
+	for _, s := range strings.Fields(c.Scope) {
+		if s == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// IsAccessToken reports whether the token may be used as a bearer access token.
+// ID tokens may not; besides their token_use they name the relying party as
+// audience, which access tokens never do.
+func (c *Claims) IsAccessToken() bool {
+	return c.TokenUse != TokenUseID && len(c.Audience) == 0
+}
+
+// IsService reports whether the token was issued to an API client rather than a user.
+func (c *Claims) IsService() bool {
+	return c.ClientID != ""
+}
+
+// IsImpersonation reports whether an admin is acting as the token's user.
+func (c *Claims) IsImpersonation() bool {
+	return c.Act != nil
+}
+
+// HasRole reports whether the token's user holds the given role.
+func (c *Claims) HasRole(role string) bool {
+	for _, r := range c.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
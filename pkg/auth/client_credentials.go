@@ -0,0 +1,110 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// expiryLeeway renews a cached service token this long before it expires.
+const expiryLeeway = 30 * time.Second
+
+// ClientCredentials obtains service tokens from the User Service's /oauth/token
+// endpoint with the client_credentials grant and caches them until shortly
+// before they expire.
+type ClientCredentials struct {
+	TokenURL     string
+	ClientID     string
+	ClientSecret string
+	Scopes       []string // Optional; narrows the token to some of the client's scopes
+	HTTPClient   *http.Client
+
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+}
+
+// ClientCredentialsFromEnv reads SERVICE_CLIENT_ID, SERVICE_CLIENT_SECRET and
+// OAUTH_TOKEN_URL (default http://userservice:8080/oauth/token). It returns nil
+// if the service has no client configured.
+func ClientCredentialsFromEnv(scopes ...string) *ClientCredentials {
+	clientID := os.Getenv("SERVICE_CLIENT_ID")
+	if clientID == "" {
+		return nil
+	}
+	tokenURL := os.Getenv("OAUTH_TOKEN_URL")
+	if tokenURL == "" {
+		tokenURL = "http://userservice:8080/oauth/token"
+	}
+	return &ClientCredentials{
+		TokenURL:     tokenURL,
+		ClientID:     clientID,
+		ClientSecret: os.Getenv("SERVICE_CLIENT_SECRET"),
+		Scopes:       scopes,
+	}
+}
+
+// Token returns a valid access token, requesting a new one if the cached token
+// is missing or about to expire.
+func (c *ClientCredentials) Token(ctx context.Context) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.token != "" && time.Now().Add(expiryLeeway).Before(c.expires) {
+		return c.token, nil
+	}
+
+	form := url.Values{"grant_type": {"client_credentials"}}
+	if len(c.Scopes) > 0 {
+		form.Set("scope", strings.Join(c.Scopes, " "))
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(c.ClientID, c.ClientSecret)
+
+	client := c.HTTPClient
+	if client == nil {
+		client = &http.Client{Timeout: 5 * time.Second}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		AccessToken      string `json:"access_token"`
+		ExpiresIn        int64  `json:"expires_in"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("token endpoint returned %s", resp.Status)
+	}
+	if resp.StatusCode != http.StatusOK || body.AccessToken == "" {
+		return "", fmt.Errorf("token endpoint returned %s: %s %s", resp.Status, body.Error, body.ErrorDescription)
+	}
+
+	c.token = body.AccessToken
+	c.expires = time.Now().Add(time.Duration(body.ExpiresIn) * time.Second)
+	return c.token, nil
+}
+
+// Authorize sets the Authorization header of req to a service token.
+func (c *ClientCredentials) Authorize(req *http.Request) error {
+	token, err := c.Token(req.Context())
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	return nil
+}
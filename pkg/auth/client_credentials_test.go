@@ -0,0 +1,46 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientCredentialsToken(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		id, secret, ok := r.BasicAuth()
+		if !ok || id != "svc_orders" || secret != "s3cret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_client"})
+			return
+		}
+		if r.PostFormValue("grant_type") != "client_credentials" || r.PostFormValue("scope") != "user:read" {
+			t.Errorf("unexpected form %v", r.PostForm)
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"access_token": "token-1", "expires_in": 900})
+	}))
+	defer server.Close()
+
+	cc := &ClientCredentials{TokenURL: server.URL, ClientID: "svc_orders", ClientSecret: "s3cret", Scopes: []string{"user:read"}}
+	for i := 0; i < 2; i++ {
+		token, err := cc.Token(context.Background())
+		if err != nil {
+			t.Fatalf("Token failed: %v", err)
+		}
+		if token != "token-1" {
+			t.Fatalf("got token %q", token)
+		}
+	}
+	if requests != 1 {
+		t.Errorf("expected the token to be cached, got %d requests", requests)
+	}
+
+	bad := &ClientCredentials{TokenURL: server.URL, ClientID: "svc_orders", ClientSecret: "wrong"}
+	if _, err := bad.Token(context.Background()); err == nil {
+		t.Error("expected an error for wrong credentials")
+	}
+}
@@ -0,0 +1,84 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+)
+
+type contextKey struct{}
+
+// WithClaims returns a copy of ctx carrying the verified claims of the request.
+func WithClaims(ctx context.Context, claims *Claims) context.Context {
+	return context.WithValue(ctx, contextKey{}, claims)
+}
+
+// ClaimsFromContext returns the claims stored by an authentication middleware.
+func ClaimsFromContext(ctx context.Context) (*Claims, bool) {
+	claims, ok := ctx.Value(contextKey{}).(*Claims)
+	return claims, ok && claims != nil
+}
+
+// Authenticate returns middleware that verifies the request's bearer token with
+// the verifier and stores its claims with WithClaims. Requests without a valid
+// token are rejected, so mount it on every route that needs a user or service token.
+func Authenticate(v *Verifier) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token := r.Header.Get("Authorization")
+			if token == "" {
+				http.Error(w, "Authorization header missing", http.StatusUnauthorized)
+				return
+			}
+			claims, err := v.Parse(token)
+			if err != nil {
+				http.Error(w, "Invalid token", http.StatusUnauthorized)
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(WithClaims(r.Context(), claims)))
+		})
+	}
+}
+
+// Require is a shorthand for Authenticate followed by RequirePermission, for
+// routes that need a user or service token granting the permission.
+func Require(v *Verifier, permission string, next http.HandlerFunc) http.Handler {
+	return Authenticate(v)(RequirePermission(permission)(next))
+}
+
+// RequirePermission returns middleware that only lets requests through whose
+// claims grant the permission. It must run after a middleware that stored the
+// claims with WithClaims.
+func RequirePermission(permission string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, ok := ClaimsFromContext(r.Context())
+			if !ok {
+				http.Error(w, "Authorization required", http.StatusUnauthorized)
+				return
+			}
+			if !claims.HasPermission(permission) {
+				http.Error(w, "Missing permission "+permission, http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireUser returns middleware that rejects service tokens, for routes that
+// act on behalf of the calling user or record them as the actor. It must run
+// after a middleware that stored the claims with WithClaims.
+func RequireUser(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := ClaimsFromContext(r.Context())
+		if !ok {
+			http.Error(w, "Authorization required", http.StatusUnauthorized)
+			return
+		}
+		if claims.IsService() {
+			http.Error(w, "This endpoint needs a user token", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
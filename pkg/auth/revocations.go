@@ -0,0 +1,114 @@
+package auth
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// revocationRefreshInterval is how long a downloaded revocation list is used,
+// and so how long a revocation can take to reach services verifying locally.
+const revocationRefreshInterval = 10 * time.Second
+
+// Revocations lists the access tokens the User Service revoked before they
+// expired: single tokens, ended sessions, and users whose earlier tokens were
+// all revoked, e.g. on disabling, a forced password reset or erasure. Only
+// revocations of tokens that may not have expired yet are listed.
+type Revocations struct {
+	Tokens   []string         `json:"tokens"`   // Token IDs ("jti")
+	Sessions []string         `json:"sessions"` // Session IDs ("sid")
+	Users    []UserRevocation `json:"users"`
+}
+
+// UserRevocation rejects the user's tokens issued before NotBefore.
+type UserRevocation struct {
+	UserID    int64     `json:"user_id"`
+	NotBefore time.Time `json:"not_before"`
+}
+
+// revocationIndex is a Revocations document prepared for lookups.
+type revocationIndex struct {
+	tokens   map[string]bool
+	sessions map[string]bool
+	users    map[int64]time.Time
+}
+
+func newRevocationIndex(list Revocations) *revocationIndex {
+	idx := &revocationIndex{
+		tokens:   make(map[string]bool, len(list.Tokens)),
+		sessions: make(map[string]bool, len(list.Sessions)),
+		users:    make(map[int64]time.Time, len(list.Users)),
+	}
+	for _, jti := range list.Tokens {
+		idx.tokens[jti] = true
+	}
+	for _, sid := range list.Sessions {
+		idx.sessions[sid] = true
+	}
+	for _, u := range list.Users {
+		idx.users[u.UserID] = u.NotBefore
+	}
+	return idx
+}
+
+// revoked reports whether the list revokes the token with the claims.
+func (idx *revocationIndex) revoked(claims *Claims) bool {
+	if idx.tokens[claims.ID] {
+		return true
+	}
+	if claims.IsService() {
+		return false
+	}
+	if claims.SessionID != "" && idx.sessions[claims.SessionID] {
+		return true
+	}
+	notBefore, ok := idx.users[claims.UserID]
+	return ok && (claims.IssuedAt == nil || claims.IssuedAt.Time.Before(notBefore))
+}
+
+// revocationList keeps the latest revocations downloaded from the User Service.
+type revocationList struct {
+	url    string
+	client *http.Client
+
+	mu        sync.Mutex
+	index     *revocationIndex
+	fetchedAt time.Time
+}
+
+// current returns the revocations, downloading them again once they are older
+// than revocationRefreshInterval. If that fails the previous list is kept, so
+// the User Service being down does not reject every request.
+func (l *revocationList) current() *revocationIndex {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if time.Since(l.fetchedAt) >= revocationRefreshInterval {
+		l.fetchedAt = time.Now()
+		if err := l.fetch(); err != nil {
+			log.Printf("Failed to refresh token revocations, using the previous list: %v", err)
+		}
+	}
+	return l.index
+}
+
+func (l *revocationList) fetch() error {
+	resp, err := l.client.Get(l.url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("status %d", resp.StatusCode)
+	}
+
+	var list Revocations
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		return err
+	}
+	l.index = newRevocationIndex(list)
+	return nil
+}
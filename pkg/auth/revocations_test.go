@@ -0,0 +1,45 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+func TestRevocationIndexRevoked(t *testing.T) {
+	now := time.Now()
+	idx := newRevocationIndex(Revocations{
+		Tokens:   []string{"jti-1"},
+		Sessions: []string{"sid-1"},
+		Users:    []UserRevocation{{UserID: 7, NotBefore: now}},
+	})
+
+	claims := func(jti, sid string, userID int64, issuedAt time.Time) *Claims {
+		return &Claims{
+			UserID:           userID,
+			SessionID:        sid,
+			RegisteredClaims: jwt.RegisteredClaims{ID: jti, IssuedAt: jwt.NewNumericDate(issuedAt)},
+		}
+	}
+	service := claims("jti-2", "", 0, now.Add(-time.Minute))
+	service.ClientID = "svc_reporting"
+
+	tests := []struct {
+		name   string
+		claims *Claims
+		want   bool
+	}{
+		{"revoked token", claims("jti-1", "", 3, now), true},
+		{"ended session", claims("jti-2", "sid-1", 3, now), true},
+		{"user revoked after issue", claims("jti-2", "sid-2", 7, now.Add(-time.Minute)), true},
+		{"user revoked before issue", claims("jti-2", "sid-2", 7, now.Add(time.Minute)), false},
+		{"other user", claims("jti-2", "sid-2", 3, now.Add(-time.Minute)), false},
+		{"service token", service, false},
+	}
+	for _, tt := range tests {
+		if got := idx.revoked(tt.claims); got != tt.want {
+			t.Errorf("%s: revoked = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package auth
+
+import (
+	"crypto"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// minRefreshInterval limits how often an unknown key ID can trigger a JWKS download.
+const minRefreshInterval = 30 * time.Second
+
+var (
+	// ErrRevoked is returned for tokens the User Service revoked before they expired.
+	ErrRevoked = errors.New("token has been revoked")
+	// ErrNotAccessToken is returned for validly signed tokens that are not
+	// access tokens, such as ID tokens issued to OpenID Connect clients.
+	ErrNotAccessToken = errors.New("not an access token")
+)
+
+// Verifier validates access tokens locally using the keys the User Service
+// publishes at /.well-known/jwks.json. Keys are cached and re-fetched when a
+// token names a key ID that is not cached yet, which picks up rotated keys, or
+// when a signature does not match the cached key, which picks up a key that
+// was replaced under the same ID.
+type Verifier struct {
+	jwksURL     string
+	client      *http.Client
+	revocations *revocationList
+
+	mu        sync.RWMutex
+	keys      map[string]crypto.PublicKey
+	fetchedAt time.Time
+}
+
+// NewVerifier creates a Verifier that loads keys from the given JWKS URL.
+func NewVerifier(jwksURL string) *Verifier {
+	return &Verifier{
+		jwksURL: jwksURL,
+		client:  &http.Client{Timeout: 5 * time.Second},
+		keys:    make(map[string]crypto.PublicKey),
+	}
+}
+
+// CheckRevocations makes the verifier also reject tokens listed at the User
+// Service's revocation endpoint (/token-revocations), so disabling a user,
+// ending a session or logging out takes effect within seconds instead of when
+// the token expires. It returns v.
+func (v *Verifier) CheckRevocations(url string) *Verifier {
+	v.revocations = &revocationList{url: url, client: v.client}
+	return v
+}
+
+// Parse verifies the token's signature and expiry and returns its claims.
+// A leading "Bearer " is stripped so the Authorization header can be passed as is.
+func (v *Verifier) Parse(tokenStr string) (*Claims, error) {
+	tokenStr = strings.TrimPrefix(tokenStr, "Bearer ")
+
+	claims, err := v.parse(tokenStr)
+	var ve *jwt.ValidationError
+	if errors.As(err, &ve) && ve.Errors&jwt.ValidationErrorSignatureInvalid != 0 {
+		if v.refresh() == nil {
+			claims, err = v.parse(tokenStr)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if v.revocations != nil {
+		if idx := v.revocations.current(); idx != nil && idx.revoked(claims) {
+			return nil, ErrRevoked
+		}
+	}
+	return claims, nil
+}
+
+// parse verifies the token against the cached keys.
+func (v *Verifier) parse(tokenStr string) (*Claims, error) {
+	claims := &Claims{}
+	parser := jwt.NewParser(jwt.WithValidMethods([]string{"RS256", "EdDSA"}))
+	_, err := parser.ParseWithClaims(tokenStr, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		if kid == "" {
+			return nil, errors.New("token has no kid header")
+		}
+		return v.key(kid)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !claims.IsAccessToken() {
+		return nil, ErrNotAccessToken
+	}
+	return claims, nil
+}
+
+// key returns the public key with the given ID, refreshing the cache if it is unknown.
+func (v *Verifier) key(kid string) (crypto.PublicKey, error) {
+	v.mu.RLock()
+	key, ok := v.keys[kid]
+	fetchedAt := v.fetchedAt
+	v.mu.RUnlock()
+	if ok {
+		return key, nil
+	}
+
+	if time.Since(fetchedAt) < minRefreshInterval {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	if err := v.refresh(); err != nil {
+		return nil, err
+	}
+
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	if key, ok := v.keys[kid]; ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+// refresh replaces the cached keys with the current JWKS document.
+func (v *Verifier) refresh() error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	// Another caller may have refreshed while we waited for the lock.
+	if time.Since(v.fetchedAt) < minRefreshInterval {
+		return nil
+	}
+	v.fetchedAt = time.Now()
+
+	resp, err := v.client.Get(v.jwksURL)
+	if err != nil {
+		return fmt.Errorf("failed to fetch JWKS: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to fetch JWKS: status %d", resp.StatusCode)
+	}
+
+	var set JWKSet
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return fmt.Errorf("failed to decode JWKS: %w", err)
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, jwk := range set.Keys {
+		key, err := jwk.PublicKey()
+		if err != nil {
+			continue // skip keys we cannot use rather than rejecting the whole set
+		}
+		keys[jwk.Kid] = key
+	}
+	v.keys = keys
+	return nil
+}
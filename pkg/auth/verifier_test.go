@@ -0,0 +1,119 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+func TestVerifierParse(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey failed: %v", err)
+	}
+	jwk, err := NewJWK("key-1", "EdDSA", pub)
+	if err != nil {
+		t.Fatalf("NewJWK failed: %v", err)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(JWKSet{Keys: []JWK{jwk}})
+	}))
+	defer server.Close()
+
+	sign := func(kid string) string {
+		token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, &Claims{
+			UserID: 14,
+			Email:  "hari12.james@example.com",
+			Roles:  []string{"user"},
+			RegisteredClaims: jwt.RegisteredClaims{
+				ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+			},
+		})
+		token.Header["kid"] = kid
+		signed, err := token.SignedString(priv)
+		if err != nil {
+			t.Fatalf("SignedString failed: %v", err)
+		}
+		return signed
+	}
+
+	verifier := NewVerifier(server.URL)
+
+	claims, err := verifier.Parse("Bearer " + sign("key-1"))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if claims.UserID != 14 || claims.Email != "hari12.james@example.com" {
+		t.Errorf("Unexpected claims %+v", claims)
+	}
+
+	if _, err := verifier.Parse(sign("key-2")); err == nil {
+		t.Errorf("Expected a token signed with an unknown kid to be rejected")
+	}
+
+	// ID tokens are signed with the same keys but must not work as access tokens
+	for _, idClaims := range []*Claims{
+		{UserID: 14, TokenUse: TokenUseID},
+		{RegisteredClaims: jwt.RegisteredClaims{Audience: jwt.ClaimStrings{"wiki"}}},
+	} {
+		idClaims.ExpiresAt = jwt.NewNumericDate(time.Now().Add(time.Minute))
+		token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, idClaims)
+		token.Header["kid"] = "key-1"
+		signed, err := token.SignedString(priv)
+		if err != nil {
+			t.Fatalf("SignedString failed: %v", err)
+		}
+		if _, err := verifier.Parse(signed); !errors.Is(err, ErrNotAccessToken) {
+			t.Errorf("Expected an ID token to be rejected with ErrNotAccessToken, got %v", err)
+		}
+	}
+}
+
+func TestVerifierRefetchesReplacedKey(t *testing.T) {
+	var current JWK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(JWKSet{Keys: []JWK{current}})
+	}))
+	defer server.Close()
+
+	// newKey publishes a fresh key under the same kid, as a restarted User
+	// Service with an unchanged JWT_KEY_ID would, and returns a token signed with it
+	newKey := func() string {
+		pub, priv, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			t.Fatalf("GenerateKey failed: %v", err)
+		}
+		if current, err = NewJWK("default", "EdDSA", pub); err != nil {
+			t.Fatalf("NewJWK failed: %v", err)
+		}
+		token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, &Claims{
+			UserID:           14,
+			RegisteredClaims: jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute))},
+		})
+		token.Header["kid"] = "default"
+		signed, err := token.SignedString(priv)
+		if err != nil {
+			t.Fatalf("SignedString failed: %v", err)
+		}
+		return signed
+	}
+
+	verifier := NewVerifier(server.URL)
+	if _, err := verifier.Parse(newKey()); err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	token := newKey()
+	verifier.fetchedAt = time.Time{} // pretend the refresh interval has passed
+	if _, err := verifier.Parse(token); err != nil {
+		t.Errorf("Expected the replaced key to be fetched, got %v", err)
+	}
+}
@@ -0,0 +1,172 @@
+// Package blobstore stores binary objects such as images behind a small
+// interface, so services do not depend on where the bytes live. Local keeps
+// them on the filesystem; an S3-compatible store can implement Store later,
+// returning bucket or CDN URLs from URL.
+package blobstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	// ErrNotFound is returned when opening a blob that does not exist.
+	ErrNotFound = errors.New("blob not found")
+	// ErrInvalidKey is returned for keys that are empty, absolute or leave the store with "..".
+	ErrInvalidKey = errors.New("invalid blob key")
+)
+
+// Store saves and retrieves blobs by key. Keys are slash-separated relative
+// paths such as "products/12/3f2a.jpg".
+type Store interface {
+	// Put stores the blob, replacing any blob with the same key.
+	Put(ctx context.Context, key string, r io.Reader, contentType string) error
+	// Open returns the blob's contents, or ErrNotFound.
+	Open(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete removes the blob. Deleting a missing blob is not an error.
+	Delete(ctx context.Context, key string) error
+	// URL returns the address clients can fetch the blob from.
+	URL(key string) string
+}
+
+// Config selects and configures a Store.
+type Config struct {
+	Kind    string // "local" (the default); other kinds are not supported yet
+	Dir     string // Directory of the local store
+	BaseURL string // URL the blobs are served under, e.g. http://localhost:8080/images
+}
+
+// New returns the Store described by cfg.
+func New(cfg Config) (Store, error) {
+	switch cfg.Kind {
+	case "", "local":
+		return NewLocal(cfg.Dir, cfg.BaseURL)
+	default:
+		return nil, fmt.Errorf("blobstore: unsupported kind %q", cfg.Kind)
+	}
+}
+
+// CleanKey validates a key and returns it in canonical form.
+func CleanKey(key string) (string, error) {
+	if key == "" || strings.HasPrefix(key, "/") || strings.Contains(key, "\\") {
+		return "", ErrInvalidKey
+	}
+	clean := path.Clean(key)
+	if clean == "." || clean == ".." || strings.HasPrefix(clean, "../") {
+		return "", ErrInvalidKey
+	}
+	return clean, nil
+}
+
+// Local stores blobs as files below a directory. Serve them with Handler.
+type Local struct {
+	dir     string
+	baseURL string
+}
+
+// NewLocal returns a store keeping blobs below dir, creating it if needed.
+func NewLocal(dir, baseURL string) (*Local, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &Local{dir: dir, baseURL: strings.TrimRight(baseURL, "/")}, nil
+}
+
+func (l *Local) path(key string) (string, error) {
+	clean, err := CleanKey(key)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(l.dir, filepath.FromSlash(clean)), nil
+}
+
+// Put writes the blob to a temporary file and renames it into place, so
+// readers never see a partly written blob.
+func (l *Local) Put(ctx context.Context, key string, r io.Reader, contentType string) error {
+	name, err := l.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(name), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), name)
+}
+
+// Open opens the blob's file.
+func (l *Local) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	name, err := l.path(key)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(name)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	return f, err
+}
+
+// Delete removes the blob's file.
+func (l *Local) Delete(ctx context.Context, key string) error {
+	name, err := l.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(name); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// URL returns the blob's URL below the base URL.
+func (l *Local) URL(key string) string {
+	return l.baseURL + "/" + key
+}
+
+// Handler serves the blobs read-only, taking the request path, with any prefix
+// stripped, as the key. Keys are never reused, so responses may be cached for good.
+func (l *Local) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name, err := l.path(strings.TrimPrefix(r.URL.Path, "/"))
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		f, err := os.Open(name)
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		defer f.Close()
+		info, err := f.Stat()
+		if err != nil || info.IsDir() {
+			http.NotFound(w, r)
+			return
+		}
+
+		w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+		http.ServeContent(w, r, info.Name(), info.ModTime(), f)
+	})
+}
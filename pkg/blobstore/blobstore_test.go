@@ -0,0 +1,71 @@
+package blobstore
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCleanKey(t *testing.T) {
+	for key, want := range map[string]string{
+		"products/1/a.jpg":    "products/1/a.jpg",
+		"products//1/./a.jpg": "products/1/a.jpg",
+	} {
+		if got, err := CleanKey(key); err != nil || got != want {
+			t.Errorf("CleanKey(%q) = %q, %v, want %q", key, got, err, want)
+		}
+	}
+	for _, key := range []string{"", ".", "/etc/passwd", "..", "../a", "products/../../a", `products\a`} {
+		if _, err := CleanKey(key); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("CleanKey(%q) = %v, want ErrInvalidKey", key, err)
+		}
+	}
+}
+
+func TestLocal(t *testing.T) {
+	ctx := context.Background()
+	store, err := NewLocal(t.TempDir(), "http://localhost:8080/images/")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.Put(ctx, "products/1/a.txt", strings.NewReader("hello"), "text/plain"); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	r, err := store.Open(ctx, "products/1/a.txt")
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	data, _ := io.ReadAll(r)
+	r.Close()
+	if string(data) != "hello" {
+		t.Errorf("Open read %q", data)
+	}
+	if got, want := store.URL("products/1/a.txt"), "http://localhost:8080/images/products/1/a.txt"; got != want {
+		t.Errorf("URL = %q, want %q", got, want)
+	}
+
+	rec := httptest.NewRecorder()
+	store.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/products/1/a.txt", nil))
+	if rec.Code != 200 || rec.Body.String() != "hello" {
+		t.Errorf("Handler served %d %q", rec.Code, rec.Body.String())
+	}
+	rec = httptest.NewRecorder()
+	store.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/products", nil))
+	if rec.Code != 404 {
+		t.Errorf("Handler served a directory with %d", rec.Code)
+	}
+
+	if err := store.Delete(ctx, "products/1/a.txt"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := store.Open(ctx, "products/1/a.txt"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Open after Delete = %v, want ErrNotFound", err)
+	}
+	if err := store.Delete(ctx, "products/1/a.txt"); err != nil {
+		t.Errorf("Delete of a missing blob = %v", err)
+	}
+}
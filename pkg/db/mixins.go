@@ -0,0 +1,17 @@
+package db
+
+import "time"
+
+// SoftDelete is embedded into models whose rows are hidden instead of removed.
+// Bun turns NewDelete into an UPDATE of deleted_at and adds "deleted_at IS NULL"
+// to selects and updates by default; use WhereDeleted or WhereAllWithDeleted
+// (and ForceDelete) to reach soft-deleted rows.
+type SoftDelete struct {
+	DeletedAt time.Time `bun:"deleted_at,soft_delete,nullzero"` // Timestamp when the row was soft-deleted
+}
+
+// Audit is embedded into models that record which user created and last updated a row.
+type Audit struct {
+	CreatedBy int64 `bun:"created_by,nullzero"` // User who created the row
+	UpdatedBy int64 `bun:"updated_by,nullzero"` // User who last updated the row
+}
@@ -18,29 +18,144 @@ type UserProfileUpdated struct {
 	UpdatedAt time.Time `json:"updated_at"`
 }
 
+// UserErased event is emitted when a user's personal data has been erased.
+// Services must anonymize their copies but may keep records such as orders.
+type UserErased struct {
+	UserID   string    `json:"user_id"`
+	ErasedAt time.Time `json:"erased_at"`
+}
+
 type ProductCreated struct {
-	ProductID      string  `json:"product_id"`
-	Name           string  `json:"name"`
-	Price          float64 `json:"price"`
-	InventoryCount int     `json:"inventory_count"`
+	ProductID      string            `json:"product_id"`
+	Name           string            `json:"name"`
+	Price          float64           `json:"price"`
+	InventoryCount int               `json:"inventory_count"`
+	Categories     []ProductCategory `json:"categories,omitempty"`
+	Variants       []ProductVariant  `json:"variants,omitempty"`
+}
+
+// ProductCategory is a category a product was put in, as carried by product events.
+type ProductCategory struct {
+	CategoryID string `json:"category_id"`
+	ParentID   string `json:"parent_id,omitempty"`
+	Name       string `json:"name"`
+	Slug       string `json:"slug"`
+}
+
+// ProductVariant is a variant of a product with its own SKU, price and inventory,
+// as carried by product events.
+type ProductVariant struct {
+	VariantID      string            `json:"variant_id"`
+	ProductID      string            `json:"product_id"`
+	SKU            string            `json:"sku"`
+	Attributes     map[string]string `json:"attributes"`
+	Price          float64           `json:"price"`
+	InventoryCount int               `json:"inventory_count"`
+}
+
+// ProductVariantUpdated event is emitted when a variant is added to a product or
+// changed. It carries the whole variant, so consumers can create missing copies.
+type ProductVariantUpdated struct {
+	ProductVariant
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// ProductVariantDeleted event is emitted when a variant is soft-deleted and
+// should no longer be ordered.
+type ProductVariantDeleted struct {
+	VariantID string    `json:"variant_id"`
+	ProductID string    `json:"product_id"`
+	DeletedAt time.Time `json:"deleted_at"`
+}
+
+// ProductDeleted event is emitted when a product is soft-deleted and should be marked unavailable.
+type ProductDeleted struct {
+	ProductID string    `json:"product_id"`
+	DeletedAt time.Time `json:"deleted_at"`
+}
+
+// ProductRestored event is emitted when a soft-deleted product is made available again.
+type ProductRestored struct {
+	ProductID string `json:"product_id"`
 }
 
 // ProductInventoryUpdated represents the event when product inventory is updated.
+// VariantID is set when the inventory of one of the product's variants changed.
 type ProductInventoryUpdated struct {
-	ProductID      string `json:"product_id"`
+	ProductID      string              `json:"product_id"`
+	VariantID      string              `json:"variant_id,omitempty"`
+	InventoryCount int                 `json:"inventory_count"` // Total over all warehouses
+	Locations      []InventoryLocation `json:"locations,omitempty"`
+}
+
+// InventoryLocation is the inventory of a product or variant at a warehouse.
+type InventoryLocation struct {
+	WarehouseID    string `json:"warehouse_id"`
+	Code           string `json:"code"`
 	InventoryCount int    `json:"inventory_count"`
 }
 
+// StockReservationReleased event is emitted when stock held by a reservation
+// becomes available to sell again, because the reservation was released or expired.
+type StockReservationReleased struct {
+	ReservationID string         `json:"reservation_id"`
+	ReferenceID   string         `json:"reference_id"`
+	Status        string         `json:"status"` // "released" or "expired"
+	Items         []ReservedItem `json:"items"`
+	ReleasedAt    time.Time      `json:"released_at"`
+}
+
+// ReservedItem is the quantity of a product or variant a reservation held.
+type ReservedItem struct {
+	ProductID string `json:"product_id"`
+	VariantID string `json:"variant_id,omitempty"`
+	Quantity  int    `json:"quantity"`
+}
+
+// ProductLowStock event is emitted when a product's inventory falls to its
+// reorder threshold or below, and again only after it was restocked above it.
+type ProductLowStock struct {
+	ProductID        string    `json:"product_id"`
+	InventoryCount   int       `json:"inventory_count"`
+	ReorderThreshold int       `json:"reorder_threshold"`
+	OccurredAt       time.Time `json:"occurred_at"`
+}
+
+// ProductOutOfStock event is emitted when a product's inventory runs out.
+type ProductOutOfStock struct {
+	ProductID  string    `json:"product_id"`
+	OccurredAt time.Time `json:"occurred_at"`
+}
+
+// ProductBackInStock event is emitted when a product or variant users asked
+// about is in stock again. UserIDs are the users to notify; each is notified once.
+type ProductBackInStock struct {
+	ProductID      string    `json:"product_id"`
+	VariantID      string    `json:"variant_id,omitempty"`
+	InventoryCount int       `json:"inventory_count"`
+	UserIDs        []string  `json:"user_ids"`
+	OccurredAt     time.Time `json:"occurred_at"`
+}
+
 // OrderPlaced represents the event for an order that has been placed.
 type OrderPlaced struct {
     OrderID int64 `json:"order_id"`
     UserID  int64 `json:"user_id"`
     Items   []OrderItem `json:"items"`
+    ShipTo  *ShippingDestination `json:"ship_to,omitempty"` // Used to allocate stock from the nearest warehouse
+    ReservationID int64 `json:"reservation_id,omitempty"` // Set when the order holds a stock reservation, which takes the stock when it is confirmed
+}
+
+// ShippingDestination is where an order ships to.
+type ShippingDestination struct {
+    Country    string `json:"country"`
+    PostalCode string `json:"postal_code"`
 }
 
 // OrderItem represents a single item in an order.
 type OrderItem struct {
     ProductID int64 `json:"product_id"`
+    VariantID int64 `json:"variant_id,omitempty"` // Set when a variant of the product was ordered
     Quantity  int   `json:"quantity"`
 }
 
@@ -49,3 +164,84 @@ type OrderShipped struct {
 	OrderID   string    `json:"order_id"`
 	ShippedAt time.Time `json:"shipped_at"`
 }
+
+// UserEmailVerificationRequested event is emitted when a user must confirm their email address.
+// Token is the single-use verification token to deliver to the user.
+type UserEmailVerificationRequested struct {
+	UserID    string    `json:"user_id"`
+	Email     string    `json:"email"`
+	Name      string    `json:"name"`
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// PasswordResetRequested event is emitted when a user asks to reset a forgotten password,
+// or when an admin forces a reset. Token is the single-use reset token to deliver to the user.
+type PasswordResetRequested struct {
+	UserID    string    `json:"user_id"`
+	Email     string    `json:"email"`
+	Name      string    `json:"name"`
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+	Forced    bool      `json:"forced,omitempty"` // Set when an admin required the reset
+}
+
+// AccountLocked event is emitted when too many failed logins lock an account out.
+// UserID is empty when the email does not belong to a registered user.
+type AccountLocked struct {
+	UserID      string    `json:"user_id,omitempty"`
+	Email       string    `json:"email"`
+	IP          string    `json:"ip"`
+	Failures    int       `json:"failures"`
+	LockedUntil time.Time `json:"locked_until"`
+}
+
+// AccountUnlocked event is emitted when an admin lifts an account lockout.
+type AccountUnlocked struct {
+	UserID     string    `json:"user_id"`
+	Email      string    `json:"email"`
+	UnlockedBy string    `json:"unlocked_by"`
+	UnlockedAt time.Time `json:"unlocked_at"`
+}
+
+// UserDisabled event is emitted when an admin disables an account.
+type UserDisabled struct {
+	UserID     string    `json:"user_id"`
+	Reason     string    `json:"reason,omitempty"`
+	DisabledBy string    `json:"disabled_by"`
+	DisabledAt time.Time `json:"disabled_at"`
+}
+
+// UserEnabled event is emitted when an admin enables a disabled account again.
+type UserEnabled struct {
+	UserID    string    `json:"user_id"`
+	EnabledBy string    `json:"enabled_by"`
+	EnabledAt time.Time `json:"enabled_at"`
+}
+
+// UserImpersonated event is emitted when an admin is issued a token to act as a user.
+// TokenID is the "jti" of that token, so requests made with it can be traced.
+type UserImpersonated struct {
+	UserID         string    `json:"user_id"`
+	ImpersonatorID string    `json:"impersonator_id"`
+	Reason         string    `json:"reason"`
+	TokenID        string    `json:"token_id"`
+	IssuedAt       time.Time `json:"issued_at"`
+	ExpiresAt      time.Time `json:"expires_at"`
+}
+
+// UserAuditEvent is emitted for every entry of the User Service's audit log,
+// for ingestion by a SIEM. Outcome is "success", "failure" or "denied".
+type UserAuditEvent struct {
+	AuditID        int64     `json:"audit_id"`
+	Action         string    `json:"action"`
+	Outcome        string    `json:"outcome"`
+	ActorID        string    `json:"actor_id,omitempty"`
+	ImpersonatorID string    `json:"impersonator_id,omitempty"`
+	ActorClientID  string    `json:"actor_client_id,omitempty"`
+	TargetUserID   string    `json:"target_user_id,omitempty"`
+	Detail         string    `json:"detail,omitempty"`
+	IP             string    `json:"ip,omitempty"`
+	UserAgent      string    `json:"user_agent,omitempty"`
+	OccurredAt     time.Time `json:"occurred_at"`
+}
@@ -0,0 +1,334 @@
+// Package validation normalizes and checks decoded request bodies according to
+// their struct tags, and writes the 422 response listing invalid fields that
+// every service returns.
+//
+// The normalize tag lists transformations applied first:
+//
+//	trim   remove leading and trailing white space
+//	lower  convert to lower case
+//	upper  convert to upper case
+//	e164   turn a phone number into E.164 form, see NormalizePhone
+//
+// The validate tag lists rules:
+//
+//	required     must not be empty, zero or nil
+//	email        must be an email address
+//	e164         must be a phone number in E.164 form
+//	min=N        numbers must be at least N; strings and slices must have at least N characters or items
+//	max=N        the same, at most N
+//	gt=N         numbers must be greater than N
+//	oneof=a b c  must be one of the listed values
+//
+// Rules other than required and the numeric ones pass for empty strings, so
+// optional fields are only checked when given. Structs, pointers to structs and
+// slices of them are checked field by field, and null entries in such slices are
+// rejected. Errors are keyed by JSON path, e.g. "items[0].quantity".
+package validation
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Errors maps the JSON path of each invalid field to what is wrong with it.
+type Errors map[string]string
+
+func (e Errors) Error() string {
+	fields := make([]string, 0, len(e))
+	for field := range e {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	parts := make([]string, len(fields))
+	for i, field := range fields {
+		parts[i] = field + " " + e[field]
+	}
+	return "invalid request: " + strings.Join(parts, "; ")
+}
+
+// Add records a problem with a field, keeping the first one reported for it.
+func (e Errors) Add(field, message string) {
+	if _, ok := e[field]; !ok {
+		e[field] = message
+	}
+}
+
+// Response is the body of a 422 response.
+type Response struct {
+	Error  string `json:"error"`
+	Fields Errors `json:"fields"`
+}
+
+// WriteErrors responds with 422 Unprocessable Entity listing the invalid fields.
+func WriteErrors(w http.ResponseWriter, errs Errors) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusUnprocessableEntity)
+	json.NewEncoder(w).Encode(Response{Error: "Validation failed", Fields: errs})
+}
+
+// Decode reads the JSON request body into the struct v points to, normalizes
+// and validates it. On failure it responds with 400 for a malformed body or 422
+// for invalid fields, and returns false.
+func Decode(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return false
+	}
+	if err := Struct(v); err != nil {
+		WriteErrors(w, err.(Errors))
+		return false
+	}
+	return true
+}
+
+// Struct normalizes the struct v points to in place and validates it. It
+// returns nil or Errors.
+func Struct(v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Struct {
+		panic("validation: Struct needs a pointer to a struct")
+	}
+	errs := Errors{}
+	checkStruct(rv.Elem(), "", errs)
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func checkStruct(v reflect.Value, prefix string, errs Errors) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		fv := v.Field(i)
+		if field.Anonymous && fv.Kind() == reflect.Struct {
+			checkStruct(fv, prefix, errs)
+			continue
+		}
+		name := fieldName(field)
+		if name == "-" {
+			continue
+		}
+		path := prefix + name
+
+		if tag := field.Tag.Get("normalize"); tag != "" {
+			normalize(fv, tag)
+		}
+		if tag := field.Tag.Get("validate"); tag != "" {
+			if msg := check(fv, tag); msg != "" {
+				errs.Add(path, msg)
+				continue
+			}
+		}
+		descend(fv, path, errs)
+	}
+}
+
+// descend checks the fields of nested structs and of structs in slices.
+func descend(v reflect.Value, path string, errs Errors) {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if !v.IsNil() {
+			descend(v.Elem(), path, errs)
+		}
+	case reflect.Struct:
+		checkStruct(v, path+".", errs)
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			elem, elemPath := v.Index(i), fmt.Sprintf("%s[%d]", path, i)
+			if elem.Kind() == reflect.Ptr && elem.IsNil() && elem.Type().Elem().Kind() == reflect.Struct {
+				errs.Add(elemPath, "is required")
+				continue
+			}
+			descend(elem, elemPath, errs)
+		}
+	}
+}
+
+func fieldName(field reflect.StructField) string {
+	if tag := field.Tag.Get("json"); tag != "" {
+		if name, _, _ := strings.Cut(tag, ","); name != "" {
+			return name
+		}
+	}
+	return field.Name
+}
+
+func normalize(v reflect.Value, tag string) {
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.String {
+		panic("validation: normalize tag on a non-string field")
+	}
+	s := v.String()
+	for _, op := range strings.Split(tag, ",") {
+		switch op {
+		case "trim":
+			s = strings.TrimSpace(s)
+		case "lower":
+			s = strings.ToLower(s)
+		case "upper":
+			s = strings.ToUpper(s)
+		case "e164":
+			s = NormalizePhone(s)
+		default:
+			panic("validation: unknown normalization " + op)
+		}
+	}
+	v.SetString(s)
+}
+
+// check applies the rules of a validate tag and returns the first failure's message.
+func check(v reflect.Value, tag string) string {
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			if strings.Contains(","+tag+",", ",required,") {
+				return "is required"
+			}
+			return ""
+		}
+		v = v.Elem()
+	}
+
+	for _, rule := range strings.Split(tag, ",") {
+		name, arg, _ := strings.Cut(rule, "=")
+		var msg string
+		switch name {
+		case "required":
+			if v.IsZero() || (v.Kind() == reflect.Slice || v.Kind() == reflect.Map) && v.Len() == 0 {
+				msg = "is required"
+			}
+		case "email":
+			msg = checkString(v, func(s string) string {
+				if addr, err := mail.ParseAddress(s); err != nil || addr.Address != s || addr.Name != "" {
+					return "must be a valid email address"
+				}
+				return ""
+			})
+		case "e164":
+			msg = checkString(v, func(s string) string {
+				if !e164.MatchString(s) {
+					return "must be a phone number in international format, e.g. +919876543210"
+				}
+				return ""
+			})
+		case "min", "max", "gt":
+			msg = checkBound(v, name, arg)
+		case "oneof":
+			msg = checkString(v, func(s string) string {
+				allowed := strings.Fields(arg)
+				for _, a := range allowed {
+					if s == a {
+						return ""
+					}
+				}
+				return "must be one of " + strings.Join(allowed, ", ")
+			})
+		default:
+			panic("validation: unknown rule " + name)
+		}
+		if msg != "" {
+			return msg
+		}
+	}
+	return ""
+}
+
+// checkString applies a string rule, skipping empty strings.
+func checkString(v reflect.Value, rule func(string) string) string {
+	if v.Kind() != reflect.String {
+		panic("validation: string rule on a " + v.Kind().String() + " field")
+	}
+	if v.String() == "" {
+		return ""
+	}
+	return rule(v.String())
+}
+
+func checkBound(v reflect.Value, rule, arg string) string {
+	bound, err := strconv.ParseFloat(arg, 64)
+	if err != nil {
+		panic("validation: invalid bound " + rule + "=" + arg)
+	}
+
+	var n float64
+	var unit string
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n = float64(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n = float64(v.Uint())
+	case reflect.Float32, reflect.Float64:
+		n = v.Float()
+	case reflect.String:
+		if v.String() == "" {
+			return ""
+		}
+		n, unit = float64(utf8.RuneCountInString(v.String())), " characters"
+	case reflect.Slice, reflect.Array, reflect.Map:
+		n, unit = float64(v.Len()), " items"
+	default:
+		panic("validation: " + rule + " rule on a " + v.Kind().String() + " field")
+	}
+
+	switch {
+	case rule == "min" && n < bound && unit == "":
+		return "must be at least " + arg
+	case rule == "min" && n < bound:
+		return "must have at least " + arg + unit
+	case rule == "max" && n > bound && unit == "":
+		return "must be at most " + arg
+	case rule == "max" && n > bound:
+		return "must have at most " + arg + unit
+	case rule == "gt" && n <= bound:
+		return "must be greater than " + arg
+	}
+	return ""
+}
+
+var (
+	e164            = regexp.MustCompile(`^\+[1-9][0-9]{7,14}$`)
+	phoneSeparators = strings.NewReplacer(" ", "", "-", "", ".", "", "(", "", ")", "")
+)
+
+// DefaultCallingCode is prefixed to phone numbers given without a country
+// code. It is read from PHONE_DEFAULT_COUNTRY_CODE and defaults to 91 (India).
+var DefaultCallingCode = defaultCallingCode()
+
+func defaultCallingCode() string {
+	if code := strings.TrimPrefix(os.Getenv("PHONE_DEFAULT_COUNTRY_CODE"), "+"); code != "" {
+		return code
+	}
+	return "91"
+}
+
+// NormalizePhone turns a phone number into E.164 form where it can: separators
+// are removed, a leading 00 becomes +, and numbers without a country code get
+// DefaultCallingCode after dropping a trunk prefix 0. Anything else is returned
+// without separators, for the e164 rule to reject.
+func NormalizePhone(s string) string {
+	s = phoneSeparators.Replace(strings.TrimSpace(s))
+	switch {
+	case s == "" || strings.HasPrefix(s, "+"):
+		return s
+	case strings.HasPrefix(s, "00"):
+		return "+" + s[2:]
+	}
+	return "+" + DefaultCallingCode + strings.TrimPrefix(s, "0")
+}
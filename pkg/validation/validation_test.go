@@ -0,0 +1,102 @@
+package validation
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type item struct {
+	ProductID int64   `json:"product_id" validate:"gt=0"`
+	Quantity  int     `json:"quantity" validate:"min=1,max=100"`
+	Price     float64 `json:"price" validate:"min=0"`
+}
+
+type request struct {
+	Email  string  `json:"email" validate:"required,email" normalize:"trim,lower"`
+	Phone  string  `json:"phone_no" validate:"e164" normalize:"e164"`
+	Status string  `json:"status" validate:"oneof=placed shipped"`
+	Note   *string `json:"note" validate:"max=5"`
+	Items  []*item `json:"items" validate:"required,min=1"`
+}
+
+func TestStructNormalizes(t *testing.T) {
+	req := request{
+		Email: "  Jane.Doe@Example.COM ",
+		Phone: "098765 43210",
+		Items: []*item{{ProductID: 1, Quantity: 2}},
+	}
+	if err := Struct(&req); err != nil {
+		t.Fatal(err)
+	}
+	if req.Email != "jane.doe@example.com" {
+		t.Errorf("email = %q", req.Email)
+	}
+	if req.Phone != "+919876543210" {
+		t.Errorf("phone = %q", req.Phone)
+	}
+}
+
+func TestStructReportsFields(t *testing.T) {
+	note := "too long"
+	req := request{
+		Email:  "not an email",
+		Phone:  "+12",
+		Status: "lost",
+		Note:   &note,
+		Items:  []*item{{ProductID: 1, Quantity: 1}, {Quantity: 0, Price: -1}, nil},
+	}
+	err := Struct(&req)
+	want := Errors{
+		"email":               "must be a valid email address",
+		"phone_no":            "must be a phone number in international format, e.g. +919876543210",
+		"status":              "must be one of placed, shipped",
+		"note":                "must have at most 5 characters",
+		"items[1].product_id": "must be greater than 0",
+		"items[1].quantity":   "must be at least 1",
+		"items[1].price":      "must be at least 0",
+		"items[2]":            "is required",
+	}
+	if !reflect.DeepEqual(err, want) {
+		t.Errorf("Struct() = %v, want %v", err, want)
+	}
+
+	err = Struct(&request{})
+	want = Errors{"email": "is required", "items": "is required"}
+	if !reflect.DeepEqual(err, want) {
+		t.Errorf("Struct(empty) = %v, want %v", err, want)
+	}
+}
+
+func TestNormalizePhone(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{"+1 (415) 555-0123", "+14155550123"},
+		{"0044 20 7946 0958", "+442079460958"},
+		{"9876543210", "+919876543210"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := NormalizePhone(tt.in); got != tt.want {
+			t.Errorf("NormalizePhone(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestDecode(t *testing.T) {
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"email": "x@example.com", "items": []}`))
+	if Decode(w, r, &request{}) {
+		t.Fatal("Decode accepted a request without items")
+	}
+	if w.Code != http.StatusUnprocessableEntity || !strings.Contains(w.Body.String(), `"items":"is required"`) {
+		t.Errorf("got %d %s", w.Code, w.Body)
+	}
+
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"email":`))
+	if Decode(w, r, &request{}) || w.Code != http.StatusBadRequest {
+		t.Errorf("malformed body gave %d", w.Code)
+	}
+}
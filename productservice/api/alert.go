@@ -0,0 +1,153 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/hari134/pratilipi/pkg/audit"
+	"github.com/hari134/pratilipi/pkg/auth"
+	"github.com/hari134/pratilipi/pkg/validation"
+	"github.com/hari134/pratilipi/productservice/internal/alerts"
+	"github.com/hari134/pratilipi/productservice/models"
+	"github.com/uptrace/bun"
+)
+
+// StockSubscriptionRequest represents the request body for asking to be told
+// when a product, or one of its variants, is back in stock.
+type StockSubscriptionRequest struct {
+	VariantID int64 `json:"variant_id" validate:"min=0"` // Leave out to wait for any of the product's stock
+}
+
+// LowStockResponse is one page of the products at or below their reorder threshold.
+type LowStockResponse struct {
+	Products []models.Product `json:"products"`
+	Total    int              `json:"total"`
+}
+
+// subscriberID returns the user a stock subscription is for, writing an error
+// response if the request does not name one. Impersonating admins subscribe
+// the impersonated user; service tokens name the user in the actor header.
+func subscriberID(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	var userID int64
+	if claims, ok := auth.ClaimsFromContext(r.Context()); ok && !claims.IsService() {
+		userID = claims.UserID
+	} else {
+		userID = audit.ActorFromRequest(r)
+	}
+	if userID == 0 {
+		http.Error(w, "Stock subscriptions need a user", http.StatusBadRequest)
+		return 0, false
+	}
+	return userID, true
+}
+
+// GetLowStockHandler lists the products whose inventory is at or below their
+// reorder threshold, emptiest first.
+func (h *ProductAPIHandler) GetLowStockHandler(w http.ResponseWriter, r *http.Request) {
+	limit, offset, ok := pageParams(w, r)
+	if !ok {
+		return
+	}
+
+	products, total, err := alerts.LowStock(context.Background(), h.DB, limit, offset)
+	if err != nil {
+		http.Error(w, "Failed to retrieve low-stock products", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(LowStockResponse{Products: products, Total: total})
+}
+
+// SubscribeStockHandler asks for the user to be told when an out-of-stock
+// product or variant is back. Subscribing again while waiting is harmless.
+func (h *ProductAPIHandler) SubscribeStockHandler(w http.ResponseWriter, r *http.Request) {
+	var req StockSubscriptionRequest
+	if !validation.Decode(w, r, &req) {
+		return
+	}
+	productID, _, ok := variantPath(w, r)
+	if !ok {
+		return
+	}
+	userID, ok := subscriberID(w, r)
+	if !ok {
+		return
+	}
+
+	sub := &models.StockSubscription{ProductID: productID, VariantID: req.VariantID, UserID: userID}
+	err := h.DB.RunInTx(context.Background(), nil, func(ctx context.Context, tx bun.Tx) error {
+		return alerts.Subscribe(ctx, tx, sub)
+	})
+	switch {
+	case errors.Is(err, alerts.ErrNotFound) && req.VariantID != 0:
+		validation.WriteErrors(w, validation.Errors{"variant_id": "must be a variant of the product"})
+		return
+	case errors.Is(err, alerts.ErrNotFound):
+		http.Error(w, "Product not found", http.StatusNotFound)
+		return
+	case errors.Is(err, alerts.ErrInStock):
+		http.Error(w, "The item is in stock", http.StatusConflict)
+		return
+	case err != nil:
+		http.Error(w, "Failed to save stock subscription", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(sub)
+}
+
+// UnsubscribeStockHandler cancels the user's waiting subscription to a product,
+// or to the variant named by variant_id in the query string.
+func (h *ProductAPIHandler) UnsubscribeStockHandler(w http.ResponseWriter, r *http.Request) {
+	productID, _, ok := variantPath(w, r)
+	if !ok {
+		return
+	}
+	var variantID int64
+	if v := r.URL.Query().Get("variant_id"); v != "" {
+		var err error
+		if variantID, err = strconv.ParseInt(v, 10, 64); err != nil {
+			http.Error(w, "Invalid variant ID", http.StatusBadRequest)
+			return
+		}
+	}
+	userID, ok := subscriberID(w, r)
+	if !ok {
+		return
+	}
+
+	err := alerts.Unsubscribe(context.Background(), h.DB, productID, variantID, userID)
+	if err != nil {
+		if errors.Is(err, alerts.ErrNotFound) {
+			http.Error(w, "Stock subscription not found", http.StatusNotFound)
+		} else {
+			http.Error(w, "Failed to delete stock subscription", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Stock subscription deleted successfully"})
+}
+
+// GetStockSubscriptionsHandler lists the user's waiting stock subscriptions.
+func (h *ProductAPIHandler) GetStockSubscriptionsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := subscriberID(w, r)
+	if !ok {
+		return
+	}
+
+	subs, err := alerts.Subscriptions(context.Background(), h.DB, userID)
+	if err != nil {
+		http.Error(w, "Failed to retrieve stock subscriptions", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(subs)
+}
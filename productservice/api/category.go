@@ -0,0 +1,205 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/hari134/pratilipi/pkg/blobstore"
+	"github.com/hari134/pratilipi/pkg/db"
+	"github.com/hari134/pratilipi/pkg/validation"
+	"github.com/hari134/pratilipi/productservice/internal/categories"
+	"github.com/hari134/pratilipi/productservice/internal/images"
+	"github.com/hari134/pratilipi/productservice/models"
+)
+
+type CategoryAPIHandler struct {
+	DB    *db.DB
+	Blobs blobstore.Store // Serves the URLs of product images
+}
+
+// CategoryRequest represents the request body for creating or updating a
+// category. The slug is derived from the name when left out.
+type CategoryRequest struct {
+	Name     string `json:"name" validate:"required,max=100" normalize:"trim"`
+	Slug     string `json:"slug" validate:"max=100" normalize:"trim,lower"`
+	ParentID int64  `json:"parent_id" validate:"min=0"`
+	Position int    `json:"position"`
+}
+
+// CategoryProductsResponse is one page of the products in a category.
+type CategoryProductsResponse struct {
+	Category *models.Category `json:"category"`
+	Products []models.Product `json:"products"`
+	Total    int              `json:"total"`
+}
+
+// GetCategoriesHandler returns the whole category tree.
+func (h *CategoryAPIHandler) GetCategoriesHandler(w http.ResponseWriter, r *http.Request) {
+	tree, err := categories.Tree(context.Background(), h.DB)
+	if err != nil {
+		http.Error(w, "Failed to retrieve categories", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(tree)
+}
+
+// CreateCategoryHandler adds a category to the tree.
+func (h *CategoryAPIHandler) CreateCategoryHandler(w http.ResponseWriter, r *http.Request) {
+	var req CategoryRequest
+	if !validation.Decode(w, r, &req) {
+		return
+	}
+
+	category := &models.Category{Name: req.Name, Slug: req.Slug, ParentID: req.ParentID, Position: req.Position}
+	if !h.save(w, category) {
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(category)
+}
+
+// UpdateCategoryHandler renames, reorders or moves a category. Moving a
+// category takes its subcategories and products along.
+func (h *CategoryAPIHandler) UpdateCategoryHandler(w http.ResponseWriter, r *http.Request) {
+	var req CategoryRequest
+	if !validation.Decode(w, r, &req) {
+		return
+	}
+	categoryID, err := strconv.ParseInt(mux.Vars(r)["category_id"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid category ID", http.StatusBadRequest)
+		return
+	}
+
+	category, err := categories.Find(context.Background(), h.DB, categoryID)
+	if err != nil {
+		if errors.Is(err, categories.ErrNotFound) {
+			http.Error(w, "Category not found", http.StatusNotFound)
+		} else {
+			http.Error(w, "Failed to retrieve category", http.StatusInternalServerError)
+		}
+		return
+	}
+	category.Name, category.Slug, category.ParentID, category.Position = req.Name, req.Slug, req.ParentID, req.Position
+	if !h.save(w, category) {
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(category)
+}
+
+// save stores the category, writing an error response if that fails.
+func (h *CategoryAPIHandler) save(w http.ResponseWriter, category *models.Category) bool {
+	err := categories.Save(context.Background(), h.DB, category)
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, categories.ErrInvalidSlug):
+		validation.WriteErrors(w, validation.Errors{"slug": "must be lowercase letters and digits joined by hyphens, e.g. running-shoes"})
+	case errors.Is(err, categories.ErrNotFound):
+		validation.WriteErrors(w, validation.Errors{"parent_id": "must be an existing category"})
+	case errors.Is(err, categories.ErrCycle):
+		validation.WriteErrors(w, validation.Errors{"parent_id": "must not be the category or one of its subcategories"})
+	case errors.Is(err, categories.ErrSlugTaken):
+		http.Error(w, "Another category already uses this slug", http.StatusConflict)
+	default:
+		http.Error(w, "Failed to save category", http.StatusInternalServerError)
+	}
+	return false
+}
+
+// DeleteCategoryHandler deletes a category without subcategories. Its products
+// are kept and only lose the category.
+func (h *CategoryAPIHandler) DeleteCategoryHandler(w http.ResponseWriter, r *http.Request) {
+	categoryID, err := strconv.ParseInt(mux.Vars(r)["category_id"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid category ID", http.StatusBadRequest)
+		return
+	}
+
+	err = categories.Delete(context.Background(), h.DB, categoryID)
+	switch {
+	case errors.Is(err, categories.ErrNotFound):
+		http.Error(w, "Category not found", http.StatusNotFound)
+		return
+	case errors.Is(err, categories.ErrHasChildren):
+		http.Error(w, "Move or delete the subcategories first", http.StatusConflict)
+		return
+	case err != nil:
+		http.Error(w, "Failed to delete category", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Category deleted successfully"})
+}
+
+// GetCategoryProductsHandler browses a category by slug. Products of the
+// categories below it are included unless include_descendants=false.
+func (h *CategoryAPIHandler) GetCategoryProductsHandler(w http.ResponseWriter, r *http.Request) {
+	includeDescendants := true
+	if v := r.URL.Query().Get("include_descendants"); v != "" {
+		var err error
+		if includeDescendants, err = strconv.ParseBool(v); err != nil {
+			http.Error(w, "include_descendants must be true or false", http.StatusBadRequest)
+			return
+		}
+	}
+	limit, offset, ok := pageParams(w, r)
+	if !ok {
+		return
+	}
+
+	ctx := context.Background()
+	category, err := categories.FindBySlug(ctx, h.DB, mux.Vars(r)["slug"])
+	if err != nil {
+		if errors.Is(err, categories.ErrNotFound) {
+			http.Error(w, "Category not found", http.StatusNotFound)
+		} else {
+			http.Error(w, "Failed to retrieve category", http.StatusInternalServerError)
+		}
+		return
+	}
+	products, total, err := categories.Products(ctx, h.DB, category.CategoryID, includeDescendants, limit, offset)
+	if err != nil {
+		http.Error(w, "Failed to retrieve products", http.StatusInternalServerError)
+		return
+	}
+	for i := range products {
+		images.SetProductURLs(h.Blobs, &products[i])
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(CategoryProductsResponse{Category: category, Products: products, Total: total})
+}
+
+// pageParams reads limit (default 20, at most 100) and offset from the query
+// string, writing an error response if they are invalid.
+func pageParams(w http.ResponseWriter, r *http.Request) (int, int, bool) {
+	limit, offset := 20, 0
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			http.Error(w, "limit must be a positive number", http.StatusBadRequest)
+			return 0, 0, false
+		}
+		limit = min(n, 100)
+	}
+	if v := r.URL.Query().Get("offset"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			http.Error(w, "offset must not be negative", http.StatusBadRequest)
+			return 0, 0, false
+		}
+		offset = n
+	}
+	return limit, offset, true
+}
@@ -0,0 +1,190 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gorilla/mux"
+	"github.com/hari134/pratilipi/pkg/audit"
+	"github.com/hari134/pratilipi/pkg/validation"
+	"github.com/hari134/pratilipi/productservice/internal/images"
+	"github.com/hari134/pratilipi/productservice/models"
+	"github.com/uptrace/bun"
+)
+
+const maxAltTextLength = 200
+
+// ReorderImagesRequest represents the request body for reordering the images
+// of a product. It must list each of the product's images once, main image first.
+type ReorderImagesRequest struct {
+	ImageIDs []int64 `json:"image_ids" validate:"required"`
+}
+
+// imagePath reads the product and, if present, image IDs from the URL,
+// writing an error response if they are invalid.
+func imagePath(w http.ResponseWriter, r *http.Request) (productID, imageID int64, ok bool) {
+	vars := mux.Vars(r)
+	productID, err := strconv.ParseInt(vars["product_id"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid product ID", http.StatusBadRequest)
+		return 0, 0, false
+	}
+	if v, present := vars["image_id"]; present {
+		if imageID, err = strconv.ParseInt(v, 10, 64); err != nil {
+			http.Error(w, "Invalid image ID", http.StatusBadRequest)
+			return 0, 0, false
+		}
+	}
+	return productID, imageID, true
+}
+
+// GetImagesHandler lists the images of a product, main image first.
+func (h *ProductAPIHandler) GetImagesHandler(w http.ResponseWriter, r *http.Request) {
+	productID, _, ok := imagePath(w, r)
+	if !ok {
+		return
+	}
+
+	ctx := context.Background()
+	if !h.productExists(ctx, w, productID) {
+		return
+	}
+	list, err := images.List(ctx, h.DB, h.Blobs, productID)
+	if err != nil {
+		http.Error(w, "Failed to retrieve images", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(list)
+}
+
+// UploadImageHandler adds an image to a product from a multipart form with the
+// file in "image" and an optional "alt_text". JPEG, PNG and GIF images of up
+// to images.MaxBytes are accepted; a thumbnail is made of each.
+func (h *ProductAPIHandler) UploadImageHandler(w http.ResponseWriter, r *http.Request) {
+	productID, _, ok := imagePath(w, r)
+	if !ok {
+		return
+	}
+
+	maxBytes := images.MaxBytes()
+	r.Body = http.MaxBytesReader(w, r.Body, maxBytes+1<<20) // Room for the other form fields
+	if err := r.ParseMultipartForm(1 << 20); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, "Image too large", http.StatusRequestEntityTooLarge)
+		} else {
+			http.Error(w, "Invalid multipart form", http.StatusBadRequest)
+		}
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	altText := strings.TrimSpace(r.FormValue("alt_text"))
+	if utf8.RuneCountInString(altText) > maxAltTextLength {
+		validation.WriteErrors(w, validation.Errors{"alt_text": "must be at most 200 characters"})
+		return
+	}
+	file, _, err := r.FormFile("image")
+	if err != nil {
+		validation.WriteErrors(w, validation.Errors{"image": "is required"})
+		return
+	}
+	defer file.Close()
+	data, err := io.ReadAll(io.LimitReader(file, maxBytes+1))
+	if err != nil {
+		http.Error(w, "Failed to read image", http.StatusBadRequest)
+		return
+	}
+
+	ctx := context.Background()
+	if !h.productExists(ctx, w, productID) {
+		return
+	}
+	img := &models.ProductImage{
+		ProductID: productID,
+		AltText:   altText,
+		CreatedBy: audit.ActorFromRequest(r),
+	}
+	if err := images.Upload(ctx, h.DB, h.Blobs, img, data); err != nil {
+		switch {
+		case errors.Is(err, images.ErrTooLarge):
+			http.Error(w, "Image too large", http.StatusRequestEntityTooLarge)
+		case errors.Is(err, images.ErrUnsupportedType):
+			http.Error(w, "Images must be JPEG, PNG or GIF", http.StatusUnsupportedMediaType)
+		case errors.Is(err, images.ErrInvalidImage):
+			validation.WriteErrors(w, validation.Errors{"image": "must be a valid image"})
+		default:
+			http.Error(w, "Failed to save image", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(img)
+}
+
+// ReorderImagesHandler sets the order of a product's images. The first one is
+// the product's main image.
+func (h *ProductAPIHandler) ReorderImagesHandler(w http.ResponseWriter, r *http.Request) {
+	var req ReorderImagesRequest
+	if !validation.Decode(w, r, &req) {
+		return
+	}
+	productID, _, ok := imagePath(w, r)
+	if !ok {
+		return
+	}
+
+	ctx := context.Background()
+	if !h.productExists(ctx, w, productID) {
+		return
+	}
+	err := h.DB.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		return images.Reorder(ctx, tx, productID, req.ImageIDs)
+	})
+	if errors.Is(err, images.ErrImageSet) {
+		validation.WriteErrors(w, validation.Errors{"image_ids": "must list each of the product's images once"})
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to reorder images", http.StatusInternalServerError)
+		return
+	}
+	list, err := images.List(ctx, h.DB, h.Blobs, productID)
+	if err != nil {
+		http.Error(w, "Failed to retrieve images", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(list)
+}
+
+// DeleteImageHandler removes an image of a product along with its files.
+func (h *ProductAPIHandler) DeleteImageHandler(w http.ResponseWriter, r *http.Request) {
+	productID, imageID, ok := imagePath(w, r)
+	if !ok {
+		return
+	}
+
+	err := images.Delete(context.Background(), h.DB, h.Blobs, productID, imageID)
+	if err != nil {
+		if errors.Is(err, images.ErrNotFound) {
+			http.Error(w, "Image not found", http.StatusNotFound)
+		} else {
+			http.Error(w, "Failed to delete image", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Image deleted successfully"})
+}
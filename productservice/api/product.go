@@ -4,38 +4,137 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
-	"log"
+	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
 	"time"
 
 	"github.com/gorilla/mux"
+	"github.com/hari134/pratilipi/pkg/audit"
+	"github.com/hari134/pratilipi/pkg/blobstore"
 	"github.com/hari134/pratilipi/pkg/db"
 	"github.com/hari134/pratilipi/pkg/messaging"
+	"github.com/hari134/pratilipi/pkg/validation"
+	"github.com/hari134/pratilipi/productservice/internal/alerts"
+	"github.com/hari134/pratilipi/productservice/internal/categories"
+	"github.com/hari134/pratilipi/productservice/internal/images"
+	"github.com/hari134/pratilipi/productservice/internal/search"
+	"github.com/hari134/pratilipi/productservice/internal/stock"
+	"github.com/hari134/pratilipi/productservice/internal/variants"
 	"github.com/hari134/pratilipi/productservice/models"
 	"github.com/hari134/pratilipi/productservice/producer"
+	"github.com/uptrace/bun"
 )
 
 type ProductAPIHandler struct {
 	DB       *db.DB
 	Producer *producer.ProducerManager
+	Blobs    blobstore.Store // Product images and their thumbnails
+}
+
+// ProductRequest represents the request body for creating or updating a product.
+// Updates leave the inventory alone; it is changed through UpdateInventoryHandler.
+// CategoryIDs replaces the product's categories; updates without it keep them.
+// Variants are only read on creation; a product with variants gets the sum of
+// their inventory instead of InventoryCount.
+type ProductRequest struct {
+	Name             string            `json:"name" validate:"required,max=200" normalize:"trim"`
+	Description      string            `json:"description" normalize:"trim"`
+	Price            float64           `json:"price" validate:"min=0,max=99999999.99"`
+	InventoryCount   int               `json:"inventorycount" validate:"min=0"`
+	ReorderThreshold *int              `json:"reorder_threshold" validate:"min=0,max=1000000"` // Left unchanged on update when omitted
+	CategoryIDs      []int64           `json:"category_ids"`
+	Variants         []*VariantRequest `json:"variants" validate:"max=100"`
+}
+
+// InventoryRequest represents the request body for setting a product's
+// inventory at a warehouse, by default the highest-priority active one.
+type InventoryRequest struct {
+	InventoryCount int   `json:"inventory_count" validate:"min=0"`
+	WarehouseID    int64 `json:"warehouse_id" validate:"min=0"`
 }
 
 // CreateProductHandler handles the creation of a new product and emits a ProductCreated event.
 func (h *ProductAPIHandler) CreateProductHandler(w http.ResponseWriter, r *http.Request) {
-	var product models.Product
-	
-	if err := json.NewDecoder(r.Body).Decode(&product); err != nil {
-		log.Println("marshalling error")
-		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+	var req ProductRequest
+	if !validation.Decode(w, r, &req) {
 		return
 	}
 
+	var productVariants []*models.ProductVariant
+	for i, v := range req.Variants {
+		variant := &models.ProductVariant{InventoryCount: v.InventoryCount}
+		if errs := v.apply(variant, fmt.Sprintf("variants[%d].", i)); errs != nil {
+			validation.WriteErrors(w, errs)
+			return
+		}
+		productVariants = append(productVariants, variant)
+	}
+
+	actorID := audit.ActorFromRequest(r)
+	product := models.Product{
+		Name:           req.Name,
+		Description:    req.Description,
+		Price:          req.Price,
+		InventoryCount: req.InventoryCount,
+	}
+	if req.ReorderThreshold != nil {
+		product.ReorderThreshold = *req.ReorderThreshold
+	}
+	// Start at the current level, so new products announce nothing
+	onHand := req.InventoryCount
+	if len(productVariants) > 0 {
+		onHand = 0
+		for _, v := range productVariants {
+			onHand += v.InventoryCount
+		}
+	}
+	product.StockStatus = alerts.Status(onHand, product.ReorderThreshold)
 	product.CreatedAt = time.Now()
 	product.UpdatedAt = time.Now()
+	product.CreatedBy = actorID
+	product.UpdatedBy = actorID
 
 	ctx := context.Background()
-	_, err := h.DB.NewInsert().Model(&product).Exec(ctx)
+	failedVariant := -1
+	err := h.DB.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		if _, err := tx.NewInsert().Model(&product).Exec(ctx); err != nil {
+			return err
+		}
+		if len(productVariants) == 0 {
+			if err := stock.Opening(ctx, tx, product.ProductID, 0, product.InventoryCount, actorID); err != nil {
+				return err
+			}
+		}
+		for i, variant := range productVariants {
+			variant.ProductID = product.ProductID
+			if err := variants.Save(ctx, tx, variant); err != nil {
+				failedVariant = i
+				return err
+			}
+			if err := stock.Opening(ctx, tx, product.ProductID, variant.VariantID, variant.InventoryCount, actorID); err != nil {
+				return err
+			}
+		}
+		return categories.SetProductCategories(ctx, tx, product.ProductID, req.CategoryIDs)
+	})
+	if errors.Is(err, categories.ErrNotFound) {
+		validation.WriteErrors(w, validation.Errors{"category_ids": "must be existing categories"})
+		return
+	}
+	if failedVariant >= 0 {
+		writeVariantError(w, err, fmt.Sprintf("variants[%d].", failedVariant))
+		return
+	}
+	if err == nil {
+		err = h.DB.NewSelect().Model(&product).
+			Relation("Categories").
+			Relation("Variants", variants.Ordered).
+			Relation("Images", images.Ordered).
+			WherePK().
+			Scan(ctx)
+	}
 	if err != nil {
 		http.Error(w, "Failed to create product", http.StatusInternalServerError)
 		return
@@ -49,6 +148,20 @@ func (h *ProductAPIHandler) CreateProductHandler(w http.ResponseWriter, r *http.
 		Price:          product.Price,
 		InventoryCount: product.InventoryCount,
 	}
+	for _, c := range product.Categories {
+		category := messaging.ProductCategory{
+			CategoryID: strconv.FormatInt(c.CategoryID, 10),
+			Name:       c.Name,
+			Slug:       c.Slug,
+		}
+		if c.ParentID != 0 {
+			category.ParentID = strconv.FormatInt(c.ParentID, 10)
+		}
+		event.Categories = append(event.Categories, category)
+	}
+	for i := range product.Variants {
+		event.Variants = append(event.Variants, variantEvent(&product.Variants[i]))
+	}
 
 	if err := h.Producer.EmitProductCreatedEvent(event); err != nil {
 		http.Error(w, "Failed to emit ProductCreated event", http.StatusInternalServerError)
@@ -64,10 +177,8 @@ func (h *ProductAPIHandler) UpdateProductHandler(w http.ResponseWriter, r *http.
 	vars := mux.Vars(r)
 	productID := vars["product_id"]
 
-	var productUpdate models.Product
-
-	if err := json.NewDecoder(r.Body).Decode(&productUpdate); err != nil {
-		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+	var productUpdate ProductRequest
+	if !validation.Decode(w, r, &productUpdate) {
 		return
 	}
 
@@ -83,20 +194,51 @@ func (h *ProductAPIHandler) UpdateProductHandler(w http.ResponseWriter, r *http.
 	product.Name = productUpdate.Name
 	product.Description = productUpdate.Description
 	product.Price = productUpdate.Price
+	if productUpdate.ReorderThreshold != nil {
+		product.ReorderThreshold = *productUpdate.ReorderThreshold
+	}
 	product.UpdatedAt = time.Now()
+	product.UpdatedBy = audit.ActorFromRequest(r)
 
-	_, err = h.DB.NewUpdate().Model(product).Where("product_id = ?", productID).Exec(ctx)
+	err = h.DB.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		if _, err := tx.NewUpdate().Model(product).Where("product_id = ?", productID).Exec(ctx); err != nil {
+			return err
+		}
+		if productUpdate.ReorderThreshold != nil {
+			if _, err := alerts.Evaluate(ctx, tx, product.ProductID, time.Now()); err != nil {
+				return err
+			}
+		}
+		if productUpdate.CategoryIDs == nil {
+			return nil
+		}
+		return categories.SetProductCategories(ctx, tx, product.ProductID, productUpdate.CategoryIDs)
+	})
+	if errors.Is(err, categories.ErrNotFound) {
+		validation.WriteErrors(w, validation.Errors{"category_ids": "must be existing categories"})
+		return
+	}
+	if err == nil {
+		err = h.DB.NewSelect().Model(product).
+			Relation("Categories").
+			Relation("Variants", variants.Ordered).
+			Relation("Images", images.Ordered).
+			WherePK().
+			Scan(ctx)
+	}
 	if err != nil {
 		http.Error(w, "Failed to update product", http.StatusInternalServerError)
 		return
 	}
-
+	images.SetProductURLs(h.Blobs, product)
 
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(product)
 }
 
-// DeleteProductHandler deletes a product and emits a ProductDeleted event.
+// DeleteProductHandler soft-deletes a product and emits a ProductDeleted event.
+// The row is kept so that order items referencing it stay valid; it can be
+// brought back with RestoreProductHandler.
 func (h *ProductAPIHandler) DeleteProductHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	productID := vars["product_id"]
@@ -109,56 +251,137 @@ func (h *ProductAPIHandler) DeleteProductHandler(w http.ResponseWriter, r *http.
 		return
 	}
 
-	_, err = h.DB.NewDelete().Model(product).Where("product_id = ?", productID).Exec(ctx)
+	product.UpdatedAt = time.Now()
+	product.UpdatedBy = audit.ActorFromRequest(r)
+	err = h.DB.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		_, err := tx.NewUpdate().Model(product).
+			Column("updated_at", "updated_by").
+			Where("product_id = ?", productID).
+			Exec(ctx)
+		if err != nil {
+			return err
+		}
+		_, err = tx.NewDelete().Model(product).Where("product_id = ?", productID).Exec(ctx)
+		return err
+	})
 	if err != nil {
 		http.Error(w, "Failed to delete product", http.StatusInternalServerError)
 		return
 	}
 
+	event := &messaging.ProductDeleted{
+		ProductID: strconv.FormatInt(product.ProductID, 10),
+		DeletedAt: time.Now(),
+	}
+	if err := h.Producer.EmitProductDeletedEvent(event); err != nil {
+		http.Error(w, "Failed to emit ProductDeleted event", http.StatusInternalServerError)
+		return
+	}
+
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]string{"message": "Product deleted successfully"})
 }
 
-// UpdateInventoryHandler updates the inventory of a product and emits an InventoryUpdated event.
-func (h *ProductAPIHandler) UpdateInventoryHandler(w http.ResponseWriter, r *http.Request) {
+// RestoreProductHandler restores a soft-deleted product and emits a ProductRestored event.
+func (h *ProductAPIHandler) RestoreProductHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	productID := vars["product_id"]
 
-	var inventoryUpdate struct {
-		InventoryCount int `json:"inventory_count"`
+	ctx := context.Background()
+	product := &models.Product{}
+	err := h.DB.NewSelect().Model(product).WhereDeleted().Where("product_id = ?", productID).Scan(ctx)
+	if err != nil {
+		http.Error(w, "Deleted product not found", http.StatusNotFound)
+		return
+	}
+
+	product.UpdatedAt = time.Now()
+	product.UpdatedBy = audit.ActorFromRequest(r)
+
+	_, err = h.DB.NewUpdate().Model(product).
+		Column("deleted_at", "updated_at", "updated_by").
+		WhereAllWithDeleted().
+		Where("product_id = ?", productID).
+		Exec(ctx)
+	if err != nil {
+		http.Error(w, "Failed to restore product", http.StatusInternalServerError)
+		return
+	}
+
+	event := &messaging.ProductRestored{
+		ProductID: strconv.FormatInt(product.ProductID, 10),
+	}
+	if err := h.Producer.EmitProductRestoredEvent(event); err != nil {
+		http.Error(w, "Failed to emit ProductRestored event", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(product)
+}
+
+// UpdateInventoryHandler sets the inventory of a product at a warehouse,
+// recording the difference as a stock adjustment, and emits an InventoryUpdated event.
+func (h *ProductAPIHandler) UpdateInventoryHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	productID, err := strconv.ParseInt(vars["product_id"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid product ID", http.StatusBadRequest)
+		return
 	}
 
-	if err := json.NewDecoder(r.Body).Decode(&inventoryUpdate); err != nil {
-		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+	var inventoryUpdate InventoryRequest
+	if !validation.Decode(w, r, &inventoryUpdate) {
 		return
 	}
 
 	ctx := context.Background()
 	product := &models.Product{}
-	err := h.DB.NewSelect().Model(product).Where("product_id = ?", productID).Scan(ctx)
+	err = h.DB.NewSelect().Model(product).Where("product_id = ?", productID).Scan(ctx)
 	if err != nil {
 		http.Error(w, "Product not found", http.StatusNotFound)
 		return
 	}
 
-	product.InventoryCount = inventoryUpdate.InventoryCount
-	product.UpdatedAt = time.Now()
-
-	_, err = h.DB.NewUpdate().Model(product).Where("product_id = ?", productID).Exec(ctx)
+	movement := &models.StockMovement{
+		ProductID:   productID,
+		WarehouseID: inventoryUpdate.WarehouseID,
+		Reason:      stock.ReasonAdjustment,
+		Note:        "Inventory set to " + strconv.Itoa(inventoryUpdate.InventoryCount),
+		CreatedBy:   audit.ActorFromRequest(r),
+	}
+	err = h.DB.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		if err := stock.Set(ctx, tx, movement, inventoryUpdate.InventoryCount); err != nil {
+			return err
+		}
+		_, err := alerts.Evaluate(ctx, tx, productID, time.Now())
+		return err
+	})
+	switch {
+	case errors.Is(err, stock.ErrHasVariants):
+		http.Error(w, "The product has variants; set the inventory of each variant", http.StatusConflict)
+		return
+	case errors.Is(err, stock.ErrWarehouseNotFound):
+		validation.WriteErrors(w, validation.Errors{"warehouse_id": "must be an existing warehouse"})
+		return
+	case errors.Is(err, stock.ErrInsufficientStock):
+		http.Error(w, "The inventory cannot go below the stock held by reservations", http.StatusConflict)
+		return
+	}
+	if err == nil {
+		err = h.DB.NewSelect().Model(product).WherePK().Scan(ctx)
+	}
 	if err != nil {
 		http.Error(w, "Failed to update inventory", http.StatusInternalServerError)
 		return
 	}
 
-	productIDStr := strconv.FormatInt(product.ProductID, 10)
-
 	// Emit the InventoryUpdated event to Kafka
-	event := &messaging.ProductInventoryUpdated{
-		ProductID:      productIDStr,
-		InventoryCount: product.InventoryCount,
+	event, err := stock.InventoryEvent(ctx, h.DB, productID, 0)
+	if err == nil {
+		err = h.Producer.EmitInventoryUpdatedEvent(event)
 	}
-
-	if err := h.Producer.EmitInventoryUpdatedEvent(event); err != nil {
+	if err != nil {
 		http.Error(w, "Failed to emit InventoryUpdated event", http.StatusInternalServerError)
 		return
 	}
@@ -183,7 +406,12 @@ func (h *ProductAPIHandler) GetProductByIdHandler(w http.ResponseWriter, r *http
 	// Fetch the product from the database
 	var product models.Product
 	ctx := context.Background()
-	err = h.DB.NewSelect().Model(&product).Where("product_id = ?", productID).Scan(ctx)
+	err = h.DB.NewSelect().Model(&product).
+		Relation("Categories").
+		Relation("Variants", variants.Ordered).
+		Relation("Images", images.Ordered).
+		Where("p.product_id = ?", productID).
+		Scan(ctx)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			http.Error(w, "Product not found", http.StatusNotFound)
@@ -192,6 +420,7 @@ func (h *ProductAPIHandler) GetProductByIdHandler(w http.ResponseWriter, r *http
 		}
 		return
 	}
+	images.SetProductURLs(h.Blobs, &product)
 
 	// Return the product as JSON
 	w.WriteHeader(http.StatusOK)
@@ -203,13 +432,42 @@ func (h *ProductAPIHandler) GetProductsHandler(w http.ResponseWriter, r *http.Re
 	// Fetch all products from the database
 	var products []models.Product
 	ctx := context.Background()
-	err := h.DB.NewSelect().Model(&products).Scan(ctx)
+	err := h.DB.NewSelect().Model(&products).
+		Relation("Categories").
+		Relation("Variants", variants.Ordered).
+		Relation("Images", images.Ordered).
+		Scan(ctx)
 	if err != nil {
 		http.Error(w, "Failed to retrieve products", http.StatusInternalServerError)
 		return
 	}
+	for i := range products {
+		images.SetProductURLs(h.Blobs, &products[i])
+	}
 
 	// Return the list of products as JSON
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(products)
 }
+
+// SearchProductsHandler searches products by name and description, with
+// filters, sorting, facet counts and pagination taken from the query string.
+func (h *ProductAPIHandler) SearchProductsHandler(w http.ResponseWriter, r *http.Request) {
+	params, err := search.ParamsFromQuery(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	result, err := search.Search(context.Background(), h.DB, params)
+	if err != nil {
+		http.Error(w, "Failed to search products", http.StatusInternalServerError)
+		return
+	}
+	for i := range result.Products {
+		images.SetProductURLs(h.Blobs, &result.Products[i])
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(result)
+}
@@ -0,0 +1,242 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/hari134/pratilipi/pkg/audit"
+	"github.com/hari134/pratilipi/pkg/db"
+	"github.com/hari134/pratilipi/pkg/validation"
+	"github.com/hari134/pratilipi/productservice/internal/alerts"
+	"github.com/hari134/pratilipi/productservice/internal/reservations"
+	"github.com/hari134/pratilipi/productservice/internal/stock"
+	"github.com/hari134/pratilipi/productservice/models"
+	"github.com/hari134/pratilipi/productservice/producer"
+	"github.com/uptrace/bun"
+)
+
+// ReservationAPIHandler holds stock for orders. Its routes are meant for the
+// Order Service, using a service token with the inventory:reserve permission.
+type ReservationAPIHandler struct {
+	DB       *db.DB
+	Producer *producer.ProducerManager
+}
+
+// ReservationRequest represents the request body for holding stock. The
+// reference is typically the order ID; confirming the reservation records its
+// stock movements under it, so a later order-placed event for the same order
+// does not take the stock twice.
+type ReservationRequest struct {
+	ReferenceID string                    `json:"reference_id" validate:"required,max=100" normalize:"trim"`
+	TTLSeconds  int                       `json:"ttl_seconds" validate:"min=0"` // Defaults to RESERVATION_TTL
+	Items       []*ReservationItemRequest `json:"items" validate:"required,max=100"`
+}
+
+// ReservationItemRequest is a product or variant to hold.
+type ReservationItemRequest struct {
+	ProductID int64 `json:"product_id" validate:"required"`
+	VariantID int64 `json:"variant_id"` // Required for products with variants
+	Quantity  int   `json:"quantity" validate:"min=1,max=10000"`
+}
+
+// reservationID reads the reservation ID from the URL, writing an error
+// response if it is invalid.
+func reservationID(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	id, err := strconv.ParseInt(mux.Vars(r)["reservation_id"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid reservation ID", http.StatusBadRequest)
+		return 0, false
+	}
+	return id, true
+}
+
+// writeReservationError writes the response for a failure to change a reservation.
+func writeReservationError(w http.ResponseWriter, res *models.StockReservation, err error) {
+	switch {
+	case errors.Is(err, reservations.ErrNotFound):
+		http.Error(w, "Reservation not found", http.StatusNotFound)
+	case errors.Is(err, reservations.ErrNotHeld):
+		http.Error(w, "The reservation is already "+res.Status, http.StatusConflict)
+	case errors.Is(err, reservations.ErrExpired):
+		http.Error(w, "The reservation expired", http.StatusConflict)
+	case errors.Is(err, stock.ErrInsufficientStock):
+		http.Error(w, "Not enough stock on hand to confirm the reservation", http.StatusConflict)
+	default:
+		http.Error(w, "Failed to update reservation", http.StatusInternalServerError)
+	}
+}
+
+// CreateReservationHandler holds stock for a reference until the reservation
+// is confirmed, released or expires. Every item must be available to sell.
+func (h *ReservationAPIHandler) CreateReservationHandler(w http.ResponseWriter, r *http.Request) {
+	var req ReservationRequest
+	if !validation.Decode(w, r, &req) {
+		return
+	}
+	ttl := reservations.DefaultTTL()
+	if req.TTLSeconds > 0 {
+		ttl = time.Duration(req.TTLSeconds) * time.Second
+	}
+	if ttl > reservations.MaxTTL {
+		validation.WriteErrors(w, validation.Errors{"ttl_seconds": fmt.Sprintf("must be at most %d", int(reservations.MaxTTL.Seconds()))})
+		return
+	}
+
+	res := &models.StockReservation{ReferenceID: req.ReferenceID, CreatedBy: audit.ActorFromRequest(r)}
+	for _, item := range req.Items {
+		res.Items = append(res.Items, models.StockReservationItem{
+			ProductID: item.ProductID,
+			VariantID: item.VariantID,
+			Quantity:  item.Quantity,
+		})
+	}
+	ctx := context.Background()
+	err := h.DB.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		return reservations.Reserve(ctx, tx, res, ttl)
+	})
+	if err != nil {
+		var insufficient *reservations.InsufficientStockError
+		switch {
+		case errors.As(err, &insufficient):
+			http.Error(w, fmt.Sprintf("Not enough stock for items[%d]: %d available", insufficient.Index, insufficient.Available), http.StatusConflict)
+		case errors.Is(err, reservations.ErrReferenceHeld):
+			http.Error(w, "The reference already holds a reservation", http.StatusConflict)
+		case errors.Is(err, reservations.ErrNotFound), errors.Is(err, stock.ErrNotFound):
+			validation.WriteErrors(w, validation.Errors{"items": "must be existing products and variants"})
+		case errors.Is(err, stock.ErrHasVariants):
+			validation.WriteErrors(w, validation.Errors{"items": "must name a variant_id for products with variants"})
+		case errors.Is(err, reservations.ErrDuplicateItem):
+			validation.WriteErrors(w, validation.Errors{"items": "must not list a product or variant twice"})
+		default:
+			http.Error(w, "Failed to reserve stock", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(res)
+}
+
+// GetReservationHandler returns a reservation with its items.
+func (h *ReservationAPIHandler) GetReservationHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := reservationID(w, r)
+	if !ok {
+		return
+	}
+
+	res, err := reservations.Find(context.Background(), h.DB, id)
+	if err != nil {
+		writeReservationError(w, res, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(res)
+}
+
+// ConfirmReservationHandler takes a held reservation's stock off hand and
+// emits an InventoryUpdated event for each item.
+func (h *ReservationAPIHandler) ConfirmReservationHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := reservationID(w, r)
+	if !ok {
+		return
+	}
+
+	var res *models.StockReservation
+	var taken []models.StockReservationItem
+	ctx := context.Background()
+	err := h.DB.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		var err error
+		res, taken, err = reservations.Confirm(ctx, tx, id, audit.ActorFromRequest(r))
+		if err != nil {
+			return err
+		}
+		checked := map[int64]bool{}
+		for _, item := range taken {
+			if checked[item.ProductID] {
+				continue
+			}
+			checked[item.ProductID] = true
+			if _, err := alerts.Evaluate(ctx, tx, item.ProductID, time.Now()); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		writeReservationError(w, res, err)
+		return
+	}
+
+	for _, item := range taken {
+		event, err := stock.InventoryEvent(ctx, h.DB, item.ProductID, item.VariantID)
+		if err == nil {
+			err = h.Producer.EmitInventoryUpdatedEvent(event)
+		}
+		if err != nil {
+			http.Error(w, "Failed to emit InventoryUpdated event", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(res)
+}
+
+// ReleaseReservationHandler gives a held reservation's stock back to sell and
+// emits a StockReservationReleased event. If the event cannot be emitted now,
+// the reservation sweeper retries it.
+func (h *ReservationAPIHandler) ReleaseReservationHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := reservationID(w, r)
+	if !ok {
+		return
+	}
+
+	var res *models.StockReservation
+	ctx := context.Background()
+	err := h.DB.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		var err error
+		res, err = reservations.Release(ctx, tx, id)
+		return err
+	})
+	if err != nil {
+		writeReservationError(w, res, err)
+		return
+	}
+
+	if err := reservations.PublishReleases(ctx, h.DB, h.Producer); err != nil {
+		log.Printf("Failed to emit StockReservationReleased event for reservation %d, the sweeper retries it: %v", res.ReservationID, err)
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(res)
+}
+
+// GetAvailabilityHandler returns a product's stock on hand, reserved and
+// available to sell, with the same figures for each of its variants.
+func (h *ProductAPIHandler) GetAvailabilityHandler(w http.ResponseWriter, r *http.Request) {
+	productID, _, ok := variantPath(w, r)
+	if !ok {
+		return
+	}
+
+	availability, err := reservations.ProductAvailability(context.Background(), h.DB, productID)
+	if err != nil {
+		if errors.Is(err, reservations.ErrNotFound) {
+			http.Error(w, "Product not found", http.StatusNotFound)
+		} else {
+			http.Error(w, "Failed to retrieve availability", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(availability)
+}
@@ -0,0 +1,171 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/hari134/pratilipi/pkg/audit"
+	"github.com/hari134/pratilipi/pkg/validation"
+	"github.com/hari134/pratilipi/productservice/internal/alerts"
+	"github.com/hari134/pratilipi/productservice/internal/stock"
+	"github.com/hari134/pratilipi/productservice/internal/variants"
+	"github.com/hari134/pratilipi/productservice/models"
+	"github.com/uptrace/bun"
+)
+
+// StockMovementRequest represents the request body for posting a stock
+// movement. Orders and opening stock are recorded by the service itself.
+type StockMovementRequest struct {
+	VariantID   int64  `json:"variant_id"`                    // Required for products with variants
+	WarehouseID int64  `json:"warehouse_id" validate:"min=0"` // Defaults to the highest-priority active warehouse
+	Delta       int    `json:"delta" validate:"required,min=-1000000,max=1000000"`
+	Reason      string `json:"reason" validate:"required,oneof=restock adjustment return" normalize:"trim,lower"`
+	ReferenceID string `json:"reference_id" validate:"max=100" normalize:"trim"`
+	Note        string `json:"note" validate:"max=500" normalize:"trim"`
+}
+
+// StockHistoryResponse is one page of a product's stock movements.
+type StockHistoryResponse struct {
+	Movements []models.StockMovement `json:"movements"`
+	Total     int                    `json:"total"`
+}
+
+// StockCheckResponse lists the products and variants whose inventory does not
+// match their stock ledger.
+type StockCheckResponse struct {
+	Consistent    bool                `json:"consistent"`
+	Discrepancies []stock.Discrepancy `json:"discrepancies"`
+}
+
+// PostStockMovementHandler records a restock, adjustment or return of a
+// product or variant and emits an InventoryUpdated event.
+func (h *ProductAPIHandler) PostStockMovementHandler(w http.ResponseWriter, r *http.Request) {
+	var req StockMovementRequest
+	if !validation.Decode(w, r, &req) {
+		return
+	}
+	productID, _, ok := variantPath(w, r)
+	if !ok {
+		return
+	}
+
+	ctx := context.Background()
+	if !h.productExists(ctx, w, productID) {
+		return
+	}
+	if req.VariantID != 0 {
+		if _, err := variants.Find(ctx, h.DB, productID, req.VariantID); err != nil {
+			writeVariantError(w, err, "")
+			return
+		}
+	}
+	movement := &models.StockMovement{
+		ProductID:   productID,
+		VariantID:   req.VariantID,
+		WarehouseID: req.WarehouseID,
+		Delta:       req.Delta,
+		Reason:      req.Reason,
+		ReferenceID: req.ReferenceID,
+		Note:        req.Note,
+		CreatedBy:   audit.ActorFromRequest(r),
+	}
+	err := h.DB.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		if err := stock.Record(ctx, tx, movement); err != nil {
+			return err
+		}
+		_, err := alerts.Evaluate(ctx, tx, productID, time.Now())
+		return err
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, stock.ErrInsufficientStock):
+			http.Error(w, "Not enough stock for this movement; reserved stock cannot be taken", http.StatusConflict)
+		case errors.Is(err, stock.ErrHasVariants):
+			validation.WriteErrors(w, validation.Errors{"variant_id": "is required for products with variants"})
+		case errors.Is(err, stock.ErrWarehouseNotFound):
+			validation.WriteErrors(w, validation.Errors{"warehouse_id": "must be an existing warehouse"})
+		default:
+			http.Error(w, "Failed to record stock movement", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	event, err := stock.InventoryEvent(ctx, h.DB, productID, movement.VariantID)
+	if err == nil {
+		err = h.Producer.EmitInventoryUpdatedEvent(event)
+	}
+	if err != nil {
+		http.Error(w, "Failed to emit InventoryUpdated event", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(movement)
+}
+
+// GetStockMovementsHandler lists a product's stock movements, newest first.
+// The query string may filter them by variant_id, warehouse_id and reason.
+func (h *ProductAPIHandler) GetStockMovementsHandler(w http.ResponseWriter, r *http.Request) {
+	productID, _, ok := variantPath(w, r)
+	if !ok {
+		return
+	}
+	limit, offset, ok := pageParams(w, r)
+	if !ok {
+		return
+	}
+	filter := stock.HistoryFilter{ProductID: productID, Reason: r.URL.Query().Get("reason"), Limit: limit, Offset: offset}
+	if v := r.URL.Query().Get("variant_id"); v != "" {
+		var err error
+		if filter.VariantID, err = strconv.ParseInt(v, 10, 64); err != nil {
+			http.Error(w, "Invalid variant ID", http.StatusBadRequest)
+			return
+		}
+	}
+	if v := r.URL.Query().Get("warehouse_id"); v != "" {
+		var err error
+		if filter.WarehouseID, err = strconv.ParseInt(v, 10, 64); err != nil {
+			http.Error(w, "Invalid warehouse ID", http.StatusBadRequest)
+			return
+		}
+	}
+
+	ctx := context.Background()
+	if !h.productExists(ctx, w, productID) {
+		return
+	}
+	movements, total, err := stock.History(ctx, h.DB, filter)
+	if err != nil {
+		http.Error(w, "Failed to retrieve stock movements", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(StockHistoryResponse{Movements: movements, Total: total})
+}
+
+// CheckStockHandler compares the inventory of every product and variant, or
+// of the one product named by product_id, with its stock ledger.
+func (h *ProductAPIHandler) CheckStockHandler(w http.ResponseWriter, r *http.Request) {
+	var productID int64
+	if v := r.URL.Query().Get("product_id"); v != "" {
+		var err error
+		if productID, err = strconv.ParseInt(v, 10, 64); err != nil {
+			http.Error(w, "Invalid product ID", http.StatusBadRequest)
+			return
+		}
+	}
+
+	discrepancies, err := stock.Check(context.Background(), h.DB, productID)
+	if err != nil {
+		http.Error(w, "Failed to check inventory", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(StockCheckResponse{Consistent: len(discrepancies) == 0, Discrepancies: discrepancies})
+}
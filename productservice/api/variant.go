@@ -0,0 +1,324 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/hari134/pratilipi/pkg/audit"
+	"github.com/hari134/pratilipi/pkg/messaging"
+	"github.com/hari134/pratilipi/pkg/validation"
+	"github.com/hari134/pratilipi/productservice/internal/alerts"
+	"github.com/hari134/pratilipi/productservice/internal/stock"
+	"github.com/hari134/pratilipi/productservice/internal/variants"
+	"github.com/hari134/pratilipi/productservice/models"
+	"github.com/uptrace/bun"
+)
+
+// VariantRequest represents the request body for creating or updating a
+// variant. Updates leave the inventory alone; it is changed through
+// UpdateVariantInventoryHandler.
+type VariantRequest struct {
+	SKU            string            `json:"sku" validate:"required,max=64" normalize:"trim,upper"`
+	Attributes     map[string]string `json:"attributes"` // e.g. {"color": "red", "size": "m"}
+	Price          float64           `json:"price" validate:"min=0,max=99999999.99"`
+	InventoryCount int               `json:"inventory_count" validate:"min=0"`
+	Position       int               `json:"position"`
+}
+
+// apply copies the request onto a variant, returning field errors for
+// invalid attributes. field is the request field holding the variant.
+func (req *VariantRequest) apply(variant *models.ProductVariant, field string) validation.Errors {
+	attributes, msg := variants.NormalizeAttributes(req.Attributes)
+	if msg != "" {
+		return validation.Errors{field + "attributes": msg}
+	}
+	variant.SKU = req.SKU
+	variant.Attributes = attributes
+	variant.Price = req.Price
+	variant.Position = req.Position
+	return nil
+}
+
+// writeVariantError writes the response for a failure to save a variant.
+// field is the request field holding the variant.
+func writeVariantError(w http.ResponseWriter, err error, field string) {
+	switch {
+	case errors.Is(err, variants.ErrInvalidSKU):
+		validation.WriteErrors(w, validation.Errors{field + "sku": "must be uppercase letters and digits joined by hyphens, underscores or dots, e.g. TSHIRT-RED-M"})
+	case errors.Is(err, variants.ErrSKUTaken):
+		http.Error(w, "Another variant already uses this SKU", http.StatusConflict)
+	case errors.Is(err, variants.ErrDuplicateAttributes):
+		http.Error(w, "Another variant of the product has the same attributes", http.StatusConflict)
+	case errors.Is(err, variants.ErrNotFound):
+		http.Error(w, "Variant not found", http.StatusNotFound)
+	default:
+		http.Error(w, "Failed to save variant", http.StatusInternalServerError)
+	}
+}
+
+// variantEvent returns the variant as carried by product events.
+func variantEvent(v *models.ProductVariant) messaging.ProductVariant {
+	return messaging.ProductVariant{
+		VariantID:      strconv.FormatInt(v.VariantID, 10),
+		ProductID:      strconv.FormatInt(v.ProductID, 10),
+		SKU:            v.SKU,
+		Attributes:     v.Attributes,
+		Price:          v.Price,
+		InventoryCount: v.InventoryCount,
+	}
+}
+
+// variantPath reads the product and, if present, variant IDs from the URL,
+// writing an error response if they are invalid.
+func variantPath(w http.ResponseWriter, r *http.Request) (productID, variantID int64, ok bool) {
+	vars := mux.Vars(r)
+	productID, err := strconv.ParseInt(vars["product_id"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid product ID", http.StatusBadRequest)
+		return 0, 0, false
+	}
+	if v, present := vars["variant_id"]; present {
+		if variantID, err = strconv.ParseInt(v, 10, 64); err != nil {
+			http.Error(w, "Invalid variant ID", http.StatusBadRequest)
+			return 0, 0, false
+		}
+	}
+	return productID, variantID, true
+}
+
+// productExists writes a 404 response and returns false if the product does not exist.
+func (h *ProductAPIHandler) productExists(ctx context.Context, w http.ResponseWriter, productID int64) bool {
+	exists, err := h.DB.NewSelect().Model((*models.Product)(nil)).Where("p.product_id = ?", productID).Exists(ctx)
+	if err != nil {
+		http.Error(w, "Failed to retrieve product", http.StatusInternalServerError)
+		return false
+	}
+	if !exists {
+		http.Error(w, "Product not found", http.StatusNotFound)
+	}
+	return exists
+}
+
+// GetVariantsHandler lists the variants of a product.
+func (h *ProductAPIHandler) GetVariantsHandler(w http.ResponseWriter, r *http.Request) {
+	productID, _, ok := variantPath(w, r)
+	if !ok {
+		return
+	}
+
+	ctx := context.Background()
+	if !h.productExists(ctx, w, productID) {
+		return
+	}
+	list, err := variants.List(ctx, h.DB, productID)
+	if err != nil {
+		http.Error(w, "Failed to retrieve variants", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(list)
+}
+
+// CreateVariantHandler adds a variant to a product and emits a ProductVariantUpdated
+// event. The product's inventory becomes the sum of its variants' inventory.
+func (h *ProductAPIHandler) CreateVariantHandler(w http.ResponseWriter, r *http.Request) {
+	var req VariantRequest
+	if !validation.Decode(w, r, &req) {
+		return
+	}
+	productID, _, ok := variantPath(w, r)
+	if !ok {
+		return
+	}
+
+	ctx := context.Background()
+	if !h.productExists(ctx, w, productID) {
+		return
+	}
+	variant := &models.ProductVariant{ProductID: productID, InventoryCount: req.InventoryCount}
+	if errs := req.apply(variant, ""); errs != nil {
+		validation.WriteErrors(w, errs)
+		return
+	}
+	actorID := audit.ActorFromRequest(r)
+	err := h.DB.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		// The first variant takes over the product's stock, so clear the product's own
+		hasVariants, err := variants.HasVariants(ctx, tx, productID)
+		if err != nil {
+			return err
+		}
+		if !hasVariants {
+			movement := &models.StockMovement{
+				ProductID: productID,
+				Reason:    stock.ReasonAdjustment,
+				Note:      "Stock moved to the product's variants",
+				CreatedBy: actorID,
+			}
+			if err := stock.Clear(ctx, tx, movement); err != nil {
+				return err
+			}
+		}
+		if err := variants.Save(ctx, tx, variant); err != nil {
+			return err
+		}
+		if err := stock.Opening(ctx, tx, productID, variant.VariantID, variant.InventoryCount, actorID); err != nil {
+			return err
+		}
+		_, err = alerts.Evaluate(ctx, tx, productID, time.Now())
+		return err
+	})
+	if err != nil {
+		writeVariantError(w, err, "")
+		return
+	}
+
+	event := &messaging.ProductVariantUpdated{ProductVariant: variantEvent(variant), UpdatedAt: variant.UpdatedAt}
+	if err := h.Producer.EmitProductVariantUpdatedEvent(event); err != nil {
+		http.Error(w, "Failed to emit ProductVariantUpdated event", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(variant)
+}
+
+// UpdateVariantHandler changes a variant's SKU, attributes, price or position
+// and emits a ProductVariantUpdated event.
+func (h *ProductAPIHandler) UpdateVariantHandler(w http.ResponseWriter, r *http.Request) {
+	var req VariantRequest
+	if !validation.Decode(w, r, &req) {
+		return
+	}
+	productID, variantID, ok := variantPath(w, r)
+	if !ok {
+		return
+	}
+
+	ctx := context.Background()
+	variant, err := variants.Find(ctx, h.DB, productID, variantID)
+	if err != nil {
+		writeVariantError(w, err, "")
+		return
+	}
+	if errs := req.apply(variant, ""); errs != nil {
+		validation.WriteErrors(w, errs)
+		return
+	}
+	if err := variants.Save(ctx, h.DB, variant); err != nil {
+		writeVariantError(w, err, "")
+		return
+	}
+
+	event := &messaging.ProductVariantUpdated{ProductVariant: variantEvent(variant), UpdatedAt: variant.UpdatedAt}
+	if err := h.Producer.EmitProductVariantUpdatedEvent(event); err != nil {
+		http.Error(w, "Failed to emit ProductVariantUpdated event", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(variant)
+}
+
+// DeleteVariantHandler soft-deletes a variant and emits a ProductVariantDeleted
+// event. Orders keep referring to it, but it can no longer be ordered.
+func (h *ProductAPIHandler) DeleteVariantHandler(w http.ResponseWriter, r *http.Request) {
+	productID, variantID, ok := variantPath(w, r)
+	if !ok {
+		return
+	}
+
+	ctx := context.Background()
+	err := h.DB.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		return variants.Delete(ctx, tx, productID, variantID)
+	})
+	if err != nil {
+		if errors.Is(err, variants.ErrNotFound) {
+			http.Error(w, "Variant not found", http.StatusNotFound)
+		} else {
+			http.Error(w, "Failed to delete variant", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	event := &messaging.ProductVariantDeleted{
+		VariantID: strconv.FormatInt(variantID, 10),
+		ProductID: strconv.FormatInt(productID, 10),
+		DeletedAt: time.Now(),
+	}
+	if err := h.Producer.EmitProductVariantDeletedEvent(event); err != nil {
+		http.Error(w, "Failed to emit ProductVariantDeleted event", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Variant deleted successfully"})
+}
+
+// UpdateVariantInventoryHandler sets the inventory of a variant at a warehouse,
+// recording the difference as a stock adjustment, and emits an InventoryUpdated
+// event for it.
+func (h *ProductAPIHandler) UpdateVariantInventoryHandler(w http.ResponseWriter, r *http.Request) {
+	var req InventoryRequest
+	if !validation.Decode(w, r, &req) {
+		return
+	}
+	productID, variantID, ok := variantPath(w, r)
+	if !ok {
+		return
+	}
+
+	ctx := context.Background()
+	variant, err := variants.Find(ctx, h.DB, productID, variantID)
+	if err != nil {
+		writeVariantError(w, err, "")
+		return
+	}
+	movement := &models.StockMovement{
+		ProductID:   productID,
+		VariantID:   variantID,
+		WarehouseID: req.WarehouseID,
+		Reason:      stock.ReasonAdjustment,
+		Note:        "Inventory set to " + strconv.Itoa(req.InventoryCount),
+		CreatedBy:   audit.ActorFromRequest(r),
+	}
+	err = h.DB.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		if err := stock.Set(ctx, tx, movement, req.InventoryCount); err != nil {
+			return err
+		}
+		_, err := alerts.Evaluate(ctx, tx, productID, time.Now())
+		return err
+	})
+	if errors.Is(err, stock.ErrWarehouseNotFound) {
+		validation.WriteErrors(w, validation.Errors{"warehouse_id": "must be an existing warehouse"})
+		return
+	}
+	if errors.Is(err, stock.ErrInsufficientStock) {
+		http.Error(w, "The inventory cannot go below the stock held by reservations", http.StatusConflict)
+		return
+	}
+	if err == nil {
+		variant, err = variants.Find(ctx, h.DB, productID, variantID)
+	}
+	if err != nil {
+		http.Error(w, "Failed to update inventory", http.StatusInternalServerError)
+		return
+	}
+
+	event, err := stock.InventoryEvent(ctx, h.DB, productID, variantID)
+	if err == nil {
+		err = h.Producer.EmitInventoryUpdatedEvent(event)
+	}
+	if err != nil {
+		http.Error(w, "Failed to emit InventoryUpdated event", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(variant)
+}
@@ -0,0 +1,233 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/hari134/pratilipi/pkg/audit"
+	"github.com/hari134/pratilipi/pkg/db"
+	"github.com/hari134/pratilipi/pkg/validation"
+	"github.com/hari134/pratilipi/productservice/internal/stock"
+	"github.com/hari134/pratilipi/productservice/internal/variants"
+	"github.com/hari134/pratilipi/productservice/internal/warehouses"
+	"github.com/hari134/pratilipi/productservice/models"
+	"github.com/hari134/pratilipi/productservice/producer"
+	"github.com/uptrace/bun"
+)
+
+type WarehouseAPIHandler struct {
+	DB       *db.DB
+	Producer *producer.ProducerManager
+}
+
+// WarehouseRequest represents the request body for creating or updating a
+// warehouse. Warehouses are created active.
+type WarehouseRequest struct {
+	Code       string `json:"code" validate:"required,max=32" normalize:"trim,upper"`
+	Name       string `json:"name" validate:"required,max=100" normalize:"trim"`
+	Country    string `json:"country" validate:"required,min=2,max=2" normalize:"trim,upper"`
+	PostalCode string `json:"postal_code" validate:"max=20" normalize:"trim"`
+	Priority   int    `json:"priority"`
+	Active     *bool  `json:"active"` // Left unchanged when omitted
+}
+
+// TransferRequest represents the request body for moving stock between warehouses.
+type TransferRequest struct {
+	ProductID       int64  `json:"product_id" validate:"required"`
+	VariantID       int64  `json:"variant_id"` // Required for products with variants
+	FromWarehouseID int64  `json:"from_warehouse_id" validate:"required"`
+	ToWarehouseID   int64  `json:"to_warehouse_id" validate:"required"`
+	Quantity        int    `json:"quantity" validate:"min=1,max=1000000"`
+	ReferenceID     string `json:"reference_id" validate:"max=100" normalize:"trim"` // Generated when omitted
+	Note            string `json:"note" validate:"max=500" normalize:"trim"`
+}
+
+// GetWarehousesHandler lists all warehouses in priority order.
+func (h *WarehouseAPIHandler) GetWarehousesHandler(w http.ResponseWriter, r *http.Request) {
+	list, err := warehouses.List(context.Background(), h.DB)
+	if err != nil {
+		http.Error(w, "Failed to retrieve warehouses", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(list)
+}
+
+// CreateWarehouseHandler adds a warehouse.
+func (h *WarehouseAPIHandler) CreateWarehouseHandler(w http.ResponseWriter, r *http.Request) {
+	var req WarehouseRequest
+	if !validation.Decode(w, r, &req) {
+		return
+	}
+
+	warehouse := &models.Warehouse{
+		Code:       req.Code,
+		Name:       req.Name,
+		Country:    req.Country,
+		PostalCode: req.PostalCode,
+		Priority:   req.Priority,
+		Active:     req.Active == nil || *req.Active,
+	}
+	if !h.save(w, warehouse) {
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(warehouse)
+}
+
+// UpdateWarehouseHandler renames, moves, reprioritizes or (de)activates a
+// warehouse. Inactive warehouses keep their stock but are not allocated from.
+func (h *WarehouseAPIHandler) UpdateWarehouseHandler(w http.ResponseWriter, r *http.Request) {
+	var req WarehouseRequest
+	if !validation.Decode(w, r, &req) {
+		return
+	}
+	warehouseID, err := strconv.ParseInt(mux.Vars(r)["warehouse_id"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid warehouse ID", http.StatusBadRequest)
+		return
+	}
+
+	warehouse, err := warehouses.Find(context.Background(), h.DB, warehouseID)
+	if err != nil {
+		if errors.Is(err, warehouses.ErrNotFound) {
+			http.Error(w, "Warehouse not found", http.StatusNotFound)
+		} else {
+			http.Error(w, "Failed to retrieve warehouse", http.StatusInternalServerError)
+		}
+		return
+	}
+	warehouse.Code, warehouse.Name, warehouse.Country, warehouse.PostalCode, warehouse.Priority =
+		req.Code, req.Name, req.Country, req.PostalCode, req.Priority
+	if req.Active != nil {
+		warehouse.Active = *req.Active
+	}
+	if !h.save(w, warehouse) {
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(warehouse)
+}
+
+// save stores the warehouse, writing an error response if that fails.
+func (h *WarehouseAPIHandler) save(w http.ResponseWriter, warehouse *models.Warehouse) bool {
+	err := h.DB.RunInTx(context.Background(), nil, func(ctx context.Context, tx bun.Tx) error {
+		return warehouses.Save(ctx, tx, warehouse)
+	})
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, warehouses.ErrInvalidCode):
+		validation.WriteErrors(w, validation.Errors{"code": "must be uppercase letters and digits joined by hyphens, e.g. BLR-1"})
+	case errors.Is(err, warehouses.ErrCodeTaken):
+		http.Error(w, "Another warehouse already uses this code", http.StatusConflict)
+	case errors.Is(err, warehouses.ErrLastActive):
+		http.Error(w, "At least one warehouse must stay active", http.StatusConflict)
+	case errors.Is(err, warehouses.ErrNotFound):
+		http.Error(w, "Warehouse not found", http.StatusNotFound)
+	default:
+		http.Error(w, "Failed to save warehouse", http.StatusInternalServerError)
+	}
+	return false
+}
+
+// TransferStockHandler moves stock of a product or variant from one warehouse
+// to another and emits an InventoryUpdated event with the new per-warehouse
+// counts. The total inventory does not change.
+func (h *WarehouseAPIHandler) TransferStockHandler(w http.ResponseWriter, r *http.Request) {
+	var req TransferRequest
+	if !validation.Decode(w, r, &req) {
+		return
+	}
+
+	ctx := context.Background()
+	if req.VariantID != 0 {
+		if _, err := variants.Find(ctx, h.DB, req.ProductID, req.VariantID); err != nil {
+			if errors.Is(err, variants.ErrNotFound) {
+				validation.WriteErrors(w, validation.Errors{"variant_id": "must be a variant of the product"})
+			} else {
+				http.Error(w, "Failed to retrieve variant", http.StatusInternalServerError)
+			}
+			return
+		}
+	}
+	for i, id := range []int64{req.FromWarehouseID, req.ToWarehouseID} {
+		if _, err := warehouses.Find(ctx, h.DB, id); err != nil {
+			field := [...]string{"from_warehouse_id", "to_warehouse_id"}[i]
+			if errors.Is(err, warehouses.ErrNotFound) {
+				validation.WriteErrors(w, validation.Errors{field: "must be an existing warehouse"})
+			} else {
+				http.Error(w, "Failed to retrieve warehouse", http.StatusInternalServerError)
+			}
+			return
+		}
+	}
+	tmpl := &models.StockMovement{
+		ProductID:   req.ProductID,
+		VariantID:   req.VariantID,
+		ReferenceID: req.ReferenceID,
+		Note:        req.Note,
+		CreatedBy:   audit.ActorFromRequest(r),
+	}
+	var movements []*models.StockMovement
+	err := h.DB.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		var err error
+		movements, err = stock.Transfer(ctx, tx, tmpl, req.FromWarehouseID, req.ToWarehouseID, req.Quantity)
+		return err
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, stock.ErrNotFound):
+			validation.WriteErrors(w, validation.Errors{"product_id": "must be an existing product"})
+		case errors.Is(err, stock.ErrHasVariants):
+			validation.WriteErrors(w, validation.Errors{"variant_id": "is required for products with variants"})
+		case errors.Is(err, stock.ErrSameWarehouse):
+			validation.WriteErrors(w, validation.Errors{"to_warehouse_id": "must differ from from_warehouse_id"})
+		case errors.Is(err, stock.ErrInsufficientStock):
+			http.Error(w, "Not enough stock at the source warehouse", http.StatusConflict)
+		default:
+			http.Error(w, "Failed to transfer stock", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	event, err := stock.InventoryEvent(ctx, h.DB, req.ProductID, req.VariantID)
+	if err == nil {
+		err = h.Producer.EmitInventoryUpdatedEvent(event)
+	}
+	if err != nil {
+		http.Error(w, "Failed to emit InventoryUpdated event", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(movements)
+}
+
+// GetStockLevelsHandler lists the stock of a product and its variants at each warehouse.
+func (h *ProductAPIHandler) GetStockLevelsHandler(w http.ResponseWriter, r *http.Request) {
+	productID, _, ok := variantPath(w, r)
+	if !ok {
+		return
+	}
+
+	ctx := context.Background()
+	if !h.productExists(ctx, w, productID) {
+		return
+	}
+	levels, err := stock.Levels(ctx, h.DB, productID)
+	if err != nil {
+		http.Error(w, "Failed to retrieve stock levels", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(levels)
+}
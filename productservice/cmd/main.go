@@ -1,18 +1,25 @@
 package main
 
 import (
+	"context"
 	"log"
 	"net/http"
 	"os"
 	"strconv"
+	"time"
 
 	"github.com/gorilla/mux"
+	"github.com/hari134/pratilipi/pkg/auth"
+	"github.com/hari134/pratilipi/pkg/blobstore"
 	"github.com/hari134/pratilipi/pkg/db"
 	"github.com/hari134/pratilipi/pkg/kafka"
 	"github.com/hari134/pratilipi/pkg/messaging"
 	"github.com/hari134/pratilipi/productservice/api"
 	"github.com/hari134/pratilipi/productservice/consumer" // Import consumer package
+	"github.com/hari134/pratilipi/productservice/internal/outbox"
+	"github.com/hari134/pratilipi/productservice/internal/reservations"
 	"github.com/hari134/pratilipi/productservice/migrations"
+	"github.com/hari134/pratilipi/productservice/models"
 	"github.com/hari134/pratilipi/productservice/producer"
 )
 
@@ -36,6 +43,7 @@ func main() {
 		SSLMode:  "disable",
 	})
 	defer db.CloseDB(dbInstance)
+	dbInstance.RegisterModel((*models.ProductCategory)(nil)) // Join table of Product.Categories
 	migrations.RunMigrations(dbInstance)
 	// Initialize Kafka producer
 	kafkaConfig := kafka.NewKafkaConfig().
@@ -46,12 +54,54 @@ func main() {
 	// Initialize ProducerManager
 	producerManager := producer.NewProducerManager(kafkaProducer)
 
+	// Product images are kept in the blob store; the local store is served below under /images
+	blobDir := os.Getenv("BLOB_DIR")
+	if blobDir == "" {
+		blobDir = "data/blobs"
+	}
+	blobBaseURL := os.Getenv("BLOB_BASE_URL")
+	if blobBaseURL == "" {
+		blobBaseURL = "http://localhost:" + serverPort + "/images"
+	}
+	blobStore, err := blobstore.New(blobstore.Config{
+		Kind:    os.Getenv("BLOB_STORE"),
+		Dir:     blobDir,
+		BaseURL: blobBaseURL,
+	})
+	if err != nil {
+		log.Fatalf("Failed to open blob store: %v", err)
+	}
+
 	// Create API handlers
 	productAPIHandler := &api.ProductAPIHandler{
 		DB:       dbInstance,
 		Producer: producerManager,
+		Blobs:    blobStore,
 	}
 
+	categoryAPIHandler := &api.CategoryAPIHandler{DB: dbInstance, Blobs: blobStore}
+
+	reservationAPIHandler := &api.ReservationAPIHandler{DB: dbInstance, Producer: producerManager}
+	warehouseAPIHandler := &api.WarehouseAPIHandler{DB: dbInstance, Producer: producerManager}
+
+	// Expire lapsed stock reservations in the background, so their stock can be sold again
+	go func() {
+		for range time.Tick(reservations.SweepInterval()) {
+			reservations.Sweep(context.Background(), dbInstance, producerManager)
+		}
+	}()
+
+	// Publish stock alerts stored in the outbox once their transaction committed, and drop them a week later
+	relay := &outbox.Relay{DB: dbInstance, Producer: kafkaProducer}
+	go relay.Run(context.Background(), outbox.PollInterval())
+	go func() {
+		for range time.Tick(time.Hour) {
+			if err := outbox.PurgePublished(context.Background(), dbInstance, 7*24*time.Hour); err != nil {
+				log.Printf("Failed to purge published outbox events: %v", err)
+			}
+		}
+	}()
+
 	// Initialize Kafka consumer
 	kafkaConsumerConfig := kafka.NewKafkaConfig().
 		SetBrokers(kafkaBrokers)
@@ -59,19 +109,70 @@ func main() {
 	kafkaConsumer := kafka.NewKafkaConsumer(kafkaConsumerConfig)
 	kafkaConsumer.RegisterType("order-placed",&messaging.OrderPlaced{})
 	// Initialize ConsumerManager to listen for OrderPlaced events
-	consumerManager := consumer.NewConsumerManager(kafkaConsumer, dbInstance)
+	consumerManager := consumer.NewConsumerManager(kafkaConsumer, dbInstance, producerManager)
 
 	// Start listening to "Order Placed" events in a separate goroutine
 	go consumerManager.StartConsumers("order-placed")
 
+	// Every route needs a user or service token; tokens are verified against the User Service's JWKS
+	// and its list of revoked tokens
+	jwksURL := os.Getenv("JWKS_URL")
+	if jwksURL == "" {
+		jwksURL = "http://userservice:8080/.well-known/jwks.json"
+	}
+	revocationsURL := os.Getenv("TOKEN_REVOCATIONS_URL")
+	if revocationsURL == "" {
+		revocationsURL = "http://userservice:8080/token-revocations"
+	}
+	verifier := auth.NewVerifier(jwksURL).CheckRevocations(revocationsURL)
+	require := func(permission string, h http.HandlerFunc) http.Handler {
+		return auth.Require(verifier, permission, h)
+	}
+
 	// Set up HTTP routes
 	r := mux.NewRouter()
-	r.HandleFunc("/products", productAPIHandler.GetProductsHandler).Methods("GET")
-	r.HandleFunc("/products/{product_id}", productAPIHandler.GetProductByIdHandler).Methods("GET")    // Update product
-	r.HandleFunc("/products", productAPIHandler.CreateProductHandler).Methods("POST")
-	r.HandleFunc("/products/{product_id}", productAPIHandler.UpdateProductHandler).Methods("PUT")    // Update product
-	r.HandleFunc("/products/{product_id}", productAPIHandler.DeleteProductHandler).Methods("DELETE") // Delete product
-	r.HandleFunc("/products/{product_id}/inventory", productAPIHandler.UpdateInventoryHandler).Methods("PUT")
+	r.Handle("/products", require("product:read", productAPIHandler.GetProductsHandler)).Methods("GET")
+	r.Handle("/products/search", require("product:read", productAPIHandler.SearchProductsHandler)).Methods("GET") // Registered before /products/{product_id}
+	r.Handle("/products/{product_id}", require("product:read", productAPIHandler.GetProductByIdHandler)).Methods("GET")
+	r.Handle("/products", require("product:write", productAPIHandler.CreateProductHandler)).Methods("POST")
+	r.Handle("/products/{product_id}", require("product:write", productAPIHandler.UpdateProductHandler)).Methods("PUT")           // Update product
+	r.Handle("/products/{product_id}", require("product:write", productAPIHandler.DeleteProductHandler)).Methods("DELETE")        // Soft-delete product
+	r.Handle("/products/{product_id}/restore", require("product:write", productAPIHandler.RestoreProductHandler)).Methods("POST") // Restore soft-deleted product
+	r.Handle("/products/{product_id}/inventory", require("product:write", productAPIHandler.UpdateInventoryHandler)).Methods("PUT")
+	r.Handle("/products/{product_id}/variants", require("product:read", productAPIHandler.GetVariantsHandler)).Methods("GET")
+	r.Handle("/products/{product_id}/variants", require("product:write", productAPIHandler.CreateVariantHandler)).Methods("POST")
+	r.Handle("/products/{product_id}/variants/{variant_id}", require("product:write", productAPIHandler.UpdateVariantHandler)).Methods("PUT")
+	r.Handle("/products/{product_id}/variants/{variant_id}", require("product:write", productAPIHandler.DeleteVariantHandler)).Methods("DELETE") // Soft-delete variant
+	r.Handle("/products/{product_id}/variants/{variant_id}/inventory", require("product:write", productAPIHandler.UpdateVariantInventoryHandler)).Methods("PUT")
+	r.Handle("/products/{product_id}/stock-movements", require("product:read", productAPIHandler.GetStockMovementsHandler)).Methods("GET")
+	r.Handle("/products/{product_id}/stock-movements", require("product:write", productAPIHandler.PostStockMovementHandler)).Methods("POST") // Restock, adjustment or return
+	r.Handle("/products/{product_id}/availability", require("product:read", productAPIHandler.GetAvailabilityHandler)).Methods("GET") // On hand, reserved and available to sell
+	r.Handle("/reservations", require(reservations.Permission, reservationAPIHandler.CreateReservationHandler)).Methods("POST")
+	r.Handle("/reservations/{reservation_id}", require(reservations.Permission, reservationAPIHandler.GetReservationHandler)).Methods("GET")
+	r.Handle("/reservations/{reservation_id}/confirm", require(reservations.Permission, reservationAPIHandler.ConfirmReservationHandler)).Methods("POST")
+	r.Handle("/reservations/{reservation_id}/release", require(reservations.Permission, reservationAPIHandler.ReleaseReservationHandler)).Methods("POST")
+	r.Handle("/products/{product_id}/stock-levels", require("product:read", productAPIHandler.GetStockLevelsHandler)).Methods("GET") // Per warehouse
+	r.Handle("/warehouses", require("product:read", warehouseAPIHandler.GetWarehousesHandler)).Methods("GET")
+	r.Handle("/warehouses", require("product:write", warehouseAPIHandler.CreateWarehouseHandler)).Methods("POST")
+	r.Handle("/warehouses/transfers", require("product:write", warehouseAPIHandler.TransferStockHandler)).Methods("POST")
+	r.Handle("/warehouses/{warehouse_id}", require("product:write", warehouseAPIHandler.UpdateWarehouseHandler)).Methods("PUT")
+	r.Handle("/inventory/low-stock", require("product:write", productAPIHandler.GetLowStockHandler)).Methods("GET") // At or below the reorder threshold
+	r.Handle("/products/{product_id}/stock-subscriptions", require("product:read", productAPIHandler.SubscribeStockHandler)).Methods("POST")     // Notify me when back in stock
+	r.Handle("/products/{product_id}/stock-subscriptions", require("product:read", productAPIHandler.UnsubscribeStockHandler)).Methods("DELETE")
+	r.Handle("/stock-subscriptions", require("product:read", productAPIHandler.GetStockSubscriptionsHandler)).Methods("GET") // The caller's waiting subscriptions
+	r.Handle("/inventory/consistency", require("product:write", productAPIHandler.CheckStockHandler)).Methods("GET")
+	r.Handle("/products/{product_id}/images", require("product:read", productAPIHandler.GetImagesHandler)).Methods("GET")
+	r.Handle("/products/{product_id}/images", require("product:write", productAPIHandler.UploadImageHandler)).Methods("POST") // Multipart upload
+	r.Handle("/products/{product_id}/images/order", require("product:write", productAPIHandler.ReorderImagesHandler)).Methods("PUT")
+	r.Handle("/products/{product_id}/images/{image_id}", require("product:write", productAPIHandler.DeleteImageHandler)).Methods("DELETE")
+	r.Handle("/categories", require("product:read", categoryAPIHandler.GetCategoriesHandler)).Methods("GET")
+	r.Handle("/categories/{slug}/products", require("product:read", categoryAPIHandler.GetCategoryProductsHandler)).Methods("GET")
+	r.Handle("/categories", require("product:write", categoryAPIHandler.CreateCategoryHandler)).Methods("POST")
+	r.Handle("/categories/{category_id}", require("product:write", categoryAPIHandler.UpdateCategoryHandler)).Methods("PUT")
+	r.Handle("/categories/{category_id}", require("product:write", categoryAPIHandler.DeleteCategoryHandler)).Methods("DELETE") // Only categories without subcategories
+	if local, ok := blobStore.(*blobstore.Local); ok {
+		r.PathPrefix("/images/").Handler(http.StripPrefix("/images/", local.Handler())).Methods("GET", "HEAD") // Public, so <img> tags work
+	}
 
 	// Start HTTP server
 	log.Fatal(http.ListenAndServe(":"+serverPort, r))
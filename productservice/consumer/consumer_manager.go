@@ -2,23 +2,32 @@ package consumer
 
 import (
     "context"
+    "errors"
     "log"
+    "strconv"
+    "time"
     "github.com/hari134/pratilipi/pkg/db"
     "github.com/hari134/pratilipi/pkg/messaging"
+    "github.com/hari134/pratilipi/productservice/internal/alerts"
+    "github.com/hari134/pratilipi/productservice/internal/stock"
     "github.com/hari134/pratilipi/productservice/models"
+    "github.com/hari134/pratilipi/productservice/producer"
+    "github.com/uptrace/bun"
 )
 
 // ConsumerManager listens for events from Kafka and processes them.
 type ConsumerManager struct {
     consumer messaging.Consumer
     DB       *db.DB  // Injected database dependency
+    Producer *producer.ProducerManager // Emits the inventory changes made by orders
 }
 
 // NewConsumerManager creates a new instance of ConsumerManager.
-func NewConsumerManager(consumer messaging.Consumer, dbInstance *db.DB) *ConsumerManager {
+func NewConsumerManager(consumer messaging.Consumer, dbInstance *db.DB, producerManager *producer.ProducerManager) *ConsumerManager {
     return &ConsumerManager{
         consumer: consumer,
         DB:       dbInstance,
+        Producer: producerManager,
     }
 }
 
@@ -35,7 +44,10 @@ func (cm *ConsumerManager) StartConsumers(orderPlacedTopic string) {
     }
 }
 
-// handleOrderPlacedEvent processes the "Order Placed" event and updates the inventory for each product.
+// handleOrderPlacedEvent processes the "Order Placed" event and takes each item's quantity
+// off the inventory of its product or variant, allocating it across the warehouses by the
+// configured strategy and recording order movements in the stock ledger. Stock held by
+// reservations of other orders is not taken.
 func (cm *ConsumerManager) handleOrderPlacedEvent(event interface{}) error {
     log.Printf("Processing OrderPlaced event: %+v", event)
 
@@ -45,33 +57,61 @@ func (cm *ConsumerManager) handleOrderPlacedEvent(event interface{}) error {
         return nil
     }
 
+    // The stock of orders holding a reservation is taken when the reservation is confirmed
+    if orderPlaced.ReservationID != 0 {
+        log.Printf("Order %d holds reservation %d, leaving its stock to the confirmation", orderPlaced.OrderID, orderPlaced.ReservationID)
+        return nil
+    }
+
     ctx := context.Background()
+    strategy := stock.Strategy()
+    var dest stock.Destination
+    if orderPlaced.ShipTo != nil {
+        dest = stock.Destination{Country: orderPlaced.ShipTo.Country, PostalCode: orderPlaced.ShipTo.PostalCode}
+    }
 
-    // Loop through each item in the order and update the product inventory.
+    // Each item is recorded in its own transaction, so an item without enough stock
+    // does not hold back the others. Redelivered events are skipped item by item.
     for _, item := range orderPlaced.Items {
-        product := &models.Product{}
-        err := cm.DB.NewSelect().Model(product).Where("product_id = ?", item.ProductID).Scan(ctx)
-        if err != nil {
-            log.Printf("Failed to find product with ID %d: %v", item.ProductID, err)
+        tmpl := &models.StockMovement{
+            ProductID:   item.ProductID,
+            VariantID:   item.VariantID,
+            Reason:      stock.ReasonOrder,
+            ReferenceID: strconv.FormatInt(orderPlaced.OrderID, 10),
+            CreatedBy:   orderPlaced.UserID,
+        }
+        var movements []*models.StockMovement
+        err := cm.DB.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+            var err error
+            movements, err = stock.Take(ctx, tx, tmpl, item.Quantity, strategy, dest)
+            if err != nil {
+                return err
+            }
+            _, err = alerts.Evaluate(ctx, tx, item.ProductID, time.Now())
+            return err
+        })
+        switch {
+        case errors.Is(err, stock.ErrInsufficientStock):
+            log.Printf("Not enough inventory for product %d variant %d in order %d", item.ProductID, item.VariantID, orderPlaced.OrderID)
+            continue
+        case errors.Is(err, stock.ErrAlreadyRecorded):
+            log.Printf("Order %d was already deducted for product %d variant %d", orderPlaced.OrderID, item.ProductID, item.VariantID)
+            continue
+        case err != nil:
+            log.Printf("Failed to update inventory for product %d variant %d: %v", item.ProductID, item.VariantID, err)
             return err
         }
-
-        // Check if there's enough inventory to fulfill the order.
-        if product.InventoryCount < item.Quantity {
-            log.Printf("Not enough inventory for product %d", item.ProductID)
-            return nil // Optionally, return an error here to handle this case.
+        for _, m := range movements {
+            log.Printf("Took %d of product %d variant %d from warehouse %d: new inventory count is %d", -m.Delta, m.ProductID, m.VariantID, m.WarehouseID, m.BalanceAfter)
         }
 
-        // Deduct the quantity from the product's inventory.
-        product.InventoryCount -= item.Quantity
-
-        _, err = cm.DB.NewUpdate().Model(product).Where("product_id = ?", item.ProductID).Exec(ctx)
+        inventoryEvent, err := stock.InventoryEvent(ctx, cm.DB, item.ProductID, item.VariantID)
+        if err == nil {
+            err = cm.Producer.EmitInventoryUpdatedEvent(inventoryEvent)
+        }
         if err != nil {
-            log.Printf("Failed to update inventory for product %d: %v", item.ProductID, err)
-            return err
+            log.Printf("Failed to emit InventoryUpdated event for product %d variant %d: %v", item.ProductID, item.VariantID, err)
         }
-
-        log.Printf("Updated inventory for product %d: new inventory count is %d", item.ProductID, product.InventoryCount)
     }
 
     return nil
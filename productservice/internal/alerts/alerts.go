@@ -0,0 +1,286 @@
+// Package alerts tells when products run low or out of stock, and when items
+// users asked about are back. Each product's stock_status remembers the level
+// last announced, so a level is announced once when it is reached, however
+// many stock changes or redelivered events lead there.
+package alerts
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/hari134/pratilipi/pkg/messaging"
+	"github.com/hari134/pratilipi/productservice/internal/outbox"
+	"github.com/hari134/pratilipi/productservice/internal/variants"
+	"github.com/hari134/pratilipi/productservice/models"
+	"github.com/uptrace/bun"
+)
+
+// Stock levels of a product.
+const (
+	StatusInStock    = "in_stock"
+	StatusLowStock   = "low_stock"    // At or below the reorder threshold
+	StatusOutOfStock = "out_of_stock" // Nothing on hand
+)
+
+var (
+	// ErrNotFound is returned for unknown products, variants and subscriptions.
+	ErrNotFound = errors.New("not found")
+	// ErrInStock is returned when subscribing to an item that is in stock.
+	ErrInStock = errors.New("item in stock")
+)
+
+// itemCount is the inventory of the item a subscription waits for: the
+// variant's if it names one, otherwise the product's.
+const itemCount = "CASE WHEN ss.variant_id IS NULL THEN ? ELSE (SELECT v.inventory_count FROM product_variants v WHERE v.variant_id = ss.variant_id AND v.deleted_at IS NULL) END"
+
+// Status returns the stock level of an inventory count. A threshold of zero
+// never reports low stock.
+func Status(count, threshold int) string {
+	switch {
+	case count <= 0:
+		return StatusOutOfStock
+	case count <= threshold:
+		return StatusLowStock
+	default:
+		return StatusInStock
+	}
+}
+
+// Topics of the alert events.
+const (
+	TopicLowStock    = "product-low-stock"
+	TopicOutOfStock  = "product-out-of-stock"
+	TopicBackInStock = "product-back-in-stock"
+)
+
+// Alerts are the events due after a product's stock changed.
+type Alerts struct {
+	LowStock    *messaging.ProductLowStock
+	OutOfStock  *messaging.ProductOutOfStock
+	BackInStock []*messaging.ProductBackInStock
+}
+
+// levelAlerts returns the stock level of the product and the events due when
+// it differs from the level last announced. Low stock is announced when the
+// inventory falls to the threshold from above it; running out is announced
+// whenever it happens.
+func levelAlerts(product *models.Product, now time.Time) (string, *Alerts) {
+	alerts := &Alerts{}
+	status := Status(product.InventoryCount, product.ReorderThreshold)
+	if status == product.StockStatus {
+		return status, alerts
+	}
+	id := strconv.FormatInt(product.ProductID, 10)
+	switch {
+	case status == StatusOutOfStock:
+		alerts.OutOfStock = &messaging.ProductOutOfStock{ProductID: id, OccurredAt: now}
+	case status == StatusLowStock && product.StockStatus == StatusInStock:
+		alerts.LowStock = &messaging.ProductLowStock{
+			ProductID:        id,
+			InventoryCount:   product.InventoryCount,
+			ReorderThreshold: product.ReorderThreshold,
+			OccurredAt:       now,
+		}
+	}
+	return status, alerts
+}
+
+// dueSubscription is a subscription marked notified, with the inventory of
+// the item it waited for.
+type dueSubscription struct {
+	VariantID      int64 `bun:"variant_id"` // Zero for the product itself
+	UserID         int64 `bun:"user_id"`
+	InventoryCount int   `bun:"inventory_count"`
+}
+
+// backInStock returns one event per item the subscriptions waited for, naming
+// all of its users, in the order the items first appear.
+func backInStock(productID int64, due []dueSubscription, now time.Time) []*messaging.ProductBackInStock {
+	var events []*messaging.ProductBackInStock
+	byVariant := map[int64]*messaging.ProductBackInStock{}
+	for _, d := range due {
+		event, ok := byVariant[d.VariantID]
+		if !ok {
+			event = &messaging.ProductBackInStock{
+				ProductID:      strconv.FormatInt(productID, 10),
+				InventoryCount: d.InventoryCount,
+				OccurredAt:     now,
+			}
+			if d.VariantID != 0 {
+				event.VariantID = strconv.FormatInt(d.VariantID, 10)
+			}
+			byVariant[d.VariantID] = event
+			events = append(events, event)
+		}
+		event.UserIDs = append(event.UserIDs, strconv.FormatInt(d.UserID, 10))
+	}
+	return events
+}
+
+// enqueue stores the events in the outbox.
+func (a *Alerts) enqueue(ctx context.Context, db bun.IDB) error {
+	if a.OutOfStock != nil {
+		if err := outbox.Enqueue(ctx, db, TopicOutOfStock, a.OutOfStock); err != nil {
+			return err
+		}
+	}
+	if a.LowStock != nil {
+		if err := outbox.Enqueue(ctx, db, TopicLowStock, a.LowStock); err != nil {
+			return err
+		}
+	}
+	for _, event := range a.BackInStock {
+		if err := outbox.Enqueue(ctx, db, TopicBackInStock, event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Evaluate compares the product's inventory with the level last announced,
+// records the new level, marks waiting subscriptions to items in stock
+// notified and stores the events due in the outbox, which publishes them once
+// the transaction commits. It returns the events. Call it inside the
+// transaction that changed the stock, so the new level is recorded and
+// announced together with the change or not at all.
+func Evaluate(ctx context.Context, db bun.IDB, productID int64, now time.Time) (*Alerts, error) {
+	product := &models.Product{}
+	err := db.NewSelect().Model(product).
+		Column("product_id", "inventory_count", "reorder_threshold", "stock_status").
+		WhereAllWithDeleted().
+		Where("p.product_id = ?", productID).
+		For("UPDATE").
+		Scan(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	status, alerts := levelAlerts(product, now)
+	if status != product.StockStatus {
+		_, err := db.NewUpdate().Model((*models.Product)(nil)).
+			Set("stock_status = ?", status).
+			WhereAllWithDeleted().
+			Where("product_id = ?", productID).
+			Exec(ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var due []dueSubscription
+	err = db.NewUpdate().Model((*models.StockSubscription)(nil)).
+		Set("notified_at = ?", now).
+		Where("ss.product_id = ?", productID).
+		Where("ss.notified_at IS NULL").
+		Where(itemCount+" > 0", product.InventoryCount).
+		Returning("COALESCE(ss.variant_id, 0) AS variant_id, ss.user_id, "+itemCount+" AS inventory_count", product.InventoryCount).
+		Scan(ctx, &due)
+	if err != nil {
+		return nil, err
+	}
+	alerts.BackInStock = backInStock(productID, due, now)
+
+	if err := alerts.enqueue(ctx, db); err != nil {
+		return nil, err
+	}
+	return alerts, nil
+}
+
+// Subscribe records that the user wants to be told when the product, or the
+// variant if sub names one, is back in stock. Subscribing again while waiting
+// returns the existing subscription. Items in stock return ErrInStock. Call it
+// inside a transaction.
+func Subscribe(ctx context.Context, db bun.IDB, sub *models.StockSubscription) error {
+	// Share-lock the product, which every stock change updates, so a restock
+	// either sees the subscription or is seen by it
+	var count int
+	err := db.NewSelect().Model((*models.Product)(nil)).
+		Column("inventory_count").
+		Where("p.product_id = ?", sub.ProductID).
+		For("SHARE").
+		Scan(ctx, &count)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if sub.VariantID != 0 {
+		variant, err := variants.Find(ctx, db, sub.ProductID, sub.VariantID)
+		if errors.Is(err, variants.ErrNotFound) {
+			return ErrNotFound
+		}
+		if err != nil {
+			return err
+		}
+		count = variant.InventoryCount
+	}
+	if count > 0 {
+		return ErrInStock
+	}
+
+	sub.CreatedAt = time.Now()
+	res, err := db.NewInsert().Model(sub).
+		On("CONFLICT (product_id, COALESCE(variant_id, 0), user_id) WHERE notified_at IS NULL DO NOTHING").
+		Exec(ctx)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil || n > 0 {
+		return err
+	}
+	return db.NewSelect().Model(sub).
+		Where("ss.product_id = ?", sub.ProductID).
+		Where("COALESCE(ss.variant_id, 0) = ?", sub.VariantID).
+		Where("ss.user_id = ?", sub.UserID).
+		Where("ss.notified_at IS NULL").
+		Scan(ctx)
+}
+
+// Unsubscribe removes the user's waiting subscription to the product or variant.
+func Unsubscribe(ctx context.Context, db bun.IDB, productID, variantID, userID int64) error {
+	res, err := db.NewDelete().Model((*models.StockSubscription)(nil)).
+		Where("product_id = ?", productID).
+		Where("COALESCE(variant_id, 0) = ?", variantID).
+		Where("user_id = ?", userID).
+		Where("notified_at IS NULL").
+		Exec(ctx)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrNotFound
+	}
+	return err
+}
+
+// Subscriptions returns the user's waiting subscriptions, newest first.
+func Subscriptions(ctx context.Context, db bun.IDB, userID int64) ([]models.StockSubscription, error) {
+	subs := []models.StockSubscription{}
+	err := db.NewSelect().Model(&subs).
+		Where("ss.user_id = ?", userID).
+		Where("ss.notified_at IS NULL").
+		OrderExpr("ss.subscription_id DESC").
+		Scan(ctx)
+	return subs, err
+}
+
+// LowStock returns a page of the products with a reorder threshold whose
+// inventory is at or below it, emptiest first, and the total number of them.
+func LowStock(ctx context.Context, db bun.IDB, limit, offset int) ([]models.Product, int, error) {
+	products := []models.Product{}
+	total, err := db.NewSelect().Model(&products).
+		Where("p.reorder_threshold > 0").
+		Where("p.inventory_count <= p.reorder_threshold").
+		OrderExpr("p.inventory_count, p.product_id").
+		Limit(limit).
+		Offset(offset).
+		ScanAndCount(ctx)
+	return products, total, err
+}
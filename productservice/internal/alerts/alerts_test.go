@@ -0,0 +1,82 @@
+package alerts
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/hari134/pratilipi/productservice/models"
+)
+
+func TestStatus(t *testing.T) {
+	tests := []struct {
+		count, threshold int
+		want             string
+	}{
+		{0, 0, StatusOutOfStock},
+		{0, 5, StatusOutOfStock},
+		{1, 0, StatusInStock}, // No threshold, no low stock
+		{5, 5, StatusLowStock},
+		{3, 5, StatusLowStock},
+		{6, 5, StatusInStock},
+	}
+	for _, tt := range tests {
+		if got := Status(tt.count, tt.threshold); got != tt.want {
+			t.Errorf("Status(%d, %d) = %q, want %q", tt.count, tt.threshold, got, tt.want)
+		}
+	}
+}
+
+func TestLevelAlerts(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name             string
+		count, threshold int
+		last             string
+		want             string
+		lowStock         bool
+		outOfStock       bool
+	}{
+		{"unchanged", 10, 5, StatusInStock, StatusInStock, false, false},
+		{"falls to threshold", 5, 5, StatusInStock, StatusLowStock, true, false},
+		{"runs out from in stock", 0, 5, StatusInStock, StatusOutOfStock, false, true},
+		{"runs out from low stock", 0, 5, StatusLowStock, StatusOutOfStock, false, true},
+		{"restocked to low stock", 2, 5, StatusOutOfStock, StatusLowStock, false, false},
+		{"restocked", 10, 5, StatusLowStock, StatusInStock, false, false},
+		{"still low", 3, 5, StatusLowStock, StatusLowStock, false, false},
+	}
+	for _, tt := range tests {
+		product := &models.Product{ProductID: 7, InventoryCount: tt.count, ReorderThreshold: tt.threshold, StockStatus: tt.last}
+		status, alerts := levelAlerts(product, now)
+		if status != tt.want {
+			t.Errorf("%s: status = %q, want %q", tt.name, status, tt.want)
+		}
+		if (alerts.LowStock != nil) != tt.lowStock || (alerts.OutOfStock != nil) != tt.outOfStock {
+			t.Errorf("%s: low stock %v, out of stock %v, want %v, %v", tt.name, alerts.LowStock != nil, alerts.OutOfStock != nil, tt.lowStock, tt.outOfStock)
+		}
+		if alerts.LowStock != nil && (alerts.LowStock.ProductID != "7" || alerts.LowStock.InventoryCount != tt.count) {
+			t.Errorf("%s: low stock event = %+v", tt.name, alerts.LowStock)
+		}
+	}
+}
+
+func TestBackInStock(t *testing.T) {
+	due := []dueSubscription{
+		{VariantID: 3, UserID: 10, InventoryCount: 4},
+		{VariantID: 0, UserID: 11, InventoryCount: 9},
+		{VariantID: 3, UserID: 12, InventoryCount: 4},
+	}
+	events := backInStock(7, due, time.Now())
+	if len(events) != 2 {
+		t.Fatalf("got %d events, want 2", len(events))
+	}
+	if e := events[0]; e.ProductID != "7" || e.VariantID != "3" || e.InventoryCount != 4 || !reflect.DeepEqual(e.UserIDs, []string{"10", "12"}) {
+		t.Errorf("variant event = %+v", e)
+	}
+	if e := events[1]; e.VariantID != "" || e.InventoryCount != 9 || !reflect.DeepEqual(e.UserIDs, []string{"11"}) {
+		t.Errorf("product event = %+v", e)
+	}
+	if events := backInStock(7, nil, time.Now()); len(events) != 0 {
+		t.Errorf("got %d events without subscriptions, want 0", len(events))
+	}
+}
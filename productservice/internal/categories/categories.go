@@ -0,0 +1,286 @@
+// Package categories manages the category tree and the assignment of products
+// to categories. A product can be in any number of categories; browsing a
+// category includes the products of all categories below it.
+package categories
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/hari134/pratilipi/productservice/internal/images"
+	"github.com/hari134/pratilipi/productservice/internal/variants"
+	"github.com/hari134/pratilipi/productservice/models"
+	"github.com/uptrace/bun"
+)
+
+var (
+	// ErrNotFound is returned for unknown categories.
+	ErrNotFound = errors.New("category not found")
+	// ErrSlugTaken is returned when another category already has the slug.
+	ErrSlugTaken = errors.New("slug already in use")
+	// ErrInvalidSlug is returned for slugs that are not lowercase words joined by hyphens.
+	ErrInvalidSlug = errors.New("invalid slug")
+	// ErrCycle is returned when a category would become its own ancestor.
+	ErrCycle = errors.New("category cannot be moved below itself")
+	// ErrHasChildren is returned when deleting a category that still has subcategories.
+	ErrHasChildren = errors.New("category has subcategories")
+)
+
+var (
+	slugPattern  = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+	nonSlugChars = regexp.MustCompile(`[^a-z0-9]+`)
+)
+
+// Slugify derives a slug from a name, e.g. "Men's Running Shoes" becomes "men-s-running-shoes".
+func Slugify(name string) string {
+	slug := nonSlugChars.ReplaceAllString(strings.ToLower(name), "-")
+	slug = strings.Trim(slug, "-")
+	if len(slug) > 100 {
+		slug = strings.TrimRight(slug[:100], "-")
+	}
+	return slug
+}
+
+// ValidSlug reports whether slug is lowercase letters and digits, in words joined by single hyphens.
+func ValidSlug(slug string) bool {
+	return len(slug) <= 100 && slugPattern.MatchString(slug)
+}
+
+// Tree returns the root categories with their descendants in Children, each
+// level ordered by position and name.
+func Tree(ctx context.Context, db bun.IDB) ([]*models.Category, error) {
+	var all []*models.Category
+	if err := db.NewSelect().Model(&all).OrderExpr("c.position, c.name").Scan(ctx); err != nil {
+		return nil, err
+	}
+	return buildTree(all), nil
+}
+
+// buildTree links categories, given in sibling order, to their parents and returns the roots.
+func buildTree(all []*models.Category) []*models.Category {
+	byID := make(map[int64]*models.Category, len(all))
+	for _, c := range all {
+		c.Children = nil
+		byID[c.CategoryID] = c
+	}
+	roots := []*models.Category{}
+	for _, c := range all {
+		if parent, ok := byID[c.ParentID]; ok && c.ParentID != 0 {
+			parent.Children = append(parent.Children, c)
+		} else {
+			roots = append(roots, c)
+		}
+	}
+	return roots
+}
+
+// FindBySlug returns the category with the slug.
+func FindBySlug(ctx context.Context, db bun.IDB, slug string) (*models.Category, error) {
+	category := &models.Category{}
+	err := db.NewSelect().Model(category).Where("c.slug = ?", slug).Scan(ctx)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return category, nil
+}
+
+// Find returns the category with the ID.
+func Find(ctx context.Context, db bun.IDB, categoryID int64) (*models.Category, error) {
+	category := &models.Category{}
+	err := db.NewSelect().Model(category).Where("c.category_id = ?", categoryID).Scan(ctx)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return category, nil
+}
+
+// SubtreeIDs returns the IDs of the category and all categories below it.
+func SubtreeIDs(ctx context.Context, db bun.IDB, categoryID int64) ([]int64, error) {
+	var ids []int64
+	err := db.NewRaw(`
+		WITH RECURSIVE subtree AS (
+			SELECT category_id FROM categories WHERE category_id = ?
+			UNION
+			SELECT c.category_id FROM categories c JOIN subtree s ON c.parent_id = s.category_id
+		)
+		SELECT category_id FROM subtree`, categoryID).Scan(ctx, &ids)
+	return ids, err
+}
+
+// Save inserts a new category or updates an existing one, deriving the slug
+// from the name when it is empty. A category cannot be moved below itself.
+// The checks and the write run in one transaction holding locks on the
+// category, its new parent with the parent's ancestors, and the slug, so
+// concurrent saves cannot together create a cycle or a duplicate slug.
+func Save(ctx context.Context, db bun.IDB, category *models.Category) error {
+	if category.Slug == "" {
+		category.Slug = Slugify(category.Name)
+	}
+	if !ValidSlug(category.Slug) {
+		return ErrInvalidSlug
+	}
+	return db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		return save(ctx, tx, category)
+	})
+}
+
+func save(ctx context.Context, tx bun.Tx, category *models.Category) error {
+	// Moves that could form a cycle together share a locked row: the category
+	// moved below the other, or one of the ancestors of its new parent
+	var locked []int64
+	err := tx.NewRaw(`
+		WITH RECURSIVE ancestors AS (
+			SELECT category_id, parent_id FROM categories WHERE category_id = ?
+			UNION
+			SELECT c.category_id, c.parent_id FROM categories c JOIN ancestors a ON c.category_id = a.parent_id
+		)
+		SELECT category_id FROM categories
+		WHERE category_id = ? OR category_id IN (SELECT category_id FROM ancestors)
+		ORDER BY category_id
+		FOR UPDATE`, category.ParentID, category.CategoryID).Scan(ctx, &locked)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, "SELECT pg_advisory_xact_lock(hashtext(?))", "categories.slug:"+category.Slug); err != nil {
+		return err
+	}
+
+	if category.ParentID != 0 {
+		if _, err := Find(ctx, tx, category.ParentID); err != nil {
+			return err
+		}
+	}
+	if category.CategoryID != 0 && category.ParentID != 0 {
+		subtree, err := SubtreeIDs(ctx, tx, category.CategoryID)
+		if err != nil {
+			return err
+		}
+		for _, id := range subtree {
+			if id == category.ParentID {
+				return ErrCycle
+			}
+		}
+	}
+	taken, err := tx.NewSelect().Model((*models.Category)(nil)).
+		Where("c.slug = ?", category.Slug).
+		Where("c.category_id != ?", category.CategoryID).
+		Exists(ctx)
+	if err != nil {
+		return err
+	}
+	if taken {
+		return ErrSlugTaken
+	}
+
+	category.UpdatedAt = time.Now()
+	if category.CategoryID == 0 {
+		category.CreatedAt = category.UpdatedAt
+		_, err = tx.NewInsert().Model(category).Exec(ctx)
+		return err
+	}
+	res, err := tx.NewUpdate().Model(category).
+		Column("parent_id", "name", "slug", "position", "updated_at").
+		WherePK().
+		Exec(ctx)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrNotFound
+	}
+	return err
+}
+
+// Delete removes a category without subcategories. Its products stay, without
+// it. The category is locked first, so a subcategory cannot be saved below it
+// in the meantime.
+func Delete(ctx context.Context, db bun.IDB, categoryID int64) error {
+	return db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		var locked []int64
+		err := tx.NewSelect().Model((*models.Category)(nil)).
+			Column("category_id").
+			Where("c.category_id = ?", categoryID).
+			For("UPDATE").
+			Scan(ctx, &locked)
+		if err != nil {
+			return err
+		}
+		if len(locked) == 0 {
+			return ErrNotFound
+		}
+		hasChildren, err := tx.NewSelect().Model((*models.Category)(nil)).Where("c.parent_id = ?", categoryID).Exists(ctx)
+		if err != nil {
+			return err
+		}
+		if hasChildren {
+			return ErrHasChildren
+		}
+		_, err = tx.NewDelete().Model((*models.Category)(nil)).Where("category_id = ?", categoryID).Exec(ctx)
+		return err
+	})
+}
+
+// SetProductCategories replaces the categories of a product.
+func SetProductCategories(ctx context.Context, db bun.IDB, productID int64, categoryIDs []int64) error {
+	unique := make(map[int64]bool, len(categoryIDs))
+	links := make([]models.ProductCategory, 0, len(categoryIDs))
+	for _, id := range categoryIDs {
+		if !unique[id] {
+			unique[id] = true
+			links = append(links, models.ProductCategory{ProductID: productID, CategoryID: id})
+		}
+	}
+	if len(links) > 0 {
+		count, err := db.NewSelect().Model((*models.Category)(nil)).Where("c.category_id IN (?)", bun.In(categoryIDs)).Count(ctx)
+		if err != nil {
+			return err
+		}
+		if count != len(links) {
+			return ErrNotFound
+		}
+	}
+
+	if _, err := db.NewDelete().Model((*models.ProductCategory)(nil)).Where("product_id = ?", productID).Exec(ctx); err != nil {
+		return err
+	}
+	if len(links) == 0 {
+		return nil
+	}
+	_, err := db.NewInsert().Model(&links).Exec(ctx)
+	return err
+}
+
+// Products returns one page of the products in the category or, when
+// includeDescendants is set, in it or any category below it, ordered by name,
+// and the number of such products across all pages.
+func Products(ctx context.Context, db bun.IDB, categoryID int64, includeDescendants bool, limit, offset int) ([]models.Product, int, error) {
+	ids := []int64{categoryID}
+	if includeDescendants {
+		var err error
+		if ids, err = SubtreeIDs(ctx, db, categoryID); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	products := []models.Product{}
+	total, err := db.NewSelect().Model(&products).
+		Relation("Categories").
+		Relation("Variants", variants.Ordered).
+		Relation("Images", images.Ordered).
+		Where("p.product_id IN (SELECT product_id FROM product_categories WHERE category_id IN (?))", bun.In(ids)).
+		OrderExpr("lower(p.name), p.product_id").
+		Limit(limit).
+		Offset(offset).
+		ScanAndCount(ctx)
+	return products, total, err
+}
@@ -0,0 +1,49 @@
+package categories
+
+import (
+	"testing"
+
+	"github.com/hari134/pratilipi/productservice/models"
+)
+
+func TestSlugify(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{"Men's Running Shoes", "men-s-running-shoes"},
+		{"  TVs & Audio  ", "tvs-audio"},
+		{"4K--Monitors", "4k-monitors"},
+		{"!!!", ""},
+	}
+	for _, tt := range tests {
+		if got := Slugify(tt.in); got != tt.want {
+			t.Errorf("Slugify(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+		if tt.want != "" && !ValidSlug(Slugify(tt.in)) {
+			t.Errorf("Slugify(%q) is not a valid slug", tt.in)
+		}
+	}
+	for _, slug := range []string{"", "Shoes", "shoes-", "-shoes", "running--shoes", "running shoes"} {
+		if ValidSlug(slug) {
+			t.Errorf("ValidSlug(%q) = true", slug)
+		}
+	}
+}
+
+func TestBuildTree(t *testing.T) {
+	roots := buildTree([]*models.Category{
+		{CategoryID: 1, Name: "Electronics"},
+		{CategoryID: 3, ParentID: 1, Name: "Laptops"},
+		{CategoryID: 2, ParentID: 1, Name: "Phones"},
+		{CategoryID: 4, ParentID: 2, Name: "Android"},
+		{CategoryID: 5, Name: "Books"},
+	})
+	if len(roots) != 2 || roots[0].CategoryID != 1 || roots[1].CategoryID != 5 {
+		t.Fatalf("roots = %+v", roots)
+	}
+	children := roots[0].Children
+	if len(children) != 2 || children[0].Name != "Laptops" || children[1].Name != "Phones" {
+		t.Fatalf("children of Electronics = %+v", children)
+	}
+	if len(children[1].Children) != 1 || children[1].Children[0].Name != "Android" {
+		t.Errorf("children of Phones = %+v", children[1].Children)
+	}
+}
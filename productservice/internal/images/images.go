@@ -0,0 +1,285 @@
+// Package images validates uploaded product images, makes thumbnails of them,
+// keeps both in a blob store and records their metadata and order.
+package images
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif" // Registers the GIF decoder with image.Decode
+	"image/jpeg"
+	"image/png"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/hari134/pratilipi/pkg/blobstore"
+	"github.com/hari134/pratilipi/productservice/models"
+	"github.com/uptrace/bun"
+)
+
+var (
+	// ErrNotFound is returned for unknown images.
+	ErrNotFound = errors.New("image not found")
+	// ErrUnsupportedType is returned for uploads that are not JPEG, PNG or GIF images.
+	ErrUnsupportedType = errors.New("unsupported image type")
+	// ErrTooLarge is returned for uploads over MaxBytes or MaxPixels.
+	ErrTooLarge = errors.New("image too large")
+	// ErrInvalidImage is returned for uploads that cannot be decoded.
+	ErrInvalidImage = errors.New("invalid image")
+	// ErrImageSet is returned when reordering with IDs other than exactly the product's images.
+	ErrImageSet = errors.New("image IDs must be exactly the product's images")
+)
+
+const (
+	// ThumbnailSize is the longest side of a thumbnail in pixels.
+	ThumbnailSize = 320
+	// MaxPixels is the largest width times height accepted, so small files
+	// cannot expand into huge images in memory.
+	MaxPixels = 40_000_000
+)
+
+// Extensions of the supported content types.
+var extensions = map[string]string{
+	"image/jpeg": "jpg",
+	"image/png":  "png",
+	"image/gif":  "gif",
+}
+
+// MaxBytes returns the largest upload accepted, from PRODUCT_IMAGE_MAX_BYTES,
+// by default 5 MiB.
+func MaxBytes() int64 {
+	if n, err := strconv.ParseInt(os.Getenv("PRODUCT_IMAGE_MAX_BYTES"), 10, 64); err == nil && n > 0 {
+		return n
+	}
+	return 5 << 20
+}
+
+// Processed is a validated upload with its thumbnail.
+type Processed struct {
+	ContentType   string
+	Width         int
+	Height        int
+	Thumbnail     []byte // Encoded like the upload, except GIFs, whose thumbnails are PNGs
+	ThumbnailType string
+}
+
+// Process checks that data is a JPEG, PNG or GIF image within the size limits
+// and makes its thumbnail.
+func Process(data []byte) (*Processed, error) {
+	if int64(len(data)) > MaxBytes() {
+		return nil, ErrTooLarge
+	}
+	contentType := http.DetectContentType(data)
+	if _, ok := extensions[contentType]; !ok {
+		return nil, ErrUnsupportedType
+	}
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrInvalidImage
+	}
+	if config.Width*config.Height > MaxPixels {
+		return nil, ErrTooLarge
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrInvalidImage
+	}
+
+	p := &Processed{ContentType: contentType, Width: config.Width, Height: config.Height}
+	var thumb bytes.Buffer
+	if contentType == "image/jpeg" {
+		p.ThumbnailType = "image/jpeg"
+		err = jpeg.Encode(&thumb, Thumbnail(img, ThumbnailSize), &jpeg.Options{Quality: 85})
+	} else {
+		p.ThumbnailType = "image/png"
+		err = png.Encode(&thumb, Thumbnail(img, ThumbnailSize))
+	}
+	if err != nil {
+		return nil, err
+	}
+	p.Thumbnail = thumb.Bytes()
+	return p, nil
+}
+
+// Thumbnail scales img down so that its longest side is at most size pixels,
+// averaging the source pixels that fall into each thumbnail pixel. Smaller
+// images are returned unchanged.
+func Thumbnail(img image.Image, size int) image.Image {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w <= size && h <= size {
+		return img
+	}
+	tw, th := size, h*size/w
+	if h > w {
+		tw, th = w*size/h, size
+	}
+	tw, th = max(tw, 1), max(th, 1)
+
+	thumb := image.NewRGBA(image.Rect(0, 0, tw, th))
+	for y := 0; y < th; y++ {
+		y0, y1 := b.Min.Y+y*h/th, b.Min.Y+(y+1)*h/th
+		for x := 0; x < tw; x++ {
+			x0, x1 := b.Min.X+x*w/tw, b.Min.X+(x+1)*w/tw
+			var r, g, bl, a, n uint64
+			for sy := y0; sy < max(y1, y0+1); sy++ {
+				for sx := x0; sx < max(x1, x0+1); sx++ {
+					cr, cg, cb, ca := img.At(sx, sy).RGBA()
+					r, g, bl, a, n = r+uint64(cr), g+uint64(cg), bl+uint64(cb), a+uint64(ca), n+1
+				}
+			}
+			thumb.Set(x, y, color.RGBA64{uint16(r / n), uint16(g / n), uint16(bl / n), uint16(a / n)})
+		}
+	}
+	return thumb
+}
+
+// Ordered orders images by position, for loading them with
+// Relation("Images", images.Ordered).
+func Ordered(q *bun.SelectQuery) *bun.SelectQuery {
+	return q.OrderExpr("img.position, img.image_id")
+}
+
+// Upload validates an image, stores it and its thumbnail, and records it as
+// the product's last image.
+func Upload(ctx context.Context, db bun.IDB, store blobstore.Store, img *models.ProductImage, data []byte) error {
+	p, err := Process(data)
+	if err != nil {
+		return err
+	}
+	name, err := randomName()
+	if err != nil {
+		return err
+	}
+	img.ContentType, img.SizeBytes, img.Width, img.Height = p.ContentType, len(data), p.Width, p.Height
+	img.StorageKey = fmt.Sprintf("products/%d/%s.%s", img.ProductID, name, extensions[p.ContentType])
+	img.ThumbnailKey = fmt.Sprintf("products/%d/%s_thumb.%s", img.ProductID, name, extensions[p.ThumbnailType])
+
+	if err := store.Put(ctx, img.StorageKey, bytes.NewReader(data), p.ContentType); err != nil {
+		return err
+	}
+	if err := store.Put(ctx, img.ThumbnailKey, bytes.NewReader(p.Thumbnail), p.ThumbnailType); err != nil {
+		store.Delete(ctx, img.StorageKey)
+		return err
+	}
+
+	err = db.NewSelect().Model((*models.ProductImage)(nil)).
+		ColumnExpr("COALESCE(MAX(img.position) + 1, 0)").
+		Where("img.product_id = ?", img.ProductID).
+		Scan(ctx, &img.Position)
+	if err == nil {
+		img.CreatedAt = time.Now()
+		_, err = db.NewInsert().Model(img).Exec(ctx)
+	}
+	if err != nil {
+		store.Delete(ctx, img.StorageKey)
+		store.Delete(ctx, img.ThumbnailKey)
+		return err
+	}
+	SetURLs(store, img)
+	return nil
+}
+
+// List returns the images of a product, ordered by position, with their URLs.
+func List(ctx context.Context, db bun.IDB, store blobstore.Store, productID int64) ([]models.ProductImage, error) {
+	images := []models.ProductImage{}
+	err := Ordered(db.NewSelect().Model(&images).Where("img.product_id = ?", productID)).Scan(ctx)
+	for i := range images {
+		SetURLs(store, &images[i])
+	}
+	return images, err
+}
+
+// Reorder sets the order of a product's images to that of imageIDs, which must
+// name each of its images once.
+func Reorder(ctx context.Context, db bun.IDB, productID int64, imageIDs []int64) error {
+	var existing []int64
+	err := db.NewSelect().Model((*models.ProductImage)(nil)).
+		Column("image_id").
+		Where("img.product_id = ?", productID).
+		Scan(ctx, &existing)
+	if err != nil {
+		return err
+	}
+	if !sameSet(existing, imageIDs) {
+		return ErrImageSet
+	}
+	for position, id := range imageIDs {
+		_, err := db.NewUpdate().Model((*models.ProductImage)(nil)).
+			Set("position = ?", position).
+			Where("image_id = ?", id).
+			Exec(ctx)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Delete removes an image and its blobs.
+func Delete(ctx context.Context, db bun.IDB, store blobstore.Store, productID, imageID int64) error {
+	img := &models.ProductImage{}
+	err := db.NewDelete().Model(img).
+		Where("image_id = ?", imageID).
+		Where("product_id = ?", productID).
+		Returning("*").
+		Scan(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if err := store.Delete(ctx, img.StorageKey); err != nil {
+		return err
+	}
+	return store.Delete(ctx, img.ThumbnailKey)
+}
+
+// SetURLs fills in the URLs of an image from its keys.
+func SetURLs(store blobstore.Store, img *models.ProductImage) {
+	img.URL = store.URL(img.StorageKey)
+	img.ThumbnailURL = store.URL(img.ThumbnailKey)
+}
+
+// SetProductURLs fills in the URLs of the images loaded with a product.
+func SetProductURLs(store blobstore.Store, product *models.Product) {
+	for i := range product.Images {
+		SetURLs(store, &product.Images[i])
+	}
+}
+
+// sameSet reports whether a and b hold the same IDs, each once.
+func sameSet(a, b []int64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	seen := make(map[int64]bool, len(a))
+	for _, id := range a {
+		seen[id] = true
+	}
+	for _, id := range b {
+		if !seen[id] {
+			return false
+		}
+		delete(seen, id)
+	}
+	return true
+}
+
+// randomName returns a random blob name, so keys are never reused.
+func randomName() (string, error) {
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
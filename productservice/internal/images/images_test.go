@@ -0,0 +1,68 @@
+package images
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+)
+
+func TestThumbnail(t *testing.T) {
+	tests := []struct{ w, h, wantW, wantH int }{
+		{1000, 500, 320, 160},
+		{500, 1000, 160, 320},
+		{200, 100, 200, 100},
+		{5000, 3, 320, 1},
+	}
+	for _, tt := range tests {
+		got := Thumbnail(image.NewRGBA(image.Rect(0, 0, tt.w, tt.h)), ThumbnailSize).Bounds()
+		if got.Dx() != tt.wantW || got.Dy() != tt.wantH {
+			t.Errorf("Thumbnail of %dx%d is %dx%d, want %dx%d", tt.w, tt.h, got.Dx(), got.Dy(), tt.wantW, tt.wantH)
+		}
+	}
+
+	src := image.NewRGBA(image.Rect(0, 0, 640, 640))
+	for x := 0; x < 640; x++ {
+		for y := 0; y < 640; y++ {
+			if x%2 == 0 {
+				src.Set(x, y, color.White)
+			} else {
+				src.Set(x, y, color.Black)
+			}
+		}
+	}
+	if r, _, _, _ := Thumbnail(src, ThumbnailSize).At(10, 10).RGBA(); r < 0x7000 || r > 0x9000 {
+		t.Errorf("Thumbnail did not average the stripes: red %#x", r)
+	}
+}
+
+func TestProcess(t *testing.T) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 800, 400))); err != nil {
+		t.Fatal(err)
+	}
+	p, err := Process(buf.Bytes())
+	if err != nil {
+		t.Fatalf("Process: %v", err)
+	}
+	if p.ContentType != "image/png" || p.Width != 800 || p.Height != 400 || p.ThumbnailType != "image/png" {
+		t.Errorf("Process = %+v", p)
+	}
+	thumb, err := png.Decode(bytes.NewReader(p.Thumbnail))
+	if err != nil || thumb.Bounds().Dx() != ThumbnailSize {
+		t.Errorf("thumbnail is %v, %v", thumb.Bounds(), err)
+	}
+
+	if _, err := Process([]byte("not an image")); !errors.Is(err, ErrUnsupportedType) {
+		t.Errorf("Process(text) = %v, want ErrUnsupportedType", err)
+	}
+	if _, err := Process(buf.Bytes()[:60]); !errors.Is(err, ErrInvalidImage) {
+		t.Errorf("Process(truncated) = %v, want ErrInvalidImage", err)
+	}
+	t.Setenv("PRODUCT_IMAGE_MAX_BYTES", "100")
+	if _, err := Process(buf.Bytes()); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("Process(large) = %v, want ErrTooLarge", err)
+	}
+}
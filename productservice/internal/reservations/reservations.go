@@ -0,0 +1,470 @@
+// Package reservations holds stock for a while, for example while an order
+// awaits payment. Held stock stays on hand but is no longer available to sell.
+// A reservation is confirmed, taking its stock off hand through the stock
+// ledger, released, or left to expire; Sweep expires lapsed reservations.
+package reservations
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/hari134/pratilipi/pkg/messaging"
+	"github.com/hari134/pratilipi/productservice/internal/stock"
+	"github.com/hari134/pratilipi/productservice/internal/variants"
+	"github.com/hari134/pratilipi/productservice/models"
+	"github.com/hari134/pratilipi/productservice/producer"
+	"github.com/uptrace/bun"
+)
+
+// Permission allows holding, confirming and releasing stock.
+const Permission = "inventory:reserve"
+
+// Statuses of a reservation.
+const (
+	StatusHeld      = "held"
+	StatusConfirmed = "confirmed"
+	StatusReleased  = "released"
+	StatusExpired   = "expired"
+)
+
+// MaxTTL is the longest a reservation may hold stock.
+const MaxTTL = 24 * time.Hour
+
+var (
+	// ErrNotFound is returned for unknown reservations, products and variants.
+	ErrNotFound = errors.New("reservation not found")
+	// ErrNotHeld is returned when confirming or releasing a reservation that no longer holds stock.
+	ErrNotHeld = errors.New("reservation is not held")
+	// ErrExpired is returned when confirming a reservation after it lapsed.
+	ErrExpired = errors.New("reservation expired")
+	// ErrReferenceHeld is returned when the reference already holds a reservation.
+	ErrReferenceHeld = errors.New("reference already holds a reservation")
+	// ErrDuplicateItem is returned for reservations listing a product or variant twice.
+	ErrDuplicateItem = errors.New("product or variant listed twice")
+)
+
+// InsufficientStockError is returned when an item asks for more than is
+// available to sell. It matches stock.ErrInsufficientStock.
+type InsufficientStockError struct {
+	Index     int // Position of the item in the reservation
+	Available int
+}
+
+func (e *InsufficientStockError) Error() string {
+	return fmt.Sprintf("item %d: only %d available", e.Index, e.Available)
+}
+
+func (e *InsufficientStockError) Unwrap() error {
+	return stock.ErrInsufficientStock
+}
+
+// DefaultTTL returns how long reservations hold stock unless asked otherwise,
+// from RESERVATION_TTL, by default 15 minutes.
+func DefaultTTL() time.Duration {
+	if d, err := time.ParseDuration(os.Getenv("RESERVATION_TTL")); err == nil && d > 0 {
+		return min(d, MaxTTL)
+	}
+	return 15 * time.Minute
+}
+
+// SweepInterval returns how often lapsed reservations are expired, from
+// RESERVATION_SWEEP_INTERVAL, by default every 30 seconds.
+func SweepInterval() time.Duration {
+	if d, err := time.ParseDuration(os.Getenv("RESERVATION_SWEEP_INTERVAL")); err == nil && d > 0 {
+		return d
+	}
+	return 30 * time.Second
+}
+
+// Reserve holds the reservation's items for ttl if enough of each is available
+// to sell. The products and variants are locked while checking, so concurrent
+// reservations cannot oversell. Call it inside a transaction.
+func Reserve(ctx context.Context, db bun.IDB, res *models.StockReservation, ttl time.Duration) error {
+	held, err := db.NewSelect().Model((*models.StockReservation)(nil)).
+		Where("sr.reference_id = ?", res.ReferenceID).
+		Where("sr.status = ?", StatusHeld).
+		Exists(ctx)
+	if err != nil {
+		return err
+	}
+	if held {
+		return ErrReferenceHeld
+	}
+
+	// Lock in a fixed order, so reservations of the same items cannot deadlock
+	order := make([]int, len(res.Items))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(a, b int) bool {
+		x, y := res.Items[order[a]], res.Items[order[b]]
+		return x.ProductID < y.ProductID || x.ProductID == y.ProductID && x.VariantID < y.VariantID
+	})
+	for n, i := range order {
+		item := res.Items[i]
+		if n > 0 {
+			prev := res.Items[order[n-1]]
+			if prev.ProductID == item.ProductID && prev.VariantID == item.VariantID {
+				return ErrDuplicateItem
+			}
+		}
+		if err := checkSellable(ctx, db, item.ProductID, item.VariantID); err != nil {
+			return err
+		}
+		if _, err := stock.Lock(ctx, db, item.ProductID, item.VariantID); err != nil {
+			return err
+		}
+		// Stock at inactive warehouses stays on hand but cannot be sold
+		sellable, err := stock.Sellable(ctx, db, item.ProductID, item.VariantID)
+		if err != nil {
+			return err
+		}
+		reserved, err := stock.Reserved(ctx, db, item.ProductID, item.VariantID, "")
+		if err != nil {
+			return err
+		}
+		if item.Quantity > sellable-reserved {
+			return &InsufficientStockError{Index: i, Available: max(sellable-reserved, 0)}
+		}
+	}
+
+	now := time.Now()
+	res.Status = StatusHeld
+	res.ExpiresAt = now.Add(ttl)
+	res.CreatedAt, res.UpdatedAt = now, now
+	if _, err := db.NewInsert().Model(res).Exec(ctx); err != nil {
+		return err
+	}
+	for i := range res.Items {
+		res.Items[i].ReservationID = res.ReservationID
+	}
+	_, err = db.NewInsert().Model(&res.Items).Exec(ctx)
+	return err
+}
+
+// checkSellable returns ErrNotFound unless the product, and the variant if
+// variantID is set, exist and are not deleted.
+func checkSellable(ctx context.Context, db bun.IDB, productID, variantID int64) error {
+	var exists bool
+	var err error
+	if variantID != 0 {
+		exists, err = db.NewSelect().Model((*models.ProductVariant)(nil)).
+			Where("v.variant_id = ?", variantID).
+			Where("v.product_id = ?", productID).
+			Exists(ctx)
+	} else {
+		exists, err = db.NewSelect().Model((*models.Product)(nil)).
+			Where("p.product_id = ?", productID).
+			Exists(ctx)
+	}
+	if err == nil && !exists {
+		err = ErrNotFound
+	}
+	return err
+}
+
+// heldItems restricts a query of reservation items to those of reservations
+// that still hold stock.
+func heldItems(q *bun.SelectQuery) *bun.SelectQuery {
+	return q.Join("JOIN stock_reservations AS sr ON sr.reservation_id = sri.reservation_id").
+		Where("sr.status = ?", StatusHeld).
+		Where("sr.expires_at > ?", time.Now())
+}
+
+// Find returns a reservation with its items.
+func Find(ctx context.Context, db bun.IDB, reservationID int64) (*models.StockReservation, error) {
+	res := &models.StockReservation{}
+	err := db.NewSelect().Model(res).
+		Relation("Items", func(q *bun.SelectQuery) *bun.SelectQuery {
+			return q.OrderExpr("sri.item_id")
+		}).
+		Where("sr.reservation_id = ?", reservationID).
+		Scan(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// lockHeld locks a reservation for the rest of the transaction and returns it
+// with its items, or ErrNotHeld if it no longer holds stock.
+func lockHeld(ctx context.Context, db bun.IDB, reservationID int64) (*models.StockReservation, error) {
+	res := &models.StockReservation{}
+	err := db.NewSelect().Model(res).
+		Where("sr.reservation_id = ?", reservationID).
+		For("UPDATE").
+		Scan(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if res.Status != StatusHeld {
+		return res, ErrNotHeld
+	}
+	err = db.NewSelect().Model(&res.Items).
+		Where("sri.reservation_id = ?", reservationID).
+		OrderExpr("sri.item_id").
+		Scan(ctx)
+	return res, err
+}
+
+// setStatus records the reservation's new status.
+func setStatus(ctx context.Context, db bun.IDB, res *models.StockReservation, status string) error {
+	res.Status = status
+	res.UpdatedAt = time.Now()
+	_, err := db.NewUpdate().Model(res).Column("status", "updated_at").WherePK().Exec(ctx)
+	return err
+}
+
+// Confirm takes a held reservation's items off hand, allocating each across
+// the warehouses by the configured strategy and recording the stock movements
+// as order movements with the reservation's reference. Items the order-placed
+// event for the same order ID already took are skipped. It returns the items
+// taken. Call it inside a transaction.
+func Confirm(ctx context.Context, db bun.IDB, reservationID, actorID int64) (*models.StockReservation, []models.StockReservationItem, error) {
+	res, err := lockHeld(ctx, db, reservationID)
+	if err != nil {
+		return res, nil, err
+	}
+	if !res.ExpiresAt.After(time.Now()) {
+		return res, nil, ErrExpired
+	}
+
+	var taken []models.StockReservationItem
+	for _, item := range res.Items {
+		tmpl := &models.StockMovement{
+			ProductID:   item.ProductID,
+			VariantID:   item.VariantID,
+			Reason:      stock.ReasonOrder,
+			ReferenceID: res.ReferenceID,
+			CreatedBy:   actorID,
+		}
+		_, err := stock.Take(ctx, db, tmpl, item.Quantity, stock.Strategy(), stock.Destination{})
+		if errors.Is(err, stock.ErrAlreadyRecorded) {
+			continue
+		}
+		if err != nil {
+			return res, nil, err
+		}
+		taken = append(taken, item)
+	}
+	return res, taken, setStatus(ctx, db, res, StatusConfirmed)
+}
+
+// Release gives a held reservation's stock back to sell. Call it inside a
+// transaction.
+func Release(ctx context.Context, db bun.IDB, reservationID int64) (*models.StockReservation, error) {
+	res, err := lockHeld(ctx, db, reservationID)
+	if err != nil {
+		return res, err
+	}
+	return res, setStatus(ctx, db, res, StatusReleased)
+}
+
+// Expire marks held reservations that lapsed by now as expired and returns
+// them with their items.
+func Expire(ctx context.Context, db bun.IDB, now time.Time) ([]models.StockReservation, error) {
+	var expired []models.StockReservation
+	err := db.NewUpdate().Model((*models.StockReservation)(nil)).
+		Set("status = ?", StatusExpired).
+		Set("updated_at = ?", now).
+		Where("status = ?", StatusHeld).
+		Where("expires_at <= ?", now).
+		Returning("*").
+		Scan(ctx, &expired)
+	if err != nil || len(expired) == 0 {
+		return expired, err
+	}
+
+	ids := make([]int64, len(expired))
+	byID := make(map[int64]*models.StockReservation, len(expired))
+	for i := range expired {
+		ids[i] = expired[i].ReservationID
+		byID[ids[i]] = &expired[i]
+	}
+	var items []models.StockReservationItem
+	err = db.NewSelect().Model(&items).
+		Where("sri.reservation_id IN (?)", bun.In(ids)).
+		OrderExpr("sri.item_id").
+		Scan(ctx)
+	for _, item := range items {
+		res := byID[item.ReservationID]
+		res.Items = append(res.Items, item)
+	}
+	return expired, err
+}
+
+// Sweep expires lapsed reservations and announces them with PublishReleases,
+// along with releases whose events failed earlier. Failures are logged, so it
+// can run on a timer.
+func Sweep(ctx context.Context, db bun.IDB, p *producer.ProducerManager) {
+	expired, err := Expire(ctx, db, time.Now())
+	if err != nil {
+		log.Printf("Failed to expire stock reservations: %v", err)
+	}
+	if len(expired) > 0 {
+		log.Printf("Expired %d stock reservations", len(expired))
+	}
+	if err := PublishReleases(ctx, db, p); err != nil {
+		log.Printf("Failed to emit StockReservationReleased events, retrying on the next sweep: %v", err)
+	}
+}
+
+// PublishReleases emits a StockReservationReleased event for every released
+// or expired reservation that has not been announced yet, oldest first, and
+// records each as announced once its event is out. It stops at the first
+// failure; the remaining reservations are announced by a later call.
+func PublishReleases(ctx context.Context, db bun.IDB, p *producer.ProducerManager) error {
+	var emitErr error
+	err := db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		var pending []models.StockReservation
+		err := tx.NewSelect().Model(&pending).
+			Relation("Items", func(q *bun.SelectQuery) *bun.SelectQuery {
+				return q.OrderExpr("sri.item_id")
+			}).
+			Where("sr.status IN (?)", bun.In([]string{StatusReleased, StatusExpired})).
+			Where("sr.release_sent_at IS NULL").
+			OrderExpr("sr.reservation_id").
+			Limit(100).
+			For("UPDATE OF sr SKIP LOCKED").
+			Scan(ctx)
+		if err != nil {
+			return err
+		}
+		for i := range pending {
+			if emitErr = p.EmitStockReservationReleasedEvent(ReleasedEvent(&pending[i])); emitErr != nil {
+				return nil
+			}
+			_, err := tx.NewUpdate().Model((*models.StockReservation)(nil)).
+				Set("release_sent_at = ?", time.Now()).
+				Where("reservation_id = ?", pending[i].ReservationID).
+				Exec(ctx)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return emitErr
+}
+
+// ReleasedEvent returns the event announcing that a released or expired
+// reservation's stock is available again.
+func ReleasedEvent(res *models.StockReservation) *messaging.StockReservationReleased {
+	event := &messaging.StockReservationReleased{
+		ReservationID: strconv.FormatInt(res.ReservationID, 10),
+		ReferenceID:   res.ReferenceID,
+		Status:        res.Status,
+		Items:         make([]messaging.ReservedItem, len(res.Items)),
+		ReleasedAt:    res.UpdatedAt,
+	}
+	for i, item := range res.Items {
+		event.Items[i] = messaging.ReservedItem{
+			ProductID: strconv.FormatInt(item.ProductID, 10),
+			Quantity:  item.Quantity,
+		}
+		if item.VariantID != 0 {
+			event.Items[i].VariantID = strconv.FormatInt(item.VariantID, 10)
+		}
+	}
+	return event
+}
+
+// Availability is the stock of a product or variant: on hand, held by
+// reservations, and available to sell, which is the stock at active
+// warehouses less what reservations hold.
+type Availability struct {
+	ProductID int64          `json:"product_id"`
+	VariantID int64          `json:"variant_id,omitempty"`
+	OnHand    int            `json:"on_hand"`
+	Reserved  int            `json:"reserved"`
+	Available int            `json:"available"`
+	Variants  []Availability `json:"variants,omitempty"` // For products with variants; the product's figures are their sums
+}
+
+// ProductAvailability returns the availability of a product and its variants.
+func ProductAvailability(ctx context.Context, db bun.IDB, productID int64) (*Availability, error) {
+	a := &Availability{ProductID: productID}
+	err := db.NewSelect().Model((*models.Product)(nil)).
+		Column("inventory_count").
+		Where("p.product_id = ?", productID).
+		Scan(ctx, &a.OnHand)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var reserved []struct {
+		VariantID int64 `bun:"variant_id"`
+		Quantity  int   `bun:"quantity"`
+	}
+	err = heldItems(db.NewSelect().Model((*models.StockReservationItem)(nil))).
+		ColumnExpr("COALESCE(sri.variant_id, 0) AS variant_id, SUM(sri.quantity) AS quantity").
+		Where("sri.product_id = ?", productID).
+		GroupExpr("COALESCE(sri.variant_id, 0)").
+		Scan(ctx, &reserved)
+	if err != nil {
+		return nil, err
+	}
+	byVariant := make(map[int64]int, len(reserved))
+	for _, r := range reserved {
+		byVariant[r.VariantID] = r.Quantity
+	}
+	var sellable []struct {
+		VariantID int64 `bun:"variant_id"`
+		Quantity  int   `bun:"quantity"`
+	}
+	err = db.NewSelect().Model((*models.WarehouseStock)(nil)).
+		ColumnExpr("COALESCE(ws.variant_id, 0) AS variant_id, SUM(ws.quantity) AS quantity").
+		Join("JOIN warehouses AS w ON w.warehouse_id = ws.warehouse_id").
+		Where("w.active").
+		Where("ws.product_id = ?", productID).
+		GroupExpr("COALESCE(ws.variant_id, 0)").
+		Scan(ctx, &sellable)
+	if err != nil {
+		return nil, err
+	}
+	sellableByVariant := make(map[int64]int, len(sellable))
+	for _, l := range sellable {
+		sellableByVariant[l.VariantID] = l.Quantity
+	}
+
+	list, err := variants.List(ctx, db, productID)
+	if err != nil {
+		return nil, err
+	}
+	if len(list) == 0 {
+		a.Reserved = byVariant[0]
+		a.Available = max(sellableByVariant[0]-a.Reserved, 0)
+	}
+	for _, v := range list {
+		available := max(sellableByVariant[v.VariantID]-byVariant[v.VariantID], 0)
+		a.Variants = append(a.Variants, Availability{
+			ProductID: productID,
+			VariantID: v.VariantID,
+			OnHand:    v.InventoryCount,
+			Reserved:  byVariant[v.VariantID],
+			Available: available,
+		})
+		a.Reserved += byVariant[v.VariantID]
+		a.Available += available
+	}
+	return a, nil
+}
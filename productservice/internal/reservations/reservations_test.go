@@ -0,0 +1,32 @@
+package reservations
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/hari134/pratilipi/productservice/internal/stock"
+)
+
+func TestDefaultTTL(t *testing.T) {
+	tests := map[string]time.Duration{
+		"":      15 * time.Minute,
+		"5m":    5 * time.Minute,
+		"72h":   MaxTTL,
+		"-1m":   15 * time.Minute,
+		"later": 15 * time.Minute,
+	}
+	for env, want := range tests {
+		t.Setenv("RESERVATION_TTL", env)
+		if got := DefaultTTL(); got != want {
+			t.Errorf("DefaultTTL with %q = %v, want %v", env, got, want)
+		}
+	}
+}
+
+func TestInsufficientStockError(t *testing.T) {
+	var err error = &InsufficientStockError{Index: 2, Available: 1}
+	if !errors.Is(err, stock.ErrInsufficientStock) {
+		t.Errorf("%v does not match stock.ErrInsufficientStock", err)
+	}
+}
@@ -0,0 +1,230 @@
+// Package search finds products by full-text search on their name and
+// description, with typo-tolerant trigram matching on the name, filters, sort
+// orders, facet counts and pagination.
+package search
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/hari134/pratilipi/productservice/internal/images"
+	"github.com/hari134/pratilipi/productservice/internal/variants"
+	"github.com/hari134/pratilipi/productservice/models"
+	"github.com/uptrace/bun"
+)
+
+// Sort orders. SortRelevance falls back to SortNewest without a query.
+const (
+	SortRelevance = "relevance"
+	SortPriceAsc  = "price_asc"
+	SortPriceDesc = "price_desc"
+	SortNewest    = "newest"
+	SortName      = "name"
+)
+
+const (
+	defaultLimit   = 20
+	maxLimit       = 100
+	maxQueryLength = 200
+)
+
+// PriceBucketBounds are the upper bounds of the price facet buckets; the last
+// bucket has no upper bound.
+var PriceBucketBounds = []float64{500, 1000, 5000, 10000}
+
+// Params select and order the products to return.
+type Params struct {
+	Query    string   // Words to search the name and description for; empty matches every product
+	MinPrice *float64 // Inclusive
+	MaxPrice *float64 // Inclusive
+	InStock  *bool    // Only products with (true) or without (false) inventory
+	Sort     string
+	Limit    int
+	Offset   int
+}
+
+// ParamsFromQuery reads Params from the query parameters q, min_price,
+// max_price, in_stock, sort, limit and offset.
+func ParamsFromQuery(q url.Values) (Params, error) {
+	p := Params{
+		Query: strings.TrimSpace(q.Get("q")),
+		Sort:  q.Get("sort"),
+		Limit: defaultLimit,
+	}
+	if len(p.Query) > maxQueryLength {
+		return p, fmt.Errorf("q must have at most %d characters", maxQueryLength)
+	}
+	for name, price := range map[string]**float64{"min_price": &p.MinPrice, "max_price": &p.MaxPrice} {
+		if v := q.Get(name); v != "" {
+			n, err := strconv.ParseFloat(v, 64)
+			if err != nil || n < 0 {
+				return p, fmt.Errorf("%s must be a price of at least 0", name)
+			}
+			*price = &n
+		}
+	}
+	if p.MinPrice != nil && p.MaxPrice != nil && *p.MinPrice > *p.MaxPrice {
+		return p, fmt.Errorf("min_price must not be greater than max_price")
+	}
+	if v := q.Get("in_stock"); v != "" {
+		inStock, err := strconv.ParseBool(v)
+		if err != nil {
+			return p, fmt.Errorf("in_stock must be true or false")
+		}
+		p.InStock = &inStock
+	}
+	switch p.Sort {
+	case "":
+		p.Sort = SortRelevance
+	case SortRelevance, SortPriceAsc, SortPriceDesc, SortNewest, SortName:
+	default:
+		return p, fmt.Errorf("sort must be one of %s, %s, %s, %s, %s", SortRelevance, SortPriceAsc, SortPriceDesc, SortNewest, SortName)
+	}
+	if v := q.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 {
+			return p, fmt.Errorf("limit must be a positive number")
+		}
+		p.Limit = limit
+	}
+	if p.Limit > maxLimit {
+		p.Limit = maxLimit
+	}
+	if v := q.Get("offset"); v != "" {
+		offset, err := strconv.Atoi(v)
+		if err != nil || offset < 0 {
+			return p, fmt.Errorf("offset must not be negative")
+		}
+		p.Offset = offset
+	}
+	return p, nil
+}
+
+// Result is one page of matching products, the number of matches across all
+// pages, and facet counts.
+type Result struct {
+	Products []models.Product `json:"products"`
+	Total    int              `json:"total"`
+	Facets   Facets           `json:"facets"`
+}
+
+// Facets count the matching products by price range and availability. Each
+// facet ignores its own filter, so it shows what choosing another value would give.
+type Facets struct {
+	Price        []PriceBucket `json:"price"`
+	Availability Availability  `json:"availability"`
+}
+
+// PriceBucket counts the products priced from Min up to, but not including, Max.
+type PriceBucket struct {
+	Min   float64  `json:"min"`
+	Max   *float64 `json:"max,omitempty"` // Unset for the last bucket
+	Count int      `json:"count"`
+}
+
+// Availability counts the products with and without inventory.
+type Availability struct {
+	InStock    int `json:"in_stock"`
+	OutOfStock int `json:"out_of_stock"`
+}
+
+// Search returns the products matching p. Soft-deleted products are never returned.
+func Search(ctx context.Context, db bun.IDB, p Params) (*Result, error) {
+	var products []models.Product
+	q := db.NewSelect().Model(&products).Relation("Categories").Relation("Variants", variants.Ordered).Relation("Images", images.Ordered).Limit(p.Limit).Offset(p.Offset)
+	q = p.filter(q, true, true)
+	switch {
+	case p.Sort == SortRelevance && p.Query != "":
+		q = q.OrderExpr("ts_rank(p.search_vector, websearch_to_tsquery('english', ?)) + word_similarity(?, p.name) DESC", p.Query, p.Query)
+	case p.Sort == SortPriceAsc:
+		q = q.OrderExpr("p.price ASC")
+	case p.Sort == SortPriceDesc:
+		q = q.OrderExpr("p.price DESC")
+	case p.Sort == SortName:
+		q = q.OrderExpr("lower(p.name) ASC")
+	default:
+		q = q.OrderExpr("p.created_at DESC")
+	}
+	q = q.OrderExpr("p.product_id DESC")
+	total, err := q.ScanAndCount(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &Result{Products: products, Total: total}
+	if result.Products == nil {
+		result.Products = []models.Product{}
+	}
+	if result.Facets.Price, err = p.priceFacet(ctx, db); err != nil {
+		return nil, err
+	}
+	if err := p.filter(db.NewSelect().Model((*models.Product)(nil)), true, false).
+		ColumnExpr("COUNT(*) FILTER (WHERE p.inventory_count > 0) AS in_stock").
+		ColumnExpr("COUNT(*) FILTER (WHERE p.inventory_count <= 0) AS out_of_stock").
+		Scan(ctx, &result.Facets.Availability.InStock, &result.Facets.Availability.OutOfStock); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// priceFacet counts the matching products in each price bucket, ignoring the price filter.
+func (p Params) priceFacet(ctx context.Context, db bun.IDB) ([]PriceBucket, error) {
+	var rows []struct {
+		Bucket int `bun:"bucket"`
+		Count  int `bun:"count"`
+	}
+	err := p.filter(db.NewSelect().Model((*models.Product)(nil)), false, true).
+		ColumnExpr("width_bucket(p.price, ARRAY[?]::numeric[]) AS bucket", bun.In(PriceBucketBounds)).
+		ColumnExpr("COUNT(*) AS count").
+		GroupExpr("bucket").
+		Scan(ctx, &rows)
+	if err != nil {
+		return nil, err
+	}
+
+	buckets := make([]PriceBucket, len(PriceBucketBounds)+1)
+	for i := range buckets {
+		if i > 0 {
+			buckets[i].Min = PriceBucketBounds[i-1]
+		}
+		if i < len(PriceBucketBounds) {
+			max := PriceBucketBounds[i]
+			buckets[i].Max = &max
+		}
+	}
+	for _, row := range rows {
+		if row.Bucket >= 0 && row.Bucket < len(buckets) {
+			buckets[row.Bucket].Count = row.Count
+		}
+	}
+	return buckets, nil
+}
+
+// filter adds the query and, when asked for, the price and stock filters. A
+// product matches the query if its name or description contains the words, or
+// its name contains a word close to the query, so small typos still match.
+func (p Params) filter(q *bun.SelectQuery, price, stock bool) *bun.SelectQuery {
+	if p.Query != "" {
+		q = q.WhereGroup(" AND ", func(q *bun.SelectQuery) *bun.SelectQuery {
+			return q.Where("p.search_vector @@ websearch_to_tsquery('english', ?)", p.Query).
+				WhereOr("? <% p.name", p.Query)
+		})
+	}
+	if price && p.MinPrice != nil {
+		q = q.Where("p.price >= ?", *p.MinPrice)
+	}
+	if price && p.MaxPrice != nil {
+		q = q.Where("p.price <= ?", *p.MaxPrice)
+	}
+	if stock && p.InStock != nil {
+		if *p.InStock {
+			q = q.Where("p.inventory_count > 0")
+		} else {
+			q = q.Where("p.inventory_count <= 0")
+		}
+	}
+	return q
+}
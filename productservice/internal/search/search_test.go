@@ -0,0 +1,49 @@
+package search
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestParamsFromQuery(t *testing.T) {
+	p, err := ParamsFromQuery(url.Values{
+		"q":         {"  running shoes "},
+		"min_price": {"100"},
+		"max_price": {"2500.50"},
+		"in_stock":  {"true"},
+		"sort":      {"price_asc"},
+		"limit":     {"500"},
+		"offset":    {"40"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Query != "running shoes" || *p.MinPrice != 100 || *p.MaxPrice != 2500.50 || !*p.InStock ||
+		p.Sort != SortPriceAsc || p.Limit != maxLimit || p.Offset != 40 {
+		t.Errorf("ParamsFromQuery() = %+v", p)
+	}
+
+	p, err = ParamsFromQuery(url.Values{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Sort != SortRelevance || p.Limit != defaultLimit || p.MinPrice != nil || p.InStock != nil {
+		t.Errorf("defaults = %+v", p)
+	}
+}
+
+func TestParamsFromQueryRejects(t *testing.T) {
+	for _, q := range []url.Values{
+		{"min_price": {"-1"}},
+		{"max_price": {"cheap"}},
+		{"min_price": {"200"}, "max_price": {"100"}},
+		{"in_stock": {"maybe"}},
+		{"sort": {"popularity"}},
+		{"limit": {"0"}},
+		{"offset": {"-5"}},
+	} {
+		if _, err := ParamsFromQuery(q); err == nil {
+			t.Errorf("ParamsFromQuery(%v) accepted invalid parameters", q)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package stock
+
+import (
+	"os"
+	"sort"
+	"strings"
+)
+
+// Allocation strategies, which decide the warehouses an order line ships from.
+const (
+	// StrategyNearest ships from the warehouse closest to the shipping
+	// address that has the whole quantity, splitting by distance otherwise.
+	StrategyNearest = "nearest"
+	// StrategyPriority ships from the highest-priority warehouse that has the
+	// whole quantity, splitting by priority otherwise.
+	StrategyPriority = "priority"
+	// StrategySplit takes stock from warehouses in priority order, splitting
+	// lines freely, so high-priority warehouses are emptied first.
+	StrategySplit = "split"
+)
+
+// Strategy returns the allocation strategy from ALLOCATION_STRATEGY, by
+// default StrategyPriority.
+func Strategy() string {
+	switch s := strings.ToLower(os.Getenv("ALLOCATION_STRATEGY")); s {
+	case StrategyNearest, StrategySplit:
+		return s
+	default:
+		return StrategyPriority
+	}
+}
+
+// Destination is where an order ships to. Distance is judged by country and
+// then by how many leading characters the postal codes share, which suits
+// hierarchical codes such as Indian PIN codes.
+type Destination struct {
+	Country    string
+	PostalCode string
+}
+
+// Level is the stock of an item at an active warehouse.
+type Level struct {
+	WarehouseID int64
+	Priority    int
+	Country     string
+	PostalCode  string
+	Quantity    int
+}
+
+// Allocation is the quantity of an order line taken from a warehouse.
+type Allocation struct {
+	WarehouseID int64
+	Quantity    int
+}
+
+// Allocate chooses the warehouses to take quantity from, by strategy. It
+// returns ErrInsufficientStock if the warehouses do not hold enough together.
+// Nearest allocation without a destination country falls back to priority.
+func Allocate(strategy string, levels []Level, dest Destination, quantity int) ([]Allocation, error) {
+	ranked := make([]Level, 0, len(levels))
+	total := 0
+	for _, l := range levels {
+		if l.Quantity > 0 {
+			ranked = append(ranked, l)
+			total += l.Quantity
+		}
+	}
+	if total < quantity {
+		return nil, ErrInsufficientStock
+	}
+
+	nearest := strategy == StrategyNearest && dest.Country != ""
+	sort.SliceStable(ranked, func(i, j int) bool {
+		a, b := ranked[i], ranked[j]
+		if nearest {
+			if da, db := distance(a, dest), distance(b, dest); da != db {
+				return da < db
+			}
+		}
+		if a.Priority != b.Priority {
+			return a.Priority < b.Priority
+		}
+		return a.WarehouseID < b.WarehouseID
+	})
+
+	if strategy != StrategySplit {
+		for _, l := range ranked {
+			if l.Quantity >= quantity {
+				return []Allocation{{WarehouseID: l.WarehouseID, Quantity: quantity}}, nil
+			}
+		}
+	}
+	var allocations []Allocation
+	for _, l := range ranked {
+		if quantity == 0 {
+			break
+		}
+		n := min(l.Quantity, quantity)
+		allocations = append(allocations, Allocation{WarehouseID: l.WarehouseID, Quantity: n})
+		quantity -= n
+	}
+	return allocations, nil
+}
+
+// distance ranks how far a warehouse is from the destination: warehouses in
+// another country come last, and within the country the more leading postal
+// code characters they share, the closer they are.
+func distance(l Level, dest Destination) int {
+	if !strings.EqualFold(l.Country, dest.Country) {
+		return 1 << 20
+	}
+	a, b := strings.ReplaceAll(l.PostalCode, " ", ""), strings.ReplaceAll(dest.PostalCode, " ", "")
+	shared := 0
+	for shared < len(a) && shared < len(b) && a[shared] == b[shared] {
+		shared++
+	}
+	return max(len(a), len(b)) - shared
+}
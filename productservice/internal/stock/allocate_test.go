@@ -0,0 +1,53 @@
+package stock
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestAllocate(t *testing.T) {
+	levels := []Level{
+		{WarehouseID: 1, Priority: 0, Country: "IN", PostalCode: "110001", Quantity: 5}, // Delhi
+		{WarehouseID: 2, Priority: 1, Country: "IN", PostalCode: "560001", Quantity: 8}, // Bengaluru
+		{WarehouseID: 3, Priority: 2, Country: "IN", PostalCode: "560095", Quantity: 3}, // Bengaluru
+		{WarehouseID: 4, Priority: 0, Country: "IN", PostalCode: "400001", Quantity: 0}, // Mumbai, empty
+	}
+	bengaluru := Destination{Country: "IN", PostalCode: "560 099"}
+	tests := []struct {
+		strategy string
+		dest     Destination
+		quantity int
+		want     []Allocation
+	}{
+		{StrategyPriority, bengaluru, 3, []Allocation{{1, 3}}},                 // Highest priority has it all
+		{StrategyPriority, bengaluru, 6, []Allocation{{2, 6}}},                 // Warehouse 1 is short
+		{StrategyPriority, bengaluru, 10, []Allocation{{1, 5}, {2, 5}}},        // Nobody has it all
+		{StrategyNearest, bengaluru, 3, []Allocation{{3, 3}}},                  // 56009 shares the most
+		{StrategyNearest, bengaluru, 4, []Allocation{{2, 4}}},                  // Nearest is short
+		{StrategyNearest, bengaluru, 12, []Allocation{{3, 3}, {2, 8}, {1, 1}}}, // Split by distance
+		{StrategyNearest, Destination{}, 3, []Allocation{{1, 3}}},              // Falls back to priority
+		{StrategyNearest, Destination{Country: "US"}, 3, []Allocation{{1, 3}}}, // No warehouse in the country
+		{StrategySplit, bengaluru, 7, []Allocation{{1, 5}, {2, 2}}},            // Empties high priority first
+		{StrategySplit, bengaluru, 16, []Allocation{{1, 5}, {2, 8}, {3, 3}}},
+	}
+	for _, tt := range tests {
+		got, err := Allocate(tt.strategy, levels, tt.dest, tt.quantity)
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Allocate(%s, %+v, %d) = %v, %v; want %v", tt.strategy, tt.dest, tt.quantity, got, err, tt.want)
+		}
+	}
+
+	if _, err := Allocate(StrategySplit, levels, bengaluru, 17); !errors.Is(err, ErrInsufficientStock) {
+		t.Errorf("Allocate beyond the stock on hand: err = %v, want ErrInsufficientStock", err)
+	}
+}
+
+func TestStrategy(t *testing.T) {
+	for env, want := range map[string]string{"": StrategyPriority, "Nearest": StrategyNearest, "split": StrategySplit, "closest": StrategyPriority} {
+		t.Setenv("ALLOCATION_STRATEGY", env)
+		if got := Strategy(); got != want {
+			t.Errorf("Strategy() with ALLOCATION_STRATEGY=%q = %q, want %q", env, got, want)
+		}
+	}
+}
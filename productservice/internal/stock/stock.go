@@ -0,0 +1,654 @@
+// Package stock keeps the inventory ledger. Every change to the inventory of
+// a product or variant at a warehouse is recorded as a stock movement, and the
+// on-hand quantity is the sum of the movements. The warehouse_stock rows and
+// the inventory_count columns cache those sums per warehouse and in total;
+// Check finds where they have drifted from the ledger.
+package stock
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/hari134/pratilipi/pkg/messaging"
+	"github.com/hari134/pratilipi/productservice/internal/variants"
+	"github.com/hari134/pratilipi/productservice/models"
+	"github.com/uptrace/bun"
+)
+
+var (
+	// ErrNotFound is returned for unknown products and variants.
+	ErrNotFound = errors.New("product or variant not found")
+	// ErrWarehouseNotFound is returned for unknown warehouses.
+	ErrWarehouseNotFound = errors.New("warehouse not found")
+	// ErrNoWarehouse is returned when stock needs a warehouse but none is active.
+	ErrNoWarehouse = errors.New("no active warehouse")
+	// ErrSameWarehouse is returned for transfers from a warehouse to itself.
+	ErrSameWarehouse = errors.New("cannot transfer within a warehouse")
+	// ErrInsufficientStock is returned for movements that would take the quantity below zero.
+	ErrInsufficientStock = errors.New("insufficient stock")
+	// ErrHasVariants is returned for movements of a product that has variants; their stock moves per variant.
+	ErrHasVariants = errors.New("product has variants")
+	// ErrAlreadyRecorded is returned when an order's movement for the item is already in the ledger.
+	ErrAlreadyRecorded = errors.New("order already recorded")
+)
+
+// Reasons for stock movements. Users post restocks, adjustments and returns;
+// the service records the others itself.
+const (
+	ReasonInitial    = "initial"    // Stock a product or variant was created with
+	ReasonOrder      = "order"      // Taken by an order; the reference is the order ID
+	ReasonRestock    = "restock"    // Received from a supplier
+	ReasonAdjustment = "adjustment" // Counted, damaged, lost or set by hand
+	ReasonReturn     = "return"     // Returned by a customer
+	ReasonTransfer   = "transfer"   // Moved between warehouses; the two movements share a reference
+)
+
+// Record adds a movement at m's warehouse, or the default warehouse if it is
+// zero, to the ledger and applies its delta to the cached inventory. A
+// movement taking stock fails with ErrInsufficientStock if it would leave
+// less than reservations hold. The product or variant is locked until the
+// transaction ends. m.BalanceAfter and m.WarehouseBalanceAfter are set to the
+// new quantities. Soft-deleted products
+// and variants are included, since orders placed before the deletion still
+// take their stock. Call it inside a transaction.
+func Record(ctx context.Context, db bun.IDB, m *models.StockMovement) error {
+	onHand, err := Lock(ctx, db, m.ProductID, m.VariantID)
+	if err != nil {
+		return err
+	}
+	if m.Reason == ReasonOrder {
+		if err := checkNotRecorded(ctx, db, m); err != nil {
+			return err
+		}
+	}
+	if m.WarehouseID, err = resolveWarehouse(ctx, db, m.WarehouseID); err != nil {
+		return err
+	}
+	atWarehouse, err := lockLevel(ctx, db, m.WarehouseID, m.ProductID, m.VariantID)
+	if err != nil {
+		return err
+	}
+	if atWarehouse+m.Delta < 0 {
+		return ErrInsufficientStock
+	}
+	if m.Delta < 0 {
+		if err := checkAvailable(ctx, db, m, -m.Delta); err != nil {
+			return err
+		}
+	}
+	m.BalanceAfter, m.WarehouseBalanceAfter = onHand+m.Delta, atWarehouse+m.Delta
+	return write(ctx, db, m)
+}
+
+// Set records the movement that brings the quantity of a product or variant
+// at m's warehouse, or the default warehouse, to count, with m's reason,
+// reference and note. It records nothing if the quantity already is count,
+// leaving m.MovementID zero. Like Record, it cannot take the quantity below
+// what reservations hold.
+func Set(ctx context.Context, db bun.IDB, m *models.StockMovement, count int) error {
+	onHand, err := Lock(ctx, db, m.ProductID, m.VariantID)
+	if err != nil {
+		return err
+	}
+	if m.WarehouseID, err = resolveWarehouse(ctx, db, m.WarehouseID); err != nil {
+		return err
+	}
+	atWarehouse, err := lockLevel(ctx, db, m.WarehouseID, m.ProductID, m.VariantID)
+	if err != nil {
+		return err
+	}
+	m.BalanceAfter, m.WarehouseBalanceAfter = onHand, atWarehouse
+	if count == atWarehouse {
+		return nil
+	}
+	if count < 0 {
+		return ErrInsufficientStock
+	}
+	if count < atWarehouse {
+		if err := checkAvailable(ctx, db, m, atWarehouse-count); err != nil {
+			return err
+		}
+	}
+	m.Delta = count - atWarehouse
+	m.BalanceAfter, m.WarehouseBalanceAfter = onHand+m.Delta, count
+	return write(ctx, db, m)
+}
+
+// Clear records the movements that empty every warehouse of the product or
+// variant, copying the reason, reference and note from tmpl.
+func Clear(ctx context.Context, db bun.IDB, tmpl *models.StockMovement) error {
+	onHand, err := Lock(ctx, db, tmpl.ProductID, tmpl.VariantID)
+	if err != nil {
+		return err
+	}
+	var levels []models.WarehouseStock
+	err = itemLevels(db.NewSelect().Model(&levels), tmpl.ProductID, tmpl.VariantID).
+		Where("ws.quantity > 0").
+		OrderExpr("ws.warehouse_id").
+		For("UPDATE").
+		Scan(ctx)
+	if err != nil {
+		return err
+	}
+	for _, l := range levels {
+		m := *tmpl
+		m.WarehouseID, m.Delta = l.WarehouseID, -l.Quantity
+		onHand -= l.Quantity
+		m.BalanceAfter, m.WarehouseBalanceAfter = onHand, 0
+		if err := write(ctx, db, &m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Opening records the stock a new product or variant was inserted with, at
+// the default warehouse. Its inventory_count must already hold count.
+func Opening(ctx context.Context, db bun.IDB, productID, variantID int64, count int, actorID int64) error {
+	if count == 0 {
+		return nil
+	}
+	warehouseID, err := resolveWarehouse(ctx, db, 0)
+	if err != nil {
+		return err
+	}
+	m := &models.StockMovement{
+		ProductID:             productID,
+		VariantID:             variantID,
+		WarehouseID:           warehouseID,
+		Delta:                 count,
+		Reason:                ReasonInitial,
+		BalanceAfter:          count,
+		WarehouseBalanceAfter: count,
+		CreatedBy:             actorID,
+	}
+	return write(ctx, db, m)
+}
+
+// Take allocates quantity of a product or variant across the active
+// warehouses by strategy and records a movement taking it from each, copying
+// the product, variant, reason, reference and actor from tmpl. Stock held by
+// reservations is not taken, except that of an order's own reservation. An
+// order is only taken once: if tmpl's order reference already took the item,
+// ErrAlreadyRecorded is returned. Call it inside a transaction.
+func Take(ctx context.Context, db bun.IDB, tmpl *models.StockMovement, quantity int, strategy string, dest Destination) ([]*models.StockMovement, error) {
+	onHand, err := Lock(ctx, db, tmpl.ProductID, tmpl.VariantID)
+	if err != nil {
+		return nil, err
+	}
+	if tmpl.Reason == ReasonOrder {
+		if err := checkNotRecorded(ctx, db, tmpl); err != nil {
+			return nil, err
+		}
+	}
+
+	var levels []Level
+	err = itemLevels(db.NewSelect().Model((*models.WarehouseStock)(nil)), tmpl.ProductID, tmpl.VariantID).
+		ColumnExpr("ws.warehouse_id, w.priority, w.country, w.postal_code, ws.quantity").
+		Join("JOIN warehouses AS w ON w.warehouse_id = ws.warehouse_id").
+		Where("w.active").
+		OrderExpr("ws.warehouse_id").
+		For("UPDATE OF ws").
+		Scan(ctx, &levels)
+	if err != nil {
+		return nil, err
+	}
+	// Only stock at active warehouses and not held by other reservations can be taken
+	sellable := 0
+	for _, l := range levels {
+		sellable += l.Quantity
+	}
+	reserved, err := Reserved(ctx, db, tmpl.ProductID, tmpl.VariantID, orderReference(tmpl))
+	if err != nil {
+		return nil, err
+	}
+	if quantity > sellable-reserved {
+		return nil, ErrInsufficientStock
+	}
+	allocations, err := Allocate(strategy, levels, dest, quantity)
+	if err != nil {
+		return nil, err
+	}
+
+	atWarehouse := make(map[int64]int, len(levels))
+	for _, l := range levels {
+		atWarehouse[l.WarehouseID] = l.Quantity
+	}
+	movements := make([]*models.StockMovement, len(allocations))
+	for i, a := range allocations {
+		m := *tmpl
+		m.WarehouseID, m.Delta = a.WarehouseID, -a.Quantity
+		onHand -= a.Quantity
+		m.BalanceAfter, m.WarehouseBalanceAfter = onHand, atWarehouse[a.WarehouseID]-a.Quantity
+		if err := write(ctx, db, &m); err != nil {
+			return nil, err
+		}
+		movements[i] = &m
+	}
+	return movements, nil
+}
+
+// Transfer moves quantity of a product or variant from one warehouse to
+// another, recording a transfer movement at each under a shared reference,
+// generated if reference is empty. The on-hand total does not change. Call it
+// inside a transaction.
+func Transfer(ctx context.Context, db bun.IDB, tmpl *models.StockMovement, fromID, toID int64, quantity int) ([]*models.StockMovement, error) {
+	if fromID == toID {
+		return nil, ErrSameWarehouse
+	}
+	onHand, err := Lock(ctx, db, tmpl.ProductID, tmpl.VariantID)
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range []int64{fromID, toID} {
+		if _, err := resolveWarehouse(ctx, db, id); err != nil {
+			return nil, err
+		}
+	}
+	// Lock the levels in a fixed order, so opposite transfers cannot deadlock
+	quantities := map[int64]int{}
+	for _, id := range []int64{min(fromID, toID), max(fromID, toID)} {
+		if quantities[id], err = lockLevel(ctx, db, id, tmpl.ProductID, tmpl.VariantID); err != nil {
+			return nil, err
+		}
+	}
+	if quantities[fromID] < quantity {
+		return nil, ErrInsufficientStock
+	}
+	if tmpl.ReferenceID == "" {
+		b := make([]byte, 6)
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+		tmpl.ReferenceID = "TRF-" + hex.EncodeToString(b)
+	}
+
+	out, in := *tmpl, *tmpl
+	out.Reason, in.Reason = ReasonTransfer, ReasonTransfer
+	out.WarehouseID, out.Delta, out.WarehouseBalanceAfter = fromID, -quantity, quantities[fromID]-quantity
+	in.WarehouseID, in.Delta, in.WarehouseBalanceAfter = toID, quantity, quantities[toID]+quantity
+	out.BalanceAfter, in.BalanceAfter = onHand, onHand
+	for _, m := range []*models.StockMovement{&out, &in} {
+		if err := write(ctx, db, m); err != nil {
+			return nil, err
+		}
+	}
+	return []*models.StockMovement{&out, &in}, nil
+}
+
+// Lock locks the product or variant for the rest of the transaction and
+// returns its on-hand quantity over all warehouses.
+func Lock(ctx context.Context, db bun.IDB, productID, variantID int64) (int, error) {
+	var current int
+	var err error
+	if variantID != 0 {
+		err = db.NewSelect().Model((*models.ProductVariant)(nil)).
+			Column("inventory_count").
+			WhereAllWithDeleted().
+			Where("v.variant_id = ?", variantID).
+			Where("v.product_id = ?", productID).
+			For("UPDATE").
+			Scan(ctx, &current)
+	} else {
+		err = db.NewSelect().Model((*models.Product)(nil)).
+			Column("inventory_count").
+			WhereAllWithDeleted().
+			Where("p.product_id = ?", productID).
+			For("UPDATE").
+			Scan(ctx, &current)
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, ErrNotFound
+	}
+	if err != nil {
+		return 0, err
+	}
+	if variantID == 0 {
+		hasVariants, err := variants.HasVariants(ctx, db, productID)
+		if err != nil {
+			return 0, err
+		}
+		if hasVariants {
+			return 0, ErrHasVariants
+		}
+	}
+	return current, nil
+}
+
+// DefaultWarehouse returns the active warehouse with the highest priority,
+// which receives stock when no warehouse is named.
+func DefaultWarehouse(ctx context.Context, db bun.IDB) (int64, error) {
+	var id int64
+	err := db.NewSelect().Model((*models.Warehouse)(nil)).
+		Column("warehouse_id").
+		Where("w.active").
+		OrderExpr("w.priority, w.warehouse_id").
+		Limit(1).
+		Scan(ctx, &id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, ErrNoWarehouse
+	}
+	return id, err
+}
+
+// resolveWarehouse returns the default warehouse for zero, and otherwise
+// checks that the warehouse exists.
+func resolveWarehouse(ctx context.Context, db bun.IDB, warehouseID int64) (int64, error) {
+	if warehouseID == 0 {
+		return DefaultWarehouse(ctx, db)
+	}
+	exists, err := db.NewSelect().Model((*models.Warehouse)(nil)).Where("w.warehouse_id = ?", warehouseID).Exists(ctx)
+	if err == nil && !exists {
+		err = ErrWarehouseNotFound
+	}
+	return warehouseID, err
+}
+
+// itemLevels restricts a query of warehouse stock to a product or variant.
+func itemLevels(q *bun.SelectQuery, productID, variantID int64) *bun.SelectQuery {
+	return q.Where("ws.product_id = ?", productID).Where("COALESCE(ws.variant_id, 0) = ?", variantID)
+}
+
+// lockLevel locks the stock of a product or variant at a warehouse, creating
+// it if needed, and returns its quantity.
+func lockLevel(ctx context.Context, db bun.IDB, warehouseID, productID, variantID int64) (int, error) {
+	level := &models.WarehouseStock{WarehouseID: warehouseID, ProductID: productID, VariantID: variantID}
+	_, err := db.NewInsert().Model(level).
+		On("CONFLICT (product_id, COALESCE(variant_id, 0), warehouse_id) DO NOTHING").
+		Exec(ctx)
+	if err != nil {
+		return 0, err
+	}
+	var quantity int
+	err = itemLevels(db.NewSelect().Model((*models.WarehouseStock)(nil)), productID, variantID).
+		Column("quantity").
+		Where("ws.warehouse_id = ?", warehouseID).
+		For("UPDATE").
+		Scan(ctx, &quantity)
+	return quantity, err
+}
+
+// Reserved returns the quantity of a product, or of one of its variants, held
+// by reservations that have not lapsed, leaving out the reservation of
+// exceptReference if it is set.
+func Reserved(ctx context.Context, db bun.IDB, productID, variantID int64, exceptReference string) (int, error) {
+	var reserved int
+	q := db.NewSelect().Model((*models.StockReservationItem)(nil)).
+		ColumnExpr("COALESCE(SUM(sri.quantity), 0)").
+		Join("JOIN stock_reservations AS sr ON sr.reservation_id = sri.reservation_id").
+		Where("sr.status = 'held'").
+		Where("sr.expires_at > ?", time.Now()).
+		Where("sri.product_id = ?", productID).
+		Where("COALESCE(sri.variant_id, 0) = ?", variantID)
+	if exceptReference != "" {
+		q = q.Where("sr.reference_id != ?", exceptReference)
+	}
+	err := q.Scan(ctx, &reserved)
+	return reserved, err
+}
+
+// Sellable returns the quantity of a product or variant at active warehouses.
+// Stock at inactive warehouses stays on hand but cannot be sold or reserved.
+func Sellable(ctx context.Context, db bun.IDB, productID, variantID int64) (int, error) {
+	var sellable int
+	err := itemLevels(db.NewSelect().Model((*models.WarehouseStock)(nil)), productID, variantID).
+		ColumnExpr("COALESCE(SUM(ws.quantity), 0)").
+		Join("JOIN warehouses AS w ON w.warehouse_id = ws.warehouse_id").
+		Where("w.active").
+		Scan(ctx, &sellable)
+	return sellable, err
+}
+
+// orderReference returns the reference of an order movement, whose own
+// reservation it may take stock from, and "" for other movements.
+func orderReference(m *models.StockMovement) string {
+	if m.Reason == ReasonOrder {
+		return m.ReferenceID
+	}
+	return ""
+}
+
+// checkAvailable returns ErrInsufficientStock if taking quantity of the item
+// of m off its warehouse would leave less stock at active warehouses than
+// reservations hold. Stock at inactive warehouses is not sellable, so taking it
+// is always allowed.
+func checkAvailable(ctx context.Context, db bun.IDB, m *models.StockMovement, quantity int) error {
+	active, err := db.NewSelect().Model((*models.Warehouse)(nil)).
+		Where("w.warehouse_id = ?", m.WarehouseID).
+		Where("w.active").
+		Exists(ctx)
+	if err != nil || !active {
+		return err
+	}
+	sellable, err := Sellable(ctx, db, m.ProductID, m.VariantID)
+	if err != nil {
+		return err
+	}
+	reserved, err := Reserved(ctx, db, m.ProductID, m.VariantID, orderReference(m))
+	if err != nil {
+		return err
+	}
+	if quantity > sellable-reserved {
+		return ErrInsufficientStock
+	}
+	return nil
+}
+
+// checkNotRecorded returns ErrAlreadyRecorded if m's order already took the item.
+func checkNotRecorded(ctx context.Context, db bun.IDB, m *models.StockMovement) error {
+	recorded, err := db.NewSelect().Model((*models.StockMovement)(nil)).
+		Where("sm.reason = ?", ReasonOrder).
+		Where("sm.reference_id = ?", m.ReferenceID).
+		Where("sm.product_id = ?", m.ProductID).
+		Where("COALESCE(sm.variant_id, 0) = ?", m.VariantID).
+		Exists(ctx)
+	if err == nil && recorded {
+		err = ErrAlreadyRecorded
+	}
+	return err
+}
+
+// write inserts the movement, whose balances must already be set, and caches
+// them in the warehouse stock and the inventory of the product or variant.
+func write(ctx context.Context, db bun.IDB, m *models.StockMovement) error {
+	m.CreatedAt = time.Now()
+	if _, err := db.NewInsert().Model(m).Exec(ctx); err != nil {
+		return err
+	}
+
+	level := &models.WarehouseStock{
+		WarehouseID: m.WarehouseID,
+		ProductID:   m.ProductID,
+		VariantID:   m.VariantID,
+		Quantity:    m.WarehouseBalanceAfter,
+	}
+	_, err := db.NewInsert().Model(level).
+		On("CONFLICT (product_id, COALESCE(variant_id, 0), warehouse_id) DO UPDATE").
+		Set("quantity = EXCLUDED.quantity").
+		Exec(ctx)
+	if err != nil {
+		return err
+	}
+
+	if m.VariantID != 0 {
+		_, err := db.NewUpdate().Model((*models.ProductVariant)(nil)).
+			Set("inventory_count = ?", m.BalanceAfter).
+			Set("updated_at = ?", m.CreatedAt).
+			WhereAllWithDeleted().
+			Where("variant_id = ?", m.VariantID).
+			Exec(ctx)
+		if err != nil {
+			return err
+		}
+		return variants.SyncProductInventory(ctx, db, m.ProductID)
+	}
+	q := db.NewUpdate().Model((*models.Product)(nil)).
+		Set("inventory_count = ?", m.BalanceAfter).
+		Set("updated_at = ?", m.CreatedAt).
+		WhereAllWithDeleted().
+		Where("product_id = ?", m.ProductID)
+	if m.CreatedBy != 0 {
+		q = q.Set("updated_by = ?", m.CreatedBy)
+	}
+	_, err = q.Exec(ctx)
+	return err
+}
+
+// LocationLevel is the stock of a product or variant at a warehouse.
+type LocationLevel struct {
+	WarehouseID int64  `bun:"warehouse_id" json:"warehouse_id"`
+	Code        string `bun:"code" json:"code"`
+	VariantID   int64  `bun:"variant_id" json:"variant_id,omitempty"`
+	Quantity    int    `bun:"quantity" json:"quantity"`
+}
+
+// Levels returns the stock of a product and its variants at each warehouse
+// holding or having held some, ordered by variant and warehouse.
+func Levels(ctx context.Context, db bun.IDB, productID int64) ([]LocationLevel, error) {
+	levels := []LocationLevel{}
+	err := db.NewSelect().Model((*models.WarehouseStock)(nil)).
+		ColumnExpr("ws.warehouse_id, w.code, COALESCE(ws.variant_id, 0) AS variant_id, ws.quantity").
+		Join("JOIN warehouses AS w ON w.warehouse_id = ws.warehouse_id").
+		Where("ws.product_id = ?", productID).
+		OrderExpr("3, w.priority, ws.warehouse_id").
+		Scan(ctx, &levels)
+	return levels, err
+}
+
+// InventoryEvent returns the ProductInventoryUpdated event for a product, or
+// one of its variants, with its total and per-warehouse counts.
+func InventoryEvent(ctx context.Context, db bun.IDB, productID, variantID int64) (*messaging.ProductInventoryUpdated, error) {
+	event := &messaging.ProductInventoryUpdated{ProductID: strconv.FormatInt(productID, 10)}
+	var err error
+	if variantID != 0 {
+		event.VariantID = strconv.FormatInt(variantID, 10)
+		err = db.NewSelect().Model((*models.ProductVariant)(nil)).
+			Column("inventory_count").
+			WhereAllWithDeleted().
+			Where("v.variant_id = ?", variantID).
+			Scan(ctx, &event.InventoryCount)
+	} else {
+		err = db.NewSelect().Model((*models.Product)(nil)).
+			Column("inventory_count").
+			WhereAllWithDeleted().
+			Where("p.product_id = ?", productID).
+			Scan(ctx, &event.InventoryCount)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	levels, err := Levels(ctx, db, productID)
+	if err != nil {
+		return nil, err
+	}
+	for _, l := range levels {
+		if l.VariantID == variantID {
+			event.Locations = append(event.Locations, messaging.InventoryLocation{
+				WarehouseID:    strconv.FormatInt(l.WarehouseID, 10),
+				Code:           l.Code,
+				InventoryCount: l.Quantity,
+			})
+		}
+	}
+	return event, nil
+}
+
+// HistoryFilter selects stock movements. Zero fields match everything.
+type HistoryFilter struct {
+	ProductID   int64
+	VariantID   int64
+	WarehouseID int64
+	Reason      string
+	Limit       int
+	Offset      int
+}
+
+// History returns a page of the movements matching f, newest first, and the
+// total number of matches.
+func History(ctx context.Context, db bun.IDB, f HistoryFilter) ([]models.StockMovement, int, error) {
+	movements := []models.StockMovement{}
+	q := db.NewSelect().Model(&movements).
+		OrderExpr("sm.movement_id DESC").
+		Limit(f.Limit).
+		Offset(f.Offset)
+	if f.ProductID != 0 {
+		q = q.Where("sm.product_id = ?", f.ProductID)
+	}
+	if f.VariantID != 0 {
+		q = q.Where("sm.variant_id = ?", f.VariantID)
+	}
+	if f.WarehouseID != 0 {
+		q = q.Where("sm.warehouse_id = ?", f.WarehouseID)
+	}
+	if f.Reason != "" {
+		q = q.Where("sm.reason = ?", f.Reason)
+	}
+	total, err := q.ScanAndCount(ctx)
+	return movements, total, err
+}
+
+// Discrepancy is a product or variant whose cached inventory differs from the
+// sum of its stock movements, in total or, if WarehouseID is set, at a warehouse.
+type Discrepancy struct {
+	ProductID      int64 `bun:"product_id" json:"product_id"`
+	VariantID      int64 `bun:"variant_id" json:"variant_id,omitempty"`
+	WarehouseID    int64 `bun:"warehouse_id" json:"warehouse_id,omitempty"`
+	InventoryCount int   `bun:"inventory_count" json:"inventory_count"` // Cached quantity
+	LedgerCount    int   `bun:"ledger_count" json:"ledger_count"`       // Sum of the movements
+}
+
+// Check compares the cached inventory of every product without variants and
+// every variant with its ledger, in total and at each warehouse. Deleted
+// variants are left out. If productID is not zero, only that product is
+// checked. For products with variants it compares the product's inventory with
+// the sum of its variants' inventory instead, as the ledger count.
+func Check(ctx context.Context, db bun.IDB, productID int64) ([]Discrepancy, error) {
+	discrepancies := []Discrepancy{}
+	err := db.NewRaw(`
+		SELECT * FROM (
+			SELECT p.product_id, 0 AS variant_id, 0 AS warehouse_id, p.inventory_count,
+				COALESCE((SELECT SUM(sm.delta) FROM stock_movements sm WHERE sm.product_id = p.product_id AND sm.variant_id IS NULL), 0) AS ledger_count
+			FROM products p
+			WHERE (? = 0 OR p.product_id = ?)
+				AND NOT EXISTS (SELECT 1 FROM product_variants v WHERE v.product_id = p.product_id AND v.deleted_at IS NULL)
+			UNION ALL
+			SELECT v.product_id, v.variant_id, 0, v.inventory_count,
+				COALESCE((SELECT SUM(sm.delta) FROM stock_movements sm WHERE sm.variant_id = v.variant_id), 0)
+			FROM product_variants v
+			WHERE (? = 0 OR v.product_id = ?) AND v.deleted_at IS NULL
+			UNION ALL
+			SELECT p.product_id, 0, 0, p.inventory_count,
+				(SELECT SUM(v.inventory_count) FROM product_variants v WHERE v.product_id = p.product_id AND v.deleted_at IS NULL)
+			FROM products p
+			WHERE (? = 0 OR p.product_id = ?)
+				AND EXISTS (SELECT 1 FROM product_variants v WHERE v.product_id = p.product_id AND v.deleted_at IS NULL)
+			UNION ALL
+			SELECT COALESCE(ws.product_id, l.product_id), COALESCE(ws.variant_id, l.variant_id, 0),
+				COALESCE(ws.warehouse_id, l.warehouse_id), COALESCE(ws.quantity, 0), COALESCE(l.ledger_count, 0)
+			FROM (SELECT * FROM warehouse_stock WHERE ? = 0 OR product_id = ?) ws
+			FULL JOIN (
+				SELECT sm.product_id, sm.variant_id, sm.warehouse_id, SUM(sm.delta) AS ledger_count
+				FROM stock_movements sm
+				WHERE ? = 0 OR sm.product_id = ?
+				GROUP BY sm.product_id, sm.variant_id, sm.warehouse_id
+			) l ON l.product_id = ws.product_id
+				AND COALESCE(l.variant_id, 0) = COALESCE(ws.variant_id, 0)
+				AND l.warehouse_id = ws.warehouse_id
+			WHERE NOT EXISTS (
+				SELECT 1 FROM product_variants v
+				WHERE v.variant_id = COALESCE(ws.variant_id, l.variant_id) AND v.deleted_at IS NOT NULL
+			)
+		) counts
+		WHERE inventory_count <> ledger_count
+		ORDER BY product_id, variant_id, warehouse_id`,
+		productID, productID, productID, productID, productID, productID,
+		productID, productID, productID, productID,
+	).Scan(ctx, &discrepancies)
+	return discrepancies, err
+}
@@ -0,0 +1,190 @@
+// Package variants manages the variants of products, such as sizes and colors.
+// Each variant has its own SKU, attribute values, price and inventory. The
+// inventory of a product with variants is the sum of its variants' inventory.
+package variants
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/hari134/pratilipi/productservice/models"
+	"github.com/uptrace/bun"
+)
+
+var (
+	// ErrNotFound is returned for unknown variants.
+	ErrNotFound = errors.New("variant not found")
+	// ErrInvalidSKU is returned for SKUs that are not uppercase words joined by hyphens, underscores or dots.
+	ErrInvalidSKU = errors.New("invalid SKU")
+	// ErrSKUTaken is returned when another variant already has the SKU.
+	ErrSKUTaken = errors.New("SKU already in use")
+	// ErrDuplicateAttributes is returned when another variant of the product has the same attribute values.
+	ErrDuplicateAttributes = errors.New("another variant has the same attributes")
+)
+
+const (
+	maxAttributes           = 10
+	maxAttributeNameLength  = 50
+	maxAttributeValueLength = 100
+)
+
+var skuPattern = regexp.MustCompile(`^[A-Z0-9]+([-_.][A-Z0-9]+)*$`)
+
+// NormalizeSKU trims and uppercases a SKU, e.g. " tshirt-red-m" becomes "TSHIRT-RED-M".
+func NormalizeSKU(sku string) string {
+	return strings.ToUpper(strings.TrimSpace(sku))
+}
+
+// ValidSKU reports whether sku is uppercase letters and digits, in words joined
+// by single hyphens, underscores or dots, of at most 64 characters.
+func ValidSKU(sku string) bool {
+	return len(sku) <= 64 && skuPattern.MatchString(sku)
+}
+
+// NormalizeAttributes trims attribute names and values and lowercases the
+// names, so "Color" and "color " are the same attribute. It returns a message
+// describing the first problem, or "" if the attributes are valid.
+func NormalizeAttributes(attributes map[string]string) (map[string]string, string) {
+	if len(attributes) > maxAttributes {
+		return nil, fmt.Sprintf("must have at most %d attributes", maxAttributes)
+	}
+	normalized := make(map[string]string, len(attributes))
+	for name, value := range attributes {
+		name, value = strings.ToLower(strings.TrimSpace(name)), strings.TrimSpace(value)
+		switch {
+		case name == "" || value == "":
+			return nil, "must have non-empty names and values"
+		case len(name) > maxAttributeNameLength:
+			return nil, fmt.Sprintf("must have names of at most %d characters", maxAttributeNameLength)
+		case len(value) > maxAttributeValueLength:
+			return nil, fmt.Sprintf("must have values of at most %d characters", maxAttributeValueLength)
+		}
+		if _, ok := normalized[name]; ok {
+			return nil, fmt.Sprintf("must not repeat the attribute %q", name)
+		}
+		normalized[name] = value
+	}
+	return normalized, ""
+}
+
+// Ordered orders variants by position, for loading them with
+// Relation("Variants", variants.Ordered).
+func Ordered(q *bun.SelectQuery) *bun.SelectQuery {
+	return q.OrderExpr("v.position, v.variant_id")
+}
+
+// List returns the variants of a product, ordered by position.
+func List(ctx context.Context, db bun.IDB, productID int64) ([]models.ProductVariant, error) {
+	variants := []models.ProductVariant{}
+	err := Ordered(db.NewSelect().Model(&variants).Where("v.product_id = ?", productID)).Scan(ctx)
+	return variants, err
+}
+
+// Find returns a variant of a product.
+func Find(ctx context.Context, db bun.IDB, productID, variantID int64) (*models.ProductVariant, error) {
+	variant := &models.ProductVariant{}
+	err := db.NewSelect().Model(variant).
+		Where("v.variant_id = ?", variantID).
+		Where("v.product_id = ?", productID).
+		Scan(ctx)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return variant, nil
+}
+
+// HasVariants reports whether the product has variants. The inventory of such
+// a product is only changed through its variants.
+func HasVariants(ctx context.Context, db bun.IDB, productID int64) (bool, error) {
+	return db.NewSelect().Model((*models.ProductVariant)(nil)).Where("v.product_id = ?", productID).Exists(ctx)
+}
+
+// Save inserts a new variant or updates the SKU, attributes, price and
+// position of an existing one. The SKU and attributes must already be
+// normalized. The inventory is only set on insert; after that it changes
+// through the stock ledger.
+func Save(ctx context.Context, db bun.IDB, variant *models.ProductVariant) error {
+	if !ValidSKU(variant.SKU) {
+		return ErrInvalidSKU
+	}
+	if variant.Attributes == nil {
+		variant.Attributes = map[string]string{}
+	}
+	taken, err := db.NewSelect().Model((*models.ProductVariant)(nil)).
+		Where("v.sku = ?", variant.SKU).
+		Where("v.variant_id != ?", variant.VariantID).
+		Exists(ctx)
+	if err != nil {
+		return err
+	}
+	if taken {
+		return ErrSKUTaken
+	}
+	duplicate, err := db.NewSelect().Model((*models.ProductVariant)(nil)).
+		Where("v.product_id = ?", variant.ProductID).
+		Where("v.attributes = ?::jsonb", variant.Attributes).
+		Where("v.variant_id != ?", variant.VariantID).
+		Exists(ctx)
+	if err != nil {
+		return err
+	}
+	if duplicate {
+		return ErrDuplicateAttributes
+	}
+
+	variant.UpdatedAt = time.Now()
+	if variant.VariantID == 0 {
+		variant.CreatedAt = variant.UpdatedAt
+		if _, err := db.NewInsert().Model(variant).Exec(ctx); err != nil {
+			return err
+		}
+		return SyncProductInventory(ctx, db, variant.ProductID)
+	}
+	res, err := db.NewUpdate().Model(variant).
+		Column("sku", "attributes", "price", "position", "updated_at").
+		WherePK().
+		Where("product_id = ?", variant.ProductID).
+		Exec(ctx)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrNotFound
+	}
+	return err
+}
+
+// Delete soft-deletes a variant, so orders can keep referring to it, and takes
+// its inventory out of the product's.
+func Delete(ctx context.Context, db bun.IDB, productID, variantID int64) error {
+	res, err := db.NewDelete().Model((*models.ProductVariant)(nil)).
+		Where("variant_id = ?", variantID).
+		Where("product_id = ?", productID).
+		Exec(ctx)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrNotFound
+	}
+	return SyncProductInventory(ctx, db, productID)
+}
+
+// SyncProductInventory sets the inventory of a product to the sum of its
+// variants' inventory, so stock filters keep working on products.
+func SyncProductInventory(ctx context.Context, db bun.IDB, productID int64) error {
+	_, err := db.NewUpdate().Model((*models.Product)(nil)).
+		Set("inventory_count = (SELECT COALESCE(SUM(inventory_count), 0) FROM product_variants WHERE product_id = ? AND deleted_at IS NULL)", productID).
+		WhereAllWithDeleted().
+		Where("product_id = ?", productID).
+		Exec(ctx)
+	return err
+}
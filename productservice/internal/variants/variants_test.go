@@ -0,0 +1,44 @@
+package variants
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestValidSKU(t *testing.T) {
+	for _, sku := range []string{"TSHIRT-RED-M", "A1", "SHOE_42.5"} {
+		if !ValidSKU(sku) {
+			t.Errorf("ValidSKU(%q) = false", sku)
+		}
+	}
+	for _, sku := range []string{"", "tshirt-red-m", "TSHIRT--RED", "-TSHIRT", "TSHIRT RED", strings.Repeat("A", 65)} {
+		if ValidSKU(sku) {
+			t.Errorf("ValidSKU(%q) = true", sku)
+		}
+	}
+	if got := NormalizeSKU(" tshirt-red-m "); got != "TSHIRT-RED-M" {
+		t.Errorf("NormalizeSKU = %q", got)
+	}
+}
+
+func TestNormalizeAttributes(t *testing.T) {
+	got, msg := NormalizeAttributes(map[string]string{" Color ": " Red ", "size": "M"})
+	if msg != "" {
+		t.Fatalf("NormalizeAttributes failed: %s", msg)
+	}
+	if want := map[string]string{"color": "Red", "size": "M"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("NormalizeAttributes = %v, want %v", got, want)
+	}
+
+	for _, attributes := range []map[string]string{
+		{"color": ""},
+		{" ": "red"},
+		{"Color": "red", "color": "blue"},
+		{"color": strings.Repeat("r", 101)},
+	} {
+		if _, msg := NormalizeAttributes(attributes); msg == "" {
+			t.Errorf("NormalizeAttributes(%v) accepted", attributes)
+		}
+	}
+}
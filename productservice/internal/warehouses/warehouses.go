@@ -0,0 +1,106 @@
+// Package warehouses manages the locations stock is kept at. The stock itself
+// is moved by package stock.
+package warehouses
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"regexp"
+	"time"
+
+	"github.com/hari134/pratilipi/productservice/models"
+	"github.com/uptrace/bun"
+)
+
+var (
+	// ErrNotFound is returned for unknown warehouses.
+	ErrNotFound = errors.New("warehouse not found")
+	// ErrCodeTaken is returned when another warehouse already has the code.
+	ErrCodeTaken = errors.New("code already in use")
+	// ErrInvalidCode is returned for codes that are not uppercase words joined by hyphens.
+	ErrInvalidCode = errors.New("invalid code")
+	// ErrLastActive is returned when deactivating the only active warehouse.
+	ErrLastActive = errors.New("last active warehouse")
+)
+
+var codePattern = regexp.MustCompile(`^[A-Z0-9]+(-[A-Z0-9]+)*$`)
+
+// ValidCode reports whether code is uppercase letters and digits, in words
+// joined by single hyphens, e.g. "BLR-1".
+func ValidCode(code string) bool {
+	return len(code) <= 32 && codePattern.MatchString(code)
+}
+
+// List returns all warehouses, in priority order.
+func List(ctx context.Context, db bun.IDB) ([]models.Warehouse, error) {
+	list := []models.Warehouse{}
+	err := db.NewSelect().Model(&list).OrderExpr("w.priority, w.warehouse_id").Scan(ctx)
+	return list, err
+}
+
+// Find returns the warehouse with the ID.
+func Find(ctx context.Context, db bun.IDB, warehouseID int64) (*models.Warehouse, error) {
+	warehouse := &models.Warehouse{}
+	err := db.NewSelect().Model(warehouse).Where("w.warehouse_id = ?", warehouseID).Scan(ctx)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return warehouse, nil
+}
+
+// Save inserts a new warehouse or updates an existing one. At least one
+// warehouse must stay active, to receive stock that names none. Call it
+// inside a transaction.
+func Save(ctx context.Context, db bun.IDB, warehouse *models.Warehouse) error {
+	if !ValidCode(warehouse.Code) {
+		return ErrInvalidCode
+	}
+	taken, err := db.NewSelect().Model((*models.Warehouse)(nil)).
+		Where("w.code = ?", warehouse.Code).
+		Where("w.warehouse_id != ?", warehouse.WarehouseID).
+		Exists(ctx)
+	if err != nil {
+		return err
+	}
+	if taken {
+		return ErrCodeTaken
+	}
+
+	warehouse.UpdatedAt = time.Now()
+	if warehouse.WarehouseID == 0 {
+		warehouse.CreatedAt = warehouse.UpdatedAt
+		_, err = db.NewInsert().Model(warehouse).Exec(ctx)
+		return err
+	}
+	if !warehouse.Active {
+		// Lock the active warehouses, so two deactivations cannot both pass
+		var others []int64
+		err := db.NewSelect().Model((*models.Warehouse)(nil)).
+			Column("warehouse_id").
+			Where("w.active").
+			Where("w.warehouse_id != ?", warehouse.WarehouseID).
+			For("UPDATE").
+			Scan(ctx, &others)
+		if err != nil {
+			return err
+		}
+		if len(others) == 0 {
+			return ErrLastActive
+		}
+	}
+	res, err := db.NewUpdate().Model(warehouse).
+		Column("code", "name", "country", "postal_code", "priority", "active", "updated_at").
+		WherePK().
+		Exec(ctx)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrNotFound
+	}
+	return err
+}
@@ -0,0 +1,16 @@
+package warehouses
+
+import "testing"
+
+func TestValidCode(t *testing.T) {
+	for _, code := range []string{"MAIN", "BLR-1", "DEL-NORTH-2"} {
+		if !ValidCode(code) {
+			t.Errorf("ValidCode(%q) = false", code)
+		}
+	}
+	for _, code := range []string{"", "blr-1", "BLR-", "-BLR", "BLR--1", "BLR 1", "ABCDEFGHIJKLMNOPQRSTUVWXYZ-0123456"} {
+		if ValidCode(code) {
+			t.Errorf("ValidCode(%q) = true", code)
+		}
+	}
+}
@@ -0,0 +1,4 @@
+ALTER TABLE products
+    ADD COLUMN deleted_at TIMESTAMP,   -- Set when the product is soft-deleted
+    ADD COLUMN created_by INT,         -- User who created the product
+    ADD COLUMN updated_by INT;         -- User who last updated the product
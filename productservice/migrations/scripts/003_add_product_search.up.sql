@@ -0,0 +1,27 @@
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+
+--bun:split
+
+-- Names weigh more than descriptions when ranking matches
+ALTER TABLE products
+    ADD COLUMN search_vector tsvector GENERATED ALWAYS AS (
+        setweight(to_tsvector('english', coalesce(name, '')), 'A') ||
+        setweight(to_tsvector('english', coalesce(description, '')), 'B')
+    ) STORED;                          -- Full-text search document, kept up to date by Postgres
+
+
+--bun:split
+
+CREATE INDEX products_search_vector_idx ON products USING GIN (search_vector);
+
+
+--bun:split
+
+-- Trigram index for matching misspelled names
+CREATE INDEX products_name_trgm_idx ON products USING GIN (name gin_trgm_ops);
+
+
+--bun:split
+
+CREATE INDEX products_price_idx ON products (price) WHERE deleted_at IS NULL;
@@ -0,0 +1,28 @@
+CREATE TABLE categories (
+    category_id SERIAL PRIMARY KEY,                     -- Unique identifier for each category
+    parent_id INT REFERENCES categories(category_id),   -- Parent category; NULL for root categories
+    name VARCHAR(100) NOT NULL,                         -- Display name
+    slug VARCHAR(100) NOT NULL UNIQUE,                  -- URL-friendly unique name, e.g. 'running-shoes'
+    position INT NOT NULL DEFAULT 0,                    -- Order among siblings
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,     -- Category creation timestamp
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP      -- Timestamp for last update
+);
+
+
+--bun:split
+
+CREATE INDEX categories_parent_id_idx ON categories (parent_id, position);
+
+
+--bun:split
+
+CREATE TABLE product_categories (
+    product_id INT NOT NULL REFERENCES products(product_id) ON DELETE CASCADE,
+    category_id INT NOT NULL REFERENCES categories(category_id) ON DELETE CASCADE,
+    PRIMARY KEY (product_id, category_id)
+);
+
+
+--bun:split
+
+CREATE INDEX product_categories_category_id_idx ON product_categories (category_id);
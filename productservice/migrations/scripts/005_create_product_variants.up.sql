@@ -0,0 +1,22 @@
+CREATE TABLE product_variants (
+    variant_id SERIAL PRIMARY KEY,                      -- Unique identifier for each variant
+    product_id INT NOT NULL REFERENCES products(product_id), -- Parent product
+    sku VARCHAR(64) NOT NULL,                           -- Stock keeping unit, e.g. 'TSHIRT-RED-M'
+    attributes JSONB NOT NULL DEFAULT '{}',             -- Attribute values, e.g. {"color": "red", "size": "m"}
+    price DECIMAL(10, 2) NOT NULL,                      -- Variant price
+    inventory_count INT NOT NULL DEFAULT 0,             -- Available inventory of the variant
+    position INT NOT NULL DEFAULT 0,                    -- Order among the product's variants
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,     -- Variant creation timestamp
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,     -- Timestamp for last update
+    deleted_at TIMESTAMP                                -- Set when the variant is soft-deleted; orders keep referring to it
+);
+
+
+--bun:split
+
+CREATE UNIQUE INDEX product_variants_sku_idx ON product_variants (sku) WHERE deleted_at IS NULL;
+
+
+--bun:split
+
+CREATE UNIQUE INDEX product_variants_attributes_idx ON product_variants (product_id, attributes) WHERE deleted_at IS NULL;
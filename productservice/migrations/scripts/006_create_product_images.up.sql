@@ -0,0 +1,19 @@
+CREATE TABLE product_images (
+    image_id SERIAL PRIMARY KEY,                        -- Unique identifier for each image
+    product_id INT NOT NULL REFERENCES products(product_id) ON DELETE CASCADE, -- Product shown
+    storage_key VARCHAR(255) NOT NULL,                  -- Blob store key of the uploaded image
+    thumbnail_key VARCHAR(255) NOT NULL,                -- Blob store key of the thumbnail
+    content_type VARCHAR(50) NOT NULL,                  -- e.g. 'image/jpeg'
+    size_bytes INT NOT NULL,                            -- Size of the uploaded image
+    width INT NOT NULL,                                 -- Width of the uploaded image in pixels
+    height INT NOT NULL,                                -- Height of the uploaded image in pixels
+    alt_text VARCHAR(200),                              -- Description for screen readers
+    position INT NOT NULL DEFAULT 0,                    -- Order among the product's images; the first is the main image
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,     -- Upload timestamp
+    created_by INT                                      -- User who uploaded the image
+);
+
+
+--bun:split
+
+CREATE INDEX product_images_product_id_idx ON product_images (product_id, position);
@@ -0,0 +1,63 @@
+CREATE TABLE stock_movements (
+    movement_id BIGSERIAL PRIMARY KEY,                  -- Order in which movements were recorded
+    product_id INT NOT NULL REFERENCES products(product_id), -- Product whose stock moved
+    variant_id INT REFERENCES product_variants(variant_id), -- Variant whose stock moved; NULL for products without variants
+    delta INT NOT NULL CHECK (delta <> 0),              -- Units added (positive) or removed (negative)
+    reason VARCHAR(20) NOT NULL CHECK (reason IN ('initial', 'order', 'restock', 'adjustment', 'return')),
+    reference_id VARCHAR(100),                          -- What caused it, e.g. the order ID or a purchase order number
+    note TEXT,                                          -- Free-form explanation
+    balance_after INT NOT NULL CHECK (balance_after >= 0), -- On-hand quantity after the movement
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    created_by INT                                      -- User who caused the movement
+);
+
+
+--bun:split
+
+CREATE INDEX stock_movements_product_id_idx ON stock_movements (product_id, movement_id);
+
+
+--bun:split
+
+CREATE INDEX stock_movements_variant_id_idx ON stock_movements (variant_id, movement_id) WHERE variant_id IS NOT NULL;
+
+
+--bun:split
+
+-- An order takes stock off each of its items once, even if its event is delivered again
+CREATE UNIQUE INDEX stock_movements_order_idx ON stock_movements (reference_id, product_id, COALESCE(variant_id, 0)) WHERE reason = 'order';
+
+
+--bun:split
+
+-- Movements can be added but never changed or removed; corrections are new adjustments
+CREATE FUNCTION stock_movements_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'stock_movements is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+
+--bun:split
+
+CREATE TRIGGER stock_movements_append_only
+    BEFORE UPDATE OR DELETE ON stock_movements
+    FOR EACH ROW EXECUTE FUNCTION stock_movements_append_only();
+
+
+--bun:split
+
+-- Open the ledger with the stock on hand, so it adds up to the current counts
+INSERT INTO stock_movements (product_id, delta, reason, note, balance_after)
+SELECT p.product_id, p.inventory_count, 'initial', 'Stock on hand when the ledger was introduced', p.inventory_count
+FROM products p
+WHERE p.inventory_count <> 0
+    AND NOT EXISTS (SELECT 1 FROM product_variants v WHERE v.product_id = p.product_id AND v.deleted_at IS NULL);
+
+
+--bun:split
+
+INSERT INTO stock_movements (product_id, variant_id, delta, reason, note, balance_after)
+SELECT v.product_id, v.variant_id, v.inventory_count, 'initial', 'Stock on hand when the ledger was introduced', v.inventory_count
+FROM product_variants v
+WHERE v.inventory_count <> 0 AND v.deleted_at IS NULL;
@@ -0,0 +1,48 @@
+CREATE TABLE stock_reservations (
+    reservation_id BIGSERIAL PRIMARY KEY,               -- Unique identifier for each reservation
+    reference_id VARCHAR(100) NOT NULL,                 -- What the stock is held for, e.g. the order ID
+    status VARCHAR(10) NOT NULL DEFAULT 'held' CHECK (status IN ('held', 'confirmed', 'released', 'expired')),
+    expires_at TIMESTAMP NOT NULL,                      -- When a held reservation lapses
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP, -- Timestamp of the last status change
+    created_by INT,                                     -- User or service user who reserved the stock
+    release_sent_at TIMESTAMP                           -- When stock-reservation-released was emitted for a released or expired reservation
+);
+
+
+--bun:split
+
+-- A reference holds at most one reservation at a time, so retried requests cannot hold stock twice
+CREATE UNIQUE INDEX stock_reservations_reference_id_idx ON stock_reservations (reference_id) WHERE status = 'held';
+
+
+--bun:split
+
+CREATE INDEX stock_reservations_expires_at_idx ON stock_reservations (expires_at) WHERE status = 'held';
+
+
+--bun:split
+
+-- Released and expired reservations whose event still has to go out
+CREATE INDEX stock_reservations_unannounced_idx ON stock_reservations (reservation_id) WHERE status IN ('released', 'expired') AND release_sent_at IS NULL;
+
+
+--bun:split
+
+CREATE TABLE stock_reservation_items (
+    item_id BIGSERIAL PRIMARY KEY,                      -- Unique identifier for each item
+    reservation_id BIGINT NOT NULL REFERENCES stock_reservations(reservation_id) ON DELETE CASCADE,
+    product_id INT NOT NULL REFERENCES products(product_id), -- Product held
+    variant_id INT REFERENCES product_variants(variant_id), -- Variant held; NULL for products without variants
+    quantity INT NOT NULL CHECK (quantity > 0)          -- Units held
+);
+
+
+--bun:split
+
+CREATE INDEX stock_reservation_items_reservation_id_idx ON stock_reservation_items (reservation_id);
+
+
+--bun:split
+
+CREATE INDEX stock_reservation_items_product_id_idx ON stock_reservation_items (product_id, variant_id);
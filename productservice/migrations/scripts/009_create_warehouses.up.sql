@@ -0,0 +1,92 @@
+CREATE TABLE warehouses (
+    warehouse_id SERIAL PRIMARY KEY,                    -- Unique identifier for each warehouse
+    code VARCHAR(32) NOT NULL UNIQUE,                   -- Short name, e.g. 'BLR-1'
+    name VARCHAR(100) NOT NULL,                         -- Display name
+    country CHAR(2) NOT NULL,                           -- ISO 3166-1 alpha-2 code, for nearest allocation
+    postal_code VARCHAR(20) NOT NULL DEFAULT '',        -- Postal code, for nearest allocation
+    priority INT NOT NULL DEFAULT 0,                    -- Lower ships first under priority allocation
+    active BOOLEAN NOT NULL DEFAULT TRUE,               -- Inactive warehouses keep their stock but are not allocated from
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,     -- Warehouse creation timestamp
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP      -- Timestamp for last update
+);
+
+
+--bun:split
+
+-- All stock so far was in one place
+INSERT INTO warehouses (code, name, country) VALUES ('MAIN', 'Main warehouse', 'IN');
+
+
+--bun:split
+
+CREATE TABLE warehouse_stock (
+    stock_id SERIAL PRIMARY KEY,                        -- Unique identifier for each stock level
+    warehouse_id INT NOT NULL REFERENCES warehouses(warehouse_id), -- Where the stock is
+    product_id INT NOT NULL REFERENCES products(product_id), -- Product stocked
+    variant_id INT REFERENCES product_variants(variant_id), -- Variant stocked; NULL for products without variants
+    quantity INT NOT NULL DEFAULT 0 CHECK (quantity >= 0) -- Units on hand at the warehouse
+);
+
+
+--bun:split
+
+CREATE UNIQUE INDEX warehouse_stock_item_idx ON warehouse_stock (product_id, COALESCE(variant_id, 0), warehouse_id);
+
+
+--bun:split
+
+INSERT INTO warehouse_stock (warehouse_id, product_id, quantity)
+SELECT w.warehouse_id, p.product_id, p.inventory_count
+FROM products p, warehouses w
+WHERE w.code = 'MAIN' AND p.inventory_count <> 0
+    AND NOT EXISTS (SELECT 1 FROM product_variants v WHERE v.product_id = p.product_id AND v.deleted_at IS NULL);
+
+
+--bun:split
+
+INSERT INTO warehouse_stock (warehouse_id, product_id, variant_id, quantity)
+SELECT w.warehouse_id, v.product_id, v.variant_id, v.inventory_count
+FROM product_variants v, warehouses w
+WHERE w.code = 'MAIN' AND v.inventory_count <> 0 AND v.deleted_at IS NULL;
+
+
+--bun:split
+
+ALTER TABLE stock_movements
+    ADD COLUMN warehouse_id INT REFERENCES warehouses(warehouse_id), -- Where the stock moved
+    ADD COLUMN warehouse_balance_after INT CHECK (warehouse_balance_after >= 0), -- Quantity at the warehouse after the movement
+    DROP CONSTRAINT stock_movements_reason_check,
+    ADD CONSTRAINT stock_movements_reason_check CHECK (reason IN ('initial', 'order', 'restock', 'adjustment', 'return', 'transfer'));
+
+
+--bun:split
+
+-- Attribute the existing ledger to the main warehouse; the only change ever made to recorded movements
+ALTER TABLE stock_movements DISABLE TRIGGER stock_movements_append_only;
+
+
+--bun:split
+
+UPDATE stock_movements
+SET warehouse_id = (SELECT warehouse_id FROM warehouses WHERE code = 'MAIN'), warehouse_balance_after = balance_after;
+
+
+--bun:split
+
+ALTER TABLE stock_movements ENABLE TRIGGER stock_movements_append_only;
+
+
+--bun:split
+
+ALTER TABLE stock_movements ALTER COLUMN warehouse_id SET NOT NULL, ALTER COLUMN warehouse_balance_after SET NOT NULL;
+
+
+--bun:split
+
+-- An order takes an item's stock once from each warehouse it is allocated to
+DROP INDEX stock_movements_order_idx;
+
+
+--bun:split
+
+CREATE UNIQUE INDEX stock_movements_order_idx ON stock_movements (reference_id, product_id, COALESCE(variant_id, 0), warehouse_id) WHERE reason = 'order';
@@ -0,0 +1,31 @@
+ALTER TABLE products
+    ADD COLUMN reorder_threshold INT NOT NULL DEFAULT 0 CHECK (reorder_threshold >= 0), -- Stock at or below this is low; 0 turns low-stock alerts off
+    ADD COLUMN stock_status VARCHAR(20) NOT NULL DEFAULT 'in_stock' CHECK (stock_status IN ('in_stock', 'low_stock', 'out_of_stock')); -- Last alerted stock level
+
+
+--bun:split
+
+UPDATE products SET stock_status = 'out_of_stock' WHERE inventory_count = 0;
+
+
+--bun:split
+
+CREATE TABLE stock_subscriptions (
+    subscription_id BIGSERIAL PRIMARY KEY,              -- Unique identifier for each subscription
+    product_id INT NOT NULL REFERENCES products(product_id), -- Product the user waits for
+    variant_id INT REFERENCES product_variants(variant_id), -- Variant the user waits for; NULL for any of the product's stock
+    user_id INT NOT NULL,                               -- User to notify
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    notified_at TIMESTAMP                               -- When the back-in-stock event was emitted; NULL while waiting
+);
+
+
+--bun:split
+
+-- A user waits for an item at most once at a time
+CREATE UNIQUE INDEX stock_subscriptions_waiting_idx ON stock_subscriptions (product_id, COALESCE(variant_id, 0), user_id) WHERE notified_at IS NULL;
+
+
+--bun:split
+
+CREATE INDEX stock_subscriptions_user_id_idx ON stock_subscriptions (user_id);
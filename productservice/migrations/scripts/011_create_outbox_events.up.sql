@@ -0,0 +1,14 @@
+CREATE TABLE outbox_events (
+    id BIGSERIAL PRIMARY KEY,                       -- Publication order
+    topic VARCHAR(100) NOT NULL,                    -- Kafka topic, e.g. 'product-out-of-stock'
+    payload JSONB NOT NULL,                         -- Event body
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP, -- Written in the same transaction as the change
+    published_at TIMESTAMP,                         -- Set once Kafka accepted the event
+    attempts INT NOT NULL DEFAULT 0,                -- Failed publish attempts
+    last_error TEXT                                 -- Error of the last failed attempt
+);
+
+
+--bun:split
+
+CREATE INDEX idx_outbox_events_unpublished ON outbox_events (id) WHERE published_at IS NULL;
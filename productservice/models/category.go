@@ -0,0 +1,31 @@
+package models
+
+import (
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+// Category is a node of the category tree. Root categories have no parent.
+type Category struct {
+	bun.BaseModel `bun:"table:categories,alias:c"`
+
+	CategoryID int64       `bun:"category_id,pk,autoincrement" json:"category_id"`                 // Primary key
+	ParentID   int64       `bun:"parent_id,nullzero" json:"parent_id,omitempty"`                   // Parent category, unset for roots
+	Name       string      `bun:"name,notnull" json:"name"`                                        // Display name
+	Slug       string      `bun:"slug,unique,notnull" json:"slug"`                                 // URL-friendly unique name, e.g. "running-shoes"
+	Position   int         `bun:"position,notnull" json:"position"`                                // Order among siblings
+	CreatedAt  time.Time   `bun:"created_at,nullzero,default:current_timestamp" json:"created_at"` // Creation timestamp
+	UpdatedAt  time.Time   `bun:"updated_at,nullzero,default:current_timestamp" json:"updated_at"` // Timestamp for last update
+	Children   []*Category `bun:"-" json:"children,omitempty"`                                     // Filled in when listing the tree
+}
+
+// ProductCategory assigns a product to a category.
+type ProductCategory struct {
+	bun.BaseModel `bun:"table:product_categories,alias:pc"`
+
+	ProductID  int64     `bun:"product_id,pk"`
+	Product    *Product  `bun:"rel:belongs-to,join:product_id=product_id"`
+	CategoryID int64     `bun:"category_id,pk"`
+	Category   *Category `bun:"rel:belongs-to,join:category_id=category_id"`
+}
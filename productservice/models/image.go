@@ -0,0 +1,29 @@
+package models
+
+import (
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+// ProductImage is an uploaded picture of a product. The image and its
+// thumbnail are kept in the blob store; URL and ThumbnailURL are filled in
+// from their keys before the image is returned.
+type ProductImage struct {
+	bun.BaseModel `bun:"table:product_images,alias:img"`
+
+	ImageID      int64     `bun:"image_id,pk,autoincrement" json:"image_id"`                       // Primary key
+	ProductID    int64     `bun:"product_id,notnull" json:"product_id"`                            // Product shown
+	StorageKey   string    `bun:"storage_key,notnull" json:"-"`                                    // Blob store key of the uploaded image
+	ThumbnailKey string    `bun:"thumbnail_key,notnull" json:"-"`                                  // Blob store key of the thumbnail
+	ContentType  string    `bun:"content_type,notnull" json:"content_type"`                        // e.g. "image/jpeg"
+	SizeBytes    int       `bun:"size_bytes,notnull" json:"size_bytes"`                            // Size of the uploaded image
+	Width        int       `bun:"width,notnull" json:"width"`                                      // In pixels
+	Height       int       `bun:"height,notnull" json:"height"`                                    // In pixels
+	AltText      string    `bun:"alt_text,nullzero" json:"alt_text"`                               // Description for screen readers
+	Position     int       `bun:"position,notnull" json:"position"`                                // Order among the product's images
+	CreatedAt    time.Time `bun:"created_at,nullzero,default:current_timestamp" json:"created_at"` // Upload timestamp
+	CreatedBy    int64     `bun:"created_by,nullzero" json:"created_by,omitempty"`                 // User who uploaded the image
+	URL          string    `bun:"-" json:"url"`
+	ThumbnailURL string    `bun:"-" json:"thumbnail_url"`
+}
@@ -1,14 +1,28 @@
 package models
 
-import "time"
+import (
+    "time"
+
+    "github.com/hari134/pratilipi/pkg/db"
+    "github.com/uptrace/bun"
+)
 
 // Product represents a product in the Product Service.
 type Product struct {
+    bun.BaseModel `bun:"table:products,alias:p"`
+
     ProductID      int64     `bun:"product_id,pk,autoincrement"`  // Primary key
     Name           string    `bun:"name,notnull"`                 // Product name
     Description    string    `bun:"description,nullzero"`         // Product description
     Price          float64   `bun:"price,notnull"`                // Product price
     InventoryCount int       `bun:"inventory_count,notnull" json:"inventorycount"`      // Available inventory
+    ReorderThreshold int     `bun:"reorder_threshold,notnull" json:"reorder_threshold"` // Inventory at or below this is low; 0 turns low-stock alerts off
+    StockStatus    string    `bun:"stock_status,notnull" json:"stock_status"`      // in_stock, low_stock or out_of_stock, as last alerted
     CreatedAt      time.Time `bun:"created_at,nullzero,default:current_timestamp"` // Timestamp when the product was created
     UpdatedAt      time.Time `bun:"updated_at,nullzero,default:current_timestamp"` // Timestamp for last update
+    Categories     []Category `bun:"m2m:product_categories,join:Product=Category"` // Categories the product is in
+    Variants       []ProductVariant `bun:"rel:has-many,join:product_id=product_id"` // Sizes, colors and the like, each with its own SKU, price and inventory
+    Images         []ProductImage `bun:"rel:has-many,join:product_id=product_id"` // Pictures, the main one first
+    db.SoftDelete                                                        // deleted_at, hidden from default queries
+    db.Audit                                                             // created_by and updated_by
 }
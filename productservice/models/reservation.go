@@ -0,0 +1,35 @@
+package models
+
+import (
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+// StockReservation holds stock for a reference, such as an order awaiting
+// payment, until it is confirmed, released or expires. Held stock is not
+// available to sell but stays on hand until the reservation is confirmed.
+type StockReservation struct {
+	bun.BaseModel `bun:"table:stock_reservations,alias:sr"`
+
+	ReservationID int64                  `bun:"reservation_id,pk,autoincrement" json:"reservation_id"`           // Primary key
+	ReferenceID   string                 `bun:"reference_id,notnull" json:"reference_id"`                        // e.g. the order ID
+	Status        string                 `bun:"status,notnull" json:"status"`                                    // held, confirmed, released or expired
+	ExpiresAt     time.Time              `bun:"expires_at,notnull" json:"expires_at"`                            // When a held reservation lapses
+	CreatedAt     time.Time              `bun:"created_at,nullzero,default:current_timestamp" json:"created_at"` // Reservation timestamp
+	UpdatedAt     time.Time              `bun:"updated_at,nullzero,default:current_timestamp" json:"updated_at"` // Timestamp of the last status change
+	CreatedBy     int64                  `bun:"created_by,nullzero" json:"created_by,omitempty"`                 // User who reserved the stock
+	ReleaseSentAt time.Time              `bun:"release_sent_at,nullzero" json:"-"`                               // When the release or expiry was announced
+	Items         []StockReservationItem `bun:"rel:has-many,join:reservation_id=reservation_id" json:"items"`
+}
+
+// StockReservationItem is the quantity of one product or variant a reservation holds.
+type StockReservationItem struct {
+	bun.BaseModel `bun:"table:stock_reservation_items,alias:sri"`
+
+	ItemID        int64 `bun:"item_id,pk,autoincrement" json:"-"`               // Primary key
+	ReservationID int64 `bun:"reservation_id,notnull" json:"-"`                 // Reservation holding the item
+	ProductID     int64 `bun:"product_id,notnull" json:"product_id"`            // Product held
+	VariantID     int64 `bun:"variant_id,nullzero" json:"variant_id,omitempty"` // Variant held, if any
+	Quantity      int   `bun:"quantity,notnull" json:"quantity"`                // Units held
+}
@@ -0,0 +1,27 @@
+package models
+
+import (
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+// StockMovement is an entry in the append-only inventory ledger. The
+// inventory of a product or variant is the sum of its movements' deltas;
+// inventory_count caches it.
+type StockMovement struct {
+	bun.BaseModel `bun:"table:stock_movements,alias:sm"`
+
+	MovementID            int64     `bun:"movement_id,pk,autoincrement" json:"movement_id"`                 // Primary key, in recording order
+	ProductID             int64     `bun:"product_id,notnull" json:"product_id"`                            // Product whose stock moved
+	VariantID             int64     `bun:"variant_id,nullzero" json:"variant_id,omitempty"`                 // Variant whose stock moved, if any
+	WarehouseID           int64     `bun:"warehouse_id,notnull" json:"warehouse_id"`                        // Where the stock moved
+	Delta                 int       `bun:"delta,notnull" json:"delta"`                                      // Units added (positive) or removed (negative)
+	Reason                string    `bun:"reason,notnull" json:"reason"`                                    // initial, order, restock, adjustment, return or transfer
+	ReferenceID           string    `bun:"reference_id,nullzero" json:"reference_id,omitempty"`             // e.g. the order ID
+	Note                  string    `bun:"note,nullzero" json:"note,omitempty"`                             // Free-form explanation
+	BalanceAfter          int       `bun:"balance_after,notnull" json:"balance_after"`                      // On-hand quantity after the movement, over all warehouses
+	WarehouseBalanceAfter int       `bun:"warehouse_balance_after,notnull" json:"warehouse_balance_after"`  // Quantity at the warehouse after the movement
+	CreatedAt             time.Time `bun:"created_at,nullzero,default:current_timestamp" json:"created_at"` // Recording timestamp
+	CreatedBy             int64     `bun:"created_by,nullzero" json:"created_by,omitempty"`                 // User who caused the movement
+}
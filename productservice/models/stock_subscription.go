@@ -0,0 +1,20 @@
+package models
+
+import (
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+// StockSubscription is a user's request to be told when a product or variant
+// that ran out is back in stock.
+type StockSubscription struct {
+	bun.BaseModel `bun:"table:stock_subscriptions,alias:ss"`
+
+	SubscriptionID int64      `bun:"subscription_id,pk,autoincrement" json:"subscription_id"`         // Primary key
+	ProductID      int64      `bun:"product_id,notnull" json:"product_id"`                            // Product the user waits for
+	VariantID      int64      `bun:"variant_id,nullzero" json:"variant_id,omitempty"`                 // Variant the user waits for, if any
+	UserID         int64      `bun:"user_id,notnull" json:"user_id"`                                  // User to notify
+	CreatedAt      time.Time  `bun:"created_at,nullzero,default:current_timestamp" json:"created_at"` // Subscription timestamp
+	NotifiedAt     *time.Time `bun:"notified_at" json:"notified_at,omitempty"`                        // When the user was notified; nil while waiting
+}
@@ -0,0 +1,25 @@
+package models
+
+import (
+	"time"
+
+	"github.com/hari134/pratilipi/pkg/db"
+	"github.com/uptrace/bun"
+)
+
+// ProductVariant is a sellable version of a product, such as a size and color,
+// with its own SKU, price and inventory.
+type ProductVariant struct {
+	bun.BaseModel `bun:"table:product_variants,alias:v"`
+
+	VariantID      int64             `bun:"variant_id,pk,autoincrement" json:"variant_id"`                   // Primary key
+	ProductID      int64             `bun:"product_id,notnull" json:"product_id"`                            // Parent product
+	SKU            string            `bun:"sku,notnull" json:"sku"`                                          // Stock keeping unit, unique among variants
+	Attributes     map[string]string `bun:"attributes,type:jsonb,notnull" json:"attributes"`                 // Attribute values, e.g. {"color": "red", "size": "m"}
+	Price          float64           `bun:"price,notnull" json:"price"`                                      // Variant price
+	InventoryCount int               `bun:"inventory_count,notnull" json:"inventory_count"`                  // Available inventory
+	Position       int               `bun:"position,notnull" json:"position"`                                // Order among the product's variants
+	CreatedAt      time.Time         `bun:"created_at,nullzero,default:current_timestamp" json:"created_at"` // Creation timestamp
+	UpdatedAt      time.Time         `bun:"updated_at,nullzero,default:current_timestamp" json:"updated_at"` // Timestamp for last update
+	db.SoftDelete                    // deleted_at, hidden from default queries
+}
@@ -0,0 +1,35 @@
+package models
+
+import (
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+// Warehouse is a location that holds stock. Orders are allocated to active
+// warehouses by their priority or their distance from the shipping address.
+type Warehouse struct {
+	bun.BaseModel `bun:"table:warehouses,alias:w"`
+
+	WarehouseID int64     `bun:"warehouse_id,pk,autoincrement" json:"warehouse_id"`               // Primary key
+	Code        string    `bun:"code,notnull" json:"code"`                                        // Unique short name, e.g. "BLR-1"
+	Name        string    `bun:"name,notnull" json:"name"`                                        // Display name
+	Country     string    `bun:"country,notnull" json:"country"`                                  // ISO 3166-1 alpha-2 code
+	PostalCode  string    `bun:"postal_code,notnull" json:"postal_code"`                          // Postal code, for nearest allocation
+	Priority    int       `bun:"priority,notnull" json:"priority"`                                // Lower ships first under priority allocation
+	Active      bool      `bun:"active,notnull" json:"active"`                                    // Inactive warehouses are not allocated from
+	CreatedAt   time.Time `bun:"created_at,nullzero,default:current_timestamp" json:"created_at"` // Creation timestamp
+	UpdatedAt   time.Time `bun:"updated_at,nullzero,default:current_timestamp" json:"updated_at"` // Timestamp for last update
+}
+
+// WarehouseStock is the quantity of a product or variant on hand at a
+// warehouse. The inventory of a product or variant is the sum over warehouses.
+type WarehouseStock struct {
+	bun.BaseModel `bun:"table:warehouse_stock,alias:ws"`
+
+	StockID     int64 `bun:"stock_id,pk,autoincrement" json:"-"`              // Primary key
+	WarehouseID int64 `bun:"warehouse_id,notnull" json:"warehouse_id"`        // Where the stock is
+	ProductID   int64 `bun:"product_id,notnull" json:"product_id"`            // Product stocked
+	VariantID   int64 `bun:"variant_id,nullzero" json:"variant_id,omitempty"` // Variant stocked, if any
+	Quantity    int   `bun:"quantity,notnull" json:"quantity"`                // Units on hand at the warehouse
+}
@@ -38,3 +38,58 @@ func (pm *ProducerManager) EmitInventoryUpdatedEvent(event *messaging.ProductInv
     log.Printf("Emitting InventoryUpdated event: %s", eventBytes)
     return pm.producer.Emit("inventory-updated", eventBytes)
 }
+
+// EmitProductDeletedEvent emits a ProductDeleted event using the provided producer.
+func (pm *ProducerManager) EmitProductDeletedEvent(event *messaging.ProductDeleted) error {
+    eventBytes, err := json.Marshal(event)
+    if err != nil {
+        return err
+    }
+
+    log.Printf("Emitting ProductDeleted event: %s", eventBytes)
+    return pm.producer.Emit("product-deleted", eventBytes)
+}
+
+// EmitProductRestoredEvent emits a ProductRestored event using the provided producer.
+func (pm *ProducerManager) EmitProductRestoredEvent(event *messaging.ProductRestored) error {
+    eventBytes, err := json.Marshal(event)
+    if err != nil {
+        return err
+    }
+
+    log.Printf("Emitting ProductRestored event: %s", eventBytes)
+    return pm.producer.Emit("product-restored", eventBytes)
+}
+
+// EmitProductVariantUpdatedEvent emits a ProductVariantUpdated event using the provided producer.
+func (pm *ProducerManager) EmitProductVariantUpdatedEvent(event *messaging.ProductVariantUpdated) error {
+    eventBytes, err := json.Marshal(event)
+    if err != nil {
+        return err
+    }
+
+    log.Printf("Emitting ProductVariantUpdated event: %s", eventBytes)
+    return pm.producer.Emit("product-variant-updated", eventBytes)
+}
+
+// EmitProductVariantDeletedEvent emits a ProductVariantDeleted event using the provided producer.
+func (pm *ProducerManager) EmitProductVariantDeletedEvent(event *messaging.ProductVariantDeleted) error {
+    eventBytes, err := json.Marshal(event)
+    if err != nil {
+        return err
+    }
+
+    log.Printf("Emitting ProductVariantDeleted event: %s", eventBytes)
+    return pm.producer.Emit("product-variant-deleted", eventBytes)
+}
+
+// EmitStockReservationReleasedEvent emits a StockReservationReleased event using the provided producer.
+func (pm *ProducerManager) EmitStockReservationReleasedEvent(event *messaging.StockReservationReleased) error {
+    eventBytes, err := json.Marshal(event)
+    if err != nil {
+        return err
+    }
+
+    log.Printf("Emitting StockReservationReleased event: %s", eventBytes)
+    return pm.producer.Emit("stock-reservation-released", eventBytes)
+}
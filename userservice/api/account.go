@@ -0,0 +1,214 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/hari134/pratilipi/pkg/db"
+	"github.com/hari134/pratilipi/pkg/messaging"
+	"github.com/hari134/pratilipi/pkg/validation"
+	"github.com/hari134/pratilipi/userservice/internal/auditlog"
+	"github.com/hari134/pratilipi/userservice/internal/dto"
+	"github.com/hari134/pratilipi/userservice/internal/outbox"
+	"github.com/hari134/pratilipi/userservice/internal/tokenstore"
+	"github.com/hari134/pratilipi/userservice/models"
+	"github.com/uptrace/bun"
+)
+
+// AccountAPIHandler holds dependencies for the email verification and password reset routes.
+type AccountAPIHandler struct {
+	DB *db.DB
+}
+
+// Both request endpoints answer the same way whether or not the account exists,
+// so they cannot be used to find out which emails are registered. Their emails
+// go out through the outbox, and failures are logged rather than reported.
+const (
+	verificationRequestedMessage  = "If the account exists and is unverified, a verification email has been sent"
+	passwordResetRequestedMessage = "If the account exists, a password reset email has been sent"
+)
+
+// RequestEmailVerificationHandler sends a new verification email. Earlier links stop working.
+func (h *AccountAPIHandler) RequestEmailVerificationHandler(w http.ResponseWriter, r *http.Request) {
+	var req dto.EmailRequest
+	if !validation.Decode(w, r, &req) {
+		return
+	}
+
+	ctx := context.Background()
+	user, err := findUserByEmail(ctx, h.DB, req.Email)
+	if err == nil && user != nil && user.EmailVerifiedAt.IsZero() {
+		err = sendEmailVerification(ctx, h.DB, user)
+	}
+	if err != nil {
+		log.Printf("Failed to request email verification: %v", err)
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]string{"status": verificationRequestedMessage})
+}
+
+// ConfirmEmailHandler marks the email address as verified using a token from a verification email.
+func (h *AccountAPIHandler) ConfirmEmailHandler(w http.ResponseWriter, r *http.Request) {
+	var req dto.ConfirmEmailRequest
+	if !validation.Decode(w, r, &req) {
+		return
+	}
+
+	ctx := context.Background()
+	err := h.DB.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		userToken, err := tokenstore.ConsumeUserToken(ctx, tx, req.Token, models.PurposeEmailVerification)
+		if err != nil {
+			return err
+		}
+		_, err = tx.NewUpdate().
+			Model((*models.User)(nil)).
+			Set("email_verified_at = ?", time.Now()).
+			Where("user_id = ?", userToken.UserID).
+			Where("email_verified_at IS NULL").
+			Exec(ctx)
+		return err
+	})
+	if err != nil {
+		if errors.Is(err, tokenstore.ErrInvalidUserToken) {
+			http.Error(w, "Invalid or expired token", http.StatusBadRequest)
+		} else {
+			http.Error(w, "Failed to verify email", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"status": "email verified"})
+}
+
+// RequestPasswordResetHandler sends a password reset email. Earlier links stop working.
+func (h *AccountAPIHandler) RequestPasswordResetHandler(w http.ResponseWriter, r *http.Request) {
+	var req dto.EmailRequest
+	if !validation.Decode(w, r, &req) {
+		return
+	}
+
+	ctx := context.Background()
+	user, err := findUserByEmail(ctx, h.DB, req.Email)
+	if err == nil && user != nil {
+		err = h.DB.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+			return sendPasswordReset(ctx, tx, user, false)
+		})
+	}
+	if err != nil {
+		log.Printf("Failed to request password reset: %v", err)
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]string{"status": passwordResetRequestedMessage})
+}
+
+// ResetPasswordHandler sets a new password using a token from a password reset email.
+// Every refresh token of the user is revoked, so other sessions end once their access tokens expire.
+func (h *AccountAPIHandler) ResetPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	var req dto.ResetPasswordRequest
+	if !validation.Decode(w, r, &req) {
+		return
+	}
+
+	hashedPassword, err := hashPassword(req.NewPassword)
+	if err != nil {
+		http.Error(w, "Failed to hash password", http.StatusInternalServerError)
+		return
+	}
+
+	ctx := context.Background()
+	err = h.DB.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		userToken, err := tokenstore.ConsumeUserToken(ctx, tx, req.Token, models.PurposePasswordReset)
+		if err != nil {
+			return err
+		}
+
+		// Receiving the reset email also proves the user owns the address
+		now := time.Now()
+		_, err = tx.NewUpdate().
+			Model((*models.User)(nil)).
+			Set("password_hash = ?", hashedPassword).
+			Set("email_verified_at = COALESCE(email_verified_at, ?)", now).
+			Set("password_reset_required = FALSE").
+			Set("updated_at = ?", now).
+			Set("updated_by = ?", userToken.UserID).
+			Where("user_id = ?", userToken.UserID).
+			Exec(ctx)
+		if err != nil {
+			return err
+		}
+		if err := tokenstore.RevokeUserRefreshTokens(ctx, tx, userToken.UserID); err != nil {
+			return err
+		}
+		return auditlog.Record(ctx, tx, r, auditlog.Entry{Action: auditlog.ActionPasswordReset, ActorID: userToken.UserID, TargetUserID: userToken.UserID})
+	})
+	if err != nil {
+		if errors.Is(err, tokenstore.ErrInvalidUserToken) {
+			auditlog.Log(ctx, h.DB, r, auditlog.Entry{Action: auditlog.ActionPasswordReset, Outcome: auditlog.OutcomeFailure, Detail: "invalid or expired token"})
+			http.Error(w, "Invalid or expired token", http.StatusBadRequest)
+		} else {
+			http.Error(w, "Failed to reset password", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"status": "password reset"})
+}
+
+// findUserByEmail returns the active user with the given email, or nil if there is none.
+func findUserByEmail(ctx context.Context, db bun.IDB, email string) (*models.User, error) {
+	user := &models.User{}
+	err := db.NewSelect().Model(user).Where("LOWER(email) = ?", email).Scan(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// sendEmailVerification issues a verification token for the user and queues
+// the email in the outbox, in a transaction of its own unless db is one.
+func sendEmailVerification(ctx context.Context, db bun.IDB, user *models.User) error {
+	return db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		userToken, token, err := tokenstore.IssueUserToken(ctx, tx, user.UserID, models.PurposeEmailVerification)
+		if err != nil {
+			return err
+		}
+		return outbox.Enqueue(ctx, tx, "user-email-verification-requested", &messaging.UserEmailVerificationRequested{
+			UserID:    strconv.FormatInt(user.UserID, 10),
+			Email:     user.Email,
+			Name:      user.Name,
+			Token:     token,
+			ExpiresAt: userToken.ExpiresAt,
+		})
+	})
+}
+
+// sendPasswordReset issues a password reset token for the user and queues the
+// email in the outbox. forced tells that an admin requires the reset. Call it
+// inside a transaction.
+func sendPasswordReset(ctx context.Context, db bun.IDB, user *models.User, forced bool) error {
+	userToken, token, err := tokenstore.IssueUserToken(ctx, db, user.UserID, models.PurposePasswordReset)
+	if err != nil {
+		return err
+	}
+	return outbox.Enqueue(ctx, db, "password-reset-requested", &messaging.PasswordResetRequested{
+		UserID:    strconv.FormatInt(user.UserID, 10),
+		Email:     user.Email,
+		Name:      user.Name,
+		Token:     token,
+		ExpiresAt: userToken.ExpiresAt,
+		Forced:    forced,
+	})
+}
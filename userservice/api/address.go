@@ -0,0 +1,268 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/hari134/pratilipi/pkg/auth"
+	"github.com/hari134/pratilipi/pkg/db"
+	"github.com/hari134/pratilipi/pkg/validation"
+	"github.com/hari134/pratilipi/userservice/internal/addresses"
+	"github.com/hari134/pratilipi/userservice/internal/dto"
+	"github.com/hari134/pratilipi/userservice/middleware"
+	"github.com/hari134/pratilipi/userservice/models"
+	"github.com/uptrace/bun"
+)
+
+// AddressAPIHandler holds dependencies for the address book routes. The
+// /addresses routes always act on the caller's own address book.
+type AddressAPIHandler struct {
+	DB *db.DB
+}
+
+// ListAddressesHandler lists the caller's addresses, the default first.
+func (h *AddressAPIHandler) ListAddressesHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := addressBookOwner(w, r)
+	if !ok {
+		return
+	}
+
+	list := []models.Address{}
+	err := h.DB.NewSelect().
+		Model(&list).
+		Where("user_id = ?", userID).
+		Order("is_default DESC", "address_id").
+		Scan(context.Background())
+	if err != nil {
+		http.Error(w, "Failed to retrieve addresses", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(list)
+}
+
+// CreateAddressHandler adds an address to the caller's address book.
+func (h *AddressAPIHandler) CreateAddressHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := addressBookOwner(w, r)
+	if !ok {
+		return
+	}
+	address, ok := decodeAddress(w, r)
+	if !ok {
+		return
+	}
+	address.UserID = userID
+
+	ctx := context.Background()
+	err := h.DB.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		return addresses.Create(ctx, tx, address)
+	})
+	if err != nil {
+		if errors.Is(err, addresses.ErrTooMany) {
+			http.Error(w, "Address book is full", http.StatusConflict)
+			return
+		}
+		log.Printf("Failed to create address for user %d: %v", userID, err)
+		http.Error(w, "Failed to create address", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(address)
+}
+
+// GetAddressHandler returns one of the caller's addresses.
+func (h *AddressAPIHandler) GetAddressHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := addressBookOwner(w, r)
+	if !ok {
+		return
+	}
+	address, ok := h.findAddress(w, userID, mux.Vars(r)["addressID"])
+	if !ok {
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(address)
+}
+
+// UpdateAddressHandler replaces one of the caller's addresses. Orders keep the
+// copy of the address they were placed with.
+func (h *AddressAPIHandler) UpdateAddressHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := addressBookOwner(w, r)
+	if !ok {
+		return
+	}
+	current, ok := h.findAddress(w, userID, mux.Vars(r)["addressID"])
+	if !ok {
+		return
+	}
+	address, ok := decodeAddress(w, r)
+	if !ok {
+		return
+	}
+	address.AddressID = current.AddressID
+	address.UserID = userID
+	address.CreatedAt = current.CreatedAt
+	address.UpdatedAt = time.Now()
+	makeDefault := address.IsDefault && !current.IsDefault
+	// The default can only be moved to another address, not cleared
+	address.IsDefault = current.IsDefault
+
+	ctx := context.Background()
+	err := h.DB.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		if _, err := tx.NewUpdate().Model(address).WherePK().Exec(ctx); err != nil {
+			return err
+		}
+		if makeDefault {
+			return addresses.SetDefault(ctx, tx, address)
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("Failed to update address %d: %v", address.AddressID, err)
+		http.Error(w, "Failed to update address", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(address)
+}
+
+// DeleteAddressHandler removes one of the caller's addresses.
+func (h *AddressAPIHandler) DeleteAddressHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := addressBookOwner(w, r)
+	if !ok {
+		return
+	}
+	address, ok := h.findAddress(w, userID, mux.Vars(r)["addressID"])
+	if !ok {
+		return
+	}
+
+	ctx := context.Background()
+	err := h.DB.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		return addresses.Delete(ctx, tx, address)
+	})
+	if err != nil {
+		log.Printf("Failed to delete address %d: %v", address.AddressID, err)
+		http.Error(w, "Failed to delete address", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"status": "address deleted"})
+}
+
+// SetDefaultAddressHandler makes one of the caller's addresses the default.
+func (h *AddressAPIHandler) SetDefaultAddressHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := addressBookOwner(w, r)
+	if !ok {
+		return
+	}
+	address, ok := h.findAddress(w, userID, mux.Vars(r)["addressID"])
+	if !ok {
+		return
+	}
+
+	ctx := context.Background()
+	err := h.DB.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		return addresses.SetDefault(ctx, tx, address)
+	})
+	if err != nil {
+		log.Printf("Failed to set default address %d: %v", address.AddressID, err)
+		http.Error(w, "Failed to set default address", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(address)
+}
+
+// GetUserAddressHandler returns an address of any user, or their default address
+// for the ID "default". Other services use it to copy the address onto an order.
+// The caller must be that user or hold the "address:read" permission.
+func (h *AddressAPIHandler) GetUserAddressHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.ParseInt(mux.Vars(r)["userID"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+	claims, _ := auth.ClaimsFromContext(r.Context())
+	if claims == nil || (claims.IsService() || claims.UserID != userID) && !claims.HasPermission("address:read") {
+		http.Error(w, "Missing permission address:read", http.StatusForbidden)
+		return
+	}
+
+	address, ok := h.findAddress(w, userID, mux.Vars(r)["addressID"])
+	if !ok {
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(address)
+}
+
+// findAddress loads an address of the user, writing 404 if there is none.
+func (h *AddressAPIHandler) findAddress(w http.ResponseWriter, userID int64, addressID string) (*models.Address, bool) {
+	if addressID != "default" {
+		if _, err := strconv.ParseInt(addressID, 10, 64); err != nil {
+			http.Error(w, "Invalid address ID", http.StatusBadRequest)
+			return nil, false
+		}
+	}
+	address, err := addresses.Find(context.Background(), h.DB, userID, addressID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "Address not found", http.StatusNotFound)
+		} else {
+			http.Error(w, "Failed to retrieve address", http.StatusInternalServerError)
+		}
+		return nil, false
+	}
+	return address, true
+}
+
+// addressBookOwner returns the caller's user ID. Service tokens have no address book.
+func addressBookOwner(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	userID := r.Context().Value(middleware.UserIDKey).(int64)
+	if userID == 0 {
+		http.Error(w, "The address book needs a user token", http.StatusForbidden)
+		return 0, false
+	}
+	return userID, true
+}
+
+// decodeAddress reads, normalizes and validates an address from the request body.
+func decodeAddress(w http.ResponseWriter, r *http.Request) (*models.Address, bool) {
+	var req dto.AddressRequest
+	if !validation.Decode(w, r, &req) {
+		return nil, false
+	}
+	address := &models.Address{
+		Label:         req.Label,
+		RecipientName: req.RecipientName,
+		PhoneNo:       req.PhoneNo,
+		Line1:         req.Line1,
+		Line2:         req.Line2,
+		City:          req.City,
+		State:         req.State,
+		PostalCode:    req.PostalCode,
+		Country:       req.Country,
+		IsDefault:     req.IsDefault,
+	}
+	addresses.Normalize(address)
+	if err := addresses.Validate(address); err != nil {
+		validation.WriteErrors(w, validation.Errors(err.(*addresses.ValidationError).Fields))
+		return nil, false
+	}
+	return address, true
+}
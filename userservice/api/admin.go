@@ -0,0 +1,326 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/hari134/pratilipi/pkg/auth"
+	"github.com/hari134/pratilipi/pkg/db"
+	"github.com/hari134/pratilipi/pkg/messaging"
+	"github.com/hari134/pratilipi/pkg/validation"
+	"github.com/hari134/pratilipi/userservice/internal/auditlog"
+	"github.com/hari134/pratilipi/userservice/internal/dto"
+	"github.com/hari134/pratilipi/userservice/internal/emailpolicy"
+	"github.com/hari134/pratilipi/userservice/internal/jwtutil"
+	"github.com/hari134/pratilipi/userservice/internal/loginguard"
+	"github.com/hari134/pratilipi/userservice/internal/outbox"
+	"github.com/hari134/pratilipi/userservice/internal/rbac"
+	"github.com/hari134/pratilipi/userservice/internal/useradmin"
+	"github.com/hari134/pratilipi/userservice/middleware"
+	"github.com/hari134/pratilipi/userservice/models"
+	"github.com/hari134/pratilipi/userservice/producer"
+	"github.com/uptrace/bun"
+)
+
+// AdminAPIHandler holds dependencies for the user administration routes.
+// All of its routes require the "user:admin" permission, except impersonation,
+// which requires "user:impersonate".
+type AdminAPIHandler struct {
+	DB            *db.DB
+	KafkaProducer *producer.ProducerManager
+	LoginGuard    *loginguard.Guard
+}
+
+// UnlockUserHandler lifts a login lockout of a user and clears their failed attempts.
+func (h *AdminAPIHandler) UnlockUserHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.ParseInt(mux.Vars(r)["userID"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	ctx := context.Background()
+	var user models.User
+	if err := h.DB.NewSelect().Model(&user).Where("user_id = ?", userID).Scan(ctx); err != nil {
+		writeUserLookupError(w, err)
+		return
+	}
+
+	if err := h.LoginGuard.Unlock(ctx, user.Email); err != nil {
+		http.Error(w, "Failed to unlock user", http.StatusInternalServerError)
+		return
+	}
+	auditlog.Log(ctx, h.DB, r, auditlog.Entry{Action: auditlog.ActionUserUnlock, TargetUserID: user.UserID})
+
+	adminID := r.Context().Value(middleware.UserIDKey).(int64)
+	event := &messaging.AccountUnlocked{
+		UserID:     strconv.FormatInt(user.UserID, 10),
+		Email:      user.Email,
+		UnlockedBy: strconv.FormatInt(adminID, 10),
+		UnlockedAt: time.Now(),
+	}
+	if err := h.KafkaProducer.EmitAccountUnlockedEvent(event); err != nil {
+		http.Error(w, "Failed to emit event", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"status": "user unlocked"})
+}
+
+// ListUsersHandler lists users with their roles and account state, filtered by
+// the query parameters email, name, role, status, verified, limit and offset.
+func (h *AdminAPIHandler) ListUsersHandler(w http.ResponseWriter, r *http.Request) {
+	filter, err := useradmin.FilterFromQuery(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	list, err := useradmin.List(context.Background(), h.DB, filter)
+	if err != nil {
+		http.Error(w, "Failed to retrieve users", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(list)
+}
+
+// DisableUserHandler disables an account. The user cannot log in or refresh
+// tokens, and their access tokens are rejected by this service, until enabled again.
+func (h *AdminAPIHandler) DisableUserHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.ParseInt(mux.Vars(r)["userID"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+	var req dto.DisableUserRequest
+	if r.ContentLength != 0 {
+		if !validation.Decode(w, r, &req) {
+			return
+		}
+	}
+
+	adminID := r.Context().Value(middleware.UserIDKey).(int64)
+	if adminID == userID {
+		http.Error(w, "You cannot disable your own account", http.StatusForbidden)
+		return
+	}
+
+	ctx := context.Background()
+	var user models.User
+	err = h.DB.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		if err := lockUser(ctx, tx, userID, &user); err != nil {
+			return err
+		}
+		if !user.DisabledAt.IsZero() {
+			return nil
+		}
+		if err := useradmin.Disable(ctx, tx, &user, req.Reason, adminID); err != nil {
+			return err
+		}
+		if err := auditlog.Record(ctx, tx, r, auditlog.Entry{Action: auditlog.ActionUserDisable, TargetUserID: user.UserID, Detail: req.Reason}); err != nil {
+			return err
+		}
+		return outbox.Enqueue(ctx, tx, "user-disabled", &messaging.UserDisabled{
+			UserID:     strconv.FormatInt(user.UserID, 10),
+			Reason:     user.DisabledReason,
+			DisabledBy: strconv.FormatInt(adminID, 10),
+			DisabledAt: user.DisabledAt,
+		})
+	})
+	if err != nil {
+		writeUserLookupError(w, err)
+		return
+	}
+
+	h.writeAdminUser(w, &user)
+}
+
+// EnableUserHandler lets a disabled user log in again.
+func (h *AdminAPIHandler) EnableUserHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.ParseInt(mux.Vars(r)["userID"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	adminID := r.Context().Value(middleware.UserIDKey).(int64)
+	ctx := context.Background()
+	var user models.User
+	err = h.DB.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		if err := lockUser(ctx, tx, userID, &user); err != nil {
+			return err
+		}
+		if user.DisabledAt.IsZero() {
+			return nil
+		}
+		if err := useradmin.Enable(ctx, tx, &user, adminID); err != nil {
+			return err
+		}
+		if err := auditlog.Record(ctx, tx, r, auditlog.Entry{Action: auditlog.ActionUserEnable, TargetUserID: user.UserID}); err != nil {
+			return err
+		}
+		return outbox.Enqueue(ctx, tx, "user-enabled", &messaging.UserEnabled{
+			UserID:    strconv.FormatInt(user.UserID, 10),
+			EnabledBy: strconv.FormatInt(adminID, 10),
+			EnabledAt: time.Now(),
+		})
+	})
+	if err != nil {
+		writeUserLookupError(w, err)
+		return
+	}
+
+	h.writeAdminUser(w, &user)
+}
+
+// ForcePasswordResetHandler signs a user out everywhere and refuses their
+// logins until they set a new password with the reset email sent to them.
+func (h *AdminAPIHandler) ForcePasswordResetHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.ParseInt(mux.Vars(r)["userID"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	adminID := r.Context().Value(middleware.UserIDKey).(int64)
+	ctx := context.Background()
+	var user models.User
+	err = h.DB.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		if err := lockUser(ctx, tx, userID, &user); err != nil {
+			return err
+		}
+		if err := useradmin.RequirePasswordReset(ctx, tx, &user, adminID); err != nil {
+			return err
+		}
+		if err := auditlog.Record(ctx, tx, r, auditlog.Entry{Action: auditlog.ActionForcePasswordReset, TargetUserID: user.UserID}); err != nil {
+			return err
+		}
+		return sendPasswordReset(ctx, tx, &user, true)
+	})
+	if err != nil {
+		writeUserLookupError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]string{"status": "password reset required"})
+}
+
+// ImpersonateUserHandler issues a short-lived access token to act as a user for
+// support. The token carries the admin in its "act" claim, only the permissions
+// of the user's non-privileged roles, and no refresh token. Every impersonation
+// is recorded in the audit log and announced with a UserImpersonated event
+// through the outbox, in one transaction; no token is handed out if it fails.
+func (h *AdminAPIHandler) ImpersonateUserHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.ParseInt(mux.Vars(r)["userID"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+	var req dto.ImpersonateRequest
+	if !validation.Decode(w, r, &req) {
+		return
+	}
+
+	admin, _ := auth.ClaimsFromContext(r.Context())
+	if admin.IsService() || admin.IsImpersonation() {
+		http.Error(w, "Impersonation needs an admin's own user token", http.StatusForbidden)
+		return
+	}
+	if admin.UserID == userID {
+		http.Error(w, "You cannot impersonate yourself", http.StatusBadRequest)
+		return
+	}
+
+	ctx := context.Background()
+	var user models.User
+	if err := h.DB.NewSelect().Model(&user).Where("user_id = ?", userID).Scan(ctx); err != nil {
+		writeUserLookupError(w, err)
+		return
+	}
+	if !user.DisabledAt.IsZero() {
+		http.Error(w, "Account disabled", http.StatusConflict)
+		return
+	}
+
+	roles, err := rbac.UserRoles(ctx, h.DB, user.UserID)
+	if err != nil {
+		http.Error(w, "Failed to generate token", http.StatusInternalServerError)
+		return
+	}
+	permissions, err := rbac.UserPermissions(ctx, h.DB, user.UserID, false)
+	if err != nil {
+		http.Error(w, "Failed to generate token", http.StatusInternalServerError)
+		return
+	}
+	verified := !user.EmailVerifiedAt.IsZero()
+	claims := &jwtutil.Claims{
+		UserID:        user.UserID,
+		Email:         user.Email,
+		EmailVerified: verified,
+		Roles:         roles,
+		Permissions:   emailpolicy.Permissions(permissions, verified),
+		Act:           &auth.Actor{UserID: admin.UserID, Email: admin.Email},
+	}
+	ttl := jwtutil.ImpersonationTokenTTL()
+	token, err := jwtutil.GenerateJWTTokenWithTTL(claims, ttl)
+	if err != nil {
+		http.Error(w, "Failed to generate token", http.StatusInternalServerError)
+		return
+	}
+
+	event := &messaging.UserImpersonated{
+		UserID:         strconv.FormatInt(user.UserID, 10),
+		ImpersonatorID: strconv.FormatInt(admin.UserID, 10),
+		Reason:         req.Reason,
+		TokenID:        claims.ID,
+		IssuedAt:       claims.IssuedAt.Time,
+		ExpiresAt:      claims.ExpiresAt.Time,
+	}
+	err = h.DB.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		err := auditlog.Record(ctx, tx, r, auditlog.Entry{
+			Action:       auditlog.ActionImpersonate,
+			TargetUserID: user.UserID,
+			Detail:       "token " + claims.ID + ": " + req.Reason,
+		})
+		if err != nil {
+			return err
+		}
+		return outbox.Enqueue(ctx, tx, "user-impersonated", event)
+	})
+	if err != nil {
+		http.Error(w, "Failed to record impersonation", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("User %d is impersonating user %d (token %s): %s", admin.UserID, user.UserID, claims.ID, event.Reason)
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(dto.ImpersonationResponse{
+		Token:     token,
+		ExpiresIn: int64(ttl.Seconds()),
+	})
+}
+
+// writeAdminUser responds with the admin view of a user.
+func (h *AdminAPIHandler) writeAdminUser(w http.ResponseWriter, user *models.User) {
+	roles, err := rbac.UserRoles(context.Background(), h.DB, user.UserID)
+	if err != nil {
+		http.Error(w, "Failed to retrieve roles", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(useradmin.View(user, roles))
+}
+
+// lockUser loads a user and locks the row for the rest of the transaction.
+func lockUser(ctx context.Context, tx bun.Tx, userID int64, user *models.User) error {
+	return tx.NewSelect().Model(user).Where("user_id = ?", userID).For("UPDATE").Scan(ctx)
+}
@@ -0,0 +1,133 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/hari134/pratilipi/pkg/db"
+	"github.com/hari134/pratilipi/pkg/validation"
+	"github.com/hari134/pratilipi/userservice/internal/apiclients"
+	"github.com/hari134/pratilipi/userservice/internal/dto"
+	"github.com/hari134/pratilipi/userservice/middleware"
+	"github.com/hari134/pratilipi/userservice/models"
+)
+
+// APIClientAPIHandler holds dependencies for the API client administration routes.
+// All of its routes require the "user:admin" permission.
+type APIClientAPIHandler struct {
+	DB *db.DB
+}
+
+// CreateAPIClientHandler registers an API client and returns its credentials.
+func (h *APIClientAPIHandler) CreateAPIClientHandler(w http.ResponseWriter, r *http.Request) {
+	var req dto.CreateAPIClientRequest
+	if !validation.Decode(w, r, &req) {
+		return
+	}
+
+	adminID := r.Context().Value(middleware.UserIDKey).(int64)
+	client, secret, err := apiclients.Create(context.Background(), h.DB, apiclients.Registration{
+		Name:         req.Name,
+		Scopes:       req.Scopes,
+		RedirectURIs: req.RedirectURIs,
+		GrantTypes:   req.GrantTypes,
+		Public:       req.Public,
+	}, adminID)
+	if err != nil {
+		switch {
+		case errors.Is(err, apiclients.ErrInvalidScope):
+			http.Error(w, "Scopes must be one or more existing permissions other than user:admin and user:impersonate", http.StatusBadRequest)
+		case errors.Is(err, apiclients.ErrInvalidGrantType):
+			http.Error(w, "Grant types must be client_credentials or authorization_code, and public clients may only use authorization_code", http.StatusBadRequest)
+		case errors.Is(err, apiclients.ErrInvalidRedirectURI):
+			http.Error(w, "Redirect URIs must be https URLs, or http on localhost, without a fragment", http.StatusBadRequest)
+		default:
+			http.Error(w, "Failed to create API client", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(dto.CreateAPIClientResponse{
+		ClientID:     client.ClientID,
+		ClientSecret: secret,
+		Name:         client.Name,
+		Scopes:       client.Scopes,
+		RedirectURIs: client.RedirectURIs,
+		GrantTypes:   client.GrantTypes,
+		Public:       client.Public,
+	})
+}
+
+// GetAPIClientsHandler lists all API clients, including revoked ones.
+func (h *APIClientAPIHandler) GetAPIClientsHandler(w http.ResponseWriter, r *http.Request) {
+	var clients []models.APIClient
+	if err := h.DB.NewSelect().Model(&clients).Order("created_at").Scan(context.Background()); err != nil {
+		http.Error(w, "Failed to retrieve API clients", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(clients)
+}
+
+// GetAPIClientHandler returns an API client, including a revoked one.
+func (h *APIClientAPIHandler) GetAPIClientHandler(w http.ResponseWriter, r *http.Request) {
+	var client models.APIClient
+	err := h.DB.NewSelect().Model(&client).Where("client_id = ?", mux.Vars(r)["clientID"]).Scan(context.Background())
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "API client not found", http.StatusNotFound)
+		} else {
+			http.Error(w, "Failed to retrieve API client", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(client)
+}
+
+// SetRedirectURIsHandler replaces the redirect URIs of an active client.
+func (h *APIClientAPIHandler) SetRedirectURIsHandler(w http.ResponseWriter, r *http.Request) {
+	var req dto.SetRedirectURIsRequest
+	if !validation.Decode(w, r, &req) {
+		return
+	}
+
+	client, err := apiclients.SetRedirectURIs(context.Background(), h.DB, mux.Vars(r)["clientID"], req.RedirectURIs)
+	if err != nil {
+		switch {
+		case errors.Is(err, apiclients.ErrInvalidClient):
+			http.Error(w, "API client not found", http.StatusNotFound)
+		case errors.Is(err, apiclients.ErrInvalidRedirectURI):
+			http.Error(w, "Redirect URIs must be https URLs, or http on localhost, without a fragment; clients using authorization_code need at least one", http.StatusBadRequest)
+		default:
+			http.Error(w, "Failed to update API client", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(client)
+}
+
+// RevokeAPIClientHandler stops an API client from obtaining new tokens.
+func (h *APIClientAPIHandler) RevokeAPIClientHandler(w http.ResponseWriter, r *http.Request) {
+	clientID := mux.Vars(r)["clientID"]
+	if err := apiclients.Revoke(context.Background(), h.DB, clientID); err != nil {
+		if errors.Is(err, apiclients.ErrInvalidClient) {
+			http.Error(w, "API client not found", http.StatusNotFound)
+		} else {
+			http.Error(w, "Failed to revoke API client", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"status": "API client revoked"})
+}
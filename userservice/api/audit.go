@@ -0,0 +1,36 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/hari134/pratilipi/pkg/db"
+	"github.com/hari134/pratilipi/userservice/internal/auditlog"
+)
+
+// AuditAPIHandler holds dependencies for the audit log route, which requires
+// the "audit:read" permission.
+type AuditAPIHandler struct {
+	DB *db.DB
+}
+
+// ListAuditLogHandler lists audit log entries, newest first, filtered by the
+// query parameters user_id, actor_id, target_user_id, action, outcome, ip,
+// since, until, limit and offset.
+func (h *AuditAPIHandler) ListAuditLogHandler(w http.ResponseWriter, r *http.Request) {
+	filter, err := auditlog.FilterFromQuery(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	page, err := auditlog.List(context.Background(), h.DB, filter)
+	if err != nil {
+		http.Error(w, "Failed to retrieve audit log", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(page)
+}
@@ -2,59 +2,450 @@ package api
 
 import (
 	"context"
+	"database/sql"
 	"encoding/json"
+	"errors"
+	"log"
+	"math"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/hari134/pratilipi/pkg/auth"
 	"github.com/hari134/pratilipi/pkg/db"
+	"github.com/hari134/pratilipi/pkg/messaging"
+	"github.com/hari134/pratilipi/pkg/validation"
+	"github.com/hari134/pratilipi/userservice/internal/auditlog"
 	"github.com/hari134/pratilipi/userservice/internal/dto"
+	"github.com/hari134/pratilipi/userservice/internal/emailpolicy"
 	"github.com/hari134/pratilipi/userservice/internal/jwtutil"
+	"github.com/hari134/pratilipi/userservice/internal/loginguard"
+	"github.com/hari134/pratilipi/userservice/internal/password"
+	"github.com/hari134/pratilipi/userservice/internal/rbac"
+	"github.com/hari134/pratilipi/userservice/internal/tokenstore"
+	"github.com/hari134/pratilipi/userservice/internal/twofactor"
 	"github.com/hari134/pratilipi/userservice/models"
-	"golang.org/x/crypto/bcrypt"
+	"github.com/hari134/pratilipi/userservice/producer"
+	"github.com/uptrace/bun"
 )
 
 type AuthAPIHandler struct {
-	DB *db.DB
+	DB            *db.DB
+	KafkaProducer *producer.ProducerManager
+	LoginGuard    *loginguard.Guard
 }
 
 func (h *AuthAPIHandler) LoginHandler(w http.ResponseWriter, r *http.Request) {
 	var loginReq dto.LoginRequest
-	if err := json.NewDecoder(r.Body).Decode(&loginReq); err != nil {
-		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+	if !validation.Decode(w, r, &loginReq) {
 		return
 	}
 
+	// Throttled and locked out attempts are turned away before any password is hashed
 	ctx := context.Background()
-	var user models.User
-	err := h.DB.NewSelect().Model(&user).Where("email = ?", loginReq.Email).Scan(ctx)
+	ip := loginguard.ClientIP(r)
+	decision, err := h.LoginGuard.Check(ctx, loginReq.Email, ip)
 	if err != nil {
-		http.Error(w, "Invalid email or password", http.StatusUnauthorized)
+		http.Error(w, "Failed to log in", http.StatusInternalServerError)
+		return
+	}
+	if !decision.Allowed {
+		h.auditLogin(ctx, r, auditlog.ActionLogin, &models.User{}, auditlog.OutcomeDenied, "too many failed attempts, email "+auditlog.EmailHash(loginReq.Email))
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(decision.RetryAfter.Seconds()))))
+		if decision.Locked {
+			http.Error(w, "Too many failed login attempts, try again later", http.StatusTooManyRequests)
+		} else {
+			http.Error(w, "Too many failed login attempts, slow down", http.StatusTooManyRequests)
+		}
 		return
 	}
 
-	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(loginReq.Password)); err != nil {
+	var user models.User
+	err = h.DB.NewSelect().Model(&user).Where("LOWER(email) = ?", loginReq.Email).Scan(ctx)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "Failed to log in", http.StatusInternalServerError)
+		return
+	}
+	// Unknown emails are checked against a dummy hash so they take as long to reject as known ones
+	passwordHash := password.DummyHash()
+	if err == nil {
+		passwordHash = user.PasswordHash
+	}
+
+	ok, rehash, err := password.Verify(loginReq.Password, passwordHash)
+	if !ok || user.UserID == 0 {
+		if err != nil && !errors.Is(err, password.ErrUnknownHash) {
+			log.Printf("Failed to verify password of user %d: %v", user.UserID, err)
+		}
+		h.recordLoginFailure(ctx, &user, loginReq.Email, ip)
+		if user.UserID == 0 {
+			h.auditLogin(ctx, r, auditlog.ActionLogin, &user, auditlog.OutcomeFailure, "unknown email "+auditlog.EmailHash(loginReq.Email))
+		} else {
+			h.auditLogin(ctx, r, auditlog.ActionLogin, &user, auditlog.OutcomeFailure, "wrong password")
+		}
 		http.Error(w, "Invalid email or password", http.StatusUnauthorized)
 		return
 	}
+	if rehash {
+		h.upgradePasswordHash(ctx, &user, loginReq.Password)
+	}
+
+	if err := h.LoginGuard.PasswordVerified(ctx, loginReq.Email, !user.TOTPEnabledAt.IsZero()); err != nil {
+		log.Printf("Failed to reset login failures for user %d: %v", user.UserID, err)
+	}
+
+	if msg := loginBlocked(&user); msg != "" {
+		h.auditLogin(ctx, r, auditlog.ActionLogin, &user, auditlog.OutcomeDenied, msg)
+		http.Error(w, msg, http.StatusForbidden)
+		return
+	}
+
+	if !emailpolicy.LoginAllowed(!user.EmailVerifiedAt.IsZero()) {
+		h.auditLogin(ctx, r, auditlog.ActionLogin, &user, auditlog.OutcomeDenied, "Email address not verified")
+		http.Error(w, "Email address not verified", http.StatusForbidden)
+		return
+	}
+
+	// With 2FA enabled the password only earns a challenge, exchanged for tokens at /login/2fa
+	if !user.TOTPEnabledAt.IsZero() {
+		userToken, challenge, err := tokenstore.IssueUserToken(ctx, h.DB, user.UserID, models.PurposeTwoFactorChallenge)
+		if err != nil {
+			http.Error(w, "Failed to generate token", http.StatusInternalServerError)
+			return
+		}
+		h.auditLogin(ctx, r, auditlog.ActionLogin, &user, auditlog.OutcomeSuccess, "two-factor code required")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(dto.TwoFactorChallengeResponse{
+			TwoFactorRequired: true,
+			ChallengeToken:    challenge,
+			ExpiresIn:         int64(time.Until(userToken.ExpiresAt).Seconds()),
+		})
+		return
+	}
+
+	// Each login starts a new refresh token family
+	familyID, err := tokenstore.NewFamilyID()
+	if err != nil {
+		http.Error(w, "Failed to generate token", http.StatusInternalServerError)
+		return
+	}
+	resp, err := issueTokens(ctx, h.DB, &user, familyID, false, sessionClient(r, loginReq.DeviceName))
+	if err != nil {
+		http.Error(w, "Failed to generate token", http.StatusInternalServerError)
+		return
+	}
+	h.auditLogin(ctx, r, auditlog.ActionLogin, &user, auditlog.OutcomeSuccess, "session "+familyID)
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// sessionClient describes the device a login or refresh comes from. deviceName
+// is the name the client chose, if any.
+func sessionClient(r *http.Request, deviceName string) tokenstore.Client {
+	return tokenstore.Client{
+		DeviceName: deviceName,
+		UserAgent:  r.UserAgent(),
+		IP:         loginguard.ClientIP(r),
+	}
+}
+
+// loginBlocked returns why an admin has barred the user from logging in, or "" if nothing does.
+func loginBlocked(user *models.User) string {
+	switch {
+	case !user.DisabledAt.IsZero():
+		return "Account disabled"
+	case user.PasswordResetRequired:
+		return "Password reset required"
+	}
+	return ""
+}
+
+// auditLogin records an attempt to log in or use a token of user, who is
+// zero-valued when not known.
+func (h *AuthAPIHandler) auditLogin(ctx context.Context, r *http.Request, action string, user *models.User, outcome, detail string) {
+	auditlog.Log(ctx, h.DB, r, auditlog.Entry{
+		Action:       action,
+		Outcome:      outcome,
+		ActorID:      user.UserID,
+		TargetUserID: user.UserID,
+		Detail:       detail,
+	})
+}
+
+// recordLoginFailure counts a failed login and announces the lockout if this failure caused one.
+// user is zero-valued when the email is unknown.
+func (h *AuthAPIHandler) recordLoginFailure(ctx context.Context, user *models.User, email, ip string) {
+	result, err := h.LoginGuard.Failure(ctx, email, ip)
+	if err != nil {
+		log.Printf("Failed to record login failure: %v", err)
+		return
+	}
+	if !result.AccountLocked {
+		return
+	}
+
+	event := &messaging.AccountLocked{
+		Email:       email,
+		IP:          ip,
+		Failures:    result.Failures,
+		LockedUntil: result.LockedUntil,
+	}
+	if user.UserID != 0 {
+		event.UserID = strconv.FormatInt(user.UserID, 10)
+	}
+	if err := h.KafkaProducer.EmitAccountLockedEvent(event); err != nil {
+		log.Printf("Failed to emit AccountLocked event: %v", err)
+	}
+}
+
+// LoginTwoFactorHandler completes a login for a user with 2FA enabled, exchanging
+// the challenge from /login and a TOTP or recovery code for tokens.
+func (h *AuthAPIHandler) LoginTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	var req dto.TwoFactorLoginRequest
+	if !validation.Decode(w, r, &req) {
+		return
+	}
+
+	ctx := context.Background()
+	challenge, err := tokenstore.FindUserToken(ctx, h.DB, req.ChallengeToken, models.PurposeTwoFactorChallenge)
+	if err != nil {
+		if errors.Is(err, tokenstore.ErrInvalidUserToken) {
+			h.auditLogin(ctx, r, auditlog.ActionLoginTwoFactor, &models.User{}, auditlog.OutcomeFailure, "invalid or expired challenge")
+			http.Error(w, "Invalid or expired challenge, log in again", http.StatusUnauthorized)
+		} else {
+			http.Error(w, "Failed to verify code", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	var user models.User
+	if err := h.DB.NewSelect().Model(&user).Where("user_id = ?", challenge.UserID).Scan(ctx); err != nil {
+		http.Error(w, "Invalid or expired challenge, log in again", http.StatusUnauthorized)
+		return
+	}
+	if msg := loginBlocked(&user); msg != "" {
+		h.auditLogin(ctx, r, auditlog.ActionLoginTwoFactor, &user, auditlog.OutcomeDenied, msg)
+		http.Error(w, msg, http.StatusForbidden)
+		return
+	}
+
+	// Wrong codes count towards the same lockout as wrong passwords, so a new
+	// challenge does not buy more guesses
+	ip := loginguard.ClientIP(r)
+	decision, err := h.LoginGuard.Check(ctx, user.Email, ip)
+	if err != nil {
+		http.Error(w, "Failed to verify code", http.StatusInternalServerError)
+		return
+	}
+	if !decision.Allowed {
+		h.auditLogin(ctx, r, auditlog.ActionLoginTwoFactor, &user, auditlog.OutcomeDenied, "too many failed attempts")
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(decision.RetryAfter.Seconds()))))
+		http.Error(w, "Too many failed login attempts, try again later", http.StatusTooManyRequests)
+		return
+	}
+
+	ok, err := twofactor.VerifyCode(ctx, h.DB, &user, req.Code)
+	if err != nil {
+		http.Error(w, "Failed to verify code", http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		// Too many wrong codes use up the challenge, so the password has to be entered again
+		if err := tokenstore.RecordFailedAttempt(ctx, h.DB, challenge.UserTokenID, twofactor.MaxChallengeAttempts); err != nil {
+			http.Error(w, "Failed to verify code", http.StatusInternalServerError)
+			return
+		}
+		h.recordLoginFailure(ctx, &user, user.Email, ip)
+		h.auditLogin(ctx, r, auditlog.ActionLoginTwoFactor, &user, auditlog.OutcomeFailure, "wrong code")
+		http.Error(w, "Invalid code", http.StatusUnauthorized)
+		return
+	}
+	if err := h.LoginGuard.Success(ctx, user.Email); err != nil {
+		log.Printf("Failed to reset login failures for user %d: %v", user.UserID, err)
+	}
+
+	// Use up the challenge; this fails if a concurrent request already did
+	if _, err := tokenstore.ConsumeUserToken(ctx, h.DB, req.ChallengeToken, models.PurposeTwoFactorChallenge); err != nil {
+		http.Error(w, "Invalid or expired challenge, log in again", http.StatusUnauthorized)
+		return
+	}
 
-	token, err := jwtutil.GenerateJWTToken(user.UserID, user.Email, user.Role)
+	familyID, err := tokenstore.NewFamilyID()
 	if err != nil {
 		http.Error(w, "Failed to generate token", http.StatusInternalServerError)
 		return
 	}
+	resp, err := issueTokens(ctx, h.DB, &user, familyID, true, sessionClient(r, req.DeviceName))
+	if err != nil {
+		http.Error(w, "Failed to generate token", http.StatusInternalServerError)
+		return
+	}
+	h.auditLogin(ctx, r, auditlog.ActionLoginTwoFactor, &user, auditlog.OutcomeSuccess, "session "+familyID)
 
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(dto.LoginResponse{Token: token})
+	json.NewEncoder(w).Encode(resp)
+}
+
+// RefreshTokenHandler exchanges a refresh token for a new access token and a new refresh token.
+// Each refresh token can be used once; reusing one revokes every token rotated from the same login.
+func (h *AuthAPIHandler) RefreshTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var req dto.RefreshTokenRequest
+	if !validation.Decode(w, r, &req) {
+		return
+	}
+
+	// Rotation is a single conditional UPDATE, so two concurrent refreshes
+	// cannot both succeed. It shares a transaction with issuing the new tokens,
+	// so a failed issue leaves the presented refresh token usable.
+	ctx := context.Background()
+	var refreshToken *models.RefreshToken
+	var user models.User
+	var resp *dto.LoginResponse
+	var rotateErr error
+	var blocked string
+	err := h.DB.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		var err error
+		refreshToken, err = tokenstore.RotateRefreshToken(ctx, tx, req.RefreshToken)
+		if errors.Is(err, tokenstore.ErrRefreshTokenReused) {
+			rotateErr = err
+			return nil // commit the family's revocation
+		}
+		if err != nil {
+			return err
+		}
+		if err := tx.NewSelect().Model(&user).Where("user_id = ?", refreshToken.UserID).Scan(ctx); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return tokenstore.ErrInvalidRefreshToken
+			}
+			return err
+		}
+		if blocked = loginBlocked(&user); blocked != "" {
+			return nil
+		}
+		resp, err = issueTokens(ctx, tx, &user, refreshToken.FamilyID, refreshToken.TwoFactor, sessionClient(r, ""))
+		return err
+	})
+	if err == nil {
+		err = rotateErr
+	}
+	if err != nil {
+		switch {
+		case errors.Is(err, tokenstore.ErrRefreshTokenReused):
+			h.auditLogin(ctx, r, auditlog.ActionTokenRefresh, &models.User{}, auditlog.OutcomeFailure, "refresh token reused, session ended")
+			http.Error(w, "Refresh token has already been used", http.StatusUnauthorized)
+		case errors.Is(err, tokenstore.ErrInvalidRefreshToken):
+			h.auditLogin(ctx, r, auditlog.ActionTokenRefresh, &models.User{}, auditlog.OutcomeFailure, "invalid or expired refresh token")
+			http.Error(w, "Invalid or expired refresh token", http.StatusUnauthorized)
+		default:
+			http.Error(w, "Failed to refresh token", http.StatusInternalServerError)
+		}
+		return
+	}
+	if blocked != "" {
+		h.auditLogin(ctx, r, auditlog.ActionTokenRefresh, &user, auditlog.OutcomeDenied, blocked)
+		http.Error(w, blocked, http.StatusForbidden)
+		return
+	}
+	h.auditLogin(ctx, r, auditlog.ActionTokenRefresh, &user, auditlog.OutcomeSuccess, "session "+refreshToken.FamilyID)
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// LogoutHandler ends the caller's session and revokes their access token and,
+// when given, the refresh token family.
+func (h *AuthAPIHandler) LogoutHandler(w http.ResponseWriter, r *http.Request) {
+	var req dto.LogoutRequest
+	if r.ContentLength != 0 {
+		if !validation.Decode(w, r, &req) {
+			return
+		}
+	}
+
+	claims, _ := auth.ClaimsFromContext(r.Context())
+
+	ctx := context.Background()
+	if err := tokenstore.RevokeAccessToken(ctx, h.DB, claims.ID, claims.ExpiresAt.Time); err != nil {
+		http.Error(w, "Failed to revoke token", http.StatusInternalServerError)
+		return
+	}
+	if claims.SessionID != "" {
+		if err := tokenstore.RevokeFamily(ctx, h.DB, claims.SessionID); err != nil {
+			http.Error(w, "Failed to end session", http.StatusInternalServerError)
+			return
+		}
+	}
+	if req.RefreshToken != "" {
+		if err := tokenstore.RevokeRefreshToken(ctx, h.DB, req.RefreshToken); err != nil {
+			http.Error(w, "Failed to revoke refresh token", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	auditlog.Log(ctx, h.DB, r, auditlog.Entry{Action: auditlog.ActionLogout, TargetUserID: claims.UserID, Detail: "session " + claims.SessionID})
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"status": "logged out"})
+}
+
+// issueTokens creates an access token and a refresh token in the given family,
+// and records the login or refresh in the family's session. Roles and
+// permissions are loaded on every issue, so role and verification changes apply
+// from the next refresh. twoFactor tells whether the family's login passed 2FA;
+// without it, privileged roles grant no permissions unless that policy is turned off.
+func issueTokens(ctx context.Context, db bun.IDB, user *models.User, familyID string, twoFactor bool, client tokenstore.Client) (*dto.LoginResponse, error) {
+	if err := tokenstore.TouchSession(ctx, db, user.UserID, familyID, client); err != nil {
+		return nil, err
+	}
+	roles, err := rbac.UserRoles(ctx, db, user.UserID)
+	if err != nil {
+		return nil, err
+	}
+	includePrivileged := twoFactor || !twofactor.RequiredForPrivilegedRoles()
+	permissions, err := rbac.UserPermissions(ctx, db, user.UserID, includePrivileged)
+	if err != nil {
+		return nil, err
+	}
+	amr := []string{"pwd"}
+	if twoFactor {
+		amr = append(amr, "otp")
+	}
+	verified := !user.EmailVerifiedAt.IsZero()
+	token, err := jwtutil.GenerateJWTToken(&jwtutil.Claims{
+		UserID:        user.UserID,
+		Email:         user.Email,
+		EmailVerified: verified,
+		Roles:         roles,
+		Permissions:   emailpolicy.Permissions(permissions, verified),
+		AMR:           amr,
+		SessionID:     familyID,
+	})
+	if err != nil {
+		return nil, err
+	}
+	refreshToken, err := tokenstore.IssueRefreshToken(ctx, db, user.UserID, familyID, twoFactor)
+	if err != nil {
+		return nil, err
+	}
+	return &dto.LoginResponse{
+		Token:        token,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int64(jwtutil.AccessTokenTTL().Seconds()),
+	}, nil
 }
 
 func (h *AuthAPIHandler) ValidateTokenHandler(w http.ResponseWriter, r *http.Request) {
 	var req dto.ValidateTokenRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Token == "" {
-		http.Error(w, "Invalid request payload or missing token", http.StatusBadRequest)
+	if !validation.Decode(w, r, &req) {
 		return
 	}
 
+	ctx := r.Context()
 	claims, err := jwtutil.ParseJWTToken(req.Token)
 	if err != nil {
+		h.auditTokenValidation(ctx, r, nil, auditlog.OutcomeFailure, "invalid token")
 		w.WriteHeader(http.StatusUnauthorized)
 		json.NewEncoder(w).Encode(dto.ValidateTokenResponse{
 			Valid: false,
@@ -63,11 +454,93 @@ func (h *AuthAPIHandler) ValidateTokenHandler(w http.ResponseWriter, r *http.Req
 		return
 	}
 
+	revoked, err := tokenstore.IsRevoked(ctx, h.DB, claims)
+	if err != nil {
+		http.Error(w, "Failed to validate token", http.StatusInternalServerError)
+		return
+	}
+	if revoked {
+		h.auditTokenValidation(ctx, r, claims, auditlog.OutcomeFailure, "token revoked")
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(dto.ValidateTokenResponse{
+			Valid: false,
+			Error: "Token has been revoked",
+		})
+		return
+	}
+
+	h.auditTokenValidation(ctx, r, claims, auditlog.OutcomeSuccess, "")
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(dto.ValidateTokenResponse{
-		Valid:  true,
-		UserID: claims.UserID,
-		Email:  claims.Email,
-		Role:   claims.Role,
+		Valid:       true,
+		UserID:      claims.UserID,
+		Email:       claims.Email,
+		Roles:       claims.Roles,
+		Permissions: claims.Permissions,
+		ClientID:    claims.ClientID,
+		Scope:       claims.Scope,
 	})
 }
+
+// auditTokenValidation records a check of a token presented to /validate-token.
+// The token's user and jti are recorded; claims is nil when the token is invalid.
+func (h *AuthAPIHandler) auditTokenValidation(ctx context.Context, r *http.Request, claims *auth.Claims, outcome, detail string) {
+	entry := auditlog.Entry{Action: auditlog.ActionTokenValidate, Outcome: outcome, Detail: detail}
+	if claims != nil {
+		entry.TargetUserID = claims.UserID
+		entry.Detail = strings.TrimSpace("token " + claims.ID + " " + detail)
+	}
+	auditlog.Log(ctx, h.DB, r, entry)
+}
+
+// JWKSHandler publishes the public signing keys so other services can verify tokens locally.
+func (h *AuthAPIHandler) JWKSHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(jwtutil.JWKS())
+}
+
+// TokenRevocationsHandler lists the access tokens revoked before they expired,
+// so services that verify tokens locally reject them too. Only opaque token and
+// session IDs, and users with a revocation within the longest token lifetime,
+// are listed.
+func (h *AuthAPIHandler) TokenRevocationsHandler(w http.ResponseWriter, r *http.Request) {
+	lifetime := jwtutil.AccessTokenTTL()
+	if ttl := jwtutil.ImpersonationTokenTTL(); ttl > lifetime {
+		lifetime = ttl
+	}
+	list, err := tokenstore.Revocations(context.Background(), h.DB, lifetime)
+	if err != nil {
+		http.Error(w, "Failed to retrieve revocations", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(list)
+}
+
+// upgradePasswordHash replaces a stored hash made with an old algorithm or
+// weaker parameters by one from the current hasher. The update only applies if
+// the hash is unchanged, so a concurrent password change is never overwritten.
+// Failures are logged; the old hash keeps working until the next login.
+func (h *AuthAPIHandler) upgradePasswordHash(ctx context.Context, user *models.User, plain string) {
+	hash, err := password.Hash(plain)
+	if err != nil {
+		log.Printf("Failed to rehash password of user %d: %v", user.UserID, err)
+		return
+	}
+	_, err = h.DB.NewUpdate().
+		Model((*models.User)(nil)).
+		Set("password_hash = ?", hash).
+		Where("user_id = ?", user.UserID).
+		Where("password_hash = ?", user.PasswordHash).
+		Exec(ctx)
+	if err != nil {
+		log.Printf("Failed to store rehashed password of user %d: %v", user.UserID, err)
+		return
+	}
+	user.PasswordHash = hash
+}
@@ -0,0 +1,189 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/hari134/pratilipi/pkg/db"
+	"github.com/hari134/pratilipi/userservice/internal/apiclients"
+	"github.com/hari134/pratilipi/userservice/internal/dto"
+	"github.com/hari134/pratilipi/userservice/internal/jwtutil"
+	"github.com/hari134/pratilipi/userservice/internal/loginguard"
+	"github.com/hari134/pratilipi/userservice/internal/oidc"
+	"github.com/hari134/pratilipi/userservice/models"
+)
+
+// OAuthAPIHandler holds dependencies for the OAuth 2.0 token endpoint.
+type OAuthAPIHandler struct {
+	DB         *db.DB
+	LoginGuard *loginguard.Guard
+}
+
+// TokenHandler implements the client credentials grant (RFC 6749 section 4.4)
+// and the authorization code grant of OpenID Connect. Clients authenticate with
+// HTTP Basic or client_id and client_secret form fields; public clients send
+// only client_id. With client credentials, clients may narrow the token to some
+// of their scopes with "scope".
+func (h *OAuthAPIHandler) TokenHandler(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_request", "Malformed form body")
+		return
+	}
+	grantType := r.PostForm.Get("grant_type")
+	if grantType != apiclients.GrantClientCredentials && grantType != apiclients.GrantAuthorizationCode {
+		writeOAuthError(w, http.StatusBadRequest, "unsupported_grant_type", "Only client_credentials and authorization_code are supported")
+		return
+	}
+
+	client, ok := h.authenticateClient(w, r)
+	if !ok {
+		return
+	}
+	if !apiclients.AllowsGrant(client, grantType) {
+		writeOAuthError(w, http.StatusBadRequest, "unauthorized_client", "The client may not use this grant type")
+		return
+	}
+	if grantType == apiclients.GrantAuthorizationCode {
+		h.authorizationCodeGrant(w, r, client)
+		return
+	}
+
+	scopes, err := apiclients.GrantedScopes(client, strings.Fields(r.PostForm.Get("scope")))
+	if err != nil {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_scope", "The client may not request these scopes")
+		return
+	}
+	scope := strings.Join(scopes, " ")
+
+	token, err := jwtutil.GenerateJWTToken(&jwtutil.Claims{
+		ClientID:         client.ClientID,
+		Scope:            scope,
+		RegisteredClaims: jwt.RegisteredClaims{Subject: "client:" + client.ClientID},
+	})
+	if err != nil {
+		writeOAuthError(w, http.StatusInternalServerError, "server_error", "")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(dto.TokenResponse{
+		AccessToken: token,
+		TokenType:   "Bearer",
+		ExpiresIn:   int64(jwtutil.AccessTokenTTL().Seconds()),
+		Scope:       scope,
+	})
+}
+
+// authenticateClient checks the client credentials of a token request, writing
+// an error response if they are missing or wrong.
+func (h *OAuthAPIHandler) authenticateClient(w http.ResponseWriter, r *http.Request) (*models.APIClient, bool) {
+	clientID, secret, ok := r.BasicAuth()
+	if !ok {
+		clientID, secret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+	}
+	if clientID == "" {
+		writeOAuthError(w, http.StatusUnauthorized, "invalid_client", "Client credentials missing")
+		return nil, false
+	}
+
+	// Wrong secrets are throttled like wrong passwords
+	ctx := context.Background()
+	guardKey := "client:" + clientID
+	ip := loginguard.ClientIP(r)
+	decision, err := h.LoginGuard.Check(ctx, guardKey, ip)
+	if err != nil {
+		writeOAuthError(w, http.StatusInternalServerError, "server_error", "")
+		return nil, false
+	}
+	if !decision.Allowed {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(decision.RetryAfter.Seconds()))))
+		writeOAuthError(w, http.StatusTooManyRequests, "invalid_client", "Too many failed attempts, try again later")
+		return nil, false
+	}
+
+	client, err := apiclients.Authenticate(ctx, h.DB, clientID, secret)
+	if err != nil {
+		if errors.Is(err, apiclients.ErrInvalidClient) {
+			if _, err := h.LoginGuard.Failure(ctx, guardKey, ip); err != nil {
+				log.Printf("Failed to record client authentication failure: %v", err)
+			}
+			writeOAuthError(w, http.StatusUnauthorized, "invalid_client", "Invalid client credentials")
+		} else {
+			writeOAuthError(w, http.StatusInternalServerError, "server_error", "")
+		}
+		return nil, false
+	}
+	if err := h.LoginGuard.Success(ctx, guardKey); err != nil {
+		log.Printf("Failed to reset client authentication failures: %v", err)
+	}
+	return client, true
+}
+
+// authorizationCodeGrant exchanges an authorization code from /oauth/authorize
+// for an access token for the userinfo endpoint and an ID token. The request
+// must carry the redirect_uri of the authorization request and the PKCE code_verifier.
+func (h *OAuthAPIHandler) authorizationCodeGrant(w http.ResponseWriter, r *http.Request, client *models.APIClient) {
+	ctx := context.Background()
+	authCode, err := oidc.ConsumeCode(ctx, h.DB, r.PostForm.Get("code"), client.ClientID, r.PostForm.Get("redirect_uri"), r.PostForm.Get("code_verifier"))
+	if err != nil {
+		if errors.Is(err, oidc.ErrInvalidGrant) {
+			writeOAuthError(w, http.StatusBadRequest, "invalid_grant", "Invalid or expired authorization code, or wrong redirect_uri or code_verifier")
+		} else {
+			writeOAuthError(w, http.StatusInternalServerError, "server_error", "")
+		}
+		return
+	}
+
+	// The user may have been disabled since logging in
+	var user models.User
+	if err := h.DB.NewSelect().Model(&user).Where("user_id = ?", authCode.UserID).Scan(ctx); err != nil {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_grant", "The user no longer exists")
+		return
+	}
+	if msg := loginBlocked(&user); msg != "" {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_grant", msg)
+		return
+	}
+
+	accessToken, err := jwtutil.GenerateJWTToken(oidc.AccessTokenClaims(authCode))
+	if err != nil {
+		writeOAuthError(w, http.StatusInternalServerError, "server_error", "")
+		return
+	}
+	idToken, err := oidc.NewIDToken(&user, authCode)
+	if err != nil {
+		writeOAuthError(w, http.StatusInternalServerError, "server_error", "")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(dto.OIDCTokenResponse{
+		AccessToken: accessToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   int64(jwtutil.AccessTokenTTL().Seconds()),
+		Scope:       authCode.Scope,
+		IDToken:     idToken,
+	})
+}
+
+// writeOAuthError writes an error in the JSON format OAuth 2.0 clients expect.
+func writeOAuthError(w http.ResponseWriter, status int, code, description string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if status == http.StatusUnauthorized {
+		w.Header().Set("WWW-Authenticate", `Basic realm="oauth"`)
+	}
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(dto.OAuthError{Error: code, ErrorDescription: description})
+}
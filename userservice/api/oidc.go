@@ -0,0 +1,330 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/hari134/pratilipi/pkg/auth"
+	"github.com/hari134/pratilipi/userservice/internal/apiclients"
+	"github.com/hari134/pratilipi/userservice/internal/auditlog"
+	"github.com/hari134/pratilipi/userservice/internal/dto"
+	"github.com/hari134/pratilipi/userservice/internal/emailpolicy"
+	"github.com/hari134/pratilipi/userservice/internal/jwtutil"
+	"github.com/hari134/pratilipi/userservice/internal/loginguard"
+	"github.com/hari134/pratilipi/userservice/internal/oidc"
+	"github.com/hari134/pratilipi/userservice/internal/password"
+	"github.com/hari134/pratilipi/userservice/internal/tokenstore"
+	"github.com/hari134/pratilipi/userservice/internal/twofactor"
+	"github.com/hari134/pratilipi/userservice/models"
+)
+
+// OIDCAPIHandler serves the OpenID Connect discovery document, the login page
+// of the authorization code flow and the userinfo endpoint. Codes are exchanged
+// for tokens at /oauth/token. Logins go through the same checks as /login.
+type OIDCAPIHandler struct {
+	*AuthAPIHandler
+}
+
+// DiscoveryHandler serves /.well-known/openid-configuration.
+func (h *OIDCAPIHandler) DiscoveryHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(oidc.Discovery(jwtutil.Issuer(), jwtutil.SigningAlgorithms()))
+}
+
+var authorizePage = template.Must(template.New("authorize").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head><meta charset="utf-8"><title>Sign in</title></head>
+<body>
+{{if .Fatal}}
+<h1>Sign-in request rejected</h1>
+<p>{{.Error}}</p>
+{{else}}
+<h1>Sign in to continue to {{.ClientName}}</h1>
+{{if .Error}}<p role="alert">{{.Error}}</p>{{end}}
+<form method="post" action="authorize">
+{{range $name, $value := .Params}}<input type="hidden" name="{{$name}}" value="{{$value}}">
+{{end}}<input type="hidden" name="form_token" value="{{.FormToken}}">
+<p><label>Email <input type="email" name="email" value="{{.Email}}" autocomplete="username" required></label></p>
+<p><label>Password <input type="password" name="password" autocomplete="current-password" required></label></p>
+{{if .NeedCode}}<p><label>Authentication or recovery code <input type="text" name="code" autocomplete="one-time-code" required></label></p>
+{{end}}<p><button type="submit">Sign in</button></p>
+</form>
+{{end}}
+</body>
+</html>
+`))
+
+// authorizePageData fills in authorizePage.
+type authorizePageData struct {
+	ClientName string
+	Params     map[string]string // The authorization request, resubmitted with the credentials
+	FormToken  string
+	Email      string
+	NeedCode   bool
+	Error      string
+	Fatal      bool // The request cannot go back to the client, so there is no form
+}
+
+// AuthorizeHandler implements the authorization endpoint. GET shows a login
+// form for the authorization request; POST checks the credentials from the form
+// and redirects back to the client with an authorization code. Clients are
+// registered by admins, so there is no consent screen.
+func (h *OIDCAPIHandler) AuthorizeHandler(w http.ResponseWriter, r *http.Request) {
+	values := r.URL.Query()
+	if r.Method == http.MethodPost {
+		if err := r.ParseForm(); err != nil {
+			renderAuthorizePage(w, http.StatusBadRequest, authorizePageData{Error: "Malformed form body", Fatal: true})
+			return
+		}
+		values = r.PostForm
+	}
+
+	// Errors about the client or redirect URI are shown here, never sent to the redirect URI
+	ctx := context.Background()
+	client, err := apiclients.Find(ctx, h.DB, values.Get("client_id"))
+	if err != nil && !errors.Is(err, apiclients.ErrInvalidClient) {
+		renderAuthorizePage(w, http.StatusInternalServerError, authorizePageData{Error: "Failed to look up the application", Fatal: true})
+		return
+	}
+	if err != nil || !apiclients.AllowsGrant(client, apiclients.GrantAuthorizationCode) {
+		renderAuthorizePage(w, http.StatusBadRequest, authorizePageData{Error: "Unknown application", Fatal: true})
+		return
+	}
+	if !apiclients.HasRedirectURI(client, values.Get("redirect_uri")) {
+		renderAuthorizePage(w, http.StatusBadRequest, authorizePageData{Error: "The redirect URI is not registered for this application", Fatal: true})
+		return
+	}
+
+	req, err := oidc.ParseAuthorizationRequest(values)
+	if err != nil {
+		var oidcErr *oidc.Error
+		errors.As(err, &oidcErr)
+		redirectToClient(w, r, req.RedirectURI, req.State, url.Values{"error": {oidcErr.Code}, "error_description": {oidcErr.Description}})
+		return
+	}
+	// Logins are not remembered, so the user always has to be asked
+	if values.Get("prompt") == "none" {
+		redirectToClient(w, r, req.RedirectURI, req.State, url.Values{"error": {"login_required"}})
+		return
+	}
+
+	page := authorizePageData{ClientName: client.Name, Params: make(map[string]string)}
+	for _, name := range oidc.FormParams {
+		if v := values.Get(name); v != "" {
+			page.Params[name] = v
+		}
+	}
+	secret, err := formSecret(w, r)
+	if err != nil {
+		renderAuthorizePage(w, http.StatusInternalServerError, authorizePageData{Error: "Failed to show the sign-in form", Fatal: true})
+		return
+	}
+	page.FormToken = oidc.FormToken(secret, values)
+	if r.Method != http.MethodPost {
+		renderAuthorizePage(w, http.StatusOK, page)
+		return
+	}
+
+	page.Email = strings.ToLower(strings.TrimSpace(r.PostForm.Get("email")))
+	if !oidc.VerifyFormToken(secret, r.PostForm.Get("form_token"), values) {
+		page.Error = "The sign-in form has expired, sign in again"
+		renderAuthorizePage(w, http.StatusForbidden, page)
+		return
+	}
+	user, amr, status, msg := h.authenticateUser(ctx, r, client, page.Email, r.PostForm.Get("password"), strings.TrimSpace(r.PostForm.Get("code")))
+	if user == nil {
+		page.Error = msg
+		page.NeedCode = msg == twoFactorCodeNeeded || msg == twoFactorCodeInvalid
+		renderAuthorizePage(w, status, page)
+		return
+	}
+
+	code, err := oidc.IssueCode(ctx, h.DB, req, user.UserID, amr)
+	if err != nil {
+		page.Error = "Failed to sign in, try again"
+		renderAuthorizePage(w, http.StatusInternalServerError, page)
+		return
+	}
+	h.auditLogin(ctx, r, auditlog.ActionOIDCAuthorize, user, auditlog.OutcomeSuccess, "client "+client.ClientID)
+	redirectToClient(w, r, req.RedirectURI, req.State, url.Values{"code": {code}})
+}
+
+// Messages shown when the password was right but the 2FA code is missing or wrong.
+const (
+	twoFactorCodeNeeded  = "Enter the code from your authenticator app or a recovery code"
+	twoFactorCodeInvalid = "Invalid code"
+)
+
+// authenticateUser checks the credentials from the login form like LoginHandler
+// and returns the user with the authentication methods used, or the status and
+// message to show instead.
+func (h *OIDCAPIHandler) authenticateUser(ctx context.Context, r *http.Request, client *models.APIClient, email, pw, code string) (*models.User, []string, int, string) {
+	detail := "client " + client.ClientID
+	ip := loginguard.ClientIP(r)
+	decision, err := h.LoginGuard.Check(ctx, email, ip)
+	if err != nil {
+		return nil, nil, http.StatusInternalServerError, "Failed to sign in, try again"
+	}
+	if !decision.Allowed {
+		h.auditLogin(ctx, r, auditlog.ActionOIDCAuthorize, &models.User{}, auditlog.OutcomeDenied, "too many failed attempts, "+detail)
+		return nil, nil, http.StatusTooManyRequests, "Too many failed login attempts, try again later"
+	}
+
+	var user models.User
+	err = h.DB.NewSelect().Model(&user).Where("LOWER(email) = ?", email).Scan(ctx)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, nil, http.StatusInternalServerError, "Failed to sign in, try again"
+	}
+	// Unknown emails are checked against a dummy hash so they take as long to reject as known ones
+	passwordHash := password.DummyHash()
+	if err == nil {
+		passwordHash = user.PasswordHash
+	}
+	ok, rehash, err := password.Verify(pw, passwordHash)
+	if !ok || user.UserID == 0 {
+		if err != nil && !errors.Is(err, password.ErrUnknownHash) {
+			log.Printf("Failed to verify password of user %d: %v", user.UserID, err)
+		}
+		h.recordLoginFailure(ctx, &user, email, ip)
+		if user.UserID == 0 {
+			h.auditLogin(ctx, r, auditlog.ActionOIDCAuthorize, &user, auditlog.OutcomeFailure, "unknown email, "+detail)
+		} else {
+			h.auditLogin(ctx, r, auditlog.ActionOIDCAuthorize, &user, auditlog.OutcomeFailure, "wrong password, "+detail)
+		}
+		return nil, nil, http.StatusUnauthorized, "Invalid email or password"
+	}
+	if rehash {
+		h.upgradePasswordHash(ctx, &user, pw)
+	}
+	if err := h.LoginGuard.PasswordVerified(ctx, email, !user.TOTPEnabledAt.IsZero()); err != nil {
+		log.Printf("Failed to reset login failures for user %d: %v", user.UserID, err)
+	}
+
+	if msg := loginBlocked(&user); msg != "" {
+		h.auditLogin(ctx, r, auditlog.ActionOIDCAuthorize, &user, auditlog.OutcomeDenied, msg+", "+detail)
+		return nil, nil, http.StatusForbidden, msg
+	}
+	if !emailpolicy.LoginAllowed(!user.EmailVerifiedAt.IsZero()) {
+		h.auditLogin(ctx, r, auditlog.ActionOIDCAuthorize, &user, auditlog.OutcomeDenied, "Email address not verified, "+detail)
+		return nil, nil, http.StatusForbidden, "Email address not verified"
+	}
+
+	amr := []string{"pwd"}
+	if !user.TOTPEnabledAt.IsZero() {
+		if code == "" {
+			return nil, nil, http.StatusUnauthorized, twoFactorCodeNeeded
+		}
+		valid, err := twofactor.VerifyCode(ctx, h.DB, &user, code)
+		if err != nil {
+			return nil, nil, http.StatusInternalServerError, "Failed to sign in, try again"
+		}
+		if !valid {
+			// Without a challenge to use up, wrong codes count towards the lockout like wrong passwords
+			h.recordLoginFailure(ctx, &user, email, ip)
+			h.auditLogin(ctx, r, auditlog.ActionOIDCAuthorize, &user, auditlog.OutcomeFailure, "wrong code, "+detail)
+			return nil, nil, http.StatusUnauthorized, twoFactorCodeInvalid
+		}
+		if err := h.LoginGuard.Success(ctx, email); err != nil {
+			log.Printf("Failed to reset login failures for user %d: %v", user.UserID, err)
+		}
+		amr = append(amr, "otp")
+	}
+	return &user, amr, http.StatusOK, ""
+}
+
+// formSecret returns the browser's secret for login form tokens from
+// oidc.FormCookie, setting a new one if there is none yet. The cookie is only
+// sent to the authorization endpoint and not readable by scripts.
+func formSecret(w http.ResponseWriter, r *http.Request) (string, error) {
+	if cookie, err := r.Cookie(oidc.FormCookie); err == nil && cookie.Value != "" {
+		return cookie.Value, nil
+	}
+	secret, err := tokenstore.NewOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidc.FormCookie,
+		Value:    secret,
+		Path:     "/oauth/authorize",
+		HttpOnly: true,
+		Secure:   r.TLS != nil || strings.HasPrefix(jwtutil.Issuer(), "https://"),
+		SameSite: http.SameSiteLaxMode,
+	})
+	return secret, nil
+}
+
+// renderAuthorizePage writes the login page. It must not be framed, so it cannot
+// be used for clickjacking.
+func renderAuthorizePage(w http.ResponseWriter, status int, data authorizePageData) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Frame-Options", "DENY")
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; frame-ancestors 'none'")
+	w.WriteHeader(status)
+	if err := authorizePage.Execute(w, data); err != nil {
+		log.Printf("Failed to render authorize page: %v", err)
+	}
+}
+
+// redirectToClient sends the user back to the client's redirect URI with the
+// given parameters and the state of the authorization request.
+func redirectToClient(w http.ResponseWriter, r *http.Request, redirectURI, state string, params url.Values) {
+	u, err := url.Parse(redirectURI)
+	if err != nil {
+		renderAuthorizePage(w, http.StatusBadRequest, authorizePageData{Error: "Invalid redirect URI", Fatal: true})
+		return
+	}
+	q := u.Query()
+	for name, values := range params {
+		q[name] = values
+	}
+	if state != "" {
+		q.Set("state", state)
+	}
+	u.RawQuery = q.Encode()
+	w.Header().Set("Cache-Control", "no-store")
+	http.Redirect(w, r, u.String(), http.StatusFound)
+}
+
+// UserInfoHandler returns the claims about the user that the access token's
+// scopes release. Only access tokens from the authorization code flow are accepted.
+func (h *OIDCAPIHandler) UserInfoHandler(w http.ResponseWriter, r *http.Request) {
+	claims, _ := auth.ClaimsFromContext(r.Context())
+	userID, ok := oidc.UserID(claims)
+	if !ok {
+		w.Header().Set("WWW-Authenticate", `Bearer error="insufficient_scope", scope="openid"`)
+		http.Error(w, "The userinfo endpoint needs an access token from the authorization code flow", http.StatusForbidden)
+		return
+	}
+
+	var user models.User
+	err := h.DB.NewSelect().Model(&user).Where("user_id = ?", userID).Scan(context.Background())
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "Failed to retrieve user", http.StatusInternalServerError)
+		return
+	}
+	// Tokens of deleted or disabled users, and tokens issued before the user was logged out everywhere, are refused
+	if err != nil || loginBlocked(&user) != "" || claims.IssuedAt != nil && claims.IssuedAt.Before(user.TokensValidAfter) {
+		w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+		http.Error(w, "Token is no longer valid", http.StatusUnauthorized)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(dto.OIDCUserInfo{
+		Subject:     oidc.Subject(user.UserID),
+		OIDCProfile: oidc.Profile(&user, claims.Scope),
+	})
+}
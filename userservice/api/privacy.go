@@ -0,0 +1,148 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/hari134/pratilipi/pkg/db"
+	"github.com/hari134/pratilipi/pkg/validation"
+	"github.com/hari134/pratilipi/userservice/internal/dto"
+	"github.com/hari134/pratilipi/userservice/internal/loginguard"
+	"github.com/hari134/pratilipi/userservice/internal/password"
+	"github.com/hari134/pratilipi/userservice/internal/privacy"
+	"github.com/hari134/pratilipi/userservice/internal/twofactor"
+	"github.com/hari134/pratilipi/userservice/middleware"
+	"github.com/hari134/pratilipi/userservice/models"
+	"github.com/uptrace/bun"
+)
+
+// PrivacyAPIHandler holds dependencies for the personal data export and erasure routes.
+type PrivacyAPIHandler struct {
+	DB         *db.DB
+	LoginGuard *loginguard.Guard
+	Exporter   *privacy.Exporter
+}
+
+// ExportMyDataHandler returns a zip archive of everything held about the caller in every service.
+func (h *PrivacyAPIHandler) ExportMyDataHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middleware.UserIDKey).(int64)
+	if userID == 0 {
+		http.Error(w, "Exporting your data needs a user token", http.StatusForbidden)
+		return
+	}
+	h.writeExport(w, userID)
+}
+
+// ExportUserHandler returns a zip archive of everything held about a user in every service.
+func (h *PrivacyAPIHandler) ExportUserHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.ParseInt(mux.Vars(r)["userID"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+	h.writeExport(w, userID)
+}
+
+func (h *PrivacyAPIHandler) writeExport(w http.ResponseWriter, userID int64) {
+	archive, err := h.Exporter.Export(context.Background(), userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "User not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("Failed to export data of user %d: %v", userID, err)
+		http.Error(w, "Failed to export user data", http.StatusBadGateway)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"user-%d-%s.zip\"", userID, time.Now().Format("20060102")))
+	w.WriteHeader(http.StatusOK)
+	w.Write(archive)
+}
+
+// DeleteMyAccountHandler erases the caller's account after checking their
+// password, and a TOTP or recovery code if 2FA is enabled.
+func (h *PrivacyAPIHandler) DeleteMyAccountHandler(w http.ResponseWriter, r *http.Request) {
+	var req dto.DeleteAccountRequest
+	if !validation.Decode(w, r, &req) {
+		return
+	}
+
+	userID := r.Context().Value(middleware.UserIDKey).(int64)
+	if userID == 0 {
+		http.Error(w, "Deleting an account needs a user token", http.StatusForbidden)
+		return
+	}
+
+	ctx := context.Background()
+	var user models.User
+	if err := h.DB.NewSelect().Model(&user).Where("user_id = ?", userID).Scan(ctx); err != nil {
+		writeUserLookupError(w, err)
+		return
+	}
+	if ok, _, _ := password.Verify(req.Password, user.PasswordHash); !ok {
+		http.Error(w, "Invalid password", http.StatusUnauthorized)
+		return
+	}
+	if !user.TOTPEnabledAt.IsZero() {
+		valid, err := twofactor.VerifyCode(ctx, h.DB, &user, req.Code)
+		if err != nil {
+			http.Error(w, "Failed to verify code", http.StatusInternalServerError)
+			return
+		}
+		if !valid {
+			http.Error(w, "Invalid two-factor code", http.StatusUnauthorized)
+			return
+		}
+	}
+
+	h.erase(w, userID, userID)
+}
+
+// EraseUserHandler erases a user's account on behalf of an admin.
+func (h *PrivacyAPIHandler) EraseUserHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.ParseInt(mux.Vars(r)["userID"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+	adminID := r.Context().Value(middleware.UserIDKey).(int64)
+	h.erase(w, userID, adminID)
+}
+
+// erase anonymizes the user here and, through the UserErased event, in every other service.
+func (h *PrivacyAPIHandler) erase(w http.ResponseWriter, userID, erasedBy int64) {
+	ctx := context.Background()
+	var erased *models.User
+	err := h.DB.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		var err error
+		erased, err = privacy.Erase(ctx, tx, userID, erasedBy)
+		return err
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "User not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("Failed to erase user %d: %v", userID, err)
+		http.Error(w, "Failed to erase user", http.StatusInternalServerError)
+		return
+	}
+
+	// Failed logins are keyed by the old email address
+	if err := h.LoginGuard.Unlock(ctx, erased.Email); err != nil {
+		log.Printf("Failed to clear login attempts of erased user %d: %v", userID, err)
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"status": "user erased"})
+}
@@ -0,0 +1,146 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/hari134/pratilipi/pkg/db"
+	"github.com/hari134/pratilipi/pkg/validation"
+	"github.com/hari134/pratilipi/userservice/internal/auditlog"
+	"github.com/hari134/pratilipi/userservice/internal/dto"
+	"github.com/hari134/pratilipi/userservice/internal/rbac"
+	"github.com/hari134/pratilipi/userservice/middleware"
+	"github.com/hari134/pratilipi/userservice/models"
+	"github.com/uptrace/bun"
+)
+
+// RoleAPIHandler holds dependencies for the role administration routes.
+// All of its routes require the "user:admin" permission.
+type RoleAPIHandler struct {
+	DB *db.DB
+}
+
+// ListRolesHandler returns every role with the permissions it grants.
+func (h *RoleAPIHandler) ListRolesHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+	var roles []models.Role
+	if err := h.DB.NewSelect().Model(&roles).Order("name").Scan(ctx); err != nil {
+		http.Error(w, "Failed to retrieve roles", http.StatusInternalServerError)
+		return
+	}
+
+	permissions, err := rbac.RolePermissions(ctx, h.DB)
+	if err != nil {
+		http.Error(w, "Failed to retrieve roles", http.StatusInternalServerError)
+		return
+	}
+	for i := range roles {
+		roles[i].Permissions = permissions[roles[i].RoleID]
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(roles)
+}
+
+// GetUserRolesHandler returns the roles held by a user.
+func (h *RoleAPIHandler) GetUserRolesHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.ParseInt(mux.Vars(r)["userID"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	ctx := context.Background()
+	if err := h.ensureUserExists(ctx, userID); err != nil {
+		writeUserLookupError(w, err)
+		return
+	}
+	roles, err := rbac.UserRoles(ctx, h.DB, userID)
+	if err != nil {
+		http.Error(w, "Failed to retrieve roles", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(dto.SetUserRolesRequest{Roles: roles})
+}
+
+// SetUserRolesHandler replaces the roles held by a user. The change applies to
+// tokens issued from the user's next login or refresh.
+func (h *RoleAPIHandler) SetUserRolesHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.ParseInt(mux.Vars(r)["userID"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	var req dto.SetUserRolesRequest
+	if !validation.Decode(w, r, &req) {
+		return
+	}
+
+	// Admins cannot strip their own admin role, so there is always someone left to undo mistakes
+	adminID := r.Context().Value(middleware.UserIDKey).(int64)
+	if adminID == userID && !contains(req.Roles, "admin") {
+		http.Error(w, "You cannot remove your own admin role", http.StatusForbidden)
+		return
+	}
+
+	ctx := context.Background()
+	if err := h.ensureUserExists(ctx, userID); err != nil {
+		writeUserLookupError(w, err)
+		return
+	}
+	err = h.DB.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		previous, err := rbac.UserRoles(ctx, tx, userID)
+		if err != nil {
+			return err
+		}
+		if err := rbac.SetRoles(ctx, tx, userID, req.Roles, adminID); err != nil {
+			return err
+		}
+		return auditlog.Record(ctx, tx, r, auditlog.Entry{
+			Action:       auditlog.ActionRolesChange,
+			TargetUserID: userID,
+			Detail:       "[" + strings.Join(previous, ", ") + "] to [" + strings.Join(req.Roles, ", ") + "]",
+		})
+	})
+	if err != nil {
+		if errors.Is(err, rbac.ErrUnknownRole) {
+			http.Error(w, "Unknown role", http.StatusBadRequest)
+		} else {
+			http.Error(w, "Failed to update roles", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(req)
+}
+
+func (h *RoleAPIHandler) ensureUserExists(ctx context.Context, userID int64) error {
+	return h.DB.NewSelect().Model((*models.User)(nil)).Column("user_id").Where("user_id = ?", userID).Scan(ctx, new(int64))
+}
+
+func writeUserLookupError(w http.ResponseWriter, err error) {
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "User not found", http.StatusNotFound)
+	} else {
+		http.Error(w, "Failed to retrieve user", http.StatusInternalServerError)
+	}
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
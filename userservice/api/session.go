@@ -0,0 +1,109 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/hari134/pratilipi/pkg/auth"
+	"github.com/hari134/pratilipi/pkg/db"
+	"github.com/hari134/pratilipi/userservice/internal/dto"
+	"github.com/hari134/pratilipi/userservice/internal/tokenstore"
+)
+
+// SessionAPIHandler holds dependencies for the routes that list and end the
+// caller's own login sessions.
+type SessionAPIHandler struct {
+	DB *db.DB
+}
+
+// ListSessionsHandler lists the caller's active sessions, most recently used
+// first, marking the one the request's token belongs to.
+func (h *SessionAPIHandler) ListSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	claims, ok := sessionOwner(w, r, false)
+	if !ok {
+		return
+	}
+
+	sessions, err := tokenstore.ActiveSessions(context.Background(), h.DB, claims.UserID)
+	if err != nil {
+		http.Error(w, "Failed to retrieve sessions", http.StatusInternalServerError)
+		return
+	}
+
+	list := make([]dto.Session, len(sessions))
+	for i, s := range sessions {
+		list[i] = dto.Session{
+			SessionID:  s.SessionID,
+			DeviceName: s.DeviceName,
+			UserAgent:  s.UserAgent,
+			IP:         s.IP,
+			CreatedAt:  s.CreatedAt,
+			LastSeenAt: s.LastSeenAt,
+			Current:    s.SessionID == claims.SessionID,
+		}
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(list)
+}
+
+// RevokeSessionHandler ends one of the caller's sessions, which may be the current one.
+func (h *SessionAPIHandler) RevokeSessionHandler(w http.ResponseWriter, r *http.Request) {
+	claims, ok := sessionOwner(w, r, true)
+	if !ok {
+		return
+	}
+
+	err := tokenstore.RevokeSession(context.Background(), h.DB, claims.UserID, mux.Vars(r)["sessionID"])
+	if err != nil {
+		if errors.Is(err, tokenstore.ErrSessionNotFound) {
+			http.Error(w, "Session not found", http.StatusNotFound)
+		} else {
+			http.Error(w, "Failed to end session", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(dto.RevokeSessionsResponse{Revoked: 1})
+}
+
+// RevokeOtherSessionsHandler ends every session of the caller except the one
+// the request's token belongs to.
+func (h *SessionAPIHandler) RevokeOtherSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	claims, ok := sessionOwner(w, r, true)
+	if !ok {
+		return
+	}
+	if claims.SessionID == "" {
+		http.Error(w, "This token is not tied to a session, log in again", http.StatusBadRequest)
+		return
+	}
+
+	revoked, err := tokenstore.RevokeOtherSessions(context.Background(), h.DB, claims.UserID, claims.SessionID)
+	if err != nil {
+		http.Error(w, "Failed to end sessions", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(dto.RevokeSessionsResponse{Revoked: revoked})
+}
+
+// sessionOwner returns the caller's claims. Service tokens have no sessions,
+// and admins impersonating a user may look at their sessions but not end them.
+func sessionOwner(w http.ResponseWriter, r *http.Request, revoking bool) (*auth.Claims, bool) {
+	claims, _ := auth.ClaimsFromContext(r.Context())
+	if claims == nil || claims.UserID == 0 {
+		http.Error(w, "Sessions need a user token", http.StatusForbidden)
+		return nil, false
+	}
+	if revoking && claims.IsImpersonation() {
+		http.Error(w, "Sessions cannot be ended while impersonating", http.StatusForbidden)
+		return nil, false
+	}
+	return claims, true
+}
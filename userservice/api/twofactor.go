@@ -0,0 +1,230 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/hari134/pratilipi/pkg/db"
+	"github.com/hari134/pratilipi/pkg/validation"
+	"github.com/hari134/pratilipi/userservice/internal/auditlog"
+	"github.com/hari134/pratilipi/userservice/internal/dto"
+	"github.com/hari134/pratilipi/userservice/internal/totp"
+	"github.com/hari134/pratilipi/userservice/internal/twofactor"
+	"github.com/hari134/pratilipi/userservice/middleware"
+	"github.com/hari134/pratilipi/userservice/models"
+	"github.com/uptrace/bun"
+)
+
+// TwoFactorAPIHandler holds dependencies for the 2FA enrollment routes.
+// All of its routes act on the authenticated user.
+type TwoFactorAPIHandler struct {
+	DB *db.DB
+}
+
+// EnrollHandler generates a new TOTP secret for the user. 2FA is not enabled
+// until the secret is confirmed with a code from the authenticator app.
+func (h *TwoFactorAPIHandler) EnrollHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+	user, ok := h.currentUser(w, r)
+	if !ok {
+		return
+	}
+	if !user.TOTPEnabledAt.IsZero() {
+		http.Error(w, "Two-factor authentication is already enabled", http.StatusConflict)
+		return
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		http.Error(w, "Failed to generate secret", http.StatusInternalServerError)
+		return
+	}
+	_, err = h.DB.NewUpdate().
+		Model((*models.User)(nil)).
+		Set("totp_secret = ?", secret).
+		Set("totp_last_counter = NULL").
+		Where("user_id = ?", user.UserID).
+		Exec(ctx)
+	if err != nil {
+		http.Error(w, "Failed to start enrollment", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(dto.TwoFactorEnrollResponse{
+		Secret:     secret,
+		OTPAuthURI: totp.URI(twofactor.Issuer(), user.Email, secret),
+	})
+}
+
+// ConfirmHandler enables 2FA once the user proves their authenticator app
+// produces valid codes, and returns the initial recovery codes.
+func (h *TwoFactorAPIHandler) ConfirmHandler(w http.ResponseWriter, r *http.Request) {
+	var req dto.TwoFactorCodeRequest
+	if !validation.Decode(w, r, &req) {
+		return
+	}
+
+	ctx := context.Background()
+	user, ok := h.currentUser(w, r)
+	if !ok {
+		return
+	}
+	if !user.TOTPEnabledAt.IsZero() {
+		http.Error(w, "Two-factor authentication is already enabled", http.StatusConflict)
+		return
+	}
+	if user.TOTPSecret == "" {
+		http.Error(w, "Start enrollment first", http.StatusBadRequest)
+		return
+	}
+
+	var codes []string
+	err := h.DB.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		valid, err := twofactor.VerifyTOTP(ctx, tx, user, req.Code)
+		if err != nil || !valid {
+			return err
+		}
+		_, err = tx.NewUpdate().
+			Model((*models.User)(nil)).
+			Set("totp_enabled_at = ?", time.Now()).
+			Where("user_id = ?", user.UserID).
+			Exec(ctx)
+		if err != nil {
+			return err
+		}
+		codes, err = twofactor.GenerateRecoveryCodes(ctx, tx, user.UserID)
+		if err != nil {
+			return err
+		}
+		return auditlog.Record(ctx, tx, r, auditlog.Entry{Action: auditlog.ActionTwoFactorEnable, TargetUserID: user.UserID})
+	})
+	if err != nil {
+		http.Error(w, "Failed to enable two-factor authentication", http.StatusInternalServerError)
+		return
+	}
+	if codes == nil {
+		http.Error(w, "Invalid code", http.StatusBadRequest)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(dto.RecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// DisableHandler turns 2FA off after checking a TOTP or recovery code. Existing
+// sessions lose the permissions that need 2FA from their next refresh.
+func (h *TwoFactorAPIHandler) DisableHandler(w http.ResponseWriter, r *http.Request) {
+	var req dto.TwoFactorCodeRequest
+	if !validation.Decode(w, r, &req) {
+		return
+	}
+
+	ctx := context.Background()
+	user, ok := h.currentUser(w, r)
+	if !ok {
+		return
+	}
+	if user.TOTPEnabledAt.IsZero() {
+		http.Error(w, "Two-factor authentication is not enabled", http.StatusBadRequest)
+		return
+	}
+
+	valid := false
+	err := h.DB.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		var err error
+		valid, err = twofactor.VerifyCode(ctx, tx, user, req.Code)
+		if err != nil || !valid {
+			return err
+		}
+		_, err = tx.NewUpdate().
+			Model((*models.User)(nil)).
+			Set("totp_secret = NULL").
+			Set("totp_enabled_at = NULL").
+			Set("totp_last_counter = NULL").
+			Where("user_id = ?", user.UserID).
+			Exec(ctx)
+		if err != nil {
+			return err
+		}
+		_, err = tx.NewUpdate().
+			Model((*models.RefreshToken)(nil)).
+			Set("two_factor = FALSE").
+			Where("user_id = ?", user.UserID).
+			Exec(ctx)
+		if err != nil {
+			return err
+		}
+		if err := twofactor.DeleteRecoveryCodes(ctx, tx, user.UserID); err != nil {
+			return err
+		}
+		return auditlog.Record(ctx, tx, r, auditlog.Entry{Action: auditlog.ActionTwoFactorDisable, TargetUserID: user.UserID})
+	})
+	if err != nil {
+		http.Error(w, "Failed to disable two-factor authentication", http.StatusInternalServerError)
+		return
+	}
+	if !valid {
+		http.Error(w, "Invalid code", http.StatusBadRequest)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"status": "two-factor authentication disabled"})
+}
+
+// RegenerateRecoveryCodesHandler replaces the user's recovery codes after checking a TOTP code.
+func (h *TwoFactorAPIHandler) RegenerateRecoveryCodesHandler(w http.ResponseWriter, r *http.Request) {
+	var req dto.TwoFactorCodeRequest
+	if !validation.Decode(w, r, &req) {
+		return
+	}
+
+	ctx := context.Background()
+	user, ok := h.currentUser(w, r)
+	if !ok {
+		return
+	}
+	if user.TOTPEnabledAt.IsZero() {
+		http.Error(w, "Two-factor authentication is not enabled", http.StatusBadRequest)
+		return
+	}
+
+	var codes []string
+	err := h.DB.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		valid, err := twofactor.VerifyTOTP(ctx, tx, user, req.Code)
+		if err != nil || !valid {
+			return err
+		}
+		codes, err = twofactor.GenerateRecoveryCodes(ctx, tx, user.UserID)
+		return err
+	})
+	if err != nil {
+		http.Error(w, "Failed to generate recovery codes", http.StatusInternalServerError)
+		return
+	}
+	if codes == nil {
+		http.Error(w, "Invalid code", http.StatusBadRequest)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(dto.RecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// currentUser loads the authenticated user, writing an error response if that fails.
+func (h *TwoFactorAPIHandler) currentUser(w http.ResponseWriter, r *http.Request) (*models.User, bool) {
+	userID := r.Context().Value(middleware.UserIDKey).(int64)
+	if userID == 0 {
+		http.Error(w, "Two-factor authentication needs a user token", http.StatusForbidden)
+		return nil, false
+	}
+	user := &models.User{}
+	if err := h.DB.NewSelect().Model(user).Where("user_id = ?", userID).Scan(context.Background()); err != nil {
+		http.Error(w, "Failed to retrieve user", http.StatusInternalServerError)
+		return nil, false
+	}
+	return user, true
+}
@@ -4,18 +4,27 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"log"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gorilla/mux"
+	"github.com/hari134/pratilipi/pkg/audit"
+	"github.com/hari134/pratilipi/pkg/auth"
 	"github.com/hari134/pratilipi/pkg/db"
 	"github.com/hari134/pratilipi/pkg/messaging"
+	"github.com/hari134/pratilipi/pkg/validation"
+	"github.com/hari134/pratilipi/userservice/internal/auditlog"
 	"github.com/hari134/pratilipi/userservice/internal/dto"
+	"github.com/hari134/pratilipi/userservice/internal/outbox"
+	"github.com/hari134/pratilipi/userservice/internal/password"
+	"github.com/hari134/pratilipi/userservice/internal/rbac"
 	"github.com/hari134/pratilipi/userservice/middleware"
 	"github.com/hari134/pratilipi/userservice/models"
 	"github.com/hari134/pratilipi/userservice/producer"
-	"golang.org/x/crypto/bcrypt"
+	"github.com/uptrace/bun"
 )
 
 // UserAPIHandler holds dependencies for the user API routes.
@@ -26,11 +35,10 @@ type UserAPIHandler struct {
 
 // UserRequest represents the incoming payload for creating a user, including the plain password.
 type UserRequest struct {
-	Name     string `json:"name"`
-	PhoneNo  string `json:"phone_no"`
-	Email    string `json:"email"`
-	Password string `json:"password"`  // Plain password
-	Role     string `json:"role"`
+	Name     string `json:"name" validate:"required,max=100" normalize:"trim"`
+	PhoneNo  string `json:"phone_no" validate:"required,e164" normalize:"e164"`
+	Email    string `json:"email" validate:"required,email,max=150" normalize:"trim,lower"`
+	Password string `json:"password" validate:"required,min=8,max=128"`  // Plain password
 }
 
 // CreateUserHandler handles HTTP POST requests to create a new user and stores a hashed password.
@@ -38,8 +46,7 @@ func (h *UserAPIHandler) CreateUserHandler(w http.ResponseWriter, r *http.Reques
 	var userReq UserRequest
 
 	// Decode the incoming request body into UserRequest struct
-	if err := json.NewDecoder(r.Body).Decode(&userReq); err != nil {
-		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+	if !validation.Decode(w, r, &userReq) {
 		return
 	}
 
@@ -56,19 +63,22 @@ func (h *UserAPIHandler) CreateUserHandler(w http.ResponseWriter, r *http.Reques
 		PhoneNo:      userReq.PhoneNo,
 		Email:        userReq.Email,
 		PasswordHash: hashedPassword,
-		Role:         userReq.Role,
 		CreatedAt:    time.Now(),
 		UpdatedAt:    time.Now(),
+		Audit:        db.Audit{CreatedBy: audit.ActorFromRequest(r)},
 	}
 
-	// Set default role if not provided
-	if user.Role == "" {
-		user.Role = "admin"
-	}
-
-	// Insert the user into the database
+	// Insert the user with the default role; registration can never grant a privileged role
 	ctx := context.Background()
-	_, err = h.DB.NewInsert().Model(&user).Exec(ctx)
+	err = h.DB.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		if _, err := tx.NewInsert().Model(&user).Exec(ctx); err != nil {
+			return err
+		}
+		if err := rbac.AssignDefaultRole(ctx, tx, user.UserID); err != nil {
+			return err
+		}
+		return auditlog.Record(ctx, tx, r, auditlog.Entry{Action: auditlog.ActionRegister, ActorID: user.UserID, TargetUserID: user.UserID})
+	})
 	if err != nil {
 		http.Error(w, "Failed to create user", http.StatusInternalServerError)
 		return
@@ -86,27 +96,26 @@ func (h *UserAPIHandler) CreateUserHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
+	// Ask the user to verify their email; if this fails they can request another email later
+	if err := sendEmailVerification(ctx, h.DB, &user); err != nil {
+		log.Printf("Failed to send verification email to user %d: %v", user.UserID, err)
+	}
+
 	// Respond with the created user
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(user)
 }
 
-// hashPassword hashes a plain password using bcrypt.
-func hashPassword(password string) (string, error) {
-	// Use bcrypt to generate a hashed password
-	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
-	if err != nil {
-		return "", err
-	}
-	return string(hash), nil
+// hashPassword hashes a plain password with the configured password hasher.
+func hashPassword(plain string) (string, error) {
+	return password.Hash(plain)
 }
 
 func (h *UserAPIHandler) UpdateUserHandler(w http.ResponseWriter, r *http.Request) {
     var updateReq dto.UpdateUserRequest
 
     // Decode the incoming request body
-    if err := json.NewDecoder(r.Body).Decode(&updateReq); err != nil {
-        http.Error(w, "Invalid request payload", http.StatusBadRequest)
+    if !validation.Decode(w, r, &updateReq) {
         return
     }
 
@@ -119,23 +128,89 @@ func (h *UserAPIHandler) UpdateUserHandler(w http.ResponseWriter, r *http.Reques
         return
     }
 
-    // Proceed with updating the user's profile in the database
+    // Update the profile and store the UserProfileUpdated event in one transaction,
+    // so replicas in other services hear about every committed change
     ctx := context.Background()
-    _, err := h.DB.NewUpdate().
-        Model(&models.User{Email: updateReq.Email, Name: updateReq.Name}).
-        Where("user_id = ?", updateReq.UserID).
-        Exec(ctx)
+    var user *models.User
+    emailChanged := false
+    err := h.DB.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+        var current models.User
+        if err := tx.NewSelect().Model(&current).Where("user_id = ?", updateReq.UserID).For("UPDATE").Scan(ctx); err != nil {
+            return err
+        }
+        emailChanged = updateReq.Email != current.Email
+
+        user = &models.User{
+            UserID:    updateReq.UserID,
+            Email:     updateReq.Email,
+            Name:      updateReq.Name,
+            PhoneNo:   current.PhoneNo,
+            UpdatedAt: time.Now(),
+            Audit:     db.Audit{UpdatedBy: userIDFromToken},
+        }
+        columns := []string{"email", "name", "updated_at", "updated_by"}
+        if updateReq.PhoneNo != "" {
+            user.PhoneNo = updateReq.PhoneNo
+            columns = append(columns, "phone_no")
+        }
+        if emailChanged {
+            // A new address has to be verified again
+            columns = append(columns, "email_verified_at")
+        }
+        _, err := tx.NewUpdate().
+            Model(user).
+            Column(columns...).
+            Where("user_id = ?", updateReq.UserID).
+            Exec(ctx)
+        if err != nil {
+            return err
+        }
+
+        changed := []string{}
+        if emailChanged {
+            changed = append(changed, "email")
+        }
+        if user.Name != current.Name {
+            changed = append(changed, "name")
+        }
+        if user.PhoneNo != current.PhoneNo {
+            changed = append(changed, "phone_no")
+        }
+        err = auditlog.Record(ctx, tx, r, auditlog.Entry{
+            Action:       auditlog.ActionProfileUpdate,
+            TargetUserID: user.UserID,
+            Detail:       "changed [" + strings.Join(changed, ", ") + "]",
+        })
+        if err != nil {
+            return err
+        }
+
+        return outbox.Enqueue(ctx, tx, "user-profile-updated", &messaging.UserProfileUpdated{
+            UserID:    strconv.FormatInt(user.UserID, 10),
+            Name:      user.Name,
+            Email:     user.Email,
+            PhoneNo:   user.PhoneNo,
+            UpdatedAt: user.UpdatedAt,
+        })
+    })
 
     if err != nil {
         http.Error(w, "Failed to update user", http.StatusInternalServerError)
         return
     }
 
+    if emailChanged {
+        if err := sendEmailVerification(ctx, h.DB, user); err != nil {
+            log.Printf("Failed to send verification email to user %d: %v", user.UserID, err)
+        }
+    }
+
     w.WriteHeader(http.StatusOK)
     json.NewEncoder(w).Encode(map[string]string{"status": "user updated"})
 }
 
-// GetUserByIdHandler handles HTTP GET requests to retrieve a user by ID.
+// GetUserByIdHandler handles HTTP GET requests to retrieve a user by ID. The
+// caller must be that user or hold the "user:read" permission.
 func (h *UserAPIHandler) GetUserByIdHandler(w http.ResponseWriter, r *http.Request) {
 	// Get the user ID from the URL parameters
 	vars := mux.Vars(r)
@@ -148,6 +223,13 @@ func (h *UserAPIHandler) GetUserByIdHandler(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
+	// Users may read their own profile; other profiles need user:read
+	claims, _ := auth.ClaimsFromContext(r.Context())
+	if claims == nil || (claims.IsService() || claims.UserID != userID) && !claims.HasPermission("user:read") {
+		http.Error(w, "Missing permission user:read", http.StatusForbidden)
+		return
+	}
+
 	// Fetch the user from the database
 	var user models.User
 	ctx := context.Background()
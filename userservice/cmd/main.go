@@ -1,15 +1,29 @@
 package main
 
 import (
+	"context"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
 	"strconv"
+	"syscall"
+	"time"
 
 	"github.com/gorilla/mux"
+	"github.com/hari134/pratilipi/pkg/auth"
 	"github.com/hari134/pratilipi/pkg/db"
 	"github.com/hari134/pratilipi/pkg/kafka"
 	"github.com/hari134/pratilipi/userservice/api"
+	"github.com/hari134/pratilipi/userservice/internal/auditlog"
+	"github.com/hari134/pratilipi/userservice/internal/jwtutil"
+	"github.com/hari134/pratilipi/userservice/internal/loginguard"
+	"github.com/hari134/pratilipi/userservice/internal/oidc"
+	"github.com/hari134/pratilipi/userservice/internal/outbox"
+	"github.com/hari134/pratilipi/userservice/internal/privacy"
+	"github.com/hari134/pratilipi/userservice/internal/useradmin"
+	"github.com/hari134/pratilipi/userservice/internal/rbac"
+	"github.com/hari134/pratilipi/userservice/internal/tokenstore"
 	"github.com/hari134/pratilipi/userservice/middleware"
 	"github.com/hari134/pratilipi/userservice/migrations"
 	"github.com/hari134/pratilipi/userservice/producer"
@@ -25,6 +39,22 @@ func main() {
 	kafkaBrokers := os.Getenv("KAFKA_BROKERS")
 	serverPort := os.Getenv("SERVER_PORT")
 
+	// Load JWT signing keys and reload them on SIGHUP so keys can be rotated without a restart
+	if err := jwtutil.LoadKeys(); err != nil {
+		log.Fatalf("Failed to load JWT signing keys: %v", err)
+	}
+	reload := make(chan os.Signal, 1)
+	signal.Notify(reload, syscall.SIGHUP)
+	go func() {
+		for range reload {
+			if err := jwtutil.LoadKeys(); err != nil {
+				log.Printf("Failed to reload JWT signing keys, keeping the current ones: %v", err)
+				continue
+			}
+			log.Println("JWT signing keys reloaded")
+		}
+	}()
+
 	// Initialize the database using environment variables
 	dbInstance := db.InitDB(db.Config{
 		Host:     dbHost,
@@ -53,19 +83,169 @@ func main() {
 		KafkaProducer: producerManager,
 	}
 
+	// Failed logins are tracked in Postgres so all replicas share them, unless LOGIN_GUARD_STORE=memory
+	var loginStore loginguard.Store = loginguard.NewPostgresStore(dbInstance)
+	if os.Getenv("LOGIN_GUARD_STORE") == "memory" {
+		loginStore = loginguard.NewMemoryStore()
+	}
+	loginGuard := loginguard.New(loginStore, loginguard.PolicyFromEnv())
+
 	authAPIHandler := &api.AuthAPIHandler{
+		DB:            dbInstance,
+		KafkaProducer: producerManager,
+		LoginGuard:    loginGuard,
+	}
+	accountAPIHandler := &api.AccountAPIHandler{
+		DB: dbInstance,
+	}
+	twoFactorAPIHandler := &api.TwoFactorAPIHandler{
+		DB: dbInstance,
+	}
+	oauthAPIHandler := &api.OAuthAPIHandler{
+		DB:         dbInstance,
+		LoginGuard: loginGuard,
+	}
+	oidcAPIHandler := &api.OIDCAPIHandler{
+		AuthAPIHandler: authAPIHandler,
+	}
+	apiClientAPIHandler := &api.APIClientAPIHandler{
+		DB: dbInstance,
+	}
+	adminAPIHandler := &api.AdminAPIHandler{
+		DB:            dbInstance,
+		KafkaProducer: producerManager,
+		LoginGuard:    loginGuard,
+	}
+	sessionAPIHandler := &api.SessionAPIHandler{
+		DB: dbInstance,
+	}
+	addressAPIHandler := &api.AddressAPIHandler{
+		DB: dbInstance,
+	}
+	privacyAPIHandler := &api.PrivacyAPIHandler{
+		DB:         dbInstance,
+		LoginGuard: loginGuard,
+		Exporter:   &privacy.Exporter{DB: dbInstance, Sources: privacy.SourcesFromEnv()},
+	}
+	roleAPIHandler := &api.RoleAPIHandler{
+		DB: dbInstance,
+	}
+	auditAPIHandler := &api.AuditAPIHandler{
+		DB: dbInstance,
+	}
+	authMiddleware := &middleware.AuthMiddleware{
 		DB: dbInstance,
 	}
 	migrations.RunMigrations(dbInstance)
+
+	// Grant the admin role to BOOTSTRAP_ADMIN_EMAIL, since registration only ever assigns the user role
+	if err := rbac.EnsureBootstrapAdmin(context.Background(), dbInstance); err != nil {
+		log.Printf("Failed to grant bootstrap admin role: %v", err)
+	}
+
+	// Publish events stored in the outbox, e.g. profile updates, once their transaction committed
+	relay := &outbox.Relay{DB: dbInstance, Producer: kafkaProducer}
+	go relay.Run(context.Background(), outbox.PollInterval())
+
+	// Periodically drop revocation entries, tokens, authorization codes, login failures and published events that are no longer needed
+	go func() {
+		for range time.Tick(time.Hour) {
+			if err := tokenstore.PurgeExpired(context.Background(), dbInstance); err != nil {
+				log.Printf("Failed to purge expired tokens: %v", err)
+			}
+			if err := oidc.PurgeExpired(context.Background(), dbInstance); err != nil {
+				log.Printf("Failed to purge expired authorization codes: %v", err)
+			}
+			if err := loginGuard.Purge(context.Background()); err != nil {
+				log.Printf("Failed to purge login attempts: %v", err)
+			}
+			if err := outbox.PurgePublished(context.Background(), dbInstance, 7*24*time.Hour); err != nil {
+				log.Printf("Failed to purge published outbox events: %v", err)
+			}
+		}
+	}()
 	// Set up HTTP router
 	r := mux.NewRouter()
 	r.HandleFunc("/login", authAPIHandler.LoginHandler).Methods("POST")
 	r.HandleFunc("/validate-token", authAPIHandler.ValidateTokenHandler).Methods("POST")
+	r.HandleFunc("/login/2fa", authAPIHandler.LoginTwoFactorHandler).Methods("POST")
+	r.HandleFunc("/token/refresh", authAPIHandler.RefreshTokenHandler).Methods("POST")
+	r.Handle("/logout", authMiddleware.TokenValidationMiddleware(http.HandlerFunc(authAPIHandler.LogoutHandler))).Methods("POST")
+	r.HandleFunc("/.well-known/jwks.json", authAPIHandler.JWKSHandler).Methods("GET")
+	r.HandleFunc("/token-revocations", authAPIHandler.TokenRevocationsHandler).Methods("GET")
+	r.HandleFunc("/oauth/token", oauthAPIHandler.TokenHandler).Methods("POST")
+	r.HandleFunc("/.well-known/openid-configuration", oidcAPIHandler.DiscoveryHandler).Methods("GET")
+	r.HandleFunc("/oauth/authorize", oidcAPIHandler.AuthorizeHandler).Methods("GET", "POST")
 
-	r.HandleFunc("/users/{userID}", userAPIHandler.GetUserByIdHandler).Methods("GET")
-	r.HandleFunc("/users", userAPIHandler.GetUsersHandler).Methods("GET")
+	r.HandleFunc("/email-verification/request", accountAPIHandler.RequestEmailVerificationHandler).Methods("POST")
+	r.HandleFunc("/email-verification/confirm", accountAPIHandler.ConfirmEmailHandler).Methods("POST")
+	r.HandleFunc("/password-reset/request", accountAPIHandler.RequestPasswordResetHandler).Methods("POST")
+	r.HandleFunc("/password-reset/confirm", accountAPIHandler.ResetPasswordHandler).Methods("POST")
+
+	requirePermission := func(permission string, h http.HandlerFunc) http.Handler {
+		return authMiddleware.TokenValidationMiddleware(auth.RequirePermission(permission)(h))
+	}
+	r.Handle("/users/{userID}", authMiddleware.TokenValidationMiddleware(http.HandlerFunc(userAPIHandler.GetUserByIdHandler))).Methods("GET") // Own profile, or any with user:read
+	r.Handle("/users", requirePermission("user:read", userAPIHandler.GetUsersHandler)).Methods("GET")
 	r.HandleFunc("/create-user", userAPIHandler.CreateUserHandler).Methods("POST")
-	r.Handle("/update-user", middleware.TokenValidationMiddleware(http.HandlerFunc(userAPIHandler.UpdateUserHandler))).Methods("PUT")
+
+	// Routes acting for the caller, or recording them as the actor, refuse service tokens
+	requireAuth := func(h http.HandlerFunc) http.Handler {
+		return authMiddleware.TokenValidationMiddleware(auth.RequireUser(h))
+	}
+	requireUserPermission := func(permission string, h http.HandlerFunc) http.Handler {
+		return authMiddleware.TokenValidationMiddleware(auth.RequireUser(auth.RequirePermission(permission)(h)))
+	}
+	r.Handle("/update-user", requireAuth(userAPIHandler.UpdateUserHandler)).Methods("PUT")
+
+	// Two-factor authentication enrollment
+	r.Handle("/2fa/enroll", requireAuth(twoFactorAPIHandler.EnrollHandler)).Methods("POST")
+	r.Handle("/2fa/confirm", requireAuth(twoFactorAPIHandler.ConfirmHandler)).Methods("POST")
+	r.Handle("/2fa/disable", requireAuth(twoFactorAPIHandler.DisableHandler)).Methods("POST")
+	r.Handle("/2fa/recovery-codes", requireAuth(twoFactorAPIHandler.RegenerateRecoveryCodesHandler)).Methods("POST")
+
+	// OpenID Connect userinfo, for access tokens from the authorization code flow
+	r.Handle("/oauth/userinfo", authMiddleware.TokenValidationMiddleware(http.HandlerFunc(oidcAPIHandler.UserInfoHandler))).Methods("GET", "POST")
+
+	// Login sessions
+	r.Handle("/sessions", requireAuth(sessionAPIHandler.ListSessionsHandler)).Methods("GET")
+	r.Handle("/sessions/revoke-others", requireAuth(sessionAPIHandler.RevokeOtherSessionsHandler)).Methods("POST")
+	r.Handle("/sessions/{sessionID}", requireAuth(sessionAPIHandler.RevokeSessionHandler)).Methods("DELETE")
+
+	// Address book
+	r.Handle("/addresses", requireAuth(addressAPIHandler.ListAddressesHandler)).Methods("GET")
+	r.Handle("/addresses", requireAuth(addressAPIHandler.CreateAddressHandler)).Methods("POST")
+	r.Handle("/addresses/{addressID}", requireAuth(addressAPIHandler.GetAddressHandler)).Methods("GET")
+	r.Handle("/addresses/{addressID}", requireAuth(addressAPIHandler.UpdateAddressHandler)).Methods("PUT")
+	r.Handle("/addresses/{addressID}", requireAuth(addressAPIHandler.DeleteAddressHandler)).Methods("DELETE")
+	r.Handle("/addresses/{addressID}/default", requireAuth(addressAPIHandler.SetDefaultAddressHandler)).Methods("POST")
+	r.Handle("/users/{userID}/addresses/{addressID}", authMiddleware.TokenValidationMiddleware(http.HandlerFunc(addressAPIHandler.GetUserAddressHandler))).Methods("GET")
+
+	// Personal data export and erasure
+	r.Handle("/account/export", requireAuth(privacyAPIHandler.ExportMyDataHandler)).Methods("GET")
+	r.Handle("/account/delete", requireAuth(privacyAPIHandler.DeleteMyAccountHandler)).Methods("POST")
+	r.Handle("/users/{userID}/export", requirePermission(privacy.Permission, privacyAPIHandler.ExportUserHandler)).Methods("GET")
+	r.Handle("/users/{userID}", requireUserPermission(privacy.Permission, privacyAPIHandler.EraseUserHandler)).Methods("DELETE")
+
+	// Role and user administration
+	requireUserAdmin := func(h http.HandlerFunc) http.Handler {
+		return requireUserPermission("user:admin", h)
+	}
+	r.Handle("/roles", requireUserAdmin(roleAPIHandler.ListRolesHandler)).Methods("GET")
+	r.Handle("/users/{userID}/roles", requireUserAdmin(roleAPIHandler.GetUserRolesHandler)).Methods("GET")
+	r.Handle("/users/{userID}/roles", requireUserAdmin(roleAPIHandler.SetUserRolesHandler)).Methods("PUT")
+	r.Handle("/users/{userID}/unlock", requireUserAdmin(adminAPIHandler.UnlockUserHandler)).Methods("POST")
+	r.Handle("/admin/users", requireUserAdmin(adminAPIHandler.ListUsersHandler)).Methods("GET")
+	r.Handle("/users/{userID}/disable", requireUserAdmin(adminAPIHandler.DisableUserHandler)).Methods("POST")
+	r.Handle("/users/{userID}/enable", requireUserAdmin(adminAPIHandler.EnableUserHandler)).Methods("POST")
+	r.Handle("/users/{userID}/force-password-reset", requireUserAdmin(adminAPIHandler.ForcePasswordResetHandler)).Methods("POST")
+	r.Handle("/users/{userID}/impersonate", requireUserPermission(useradmin.ImpersonatePermission, adminAPIHandler.ImpersonateUserHandler)).Methods("POST")
+	r.Handle("/api-clients", requireUserAdmin(apiClientAPIHandler.CreateAPIClientHandler)).Methods("POST")
+	r.Handle("/api-clients", requireUserAdmin(apiClientAPIHandler.GetAPIClientsHandler)).Methods("GET")
+	r.Handle("/api-clients/{clientID}", requireUserAdmin(apiClientAPIHandler.GetAPIClientHandler)).Methods("GET")
+	r.Handle("/api-clients/{clientID}/redirect-uris", requireUserAdmin(apiClientAPIHandler.SetRedirectURIsHandler)).Methods("PUT")
+	r.Handle("/api-clients/{clientID}", requireUserAdmin(apiClientAPIHandler.RevokeAPIClientHandler)).Methods("DELETE")
+	r.Handle("/admin/audit-log", requirePermission(auditlog.Permission, auditAPIHandler.ListAuditLogHandler)).Methods("GET")
 
 	// Start HTTP server
 	log.Fatal(http.ListenAndServe(":"+serverPort, r))
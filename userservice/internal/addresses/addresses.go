@@ -0,0 +1,187 @@
+// Package addresses validates and stores the shipping addresses of the address book.
+package addresses
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/hari134/pratilipi/userservice/models"
+	"github.com/uptrace/bun"
+)
+
+// MaxPerUser limits the size of an address book.
+const MaxPerUser = 20
+
+// ErrTooMany is returned when a user already has MaxPerUser addresses.
+var ErrTooMany = errors.New("address book is full")
+
+// countryRule lists what a country requires beyond the recipient, first line and city.
+type countryRule struct {
+	stateRequired bool
+	postalCode    *regexp.Regexp // nil if postal codes are not required
+}
+
+// countryRules covers the countries we ship to most. Other countries only need
+// a two-letter code, and their postal code is optional and not checked.
+var countryRules = map[string]countryRule{
+	"IN": {stateRequired: true, postalCode: regexp.MustCompile(`^[1-9][0-9]{5}$`)},
+	"US": {stateRequired: true, postalCode: regexp.MustCompile(`^[0-9]{5}(-[0-9]{4})?$`)},
+	"CA": {stateRequired: true, postalCode: regexp.MustCompile(`^[A-Z][0-9][A-Z] ?[0-9][A-Z][0-9]$`)},
+	"AU": {stateRequired: true, postalCode: regexp.MustCompile(`^[0-9]{4}$`)},
+	"GB": {postalCode: regexp.MustCompile(`^[A-Z]{1,2}[0-9][A-Z0-9]? ?[0-9][A-Z]{2}$`)},
+	"DE": {postalCode: regexp.MustCompile(`^[0-9]{5}$`)},
+}
+
+var countryCode = regexp.MustCompile(`^[A-Z]{2}$`)
+
+// ValidationError lists the invalid fields of an address, keyed by JSON field name.
+type ValidationError struct {
+	Fields map[string]string
+}
+
+func (e *ValidationError) Error() string {
+	parts := make([]string, 0, len(e.Fields))
+	for _, field := range []string{"recipient_name", "line1", "city", "state", "postal_code", "country"} {
+		if msg, ok := e.Fields[field]; ok {
+			parts = append(parts, field+" "+msg)
+		}
+	}
+	return "invalid address: " + strings.Join(parts, "; ")
+}
+
+// Normalize trims every field and upper-cases the country and postal code.
+func Normalize(a *models.Address) {
+	for _, field := range []*string{&a.Label, &a.RecipientName, &a.PhoneNo, &a.Line1, &a.Line2, &a.City, &a.State, &a.PostalCode, &a.Country} {
+		*field = strings.TrimSpace(*field)
+	}
+	a.Country = strings.ToUpper(a.Country)
+	a.PostalCode = strings.ToUpper(a.PostalCode)
+}
+
+// Validate checks that a normalized address has the fields its country requires.
+func Validate(a *models.Address) error {
+	fields := map[string]string{}
+	required := map[string]string{
+		"recipient_name": a.RecipientName,
+		"line1":          a.Line1,
+		"city":           a.City,
+	}
+	for field, value := range required {
+		if value == "" {
+			fields[field] = "is required"
+		}
+	}
+
+	switch rule, ok := countryRules[a.Country]; {
+	case a.Country == "":
+		fields["country"] = "is required"
+	case !countryCode.MatchString(a.Country):
+		fields["country"] = "must be a two-letter ISO 3166-1 code"
+	case ok:
+		if rule.stateRequired && a.State == "" {
+			fields["state"] = "is required in " + a.Country
+		}
+		if rule.postalCode != nil {
+			if a.PostalCode == "" {
+				fields["postal_code"] = "is required in " + a.Country
+			} else if !rule.postalCode.MatchString(a.PostalCode) {
+				fields["postal_code"] = "is not valid in " + a.Country
+			}
+		}
+	}
+
+	if len(fields) > 0 {
+		return &ValidationError{Fields: fields}
+	}
+	return nil
+}
+
+// Find returns one of the user's addresses, or their default address if
+// addressID is "default". It returns sql.ErrNoRows if there is no such address.
+func Find(ctx context.Context, db bun.IDB, userID int64, addressID string) (*models.Address, error) {
+	address := &models.Address{}
+	query := db.NewSelect().Model(address).Where("user_id = ?", userID)
+	if addressID == "default" {
+		query = query.Where("is_default")
+	} else {
+		query = query.Where("address_id = ?", addressID)
+	}
+	if err := query.Scan(ctx); err != nil {
+		return nil, err
+	}
+	return address, nil
+}
+
+// Create stores a new address. The first address of a user becomes the default.
+func Create(ctx context.Context, tx bun.Tx, a *models.Address) error {
+	count, err := tx.NewSelect().Model((*models.Address)(nil)).Where("user_id = ?", a.UserID).Count(ctx)
+	if err != nil {
+		return err
+	}
+	if count >= MaxPerUser {
+		return ErrTooMany
+	}
+	if count == 0 {
+		a.IsDefault = true
+	}
+
+	isDefault := a.IsDefault
+	a.IsDefault = false
+	if _, err := tx.NewInsert().Model(a).Returning("*").Exec(ctx); err != nil {
+		return err
+	}
+	if isDefault {
+		return SetDefault(ctx, tx, a)
+	}
+	return nil
+}
+
+// SetDefault makes the address the user's default and clears the previous one.
+func SetDefault(ctx context.Context, tx bun.Tx, a *models.Address) error {
+	_, err := tx.NewUpdate().
+		Model((*models.Address)(nil)).
+		Set("is_default = FALSE").
+		Where("user_id = ? AND is_default", a.UserID).
+		Exec(ctx)
+	if err != nil {
+		return err
+	}
+	a.IsDefault = true
+	a.UpdatedAt = time.Now()
+	_, err = tx.NewUpdate().
+		Model(a).
+		Column("is_default", "updated_at").
+		WherePK().
+		Exec(ctx)
+	return err
+}
+
+// Delete removes the address. If it was the default, the most recently updated
+// remaining address becomes the default.
+func Delete(ctx context.Context, tx bun.Tx, a *models.Address) error {
+	if _, err := tx.NewDelete().Model(a).WherePK().Exec(ctx); err != nil {
+		return err
+	}
+	if !a.IsDefault {
+		return nil
+	}
+
+	var next models.Address
+	err := tx.NewSelect().
+		Model(&next).
+		Where("user_id = ?", a.UserID).
+		Order("updated_at DESC", "address_id DESC").
+		Limit(1).
+		Scan(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return SetDefault(ctx, tx, &next)
+}
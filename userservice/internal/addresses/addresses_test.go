@@ -0,0 +1,69 @@
+package addresses
+
+import (
+	"testing"
+
+	"github.com/hari134/pratilipi/userservice/models"
+)
+
+func TestValidate(t *testing.T) {
+	valid := func() *models.Address {
+		return &models.Address{
+			RecipientName: "Hari James",
+			Line1:         "12 MG Road",
+			City:          "Bengaluru",
+			State:         "Karnataka",
+			PostalCode:    "560001",
+			Country:       "IN",
+		}
+	}
+
+	tests := []struct {
+		name   string
+		modify func(a *models.Address)
+		fields []string
+	}{
+		{"valid", func(a *models.Address) {}, nil},
+		{"missing line1 and city", func(a *models.Address) { a.Line1, a.City = "", "" }, []string{"line1", "city"}},
+		{"state required in IN", func(a *models.Address) { a.State = "" }, []string{"state"}},
+		{"bad PIN code", func(a *models.Address) { a.PostalCode = "56001" }, []string{"postal_code"}},
+		{"US ZIP+4", func(a *models.Address) { a.Country, a.State, a.PostalCode = "US", "CA", "94105-1234" }, nil},
+		{"GB needs no state", func(a *models.Address) { a.Country, a.State, a.PostalCode = "GB", "", "SW1A 1AA" }, nil},
+		{"unknown country, no postal code", func(a *models.Address) { a.Country, a.State, a.PostalCode = "NP", "", "" }, nil},
+		{"country must be a code", func(a *models.Address) { a.Country = "India" }, []string{"country"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := valid()
+			tt.modify(a)
+			Normalize(a)
+			err := Validate(a)
+			if len(tt.fields) == 0 {
+				if err != nil {
+					t.Fatalf("expected no error, got %v", err)
+				}
+				return
+			}
+			verr, ok := err.(*ValidationError)
+			if !ok {
+				t.Fatalf("expected a ValidationError, got %v", err)
+			}
+			if len(verr.Fields) != len(tt.fields) {
+				t.Errorf("expected fields %v, got %v", tt.fields, verr.Fields)
+			}
+			for _, field := range tt.fields {
+				if _, ok := verr.Fields[field]; !ok {
+					t.Errorf("expected %s to be invalid, got %v", field, verr.Fields)
+				}
+			}
+		})
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	a := &models.Address{Country: " gb ", PostalCode: "sw1a 1aa", City: " London "}
+	Normalize(a)
+	if a.Country != "GB" || a.PostalCode != "SW1A 1AA" || a.City != "London" {
+		t.Errorf("unexpected normalized address %+v", a)
+	}
+}
@@ -0,0 +1,296 @@
+// Package apiclients manages the API clients that obtain service tokens with
+// the OAuth 2.0 client credentials grant, and the applications that log users
+// in with the OpenID Connect authorization code flow.
+package apiclients
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"net"
+	"net/url"
+	"time"
+
+	"github.com/hari134/pratilipi/userservice/internal/tokenstore"
+	"github.com/hari134/pratilipi/userservice/models"
+	"github.com/uptrace/bun"
+)
+
+var (
+	// ErrInvalidClient is returned for unknown or revoked clients and wrong secrets.
+	ErrInvalidClient = errors.New("invalid client")
+	// ErrInvalidScope is returned for scopes that are not permissions, or that the client may not request.
+	ErrInvalidScope = errors.New("invalid scope")
+	// ErrInvalidGrantType is returned for unknown grant types and grants a public client may not use.
+	ErrInvalidGrantType = errors.New("invalid grant type")
+	// ErrInvalidRedirectURI is returned for missing or unsafe redirect URIs.
+	ErrInvalidRedirectURI = errors.New("invalid redirect URI")
+)
+
+// Grant types a client may be registered for.
+const (
+	GrantClientCredentials = "client_credentials"
+	GrantAuthorizationCode = "authorization_code"
+)
+
+// userOnlyScopes are permissions that manage users or act as them. Service
+// tokens carry no user to record as the actor, so these are only granted to
+// users through their roles.
+var userOnlyScopes = map[string]bool{
+	"user:admin":       true,
+	"user:impersonate": true,
+}
+
+// Assignable reports whether a client may be given the scope.
+func Assignable(scope string) bool {
+	return !userOnlyScopes[scope]
+}
+
+// Registration describes a client to create.
+type Registration struct {
+	Name         string
+	Scopes       []string // Permissions for the client credentials grant
+	RedirectURIs []string // Needed for the authorization code grant
+	GrantTypes   []string // GrantClientCredentials when empty
+	Public       bool     // No secret; only the authorization code grant with PKCE
+}
+
+// Create registers a client. Clients using the client credentials grant need
+// scopes that are existing, assignable permissions; clients using the authorization code
+// grant need redirect URIs. The returned secret is only available now; just its
+// hash is stored. Public clients get no secret.
+func Create(ctx context.Context, db bun.IDB, reg Registration, createdBy int64) (*models.APIClient, string, error) {
+	grantTypes := reg.GrantTypes
+	if len(grantTypes) == 0 {
+		grantTypes = []string{GrantClientCredentials}
+	}
+	grants := unique(grantTypes)
+	for grant := range grants {
+		if grant != GrantClientCredentials && grant != GrantAuthorizationCode {
+			return nil, "", ErrInvalidGrantType
+		}
+	}
+	if _, ok := grants[GrantClientCredentials]; ok && reg.Public {
+		return nil, "", ErrInvalidGrantType
+	}
+
+	scopes := reg.Scopes
+	if scopes == nil {
+		scopes = []string{}
+	}
+	if _, ok := grants[GrantClientCredentials]; ok && len(scopes) == 0 {
+		return nil, "", ErrInvalidScope
+	}
+	for _, scope := range scopes {
+		if !Assignable(scope) {
+			return nil, "", ErrInvalidScope
+		}
+	}
+	if len(scopes) > 0 {
+		count, err := db.NewSelect().Model((*models.Permission)(nil)).Where("name IN (?)", bun.In(scopes)).Count(ctx)
+		if err != nil {
+			return nil, "", err
+		}
+		if count != len(unique(scopes)) {
+			return nil, "", ErrInvalidScope
+		}
+	}
+
+	redirectURIs := reg.RedirectURIs
+	if redirectURIs == nil {
+		redirectURIs = []string{}
+	}
+	if err := checkRedirectURIs(grants, redirectURIs); err != nil {
+		return nil, "", err
+	}
+
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return nil, "", err
+	}
+	client := &models.APIClient{
+		ClientID:     "svc_" + hex.EncodeToString(b),
+		Name:         reg.Name,
+		Scopes:       scopes,
+		RedirectURIs: redirectURIs,
+		GrantTypes:   grantTypes,
+		Public:       reg.Public,
+		CreatedBy:    createdBy,
+		CreatedAt:    time.Now(),
+	}
+	var secret string
+	if !reg.Public {
+		var err error
+		secret, err = tokenstore.NewOpaqueToken()
+		if err != nil {
+			return nil, "", err
+		}
+		client.SecretHash = tokenstore.HashToken(secret)
+	}
+	if _, err := db.NewInsert().Model(client).Exec(ctx); err != nil {
+		return nil, "", err
+	}
+	return client, secret, nil
+}
+
+// checkRedirectURIs validates the redirect URIs of a client registered for the
+// grants. Clients using the authorization code grant need at least one.
+func checkRedirectURIs(grants map[string]struct{}, uris []string) error {
+	if _, ok := grants[GrantAuthorizationCode]; ok && len(uris) == 0 {
+		return ErrInvalidRedirectURI
+	}
+	for _, uri := range uris {
+		if !ValidRedirectURI(uri) {
+			return ErrInvalidRedirectURI
+		}
+	}
+	return nil
+}
+
+// SetRedirectURIs replaces the redirect URIs of an active client, e.g. when an
+// application moves. Authorization requests for a removed URI are refused from
+// then on.
+func SetRedirectURIs(ctx context.Context, db bun.IDB, clientID string, uris []string) (*models.APIClient, error) {
+	client, err := Find(ctx, db, clientID)
+	if err != nil {
+		return nil, err
+	}
+	if uris == nil {
+		uris = []string{}
+	}
+	if err := checkRedirectURIs(unique(client.GrantTypes), uris); err != nil {
+		return nil, err
+	}
+	client.RedirectURIs = uris
+	_, err = db.NewUpdate().Model(client).Column("redirect_uris").WherePK().Exec(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return client, nil
+}
+
+// ValidRedirectURI reports whether uri may be registered as a redirect URI: an
+// absolute https URL without a fragment, or http on the loopback interface for
+// native apps and local development.
+func ValidRedirectURI(uri string) bool {
+	u, err := url.Parse(uri)
+	if err != nil || u.Host == "" || u.Fragment != "" || u.User != nil {
+		return false
+	}
+	switch u.Scheme {
+	case "https":
+		return true
+	case "http":
+		host := u.Hostname()
+		if host == "localhost" {
+			return true
+		}
+		ip := net.ParseIP(host)
+		return ip != nil && ip.IsLoopback()
+	}
+	return false
+}
+
+// HasRedirectURI reports whether uri is one of the client's redirect URIs.
+// Only exact matches count.
+func HasRedirectURI(client *models.APIClient, uri string) bool {
+	for _, registered := range client.RedirectURIs {
+		if registered == uri {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowsGrant reports whether the client is registered for the grant type.
+func AllowsGrant(client *models.APIClient, grantType string) bool {
+	_, ok := unique(client.GrantTypes)[grantType]
+	return ok
+}
+
+// Find returns an active client by ID, without authenticating it.
+func Find(ctx context.Context, db bun.IDB, clientID string) (*models.APIClient, error) {
+	client := &models.APIClient{}
+	err := db.NewSelect().Model(client).Where("client_id = ?", clientID).Where("revoked_at IS NULL").Scan(ctx)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrInvalidClient
+		}
+		return nil, err
+	}
+	return client, nil
+}
+
+// Authenticate checks a client's credentials and records that it was used.
+// Public clients authenticate with their ID alone and must not send a secret.
+func Authenticate(ctx context.Context, db bun.IDB, clientID, secret string) (*models.APIClient, error) {
+	client, err := Find(ctx, db, clientID)
+	if err != nil {
+		return nil, err
+	}
+	if client.Public {
+		if secret != "" {
+			return nil, ErrInvalidClient
+		}
+	} else if subtle.ConstantTimeCompare([]byte(client.SecretHash), []byte(tokenstore.HashToken(secret))) != 1 {
+		return nil, ErrInvalidClient
+	}
+
+	_, err = db.NewUpdate().
+		Model((*models.APIClient)(nil)).
+		Set("last_used_at = ?", time.Now()).
+		Where("client_id = ?", clientID).
+		Exec(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return client, nil
+}
+
+// GrantedScopes returns the scopes to put in a token for a request of the given
+// scopes. No requested scopes means all of the client's scopes.
+func GrantedScopes(client *models.APIClient, requested []string) ([]string, error) {
+	if len(requested) == 0 {
+		return client.Scopes, nil
+	}
+	allowed := unique(client.Scopes)
+	for _, s := range requested {
+		if _, ok := allowed[s]; !ok {
+			return nil, ErrInvalidScope
+		}
+	}
+	return requested, nil
+}
+
+// Revoke stops the client from obtaining new tokens. Tokens already issued stay
+// valid until they expire, as services verify them locally.
+func Revoke(ctx context.Context, db bun.IDB, clientID string) error {
+	res, err := db.NewUpdate().
+		Model((*models.APIClient)(nil)).
+		Set("revoked_at = ?", time.Now()).
+		Where("client_id = ?", clientID).
+		Where("revoked_at IS NULL").
+		Exec(ctx)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrInvalidClient
+	}
+	return nil
+}
+
+func unique(values []string) map[string]struct{} {
+	set := make(map[string]struct{}, len(values))
+	for _, v := range values {
+		set[v] = struct{}{}
+	}
+	return set
+}
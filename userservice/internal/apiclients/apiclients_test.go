@@ -0,0 +1,58 @@
+package apiclients
+
+import "testing"
+
+func TestValidRedirectURI(t *testing.T) {
+	tests := []struct {
+		uri  string
+		want bool
+	}{
+		{"https://app.example.com/callback", true},
+		{"http://localhost:8080/callback", true},
+		{"http://127.0.0.1/callback", true},
+		{"http://app.example.com/callback", false},
+		{"https://app.example.com/callback#fragment", false},
+		{"https://user@app.example.com/callback", false},
+		{"/callback", false},
+		{"javascript:alert(1)", false},
+	}
+	for _, tt := range tests {
+		if got := ValidRedirectURI(tt.uri); got != tt.want {
+			t.Errorf("ValidRedirectURI(%q) = %v, want %v", tt.uri, got, tt.want)
+		}
+	}
+}
+
+func TestAssignable(t *testing.T) {
+	for scope, want := range map[string]bool{
+		"order:read":        true,
+		"inventory:reserve": true,
+		"user:admin":        false,
+		"user:impersonate":  false,
+	} {
+		if got := Assignable(scope); got != want {
+			t.Errorf("Assignable(%q) = %v, want %v", scope, got, want)
+		}
+	}
+}
+
+func TestCheckRedirectURIs(t *testing.T) {
+	codeFlow := unique([]string{GrantAuthorizationCode})
+	serviceOnly := unique([]string{GrantClientCredentials})
+	tests := []struct {
+		grants map[string]struct{}
+		uris   []string
+		ok     bool
+	}{
+		{codeFlow, []string{"https://app.example.com/callback"}, true},
+		{codeFlow, []string{}, false}, // The code flow needs somewhere to redirect to
+		{codeFlow, []string{"https://app.example.com/callback", "http://app.example.com/callback"}, false},
+		{serviceOnly, []string{}, true},
+		{serviceOnly, []string{"javascript:alert(1)"}, false},
+	}
+	for _, tt := range tests {
+		if err := checkRedirectURIs(tt.grants, tt.uris); (err == nil) != tt.ok {
+			t.Errorf("checkRedirectURIs(%v, %q) = %v, want ok %v", tt.grants, tt.uris, err, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,290 @@
+// Package auditlog keeps the append-only record of logins, token use and
+// changes to accounts and roles. Each entry is also published as a
+// UserAuditEvent on the user-audit topic, through the outbox, for SIEM ingestion.
+package auditlog
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hari134/pratilipi/pkg/auth"
+	"github.com/hari134/pratilipi/pkg/messaging"
+	"github.com/hari134/pratilipi/userservice/internal/dto"
+	"github.com/hari134/pratilipi/userservice/internal/loginguard"
+	"github.com/hari134/pratilipi/userservice/internal/outbox"
+	"github.com/hari134/pratilipi/userservice/models"
+	"github.com/uptrace/bun"
+)
+
+// Permission allows reading the audit log.
+const Permission = "audit:read"
+
+// Topic is the Kafka topic UserAuditEvents are published on.
+const Topic = "user-audit"
+
+// Actions recorded in the audit log.
+const (
+	ActionLogin              = "login"
+	ActionLoginTwoFactor     = "login_2fa"
+	ActionTokenRefresh       = "token_refresh"
+	ActionTokenValidate      = "token_validate"
+	ActionLogout             = "logout"
+	ActionRegister           = "register"
+	ActionProfileUpdate      = "profile_update"
+	ActionPasswordReset      = "password_reset"
+	ActionTwoFactorEnable    = "2fa_enable"
+	ActionTwoFactorDisable   = "2fa_disable"
+	ActionRolesChange        = "roles_change"
+	ActionUserDisable        = "user_disable"
+	ActionUserEnable         = "user_enable"
+	ActionUserUnlock         = "user_unlock"
+	ActionForcePasswordReset = "force_password_reset"
+	ActionImpersonate        = "impersonate"
+	ActionOIDCAuthorize      = "oidc_authorize"
+)
+
+// Outcomes of an action. Failure means the credentials or token were wrong;
+// denied means they were fine but a policy refused the request.
+const (
+	OutcomeSuccess = "success"
+	OutcomeFailure = "failure"
+	OutcomeDenied  = "denied"
+)
+
+const (
+	defaultLimit = 50
+	maxLimit     = 500
+)
+
+// Entry describes something to record. The caller, IP and user agent are
+// taken from the request.
+type Entry struct {
+	Action       string
+	Outcome      string // OutcomeSuccess when empty
+	ActorID      int64  // Overrides the token's user, e.g. for logins, which carry no token
+	TargetUserID int64
+	Detail       string
+}
+
+// Record appends an entry and queues its UserAuditEvent. Pass the transaction
+// of the change it describes, so the entry is only kept if the change commits.
+func Record(ctx context.Context, db bun.IDB, r *http.Request, e Entry) error {
+	entry := &models.AuditLog{
+		Action:       e.Action,
+		Outcome:      e.Outcome,
+		ActorID:      e.ActorID,
+		TargetUserID: e.TargetUserID,
+		Detail:       e.Detail,
+		IP:           loginguard.ClientIP(r),
+		UserAgent:    r.UserAgent(),
+		CreatedAt:    time.Now(),
+	}
+	if entry.Outcome == "" {
+		entry.Outcome = OutcomeSuccess
+	}
+	if claims, ok := auth.ClaimsFromContext(r.Context()); ok && claims != nil {
+		if entry.ActorID == 0 {
+			entry.ActorID = claims.UserID
+		}
+		if claims.IsImpersonation() {
+			entry.ImpersonatorID = claims.Act.UserID
+		}
+		entry.ActorClientID = claims.ClientID
+	}
+
+	if _, err := db.NewInsert().Model(entry).Returning("audit_id").Exec(ctx); err != nil {
+		return err
+	}
+	return outbox.Enqueue(ctx, db, Topic, Event(entry))
+}
+
+// Log records an entry on its own, logging failures instead of returning them.
+// It is used for logins and token checks, which must not fail because the
+// audit log cannot be written.
+func Log(ctx context.Context, db *bun.DB, r *http.Request, e Entry) {
+	err := db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		return Record(ctx, tx, r, e)
+	})
+	if err != nil {
+		log.Printf("Failed to write %s audit log entry: %v", e.Action, err)
+	}
+}
+
+// EmailHash identifies an email address in entries about accounts that do not
+// exist, so repeated attempts on one address can be told apart without
+// recording the address itself.
+func EmailHash(email string) string {
+	sum := sha256.Sum256([]byte(strings.ToLower(strings.TrimSpace(email))))
+	return "sha256:" + hex.EncodeToString(sum[:8])
+}
+
+// Scrub clears the IP and user agent of the entries of the user's own requests,
+// and of failed logins to their account, when the user is erased. The rest of
+// each entry is kept. Call it inside the erasure's transaction.
+func Scrub(ctx context.Context, db bun.IDB, userID int64) error {
+	_, err := db.NewUpdate().Model((*models.AuditLog)(nil)).
+		Set("ip = NULL").
+		Set("user_agent = NULL").
+		WhereGroup(" AND ", func(q *bun.UpdateQuery) *bun.UpdateQuery {
+			return q.Where("actor_id = ?", userID).
+				WhereOr("target_user_id = ? AND actor_id IS NULL", userID)
+		}).
+		Where("ip IS NOT NULL OR user_agent IS NOT NULL").
+		Exec(ctx)
+	return err
+}
+
+// Event returns the UserAuditEvent for an entry.
+func Event(entry *models.AuditLog) *messaging.UserAuditEvent {
+	return &messaging.UserAuditEvent{
+		AuditID:        entry.AuditID,
+		Action:         entry.Action,
+		Outcome:        entry.Outcome,
+		ActorID:        formatID(entry.ActorID),
+		ImpersonatorID: formatID(entry.ImpersonatorID),
+		ActorClientID:  entry.ActorClientID,
+		TargetUserID:   formatID(entry.TargetUserID),
+		Detail:         entry.Detail,
+		IP:             entry.IP,
+		UserAgent:      entry.UserAgent,
+		OccurredAt:     entry.CreatedAt,
+	}
+}
+
+func formatID(id int64) string {
+	if id == 0 {
+		return ""
+	}
+	return strconv.FormatInt(id, 10)
+}
+
+// Filter selects the entries to list. Empty fields match every entry.
+type Filter struct {
+	UserID       int64 // Entries where the user is the actor, the impersonator or the target
+	ActorID      int64
+	TargetUserID int64
+	Action       string
+	Outcome      string
+	IP           string
+	Since        time.Time // Inclusive
+	Until        time.Time // Exclusive
+	Limit        int
+	Offset       int
+}
+
+// FilterFromQuery reads a Filter from the query parameters user_id, actor_id,
+// target_user_id, action, outcome, ip, since, until (RFC 3339), limit and offset.
+func FilterFromQuery(q url.Values) (Filter, error) {
+	f := Filter{
+		Action:  strings.TrimSpace(q.Get("action")),
+		Outcome: q.Get("outcome"),
+		IP:      strings.TrimSpace(q.Get("ip")),
+		Limit:   defaultLimit,
+	}
+	for name, id := range map[string]*int64{"user_id": &f.UserID, "actor_id": &f.ActorID, "target_user_id": &f.TargetUserID} {
+		if v := q.Get(name); v != "" {
+			n, err := strconv.ParseInt(v, 10, 64)
+			if err != nil || n < 1 {
+				return f, fmt.Errorf("%s must be a user ID", name)
+			}
+			*id = n
+		}
+	}
+	switch f.Outcome {
+	case "", OutcomeSuccess, OutcomeFailure, OutcomeDenied:
+	default:
+		return f, fmt.Errorf("outcome must be %s, %s or %s", OutcomeSuccess, OutcomeFailure, OutcomeDenied)
+	}
+	for name, t := range map[string]*time.Time{"since": &f.Since, "until": &f.Until} {
+		if v := q.Get(name); v != "" {
+			parsed, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return f, fmt.Errorf("%s must be an RFC 3339 time, e.g. 2024-05-01T00:00:00Z", name)
+			}
+			*t = parsed
+		}
+	}
+	if v := q.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 {
+			return f, fmt.Errorf("limit must be a positive number")
+		}
+		f.Limit = limit
+	}
+	if f.Limit > maxLimit {
+		f.Limit = maxLimit
+	}
+	if v := q.Get("offset"); v != "" {
+		offset, err := strconv.Atoi(v)
+		if err != nil || offset < 0 {
+			return f, fmt.Errorf("offset must not be negative")
+		}
+		f.Offset = offset
+	}
+	return f, nil
+}
+
+// List returns one page of entries matching the filter, newest first, and the
+// number of matching entries across all pages.
+func List(ctx context.Context, db bun.IDB, f Filter) (*dto.AuditLogPage, error) {
+	var entries []models.AuditLog
+	q := db.NewSelect().Model(&entries).OrderExpr("al.audit_id DESC").Limit(f.Limit).Offset(f.Offset)
+	if f.UserID != 0 {
+		q = q.WhereGroup(" AND ", func(q *bun.SelectQuery) *bun.SelectQuery {
+			return q.Where("al.actor_id = ?", f.UserID).
+				WhereOr("al.impersonator_id = ?", f.UserID).
+				WhereOr("al.target_user_id = ?", f.UserID)
+		})
+	}
+	if f.ActorID != 0 {
+		q = q.Where("al.actor_id = ?", f.ActorID)
+	}
+	if f.TargetUserID != 0 {
+		q = q.Where("al.target_user_id = ?", f.TargetUserID)
+	}
+	if f.Action != "" {
+		q = q.Where("al.action = ?", f.Action)
+	}
+	if f.Outcome != "" {
+		q = q.Where("al.outcome = ?", f.Outcome)
+	}
+	if f.IP != "" {
+		q = q.Where("al.ip = ?", f.IP)
+	}
+	if !f.Since.IsZero() {
+		q = q.Where("al.created_at >= ?", f.Since)
+	}
+	if !f.Until.IsZero() {
+		q = q.Where("al.created_at < ?", f.Until)
+	}
+	total, err := q.ScanAndCount(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &dto.AuditLogPage{Entries: make([]dto.AuditLogEntry, len(entries)), Total: total}
+	for i, e := range entries {
+		page.Entries[i] = dto.AuditLogEntry{
+			AuditID:        e.AuditID,
+			Action:         e.Action,
+			Outcome:        e.Outcome,
+			ActorID:        e.ActorID,
+			ImpersonatorID: e.ImpersonatorID,
+			ActorClientID:  e.ActorClientID,
+			TargetUserID:   e.TargetUserID,
+			Detail:         e.Detail,
+			IP:             e.IP,
+			UserAgent:      e.UserAgent,
+			CreatedAt:      e.CreatedAt,
+		}
+	}
+	return page, nil
+}
@@ -0,0 +1,64 @@
+package auditlog
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/hari134/pratilipi/userservice/models"
+)
+
+func TestFilterFromQuery(t *testing.T) {
+	f, err := FilterFromQuery(url.Values{
+		"user_id": {"7"},
+		"action":  {" login "},
+		"outcome": {"failure"},
+		"since":   {"2024-05-01T00:00:00Z"},
+		"limit":   {"10000"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	since := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	if f.UserID != 7 || f.Action != ActionLogin || f.Outcome != OutcomeFailure ||
+		!f.Since.Equal(since) || !f.Until.IsZero() || f.Limit != maxLimit {
+		t.Errorf("unexpected filter %+v", f)
+	}
+
+	for _, q := range []url.Values{
+		{"actor_id": {"abc"}},
+		{"target_user_id": {"0"}},
+		{"outcome": {"maybe"}},
+		{"until": {"yesterday"}},
+		{"offset": {"-1"}},
+	} {
+		if _, err := FilterFromQuery(q); err == nil {
+			t.Errorf("FilterFromQuery(%v) succeeded, want an error", q)
+		}
+	}
+}
+
+func TestEventOmitsUnsetIDs(t *testing.T) {
+	event := Event(&models.AuditLog{AuditID: 3, Action: ActionLogin, Outcome: OutcomeFailure, Detail: "unknown email"})
+	if event.ActorID != "" || event.TargetUserID != "" || event.ImpersonatorID != "" {
+		t.Errorf("unexpected IDs in %+v", event)
+	}
+
+	event = Event(&models.AuditLog{AuditID: 4, Action: ActionImpersonate, ActorID: 1, TargetUserID: 14})
+	if event.ActorID != "1" || event.TargetUserID != "14" {
+		t.Errorf("unexpected IDs in %+v", event)
+	}
+}
+
+func TestEmailHash(t *testing.T) {
+	hash := EmailHash("Hari12.James@example.com ")
+	if hash != EmailHash("hari12.james@example.com") {
+		t.Errorf("EmailHash should ignore case and surrounding spaces")
+	}
+	if hash == EmailHash("hari13.james@example.com") {
+		t.Errorf("EmailHash should differ between addresses")
+	}
+	if len(hash) != len("sha256:")+16 {
+		t.Errorf("unexpected hash %q", hash)
+	}
+}
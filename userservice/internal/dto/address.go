@@ -0,0 +1,16 @@
+package dto
+
+// AddressRequest represents the request body for creating or replacing an address.
+// The country's own rules are checked by addresses.Validate.
+type AddressRequest struct {
+	Label         string `json:"label" validate:"max=50"`
+	RecipientName string `json:"recipient_name" validate:"max=100"`
+	PhoneNo       string `json:"phone_no" validate:"e164" normalize:"e164"`
+	Line1         string `json:"line1" validate:"max=200"`
+	Line2         string `json:"line2" validate:"max=200"`
+	City          string `json:"city" validate:"max=100"`
+	State         string `json:"state" validate:"max=100"`
+	PostalCode    string `json:"postal_code" validate:"max=20"`
+	Country       string `json:"country"`
+	IsDefault     bool   `json:"is_default"`
+}
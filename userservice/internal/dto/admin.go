@@ -0,0 +1,41 @@
+package dto
+
+import "time"
+
+// AdminUser is a user as shown to admins, with their roles and account state.
+type AdminUser struct {
+	UserID                int64      `json:"user_id"`
+	Name                  string     `json:"name"`
+	Email                 string     `json:"email"`
+	PhoneNo               string     `json:"phone_no"`
+	Roles                 []string   `json:"roles"`
+	EmailVerified         bool       `json:"email_verified"`
+	TwoFactorEnabled      bool       `json:"two_factor_enabled"`
+	DisabledAt            *time.Time `json:"disabled_at,omitempty"`
+	DisabledReason        string     `json:"disabled_reason,omitempty"`
+	PasswordResetRequired bool       `json:"password_reset_required"`
+	CreatedAt             time.Time  `json:"created_at"`
+}
+
+// AdminUserList is one page of users matching an admin's filters.
+type AdminUserList struct {
+	Users []AdminUser `json:"users"`
+	Total int         `json:"total"` // Matching users across all pages
+}
+
+// DisableUserRequest represents the request body for disabling an account.
+type DisableUserRequest struct {
+	Reason string `json:"reason" validate:"max=500" normalize:"trim"`
+}
+
+// ImpersonateRequest represents the request body for acting as another user.
+type ImpersonateRequest struct {
+	Reason string `json:"reason" validate:"required,max=500" normalize:"trim"`
+}
+
+// ImpersonationResponse carries a token to act as a user. There is no refresh
+// token; the admin asks again once it expires.
+type ImpersonationResponse struct {
+	Token     string `json:"token"`
+	ExpiresIn int64  `json:"expires_in"` // Token lifetime in seconds
+}
@@ -0,0 +1,25 @@
+package dto
+
+import "time"
+
+// AuditLogEntry is an entry of the audit log as shown to admins. User IDs are
+// omitted when they do not apply.
+type AuditLogEntry struct {
+	AuditID        int64     `json:"audit_id"`
+	Action         string    `json:"action"`
+	Outcome        string    `json:"outcome"`
+	ActorID        int64     `json:"actor_id,omitempty"`
+	ImpersonatorID int64     `json:"impersonator_id,omitempty"`
+	ActorClientID  string    `json:"actor_client_id,omitempty"`
+	TargetUserID   int64     `json:"target_user_id,omitempty"`
+	Detail         string    `json:"detail,omitempty"`
+	IP             string    `json:"ip,omitempty"`
+	UserAgent      string    `json:"user_agent,omitempty"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// AuditLogPage is one page of audit log entries matching an admin's filters.
+type AuditLogPage struct {
+	Entries []AuditLogEntry `json:"entries"`
+	Total   int             `json:"total"` // Matching entries across all pages
+}
@@ -1,26 +1,163 @@
 package dto
 
+import "time"
+
 // ValidateTokenRequest represents the request body for token validation.
 type ValidateTokenRequest struct {
-	Token string `json:"token"`
+	Token string `json:"token" validate:"required"`
 }
 
 // ValidateTokenResponse represents the response body for token validation.
 type ValidateTokenResponse struct {
-	Valid  bool   `json:"valid"`
-	UserID int64  `json:"user_id,omitempty"`
-	Email  string `json:"email,omitempty"`
-	Role   string `json:"role,omitempty"`
-	Error  string `json:"error,omitempty"`
+	Valid       bool     `json:"valid"`
+	UserID      int64    `json:"user_id,omitempty"`
+	Email       string   `json:"email,omitempty"`
+	Roles       []string `json:"roles,omitempty"`
+	Permissions []string `json:"permissions,omitempty"`
+	ClientID    string   `json:"client_id,omitempty"` // Set for service tokens
+	Scope       string   `json:"scope,omitempty"`     // Set for service tokens
+	Error       string   `json:"error,omitempty"`
 }
 
 // LoginRequest represents the request body for user login.
 type LoginRequest struct {
-	Email    string `json:"email"`
-	Password string `json:"password"`
+	Email      string `json:"email" validate:"required" normalize:"trim,lower"`
+	Password   string `json:"password" validate:"required"`
+	DeviceName string `json:"device_name,omitempty" validate:"max=100" normalize:"trim"` // Shown in the session list; derived from the User-Agent when empty
 }
 
-// LoginResponse represents the response body for user login.
+// LoginResponse represents the response body for user login and token refresh.
 type LoginResponse struct {
-	Token string `json:"token"`
+	Token        string `json:"token"`         // Short-lived access token
+	RefreshToken string `json:"refresh_token"` // Single-use token for /token/refresh
+	ExpiresIn    int64  `json:"expires_in"`    // Access token lifetime in seconds
+}
+
+// RefreshTokenRequest represents the request body for token refresh.
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token" validate:"required"`
+}
+
+// LogoutRequest represents the request body for logout. The refresh token is
+// optional; when given, every token rotated from the same login is revoked.
+type LogoutRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// SetUserRolesRequest represents the request body for replacing a user's roles.
+type SetUserRolesRequest struct {
+	Roles []string `json:"roles"`
+}
+
+// EmailRequest represents the request body for requesting a verification email or a password reset.
+type EmailRequest struct {
+	Email string `json:"email" validate:"required,email" normalize:"trim,lower"`
+}
+
+// ConfirmEmailRequest represents the request body for confirming an email address.
+type ConfirmEmailRequest struct {
+	Token string `json:"token" validate:"required"`
+}
+
+// ResetPasswordRequest represents the request body for setting a new password with a reset token.
+type ResetPasswordRequest struct {
+	Token       string `json:"token" validate:"required"`
+	NewPassword string `json:"new_password" validate:"required,min=8,max=128"`
+}
+
+// TwoFactorChallengeResponse is returned by login instead of tokens when the
+// user has 2FA enabled. The challenge token is exchanged at /login/2fa.
+type TwoFactorChallengeResponse struct {
+	TwoFactorRequired bool   `json:"two_factor_required"`
+	ChallengeToken    string `json:"challenge_token"`
+	ExpiresIn         int64  `json:"expires_in"` // Challenge lifetime in seconds
+}
+
+// TwoFactorLoginRequest represents the request body for completing a 2FA login.
+// Code is a TOTP code or a recovery code.
+type TwoFactorLoginRequest struct {
+	ChallengeToken string `json:"challenge_token" validate:"required"`
+	Code           string `json:"code" validate:"required" normalize:"trim"`
+	DeviceName     string `json:"device_name,omitempty" validate:"max=100" normalize:"trim"` // As in LoginRequest
+}
+
+// TwoFactorCodeRequest represents a request body carrying a TOTP or recovery code.
+type TwoFactorCodeRequest struct {
+	Code string `json:"code" validate:"required" normalize:"trim"`
+}
+
+// TwoFactorEnrollResponse carries a new TOTP secret to add to an authenticator app.
+type TwoFactorEnrollResponse struct {
+	Secret     string `json:"secret"`
+	OTPAuthURI string `json:"otpauth_uri"` // Encode as a QR code for authenticator apps
+}
+
+// RecoveryCodesResponse carries recovery codes, which are only shown once.
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// TokenResponse is the OAuth 2.0 access token response of /oauth/token.
+type TokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int64  `json:"expires_in"`
+	Scope       string `json:"scope"`
+}
+
+// OAuthError is an OAuth 2.0 error response, e.g. {"error": "invalid_client"}.
+type OAuthError struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description,omitempty"`
+}
+
+// CreateAPIClientRequest represents the request body for registering an API
+// client. OpenID Connect clients set grant_types to ["authorization_code"] and
+// list their redirect_uris.
+type CreateAPIClientRequest struct {
+	Name         string   `json:"name" validate:"required,max=100" normalize:"trim"`
+	Scopes       []string `json:"scopes"`
+	RedirectURIs []string `json:"redirect_uris" validate:"max=10"`
+	GrantTypes   []string `json:"grant_types"`
+	Public       bool     `json:"public"` // No secret, e.g. for single-page and mobile apps
+}
+
+// CreateAPIClientResponse carries a new client's credentials. The secret is
+// only shown once, and is empty for public clients.
+type CreateAPIClientResponse struct {
+	ClientID     string   `json:"client_id"`
+	ClientSecret string   `json:"client_secret,omitempty"`
+	Name         string   `json:"name"`
+	Scopes       []string `json:"scopes"`
+	RedirectURIs []string `json:"redirect_uris"`
+	GrantTypes   []string `json:"grant_types"`
+	Public       bool     `json:"public"`
+}
+
+// SetRedirectURIsRequest replaces an OpenID Connect client's redirect URIs.
+type SetRedirectURIsRequest struct {
+	RedirectURIs []string `json:"redirect_uris" validate:"max=10"`
+}
+
+// DeleteAccountRequest confirms the caller's own account deletion. Code is a
+// TOTP or recovery code and is only needed when 2FA is enabled.
+type DeleteAccountRequest struct {
+	Password string `json:"password" validate:"required"`
+	Code     string `json:"code,omitempty" normalize:"trim"`
+}
+
+// Session is one of the caller's logins, as listed by /sessions.
+type Session struct {
+	SessionID  string    `json:"session_id"`
+	DeviceName string    `json:"device_name"`
+	UserAgent  string    `json:"user_agent"`
+	IP         string    `json:"ip"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	Current    bool      `json:"current"` // Whether the request's token belongs to this session
+}
+
+// RevokeSessionsResponse reports how many sessions were ended.
+type RevokeSessionsResponse struct {
+	Revoked int `json:"revoked"`
 }
@@ -0,0 +1,45 @@
+package dto
+
+// OIDCDiscovery is the OpenID Connect discovery document served at
+// /.well-known/openid-configuration.
+type OIDCDiscovery struct {
+	Issuer                            string   `json:"issuer"`
+	AuthorizationEndpoint             string   `json:"authorization_endpoint"`
+	TokenEndpoint                     string   `json:"token_endpoint"`
+	UserinfoEndpoint                  string   `json:"userinfo_endpoint"`
+	JWKSURI                           string   `json:"jwks_uri"`
+	ScopesSupported                   []string `json:"scopes_supported"`
+	ResponseTypesSupported            []string `json:"response_types_supported"`
+	GrantTypesSupported               []string `json:"grant_types_supported"`
+	SubjectTypesSupported             []string `json:"subject_types_supported"`
+	IDTokenSigningAlgValuesSupported  []string `json:"id_token_signing_alg_values_supported"`
+	TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported"`
+	CodeChallengeMethodsSupported     []string `json:"code_challenge_methods_supported"`
+	ClaimsSupported                   []string `json:"claims_supported"`
+}
+
+// OIDCProfile holds the standard claims about a user that the granted scopes
+// release, both in ID tokens and at the userinfo endpoint.
+type OIDCProfile struct {
+	Name                string `json:"name,omitempty"`                  // profile scope
+	UpdatedAt           int64  `json:"updated_at,omitempty"`            // profile scope, Unix time
+	Email               string `json:"email,omitempty"`                 // email scope
+	EmailVerified       *bool  `json:"email_verified,omitempty"`        // email scope
+	PhoneNumber         string `json:"phone_number,omitempty"`          // phone scope
+	PhoneNumberVerified *bool  `json:"phone_number_verified,omitempty"` // phone scope; phone numbers are never verified
+}
+
+// OIDCUserInfo is the response of the userinfo endpoint.
+type OIDCUserInfo struct {
+	Subject string `json:"sub"`
+	OIDCProfile
+}
+
+// OIDCTokenResponse is the token response of the authorization code grant.
+type OIDCTokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int64  `json:"expires_in"`
+	Scope       string `json:"scope"`
+	IDToken     string `json:"id_token"`
+}
@@ -2,7 +2,8 @@ package dto
 
 
 type UpdateUserRequest struct {
-    UserID int64  `json:"user_id"`
-    Email  string `json:"email"`
-    Name   string `json:"name"`
+    UserID int64  `json:"user_id" validate:"required"`
+    Email  string `json:"email" validate:"required,email,max=150" normalize:"trim,lower"`
+    Name   string `json:"name" validate:"required,max=100" normalize:"trim"`
+    PhoneNo string `json:"phone_no,omitempty" validate:"e164" normalize:"e164"` // Empty keeps the current number
 }
\ No newline at end of file
@@ -0,0 +1,74 @@
+// Package emailpolicy decides what users who have not verified their email address may do.
+package emailpolicy
+
+import (
+	"os"
+	"strings"
+)
+
+// Policy is the EMAIL_VERIFICATION_POLICY setting.
+type Policy string
+
+const (
+	// Off lets unverified users do everything (the default).
+	Off Policy = "off"
+	// Restrict lets unverified users log in, but their tokens lack the
+	// permissions listed in UNVERIFIED_DENIED_PERMISSIONS.
+	Restrict Policy = "restrict"
+	// Block refuses to log in unverified users.
+	Block Policy = "block"
+)
+
+// Current returns the configured policy. Unknown values fall back to Off.
+func Current() Policy {
+	switch p := Policy(os.Getenv("EMAIL_VERIFICATION_POLICY")); p {
+	case Restrict, Block:
+		return p
+	default:
+		return Off
+	}
+}
+
+// deniedPermissions returns the permissions withheld from unverified users under
+// Restrict, from the comma-separated UNVERIFIED_DENIED_PERMISSIONS (default "order:write").
+func deniedPermissions() []string {
+	env := os.Getenv("UNVERIFIED_DENIED_PERMISSIONS")
+	if env == "" {
+		return []string{"order:write"}
+	}
+	var denied []string
+	for _, p := range strings.Split(env, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			denied = append(denied, p)
+		}
+	}
+	return denied
+}
+
+// Permissions returns the permissions to embed in a user's token given whether
+// their email address is verified.
+func Permissions(permissions []string, verified bool) []string {
+	if verified || Current() != Restrict {
+		return permissions
+	}
+	denied := deniedPermissions()
+	allowed := make([]string, 0, len(permissions))
+	for _, p := range permissions {
+		withheld := false
+		for _, d := range denied {
+			if p == d {
+				withheld = true
+				break
+			}
+		}
+		if !withheld {
+			allowed = append(allowed, p)
+		}
+	}
+	return allowed
+}
+
+// LoginAllowed reports whether a user may log in given whether their email address is verified.
+func LoginAllowed(verified bool) bool {
+	return verified || Current() != Block
+}
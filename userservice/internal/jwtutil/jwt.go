@@ -1,46 +1,131 @@
 package jwtutil
 
 import (
+	"crypto/rand"
+	"encoding/hex"
+	"os"
+	"sync"
 	"time"
 
 	"github.com/golang-jwt/jwt/v4"
+	"github.com/hari134/pratilipi/pkg/auth"
 )
 
-var JWTSecretKey = []byte("your-secret-key")
+// Claims are the claims carried by access tokens; they are shared with services
+// that verify tokens locally through pkg/auth.
+type Claims = auth.Claims
 
-type Claims struct {
-	UserID int64  `json:"user_id"`
-	Email  string `json:"email"`
-	Role   string `json:"role"`
-	jwt.RegisteredClaims
+var (
+	mu   sync.RWMutex
+	keys *KeySet
+)
+
+// LoadKeys loads the signing keys from the environment. It is called at startup
+// and again on SIGHUP to pick up rotated keys.
+func LoadKeys() error {
+	ks, err := LoadKeySetFromEnv()
+	if err != nil {
+		return err
+	}
+	mu.Lock()
+	keys = ks
+	mu.Unlock()
+	return nil
+}
+
+func currentKeys() *KeySet {
+	mu.RLock()
+	defer mu.RUnlock()
+	return keys
+}
+
+// Issuer returns the "iss" claim of issued tokens, from JWT_ISSUER (default
+// "userservice"). OpenID Connect clients expect it to be the public base URL of
+// the service, e.g. https://accounts.example.com.
+func Issuer() string {
+	if iss := os.Getenv("JWT_ISSUER"); iss != "" {
+		return iss
+	}
+	return "userservice"
+}
+
+// AccessTokenTTL returns how long access tokens stay valid, from JWT_ACCESS_TOKEN_TTL (default 15 minutes).
+// Access tokens are short-lived because services verifying them locally only learn of revocations from /token-revocations.
+func AccessTokenTTL() time.Duration {
+	if ttl, err := time.ParseDuration(os.Getenv("JWT_ACCESS_TOKEN_TTL")); err == nil && ttl > 0 {
+		return ttl
+	}
+	return 15 * time.Minute
+}
+
+// newTokenID returns a random "jti" so individual tokens can be revoked.
+func newTokenID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
 }
 
-func GenerateJWTToken(userID int64, email, role string) (string, error) {
-	expirationTime := time.Now().Add(24 * time.Hour)
+// ImpersonationTokenTTL returns how long tokens for acting as another user stay
+// valid, from IMPERSONATION_TOKEN_TTL (default 15 minutes).
+func ImpersonationTokenTTL() time.Duration {
+	if ttl, err := time.ParseDuration(os.Getenv("IMPERSONATION_TOKEN_TTL")); err == nil && ttl > 0 {
+		return ttl
+	}
+	return 15 * time.Minute
+}
 
-	claims := &Claims{
-		UserID: userID,
-		Email:  email,
-		Role:   role,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(expirationTime),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-		},
+// GenerateJWTToken signs an access token for the given user or service claims,
+// filling in the token ID, issuer and validity period.
+func GenerateJWTToken(claims *Claims) (string, error) {
+	return GenerateJWTTokenWithTTL(claims, AccessTokenTTL())
+}
+
+// GenerateJWTTokenWithTTL is GenerateJWTToken with a lifetime other than AccessTokenTTL.
+func GenerateJWTTokenWithTTL(claims *Claims, ttl time.Duration) (string, error) {
+	tokenID, err := newTokenID()
+	if err != nil {
+		return "", err
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(JWTSecretKey)
+	now := time.Now()
+	claims.ID = tokenID
+	claims.Issuer = Issuer()
+	claims.ExpiresAt = jwt.NewNumericDate(now.Add(ttl))
+	claims.IssuedAt = jwt.NewNumericDate(now)
+
+	return currentKeys().sign(claims)
+}
+
+// Sign signs claims other than access token claims, such as OpenID Connect ID
+// tokens, with the active key. The caller fills in every registered claim.
+func Sign(claims jwt.Claims) (string, error) {
+	return currentKeys().sign(claims)
+}
+
+// SigningAlgorithms returns the algorithms of the loaded signing keys.
+func SigningAlgorithms() []string {
+	return currentKeys().algorithms()
 }
 
 func ParseJWTToken(tokenStr string) (*Claims, error) {
+	ks := currentKeys()
 	claims := &Claims{}
-	token, err := jwt.ParseWithClaims(tokenStr, claims, func(token *jwt.Token) (interface{}, error) {
-		return JWTSecretKey, nil
-	})
+	parser := jwt.NewParser(jwt.WithValidMethods(ks.algorithms()))
+	token, err := parser.ParseWithClaims(tokenStr, claims, ks.verificationKey)
 
 	if err != nil || !token.Valid {
 		return nil, err
 	}
+	if !claims.IsAccessToken() {
+		return nil, auth.ErrNotAccessToken
+	}
 
 	return claims, nil
 }
+
+// JWKS returns the public signing keys for /.well-known/jwks.json.
+func JWKS() auth.JWKSet {
+	return currentKeys().jwks()
+}
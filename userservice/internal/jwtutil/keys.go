@@ -0,0 +1,238 @@
+package jwtutil
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/hari134/pratilipi/pkg/auth"
+)
+
+// SigningKey is a key tokens can be signed and verified with.
+type SigningKey struct {
+	ID        string      // Key ID, sent as the "kid" token header
+	Algorithm string      // RS256 or EdDSA
+	key       interface{} // *rsa.PrivateKey or ed25519.PrivateKey
+}
+
+// KeySet holds the active signing key plus older keys that are still accepted
+// when verifying. Rotating keys means adding a new key, making it active, and
+// removing the previous one once every token it signed has expired.
+type KeySet struct {
+	active *SigningKey
+	keys   map[string]*SigningKey
+}
+
+// LoadKeySetFromEnv builds a KeySet from the environment:
+//
+//	JWT_KEYS_DIR          directory of PEM private keys (RSA or Ed25519) named <kid>.pem
+//	JWT_ACTIVE_KEY_ID     key used for signing; defaults to the last key ID in lexical order
+//	JWT_PRIVATE_KEY_FILE  a single PEM private key, used when JWT_KEYS_DIR is not set
+//	JWT_PRIVATE_KEY       the same key given inline
+//	JWT_KEY_ID            key ID for a single key (default "default")
+//
+// HS256 secrets (JWT_SECRET) are refused, since the other services verify
+// tokens with the published public keys. When nothing is configured an
+// ephemeral Ed25519 key with a random key ID is generated, so tokens do not
+// survive a restart, but verifiers caching the previous key fetch the new one.
+func LoadKeySetFromEnv() (*KeySet, error) {
+	keyID := os.Getenv("JWT_KEY_ID")
+	if keyID == "" {
+		keyID = "default"
+	}
+
+	if dir := os.Getenv("JWT_KEYS_DIR"); dir != "" {
+		return loadKeysDir(dir, os.Getenv("JWT_ACTIVE_KEY_ID"))
+	}
+
+	if path := os.Getenv("JWT_PRIVATE_KEY_FILE"); path != "" {
+		pemBytes, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read JWT_PRIVATE_KEY_FILE: %w", err)
+		}
+		key, err := parsePrivateKey(keyID, pemBytes)
+		if err != nil {
+			return nil, err
+		}
+		return newKeySet(key), nil
+	}
+
+	if pemStr := os.Getenv("JWT_PRIVATE_KEY"); pemStr != "" {
+		key, err := parsePrivateKey(keyID, []byte(pemStr))
+		if err != nil {
+			return nil, err
+		}
+		return newKeySet(key), nil
+	}
+
+	if os.Getenv("JWT_SECRET") != "" {
+		return nil, errors.New("JWT_SECRET (HS256) is not supported, configure an RSA or Ed25519 private key")
+	}
+
+	key, err := ephemeral()
+	if err != nil {
+		return nil, err
+	}
+	return newKeySet(key), nil
+}
+
+var (
+	ephemeralOnce sync.Once
+	ephemeralKey  *SigningKey
+	ephemeralErr  error
+)
+
+// ephemeral returns the process's generated key, creating it on first use so
+// reloading the keys does not invalidate every token issued so far.
+func ephemeral() (*SigningKey, error) {
+	ephemeralOnce.Do(func() {
+		log.Printf("No JWT signing key configured, generating an ephemeral Ed25519 key")
+		_, priv, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			ephemeralErr = err
+			return
+		}
+		id := make([]byte, 8)
+		if _, err := rand.Read(id); err != nil {
+			ephemeralErr = err
+			return
+		}
+		ephemeralKey = &SigningKey{ID: "ephemeral-" + hex.EncodeToString(id), Algorithm: "EdDSA", key: priv}
+	})
+	return ephemeralKey, ephemeralErr
+}
+
+// loadKeysDir loads every <kid>.pem file in dir.
+func loadKeysDir(dir, activeID string) (*KeySet, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return nil, err
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("no *.pem keys found in %s", dir)
+	}
+	sort.Strings(paths)
+
+	ks := &KeySet{keys: make(map[string]*SigningKey)}
+	for _, path := range paths {
+		pemBytes, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		kid := strings.TrimSuffix(filepath.Base(path), ".pem")
+		key, err := parsePrivateKey(kid, pemBytes)
+		if err != nil {
+			return nil, err
+		}
+		ks.keys[kid] = key
+		ks.active = key // last one wins unless JWT_ACTIVE_KEY_ID says otherwise
+	}
+
+	if activeID != "" {
+		key, ok := ks.keys[activeID]
+		if !ok {
+			return nil, fmt.Errorf("active key %q not found in %s", activeID, dir)
+		}
+		ks.active = key
+	}
+	return ks, nil
+}
+
+func newKeySet(key *SigningKey) *KeySet {
+	return &KeySet{active: key, keys: map[string]*SigningKey{key.ID: key}}
+}
+
+// parsePrivateKey parses a PKCS#8 or PKCS#1 PEM block holding an RSA or Ed25519 key.
+func parsePrivateKey(kid string, pemBytes []byte) (*SigningKey, error) {
+	block, _ := pem.Decode(pemBytes)
+	if block == nil {
+		return nil, fmt.Errorf("key %s: no PEM data found", kid)
+	}
+
+	var parsed interface{}
+	var err error
+	if block.Type == "RSA PRIVATE KEY" {
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	} else {
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("key %s: %w", kid, err)
+	}
+
+	switch key := parsed.(type) {
+	case *rsa.PrivateKey:
+		return &SigningKey{ID: kid, Algorithm: "RS256", key: key}, nil
+	case ed25519.PrivateKey:
+		return &SigningKey{ID: kid, Algorithm: "EdDSA", key: key}, nil
+	default:
+		return nil, fmt.Errorf("key %s: unsupported key type %T", kid, parsed)
+	}
+}
+
+// sign signs the claims with the active key and sets the kid header.
+func (ks *KeySet) sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(jwt.GetSigningMethod(ks.active.Algorithm), claims)
+	token.Header["kid"] = ks.active.ID
+	return token.SignedString(ks.active.key)
+}
+
+// verificationKey returns the key a token with the given kid must be verified with.
+func (ks *KeySet) verificationKey(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	key, ok := ks.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	if token.Method.Alg() != key.Algorithm {
+		return nil, errors.New("token algorithm does not match signing key")
+	}
+	return key.key.(crypto.Signer).Public(), nil
+}
+
+// algorithms returns the algorithms of all keys in the set.
+func (ks *KeySet) algorithms() []string {
+	seen := make(map[string]bool)
+	var algs []string
+	for _, key := range ks.keys {
+		if !seen[key.Algorithm] {
+			seen[key.Algorithm] = true
+			algs = append(algs, key.Algorithm)
+		}
+	}
+	return algs
+}
+
+// jwks returns the public halves of all keys.
+func (ks *KeySet) jwks() auth.JWKSet {
+	set := auth.JWKSet{Keys: []auth.JWK{}}
+	ids := make([]string, 0, len(ks.keys))
+	for kid := range ks.keys {
+		ids = append(ids, kid)
+	}
+	sort.Strings(ids)
+
+	for _, kid := range ids {
+		key := ks.keys[kid]
+		jwk, err := auth.NewJWK(key.ID, key.Algorithm, key.key.(crypto.Signer).Public())
+		if err != nil {
+			log.Printf("Skipping key %s in JWKS: %v", key.ID, err)
+			continue
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	return set
+}
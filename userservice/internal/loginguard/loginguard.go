@@ -0,0 +1,224 @@
+// Package loginguard tracks failed logins per account and per client IP, asking
+// clients to wait progressively longer between attempts and locking the
+// account or IP out for a while after too many failures.
+package loginguard
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Record is the failure history of one account or IP.
+type Record struct {
+	Failures    int       // Consecutive failures within the failure window
+	LastFailure time.Time // Time of the most recent failure
+	LockedUntil time.Time // Zero unless locked out
+}
+
+// Store persists failure records. Implementations must be safe for concurrent use.
+type Store interface {
+	// Get returns the record for key, or a zero Record if there is none.
+	Get(ctx context.Context, key string) (Record, error)
+	// Fail counts a failure at now and returns the updated record. Failures
+	// older than window no longer count, so the count starts over.
+	Fail(ctx context.Context, key string, now time.Time, window time.Duration) (Record, error)
+	// Lock locks key out until the given time.
+	Lock(ctx context.Context, key string, until time.Time) error
+	// Reset forgets the record for key.
+	Reset(ctx context.Context, key string) error
+	// Purge forgets records whose last failure and lockout are both before the given time.
+	Purge(ctx context.Context, before time.Time) error
+}
+
+// Policy configures the guard.
+type Policy struct {
+	MaxAccountFailures int           // Failures before an account is locked out
+	MaxIPFailures      int           // Failures before an IP is locked out
+	Window             time.Duration // Failures older than this are forgotten
+	LockoutDuration    time.Duration // How long a lockout lasts
+	BaseDelay          time.Duration // Wait after the first failure; doubles with each further failure
+	MaxDelay           time.Duration // Upper bound for the wait between attempts
+}
+
+// PolicyFromEnv reads the policy from LOGIN_MAX_ACCOUNT_FAILURES (default 5),
+// LOGIN_MAX_IP_FAILURES (default 50), LOGIN_FAILURE_WINDOW (default 15m),
+// LOGIN_LOCKOUT_DURATION (default 15m), LOGIN_BASE_DELAY (default 1s) and
+// LOGIN_MAX_DELAY (default 30s).
+func PolicyFromEnv() Policy {
+	return Policy{
+		MaxAccountFailures: envInt("LOGIN_MAX_ACCOUNT_FAILURES", 5),
+		MaxIPFailures:      envInt("LOGIN_MAX_IP_FAILURES", 50),
+		Window:             envDuration("LOGIN_FAILURE_WINDOW", 15*time.Minute),
+		LockoutDuration:    envDuration("LOGIN_LOCKOUT_DURATION", 15*time.Minute),
+		BaseDelay:          envDuration("LOGIN_BASE_DELAY", time.Second),
+		MaxDelay:           envDuration("LOGIN_MAX_DELAY", 30*time.Second),
+	}
+}
+
+// Guard decides whether a login attempt may go ahead.
+type Guard struct {
+	store  Store
+	policy Policy
+	now    func() time.Time
+}
+
+// New creates a Guard backed by store.
+func New(store Store, policy Policy) *Guard {
+	return &Guard{store: store, policy: policy, now: time.Now}
+}
+
+// Decision is the outcome of Check.
+type Decision struct {
+	Allowed    bool
+	Locked     bool          // The account or IP is locked out, not merely throttled
+	RetryAfter time.Duration // How long to wait before the next attempt when not allowed
+}
+
+// Result is the outcome of Failure.
+type Result struct {
+	AccountLocked bool      // This failure locked the account out
+	LockedUntil   time.Time // End of the new lockout
+	Failures      int       // Consecutive failures of the account
+}
+
+func accountKey(email string) string {
+	return "account:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func ipKey(ip string) string {
+	return "ip:" + ip
+}
+
+// Check tells whether a login for email from ip may be attempted now. It must be
+// called before the password is checked, so blocked attempts cost no hashing.
+func (g *Guard) Check(ctx context.Context, email, ip string) (Decision, error) {
+	now := g.now()
+	decision := Decision{Allowed: true}
+	for _, key := range []string{accountKey(email), ipKey(ip)} {
+		rec, err := g.store.Get(ctx, key)
+		if err != nil {
+			return Decision{}, err
+		}
+		wait, locked := g.wait(rec, now)
+		if wait > decision.RetryAfter {
+			decision = Decision{Allowed: false, Locked: locked, RetryAfter: wait}
+		}
+	}
+	return decision, nil
+}
+
+// wait returns how long a key with the given record has to wait before the next attempt.
+func (g *Guard) wait(rec Record, now time.Time) (time.Duration, bool) {
+	if now.Before(rec.LockedUntil) {
+		return rec.LockedUntil.Sub(now), true
+	}
+	if rec.Failures == 0 || now.Sub(rec.LastFailure) > g.policy.Window {
+		return 0, false
+	}
+	if next := rec.LastFailure.Add(g.delay(rec.Failures)); now.Before(next) {
+		return next.Sub(now), false
+	}
+	return 0, false
+}
+
+// delay returns the wait after the given number of consecutive failures.
+func (g *Guard) delay(failures int) time.Duration {
+	d := g.policy.BaseDelay
+	for i := 1; i < failures && d < g.policy.MaxDelay; i++ {
+		d *= 2
+	}
+	if d > g.policy.MaxDelay {
+		d = g.policy.MaxDelay
+	}
+	return d
+}
+
+// Failure records a failed login for email from ip and locks out the account
+// or IP once it reaches its limit.
+func (g *Guard) Failure(ctx context.Context, email, ip string) (Result, error) {
+	now := g.now()
+	account, err := g.store.Fail(ctx, accountKey(email), now, g.policy.Window)
+	if err != nil {
+		return Result{}, err
+	}
+	result := Result{Failures: account.Failures}
+	if account.Failures >= g.policy.MaxAccountFailures && !now.Before(account.LockedUntil) {
+		result.AccountLocked = true
+		result.LockedUntil = now.Add(g.policy.LockoutDuration)
+		if err := g.store.Lock(ctx, accountKey(email), result.LockedUntil); err != nil {
+			return Result{}, err
+		}
+	}
+
+	addr, err := g.store.Fail(ctx, ipKey(ip), now, g.policy.Window)
+	if err != nil {
+		return Result{}, err
+	}
+	if addr.Failures >= g.policy.MaxIPFailures && !now.Before(addr.LockedUntil) {
+		if err := g.store.Lock(ctx, ipKey(ip), now.Add(g.policy.LockoutDuration)); err != nil {
+			return Result{}, err
+		}
+	}
+	return result, nil
+}
+
+// Success clears the account's failures after a successful login. The IP's
+// failures are kept, so one valid account cannot be used to keep guessing others.
+func (g *Guard) Success(ctx context.Context, email string) error {
+	return g.store.Reset(ctx, accountKey(email))
+}
+
+// PasswordVerified records a correct password for email. While a second factor
+// is still due the account's failures are kept, so wrong codes count towards the
+// lockout like wrong passwords; call Success once the code passed.
+func (g *Guard) PasswordVerified(ctx context.Context, email string, secondFactorDue bool) error {
+	if secondFactorDue {
+		return nil
+	}
+	return g.Success(ctx, email)
+}
+
+// Unlock lifts a lockout of the account and clears its failures.
+func (g *Guard) Unlock(ctx context.Context, email string) error {
+	return g.store.Reset(ctx, accountKey(email))
+}
+
+// Purge forgets records that no longer affect any decision.
+func (g *Guard) Purge(ctx context.Context) error {
+	return g.store.Purge(ctx, g.now().Add(-g.policy.Window-g.policy.MaxDelay))
+}
+
+// ClientIP returns the IP of the client making the request. The first address of
+// X-Forwarded-For is used only with LOGIN_TRUST_FORWARDED_FOR=true, as clients
+// can set it to anything when the service is not behind a proxy.
+func ClientIP(r *http.Request) string {
+	if os.Getenv("LOGIN_TRUST_FORWARDED_FOR") == "true" {
+		if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+			return strings.TrimSpace(strings.Split(forwarded, ",")[0])
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func envInt(name string, def int) int {
+	if v, err := strconv.Atoi(os.Getenv(name)); err == nil && v > 0 {
+		return v
+	}
+	return def
+}
+
+func envDuration(name string, def time.Duration) time.Duration {
+	if v, err := time.ParseDuration(os.Getenv(name)); err == nil && v > 0 {
+		return v
+	}
+	return def
+}
@@ -0,0 +1,145 @@
+package loginguard
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func newTestGuard(now *time.Time) *Guard {
+	g := New(NewMemoryStore(), Policy{
+		MaxAccountFailures: 3,
+		MaxIPFailures:      10,
+		Window:             15 * time.Minute,
+		LockoutDuration:    time.Hour,
+		BaseDelay:          time.Second,
+		MaxDelay:           4 * time.Second,
+	})
+	g.now = func() time.Time { return *now }
+	return g
+}
+
+func TestProgressiveDelayAndLockout(t *testing.T) {
+	ctx := context.Background()
+	now := time.Unix(1700000000, 0)
+	g := newTestGuard(&now)
+
+	expectDecision := func(allowed, locked bool, retryAfter time.Duration) {
+		t.Helper()
+		d, err := g.Check(ctx, "User@Example.com", "10.0.0.1")
+		if err != nil {
+			t.Fatalf("Check: %v", err)
+		}
+		if d.Allowed != allowed || d.Locked != locked || d.RetryAfter != retryAfter {
+			t.Fatalf("expected allowed=%v locked=%v retryAfter=%v, got %+v", allowed, locked, retryAfter, d)
+		}
+	}
+
+	expectDecision(true, false, 0)
+
+	if _, err := g.Failure(ctx, "user@example.com", "10.0.0.1"); err != nil {
+		t.Fatalf("Failure: %v", err)
+	}
+	expectDecision(false, false, time.Second)
+
+	now = now.Add(time.Second)
+	expectDecision(true, false, 0)
+	if _, err := g.Failure(ctx, "user@example.com", "10.0.0.1"); err != nil {
+		t.Fatalf("Failure: %v", err)
+	}
+	expectDecision(false, false, 2*time.Second)
+
+	now = now.Add(2 * time.Second)
+	res, err := g.Failure(ctx, "user@example.com", "10.0.0.1")
+	if err != nil {
+		t.Fatalf("Failure: %v", err)
+	}
+	if !res.AccountLocked || res.Failures != 3 {
+		t.Fatalf("expected the third failure to lock the account, got %+v", res)
+	}
+	expectDecision(false, true, time.Hour)
+
+	if err := g.Unlock(ctx, "user@example.com"); err != nil {
+		t.Fatalf("Unlock: %v", err)
+	}
+	// The IP still has to wait after its third failure
+	expectDecision(false, false, 4*time.Second)
+}
+
+func TestFailuresExpireAfterWindow(t *testing.T) {
+	ctx := context.Background()
+	now := time.Unix(1700000000, 0)
+	g := newTestGuard(&now)
+
+	for i := 0; i < 2; i++ {
+		if _, err := g.Failure(ctx, "user@example.com", "10.0.0.1"); err != nil {
+			t.Fatalf("Failure: %v", err)
+		}
+		now = now.Add(time.Minute)
+	}
+
+	now = now.Add(20 * time.Minute)
+	res, err := g.Failure(ctx, "user@example.com", "10.0.0.1")
+	if err != nil {
+		t.Fatalf("Failure: %v", err)
+	}
+	if res.AccountLocked || res.Failures != 1 {
+		t.Fatalf("expected old failures to be forgotten, got %+v", res)
+	}
+}
+
+func TestWrongSecondFactorCodesLockAccount(t *testing.T) {
+	ctx := context.Background()
+	now := time.Unix(1700000000, 0)
+	g := newTestGuard(&now)
+
+	// Each round enters the correct password, which earns a new 2FA challenge,
+	// and then a wrong code
+	for i := 1; ; i++ {
+		d, err := g.Check(ctx, "user@example.com", "10.0.0.1")
+		if err != nil {
+			t.Fatalf("Check: %v", err)
+		}
+		if !d.Allowed {
+			if !d.Locked {
+				t.Fatalf("round %d: expected a lockout, got %+v", i, d)
+			}
+			if i != 4 {
+				t.Fatalf("expected the account to be locked after 3 wrong codes, got %d", i-1)
+			}
+			return
+		}
+		if i > 4 {
+			t.Fatalf("account not locked after %d wrong codes", i-1)
+		}
+		if err := g.PasswordVerified(ctx, "user@example.com", true); err != nil {
+			t.Fatalf("PasswordVerified: %v", err)
+		}
+		if _, err := g.Failure(ctx, "user@example.com", "10.0.0.1"); err != nil {
+			t.Fatalf("Failure: %v", err)
+		}
+		now = now.Add(5 * time.Second) // Past the throttle delay
+	}
+}
+
+func TestPasswordVerifiedWithoutSecondFactorClearsFailures(t *testing.T) {
+	ctx := context.Background()
+	now := time.Unix(1700000000, 0)
+	g := newTestGuard(&now)
+
+	for i := 0; i < 2; i++ {
+		if _, err := g.Failure(ctx, "user@example.com", "10.0.0.1"); err != nil {
+			t.Fatalf("Failure: %v", err)
+		}
+	}
+	if err := g.PasswordVerified(ctx, "user@example.com", false); err != nil {
+		t.Fatalf("PasswordVerified: %v", err)
+	}
+	res, err := g.Failure(ctx, "user@example.com", "10.0.0.2")
+	if err != nil {
+		t.Fatalf("Failure: %v", err)
+	}
+	if res.Failures != 1 {
+		t.Fatalf("expected the login to clear the account's failures, got %+v", res)
+	}
+}
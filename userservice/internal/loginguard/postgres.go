@@ -0,0 +1,81 @@
+package loginguard
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/hari134/pratilipi/userservice/models"
+	"github.com/uptrace/bun"
+)
+
+// PostgresStore keeps records in the login_attempts table, so every replica
+// of the service sees the same failures.
+type PostgresStore struct {
+	db bun.IDB
+}
+
+// NewPostgresStore creates a PostgresStore using db.
+func NewPostgresStore(db bun.IDB) *PostgresStore {
+	return &PostgresStore{db: db}
+}
+
+func (s *PostgresStore) Get(ctx context.Context, key string) (Record, error) {
+	attempt := &models.LoginAttempt{}
+	err := s.db.NewSelect().Model(attempt).Where("key = ?", key).Scan(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Record{}, nil
+	}
+	if err != nil {
+		return Record{}, err
+	}
+	return toRecord(attempt), nil
+}
+
+// Fail counts the failure in a single upsert, so concurrent failures are all counted.
+func (s *PostgresStore) Fail(ctx context.Context, key string, now time.Time, window time.Duration) (Record, error) {
+	attempt := &models.LoginAttempt{Key: key, Failures: 1, LastFailureAt: now}
+	_, err := s.db.NewInsert().
+		Model(attempt).
+		On("CONFLICT (key) DO UPDATE").
+		Set("failures = CASE WHEN la.last_failure_at < ? THEN 1 ELSE la.failures + 1 END", now.Add(-window)).
+		Set("last_failure_at = EXCLUDED.last_failure_at").
+		Returning("*").
+		Exec(ctx)
+	if err != nil {
+		return Record{}, err
+	}
+	return toRecord(attempt), nil
+}
+
+func (s *PostgresStore) Lock(ctx context.Context, key string, until time.Time) error {
+	_, err := s.db.NewUpdate().
+		Model((*models.LoginAttempt)(nil)).
+		Set("locked_until = ?", until).
+		Where("key = ?", key).
+		Exec(ctx)
+	return err
+}
+
+func (s *PostgresStore) Reset(ctx context.Context, key string) error {
+	_, err := s.db.NewDelete().Model((*models.LoginAttempt)(nil)).Where("key = ?", key).Exec(ctx)
+	return err
+}
+
+func (s *PostgresStore) Purge(ctx context.Context, before time.Time) error {
+	_, err := s.db.NewDelete().
+		Model((*models.LoginAttempt)(nil)).
+		Where("last_failure_at < ?", before).
+		Where("locked_until IS NULL OR locked_until < ?", before).
+		Exec(ctx)
+	return err
+}
+
+func toRecord(attempt *models.LoginAttempt) Record {
+	return Record{
+		Failures:    attempt.Failures,
+		LastFailure: attempt.LastFailureAt,
+		LockedUntil: attempt.LockedUntil,
+	}
+}
@@ -0,0 +1,344 @@
+// Package oidc lets third-party applications log users in with the OpenID
+// Connect authorization code flow. Clients are API clients registered for the
+// authorization_code grant; every flow must use PKCE with S256.
+package oidc
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/hari134/pratilipi/pkg/auth"
+	"github.com/hari134/pratilipi/userservice/internal/dto"
+	"github.com/hari134/pratilipi/userservice/internal/jwtutil"
+	"github.com/hari134/pratilipi/userservice/internal/tokenstore"
+	"github.com/hari134/pratilipi/userservice/models"
+	"github.com/uptrace/bun"
+)
+
+// Scopes a client may request. Every request must include ScopeOpenID.
+const (
+	ScopeOpenID  = "openid"
+	ScopeProfile = "profile"
+	ScopeEmail   = "email"
+	ScopePhone   = "phone"
+)
+
+// SupportedScopes lists the scopes in the order they are reported.
+var SupportedScopes = []string{ScopeOpenID, ScopeProfile, ScopeEmail, ScopePhone}
+
+// ErrInvalidGrant is returned for unknown, expired or used authorization codes,
+// and for token requests that do not match the authorization request.
+var ErrInvalidGrant = errors.New("invalid grant")
+
+// Error is an authorization error that is reported to the client by
+// redirecting back to it, e.g. error=invalid_scope.
+type Error struct {
+	Code        string
+	Description string
+}
+
+func (e *Error) Error() string {
+	return e.Code + ": " + e.Description
+}
+
+// AuthorizationRequest is a validated request to /oauth/authorize.
+type AuthorizationRequest struct {
+	ClientID      string
+	RedirectURI   string
+	Scope         string // Supported scopes only, space-separated
+	State         string
+	Nonce         string
+	CodeChallenge string
+}
+
+// ParseAuthorizationRequest reads an authorization request from query or form
+// values. The client and redirect URI must already have been checked, as errors
+// about them must not be redirected.
+func ParseAuthorizationRequest(values url.Values) (*AuthorizationRequest, error) {
+	req := &AuthorizationRequest{
+		ClientID:      values.Get("client_id"),
+		RedirectURI:   values.Get("redirect_uri"),
+		State:         values.Get("state"),
+		Nonce:         values.Get("nonce"),
+		CodeChallenge: values.Get("code_challenge"),
+	}
+	if responseType := values.Get("response_type"); responseType != "code" {
+		return req, &Error{Code: "unsupported_response_type", Description: "Only the code response type is supported"}
+	}
+	scopes, ok := ParseScope(values.Get("scope"))
+	if !ok {
+		return req, &Error{Code: "invalid_scope", Description: "The openid scope is required"}
+	}
+	req.Scope = strings.Join(scopes, " ")
+	if req.CodeChallenge == "" {
+		return req, &Error{Code: "invalid_request", Description: "PKCE is required: send code_challenge and code_challenge_method=S256"}
+	}
+	if values.Get("code_challenge_method") != "S256" || !validChallenge(req.CodeChallenge) {
+		return req, &Error{Code: "invalid_request", Description: "code_challenge must be an S256 challenge"}
+	}
+	if len(req.Nonce) > 255 {
+		return req, &Error{Code: "invalid_request", Description: "nonce is too long"}
+	}
+	return req, nil
+}
+
+// ParseScope returns the supported scopes among the space-separated requested
+// ones, without duplicates, and whether openid was requested. Unknown scopes are
+// ignored, as OpenID Connect asks providers to do.
+func ParseScope(scope string) ([]string, bool) {
+	requested := make(map[string]bool)
+	for _, s := range strings.Fields(scope) {
+		requested[s] = true
+	}
+	var scopes []string
+	for _, s := range SupportedScopes {
+		if requested[s] {
+			scopes = append(scopes, s)
+		}
+	}
+	return scopes, requested[ScopeOpenID]
+}
+
+// HasScope reports whether the space-separated scope includes s.
+func HasScope(scope, s string) bool {
+	for _, field := range strings.Fields(scope) {
+		if field == s {
+			return true
+		}
+	}
+	return false
+}
+
+// validChallenge reports whether challenge looks like a base64url encoded SHA-256 digest.
+func validChallenge(challenge string) bool {
+	b, err := base64.RawURLEncoding.DecodeString(challenge)
+	return err == nil && len(b) == sha256.Size
+}
+
+// VerifyPKCE reports whether verifier matches the S256 challenge of the
+// authorization request (RFC 7636).
+func VerifyPKCE(verifier, challenge string) bool {
+	if len(verifier) < 43 || len(verifier) > 128 {
+		return false
+	}
+	for _, c := range verifier {
+		if !(c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || strings.ContainsRune("-._~", c)) {
+			return false
+		}
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	computed := base64.RawURLEncoding.EncodeToString(sum[:])
+	return subtle.ConstantTimeCompare([]byte(computed), []byte(challenge)) == 1
+}
+
+// FormCookie is the cookie holding the browser's random secret that login form
+// tokens are derived from.
+const FormCookie = "oidc_form"
+
+// FormParams are the parameters of an authorization request that the login
+// form passes on and its token covers.
+var FormParams = []string{"client_id", "redirect_uri", "response_type", "scope", "state", "nonce", "code_challenge", "code_challenge_method"}
+
+// FormToken returns the token of the login form for the authorization request:
+// an HMAC of its FormParams keyed with the browser's secret from FormCookie. A
+// form posted from another site, which cannot read the cookie, or with other
+// parameters than it was shown for is rejected by VerifyFormToken.
+func FormToken(secret string, values url.Values) string {
+	params := url.Values{}
+	for _, name := range FormParams {
+		if v := values.Get(name); v != "" {
+			params.Set(name, v)
+		}
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(params.Encode()))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyFormToken reports whether token is the login form token for the
+// authorization request and the browser's secret.
+func VerifyFormToken(secret, token string, values url.Values) bool {
+	if secret == "" || token == "" {
+		return false
+	}
+	return hmac.Equal([]byte(token), []byte(FormToken(secret, values)))
+}
+
+// CodeTTL returns how long authorization codes stay valid, from OIDC_CODE_TTL (default 1 minute).
+func CodeTTL() time.Duration {
+	if ttl, err := time.ParseDuration(os.Getenv("OIDC_CODE_TTL")); err == nil && ttl > 0 {
+		return ttl
+	}
+	return time.Minute
+}
+
+// IssueCode stores a single-use authorization code for the user who just logged
+// in with the given authentication methods, and returns it.
+func IssueCode(ctx context.Context, db bun.IDB, req *AuthorizationRequest, userID int64, amr []string) (string, error) {
+	code, err := tokenstore.NewOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	authCode := &models.OIDCAuthorizationCode{
+		CodeHash:      tokenstore.HashToken(code),
+		ClientID:      req.ClientID,
+		UserID:        userID,
+		RedirectURI:   req.RedirectURI,
+		Scope:         req.Scope,
+		Nonce:         req.Nonce,
+		CodeChallenge: req.CodeChallenge,
+		AMR:           amr,
+		AuthTime:      now,
+		ExpiresAt:     now.Add(CodeTTL()),
+		CreatedAt:     now,
+	}
+	if _, err := db.NewInsert().Model(authCode).Exec(ctx); err != nil {
+		return "", err
+	}
+	return code, nil
+}
+
+// ConsumeCode uses up an authorization code and checks that the token request
+// comes from the client it was issued to, with the same redirect URI and the
+// PKCE verifier. A code is used up even if those checks fail, so it cannot be
+// guessed at.
+func ConsumeCode(ctx context.Context, db bun.IDB, code, clientID, redirectURI, verifier string) (*models.OIDCAuthorizationCode, error) {
+	now := time.Now()
+	authCode := &models.OIDCAuthorizationCode{}
+	err := db.NewUpdate().
+		Model(authCode).
+		Set("used_at = ?", now).
+		Where("code_hash = ?", tokenstore.HashToken(code)).
+		Where("used_at IS NULL").
+		Where("expires_at > ?", now).
+		Returning("*").
+		Scan(ctx)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrInvalidGrant
+		}
+		return nil, err
+	}
+	if authCode.ClientID != clientID || authCode.RedirectURI != redirectURI || !VerifyPKCE(verifier, authCode.CodeChallenge) {
+		return nil, ErrInvalidGrant
+	}
+	return authCode, nil
+}
+
+// PurgeExpired deletes authorization codes that have expired.
+func PurgeExpired(ctx context.Context, db bun.IDB) error {
+	_, err := db.NewDelete().Model((*models.OIDCAuthorizationCode)(nil)).Where("expires_at < ?", time.Now()).Exec(ctx)
+	return err
+}
+
+// IDTokenClaims are the claims of an ID token.
+type IDTokenClaims struct {
+	TokenUse string   `json:"token_use"` // auth.TokenUseID, so the token is not accepted as an access token
+	Nonce    string   `json:"nonce,omitempty"`
+	AuthTime int64    `json:"auth_time"`
+	AMR      []string `json:"amr,omitempty"`
+	dto.OIDCProfile
+	jwt.RegisteredClaims
+}
+
+// NewIDToken signs an ID token for the user the authorization code was issued for.
+func NewIDToken(user *models.User, authCode *models.OIDCAuthorizationCode) (string, error) {
+	now := time.Now()
+	return jwtutil.Sign(&IDTokenClaims{
+		TokenUse:    auth.TokenUseID,
+		Nonce:       authCode.Nonce,
+		AuthTime:    authCode.AuthTime.Unix(),
+		AMR:         authCode.AMR,
+		OIDCProfile: Profile(user, authCode.Scope),
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    jwtutil.Issuer(),
+			Subject:   Subject(user.UserID),
+			Audience:  jwt.ClaimStrings{authCode.ClientID},
+			ExpiresAt: jwt.NewNumericDate(now.Add(jwtutil.AccessTokenTTL())),
+			IssuedAt:  jwt.NewNumericDate(now),
+		},
+	})
+}
+
+// AccessTokenClaims returns the claims of the access token for the userinfo
+// endpoint. It is a service token of the client whose subject is the user, so
+// it carries none of the user's permissions and cannot act as the user anywhere else.
+func AccessTokenClaims(authCode *models.OIDCAuthorizationCode) *jwtutil.Claims {
+	return &jwtutil.Claims{
+		ClientID:         authCode.ClientID,
+		Scope:            authCode.Scope,
+		RegisteredClaims: jwt.RegisteredClaims{Subject: Subject(authCode.UserID)},
+	}
+}
+
+// UserID returns the user an access token from AccessTokenClaims was issued for.
+func UserID(claims *jwtutil.Claims) (int64, bool) {
+	if !claims.IsService() || !HasScope(claims.Scope, ScopeOpenID) {
+		return 0, false
+	}
+	userID, err := strconv.ParseInt(claims.Subject, 10, 64)
+	return userID, err == nil && userID > 0
+}
+
+// Subject returns the "sub" claim identifying a user to clients.
+func Subject(userID int64) string {
+	return strconv.FormatInt(userID, 10)
+}
+
+// Profile returns the claims about the user that the scope releases.
+func Profile(user *models.User, scope string) dto.OIDCProfile {
+	var profile dto.OIDCProfile
+	if HasScope(scope, ScopeProfile) {
+		profile.Name = user.Name
+		if !user.UpdatedAt.IsZero() {
+			profile.UpdatedAt = user.UpdatedAt.Unix()
+		}
+	}
+	if HasScope(scope, ScopeEmail) {
+		verified := !user.EmailVerifiedAt.IsZero()
+		profile.Email = user.Email
+		profile.EmailVerified = &verified
+	}
+	if HasScope(scope, ScopePhone) && user.PhoneNo != "" {
+		verified := false
+		profile.PhoneNumber = user.PhoneNo
+		profile.PhoneNumberVerified = &verified
+	}
+	return profile
+}
+
+// Discovery returns the discovery document for the given issuer, which must be
+// the public base URL of the service.
+func Discovery(issuer string, signingAlgorithms []string) *dto.OIDCDiscovery {
+	base := strings.TrimSuffix(issuer, "/")
+	return &dto.OIDCDiscovery{
+		Issuer:                            issuer,
+		AuthorizationEndpoint:             base + "/oauth/authorize",
+		TokenEndpoint:                     base + "/oauth/token",
+		UserinfoEndpoint:                  base + "/oauth/userinfo",
+		JWKSURI:                           base + "/.well-known/jwks.json",
+		ScopesSupported:                   SupportedScopes,
+		ResponseTypesSupported:            []string{"code"},
+		GrantTypesSupported:               []string{"authorization_code", "client_credentials"},
+		SubjectTypesSupported:             []string{"public"},
+		IDTokenSigningAlgValuesSupported:  signingAlgorithms,
+		TokenEndpointAuthMethodsSupported: []string{"client_secret_basic", "client_secret_post", "none"},
+		CodeChallengeMethodsSupported:     []string{"S256"},
+		ClaimsSupported: []string{
+			"sub", "iss", "aud", "exp", "iat", "auth_time", "nonce", "amr",
+			"name", "updated_at", "email", "email_verified", "phone_number", "phone_number_verified",
+		},
+	}
+}
@@ -0,0 +1,115 @@
+package oidc
+
+import (
+	"errors"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+// From RFC 7636 appendix B.
+const (
+	verifier  = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	challenge = "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+)
+
+func TestVerifyPKCE(t *testing.T) {
+	if !VerifyPKCE(verifier, challenge) {
+		t.Error("VerifyPKCE rejected the RFC 7636 example")
+	}
+	if VerifyPKCE(verifier[:42], challenge) {
+		t.Error("VerifyPKCE accepted a short verifier")
+	}
+	if VerifyPKCE(verifier+"!", challenge) {
+		t.Error("VerifyPKCE accepted a verifier with an invalid character")
+	}
+	if VerifyPKCE(challenge, challenge) {
+		t.Error("VerifyPKCE accepted the challenge as verifier")
+	}
+}
+
+func TestParseScope(t *testing.T) {
+	scopes, ok := ParseScope("email openid  email offline_access profile")
+	if !ok || !reflect.DeepEqual(scopes, []string{"openid", "profile", "email"}) {
+		t.Errorf("ParseScope() = %v, %v", scopes, ok)
+	}
+	if _, ok := ParseScope("profile email"); ok {
+		t.Error("ParseScope accepted a scope without openid")
+	}
+}
+
+func TestParseAuthorizationRequest(t *testing.T) {
+	valid := url.Values{
+		"client_id":             {"svc_1"},
+		"redirect_uri":          {"https://app.example.com/callback"},
+		"response_type":         {"code"},
+		"scope":                 {"openid email"},
+		"state":                 {"xyz"},
+		"code_challenge":        {challenge},
+		"code_challenge_method": {"S256"},
+	}
+	req, err := ParseAuthorizationRequest(valid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.Scope != "openid email" || req.State != "xyz" || req.CodeChallenge != challenge {
+		t.Errorf("ParseAuthorizationRequest() = %+v", req)
+	}
+
+	tests := []struct {
+		name, param, value, code string
+	}{
+		{"token response type", "response_type", "token", "unsupported_response_type"},
+		{"no openid", "scope", "email", "invalid_scope"},
+		{"no PKCE", "code_challenge", "", "invalid_request"},
+		{"plain PKCE", "code_challenge_method", "plain", "invalid_request"},
+		{"malformed challenge", "code_challenge", "abc", "invalid_request"},
+	}
+	for _, tt := range tests {
+		values := url.Values{}
+		for k, v := range valid {
+			values[k] = v
+		}
+		values.Set(tt.param, tt.value)
+		req, err := ParseAuthorizationRequest(values)
+		var oidcErr *Error
+		if !errors.As(err, &oidcErr) || oidcErr.Code != tt.code {
+			t.Errorf("%s: got %v, want %s", tt.name, err, tt.code)
+		}
+		if req.State != "xyz" {
+			t.Errorf("%s: state not kept for the error redirect", tt.name)
+		}
+	}
+}
+
+func TestDiscovery(t *testing.T) {
+	doc := Discovery("https://accounts.example.com/", []string{"RS256"})
+	if doc.Issuer != "https://accounts.example.com/" {
+		t.Errorf("issuer = %q", doc.Issuer)
+	}
+	if doc.TokenEndpoint != "https://accounts.example.com/oauth/token" || doc.JWKSURI != "https://accounts.example.com/.well-known/jwks.json" {
+		t.Errorf("endpoints = %q, %q", doc.TokenEndpoint, doc.JWKSURI)
+	}
+}
+
+func TestVerifyFormToken(t *testing.T) {
+	values := url.Values{"client_id": {"app"}, "redirect_uri": {"https://app.example.com/cb"}, "state": {"xyz"}, "email": {"a@example.com"}}
+	token := FormToken("secret", values)
+	if !VerifyFormToken("secret", token, values) {
+		t.Error("VerifyFormToken rejected the token of the form")
+	}
+	if VerifyFormToken("other", token, values) {
+		t.Error("VerifyFormToken accepted the token with another browser's secret")
+	}
+	changed := url.Values{"client_id": {"app"}, "redirect_uri": {"https://evil.example.com/cb"}, "state": {"xyz"}}
+	if VerifyFormToken("secret", token, changed) {
+		t.Error("VerifyFormToken accepted the token for another redirect URI")
+	}
+	values.Set("email", "b@example.com")
+	if !VerifyFormToken("secret", token, values) {
+		t.Error("VerifyFormToken rejected the token after a change to the credentials")
+	}
+	if VerifyFormToken("", FormToken("", values), values) {
+		t.Error("VerifyFormToken accepted a token without a secret")
+	}
+}
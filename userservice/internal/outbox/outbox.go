@@ -0,0 +1,122 @@
+// Package outbox makes event publishing reliable. Events are written to the
+// outbox_events table in the same transaction as the change they describe, and
+// a relay publishes them to Kafka afterwards. An event is therefore never lost
+// when Kafka is down, and never emitted for a change that was rolled back.
+// Delivery is at least once, so consumers must tolerate duplicates.
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"os"
+	"time"
+
+	"github.com/hari134/pratilipi/pkg/messaging"
+	"github.com/hari134/pratilipi/userservice/models"
+	"github.com/uptrace/bun"
+)
+
+// batchSize is the number of events published per poll.
+const batchSize = 100
+
+// Enqueue stores event for publication on topic. Pass the transaction that
+// performs the change so both commit or roll back together.
+func Enqueue(ctx context.Context, db bun.IDB, topic string, event interface{}) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	_, err = db.NewInsert().
+		Model(&models.OutboxEvent{Topic: topic, Payload: string(payload)}).
+		Exec(ctx)
+	return err
+}
+
+// PollInterval reads OUTBOX_POLL_INTERVAL (default 1s).
+func PollInterval() time.Duration {
+	if d, err := time.ParseDuration(os.Getenv("OUTBOX_POLL_INTERVAL")); err == nil && d > 0 {
+		return d
+	}
+	return time.Second
+}
+
+// Relay publishes stored events in the order they were written.
+type Relay struct {
+	DB       *bun.DB
+	Producer messaging.Producer
+}
+
+// Run publishes pending events every interval until ctx is cancelled.
+func (r *Relay) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if _, err := r.PublishPending(ctx); err != nil {
+			log.Printf("Failed to publish outbox events: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// PublishPending publishes up to one batch of unpublished events and returns
+// how many were published. It stops at the first failure so events are never
+// published out of order; the failed event is retried on the next poll. Rows
+// are locked, so several instances can run a relay at the same time.
+func (r *Relay) PublishPending(ctx context.Context) (int, error) {
+	published := 0
+	err := r.DB.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		var events []models.OutboxEvent
+		err := tx.NewSelect().
+			Model(&events).
+			Where("published_at IS NULL").
+			OrderExpr("id").
+			Limit(batchSize).
+			For("UPDATE SKIP LOCKED").
+			Scan(ctx)
+		if err != nil {
+			return err
+		}
+
+		for _, event := range events {
+			// Emit the raw JSON like the ProducerManager does, so consumers see the same format
+			if emitErr := r.Producer.Emit(event.Topic, []byte(event.Payload)); emitErr != nil {
+				_, err := tx.NewUpdate().
+					Model((*models.OutboxEvent)(nil)).
+					Set("attempts = attempts + 1").
+					Set("last_error = ?", emitErr.Error()).
+					Where("id = ?", event.ID).
+					Exec(ctx)
+				if err != nil {
+					return err
+				}
+				log.Printf("Failed to publish outbox event %d to %s: %v", event.ID, event.Topic, emitErr)
+				return nil
+			}
+			_, err := tx.NewUpdate().
+				Model((*models.OutboxEvent)(nil)).
+				Set("published_at = ?", time.Now()).
+				Where("id = ?", event.ID).
+				Exec(ctx)
+			if err != nil {
+				return err
+			}
+			published++
+		}
+		return nil
+	})
+	return published, err
+}
+
+// PurgePublished deletes events published more than retention ago.
+func PurgePublished(ctx context.Context, db bun.IDB, retention time.Duration) error {
+	_, err := db.NewDelete().
+		Model((*models.OutboxEvent)(nil)).
+		Where("published_at < ?", time.Now().Add(-retention)).
+		Exec(ctx)
+	return err
+}
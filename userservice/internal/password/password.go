@@ -0,0 +1,117 @@
+// Package password hashes and verifies user passwords. New hashes use the
+// configured algorithm (argon2id by default); hashes of other supported
+// algorithms still verify and are reported for rehashing, so stored hashes
+// are upgraded as users log in.
+package password
+
+import (
+	"errors"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+)
+
+// ErrUnknownHash is returned for a stored hash no supported algorithm recognizes.
+var ErrUnknownHash = errors.New("unknown password hash format")
+
+// Hasher is one password hashing algorithm.
+type Hasher interface {
+	// Hash returns the encoded hash of password, including salt and parameters.
+	Hash(password string) (string, error)
+	// Verify reports whether password matches an encoded hash of this algorithm.
+	Verify(password, encoded string) (bool, error)
+	// Recognizes reports whether encoded was produced by this algorithm.
+	Recognizes(encoded string) bool
+	// NeedsRehash reports whether encoded uses weaker parameters than Hash would.
+	NeedsRehash(encoded string) bool
+}
+
+// Manager hashes with its current hasher and verifies hashes of any of its hashers.
+type Manager struct {
+	Current Hasher
+	Legacy  []Hasher // Algorithms that are still verified but no longer used for new hashes
+}
+
+// Hash hashes password with the current hasher.
+func (m *Manager) Hash(password string) (string, error) {
+	return m.Current.Hash(password)
+}
+
+// Verify checks password against a stored hash. rehash is set when the password
+// matched but the hash uses another algorithm or weaker parameters than the
+// current hasher, in which case the caller should store a new Hash.
+func (m *Manager) Verify(password, encoded string) (ok, rehash bool, err error) {
+	for _, h := range append([]Hasher{m.Current}, m.Legacy...) {
+		if !h.Recognizes(encoded) {
+			continue
+		}
+		ok, err := h.Verify(password, encoded)
+		if err != nil || !ok {
+			return false, false, err
+		}
+		return true, h != m.Current || h.NeedsRehash(encoded), nil
+	}
+	return false, false, ErrUnknownHash
+}
+
+var (
+	defaultOnce    sync.Once
+	defaultManager *Manager
+	dummyHash      string
+)
+
+// Default returns the Manager configured from the environment:
+//
+//	PASSWORD_HASH_ALGORITHM  argon2id (default) or bcrypt
+//	ARGON2_MEMORY_KIB        argon2id memory in KiB (default 19456)
+//	ARGON2_ITERATIONS        argon2id passes (default 2)
+//	ARGON2_PARALLELISM       argon2id lanes (default 1)
+//	BCRYPT_COST              bcrypt cost (default 12)
+func Default() *Manager {
+	defaultOnce.Do(func() {
+		argon := &Argon2id{
+			Memory:      uint32(envInt("ARGON2_MEMORY_KIB", 19456)),
+			Iterations:  uint32(envInt("ARGON2_ITERATIONS", 2)),
+			Parallelism: uint8(envInt("ARGON2_PARALLELISM", 1)),
+			SaltLength:  16,
+			KeyLength:   32,
+		}
+		bc := &Bcrypt{Cost: envInt("BCRYPT_COST", 12)}
+
+		defaultManager = &Manager{Current: argon, Legacy: []Hasher{bc}}
+		if os.Getenv("PASSWORD_HASH_ALGORITHM") == "bcrypt" {
+			defaultManager = &Manager{Current: bc, Legacy: []Hasher{argon}}
+		}
+
+		var err error
+		if dummyHash, err = defaultManager.Hash("not a real password"); err != nil {
+			log.Fatalf("Failed to hash the dummy password: %v", err)
+		}
+	})
+	return defaultManager
+}
+
+// Hash hashes password with the default Manager.
+func Hash(password string) (string, error) {
+	return Default().Hash(password)
+}
+
+// Verify checks password against a stored hash with the default Manager.
+func Verify(password, encoded string) (ok, rehash bool, err error) {
+	return Default().Verify(password, encoded)
+}
+
+// DummyHash is a hash of the current algorithm to verify against when a user
+// does not exist, so that the response time does not reveal registered emails.
+func DummyHash() string {
+	Default()
+	return dummyHash
+}
+
+func envInt(name string, def int) int {
+	if v, err := strconv.Atoi(os.Getenv(name)); err == nil && v > 0 {
+		return v
+	}
+	return def
+}
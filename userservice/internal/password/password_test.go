@@ -0,0 +1,71 @@
+package password
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func testManager() *Manager {
+	return &Manager{
+		Current: &Argon2id{Memory: 64, Iterations: 2, Parallelism: 1, SaltLength: 16, KeyLength: 32},
+		Legacy:  []Hasher{&Bcrypt{Cost: 5}},
+	}
+}
+
+func TestHashAndVerify(t *testing.T) {
+	m := testManager()
+	hash, err := m.Hash("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(hash, "$argon2id$v=19$m=64,t=2,p=1$") {
+		t.Fatalf("unexpected hash format %q", hash)
+	}
+
+	ok, rehash, err := m.Verify("correct horse", hash)
+	if err != nil || !ok || rehash {
+		t.Fatalf("Verify(correct) = %v, %v, %v; want true, false, nil", ok, rehash, err)
+	}
+	ok, _, err = m.Verify("wrong horse", hash)
+	if err != nil || ok {
+		t.Fatalf("Verify(wrong) = %v, %v; want false, nil", ok, err)
+	}
+}
+
+func TestVerifyRehash(t *testing.T) {
+	m := testManager()
+
+	legacy, err := (&Bcrypt{Cost: 4}).Hash("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ok, rehash, err := m.Verify("correct horse", legacy)
+	if err != nil || !ok || !rehash {
+		t.Fatalf("Verify(bcrypt) = %v, %v, %v; want true, true, nil", ok, rehash, err)
+	}
+	if ok, rehash, _ := m.Verify("wrong horse", legacy); ok || rehash {
+		t.Fatalf("Verify(bcrypt, wrong) = %v, %v; want false, false", ok, rehash)
+	}
+
+	weak, err := (&Argon2id{Memory: 32, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}).Hash("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok, rehash, err := m.Verify("correct horse", weak); err != nil || !ok || !rehash {
+		t.Fatalf("Verify(weak argon2id) = %v, %v, %v; want true, true, nil", ok, rehash, err)
+	}
+}
+
+func TestVerifyUnknownHash(t *testing.T) {
+	m := testManager()
+	for _, encoded := range []string{"", "plaintext", "$argon2id$v=19$m=64,t=2,p=1$bad"} {
+		ok, _, err := m.Verify("correct horse", encoded)
+		if ok || err == nil {
+			t.Errorf("Verify(%q) = %v, %v; want false and an error", encoded, ok, err)
+		}
+	}
+	if _, _, err := m.Verify("x", ""); !errors.Is(err, ErrUnknownHash) {
+		t.Errorf("Verify(\"\") error = %v, want ErrUnknownHash", err)
+	}
+}
@@ -0,0 +1,87 @@
+// Package privacy exports and erases a user's personal data across services.
+package privacy
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/hari134/pratilipi/pkg/messaging"
+	"github.com/hari134/pratilipi/userservice/internal/auditlog"
+	"github.com/hari134/pratilipi/userservice/internal/outbox"
+	"github.com/hari134/pratilipi/userservice/models"
+	"github.com/uptrace/bun"
+)
+
+// Permission allows exporting and erasing any user's personal data.
+const Permission = "user:privacy"
+
+// ErasedName replaces the name of an erased user.
+const ErasedName = "Deleted user"
+
+// ErasedEmail is the placeholder address an erased user keeps, since email is unique and required.
+func ErasedEmail(userID int64) string {
+	return fmt.Sprintf("erased-%d@invalid", userID)
+}
+
+// Erase anonymizes the user, rejects every access token issued to them so far,
+// deletes their refresh tokens, sessions, recovery codes, roles and addresses,
+// and clears the IP and user agent from the audit log entries of their requests. The row itself is kept, soft-deleted, so audit columns
+// and orders elsewhere still refer to a user. A UserErased event is stored in
+// the outbox so other services anonymize their copies; run Erase in a
+// transaction. It returns the user as it was before erasure, or sql.ErrNoRows
+// if there is no such user.
+func Erase(ctx context.Context, tx bun.Tx, userID, erasedBy int64) (*models.User, error) {
+	var user models.User
+	if err := tx.NewSelect().Model(&user).Where("user_id = ?", userID).For("UPDATE").Scan(ctx); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	_, err := tx.NewUpdate().
+		Model((*models.User)(nil)).
+		Set("name = ?", ErasedName).
+		Set("email = ?", ErasedEmail(userID)).
+		Set("phone_no = ''").
+		Set("password_hash = ''").
+		Set("email_verified_at = NULL").
+		Set("totp_secret = NULL").
+		Set("totp_enabled_at = NULL").
+		Set("totp_last_counter = NULL").
+		Set("tokens_valid_after = ?", now).
+		Set("updated_at = ?", now).
+		Set("updated_by = ?", erasedBy).
+		Set("deleted_at = ?", now).
+		Where("user_id = ?", userID).
+		Exec(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, model := range []interface{}{
+		(*models.RefreshToken)(nil),
+		(*models.Session)(nil),
+		(*models.UserToken)(nil),
+		(*models.RecoveryCode)(nil),
+		(*models.UserRole)(nil),
+		(*models.Address)(nil),
+	} {
+		if _, err := tx.NewDelete().Model(model).Where("user_id = ?", userID).Exec(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := auditlog.Scrub(ctx, tx, userID); err != nil {
+		return nil, err
+	}
+
+	err = outbox.Enqueue(ctx, tx, "user-erased", &messaging.UserErased{
+		UserID:   strconv.FormatInt(userID, 10),
+		ErasedAt: now,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
@@ -0,0 +1,218 @@
+package privacy
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/hari134/pratilipi/userservice/internal/jwtutil"
+	"github.com/hari134/pratilipi/userservice/internal/rbac"
+	"github.com/hari134/pratilipi/userservice/models"
+	"github.com/uptrace/bun"
+)
+
+// Source is another service holding personal data. It is asked for a user's
+// data at URL, where %d is replaced by the user ID, and must answer with JSON.
+type Source struct {
+	Name string
+	URL  string
+}
+
+// SourcesFromEnv returns the services that hold personal data. ORDER_SERVICE_URL
+// defaults to http://orderservice:8080. The Product Service only stores user IDs
+// in its audit columns, so it is not asked.
+func SourcesFromEnv() []Source {
+	orderServiceURL := os.Getenv("ORDER_SERVICE_URL")
+	if orderServiceURL == "" {
+		orderServiceURL = "http://orderservice:8080"
+	}
+	return []Source{
+		{Name: "orderservice", URL: orderServiceURL + "/users/%d/personal-data"},
+	}
+}
+
+// Profile is the exported part of a user row. Password and TOTP secrets are left out.
+type Profile struct {
+	UserID             int64      `json:"user_id"`
+	Name               string     `json:"name"`
+	Email              string     `json:"email"`
+	PhoneNo            string     `json:"phone_no"`
+	CreatedAt          time.Time  `json:"created_at"`
+	UpdatedAt          time.Time  `json:"updated_at"`
+	EmailVerifiedAt    *time.Time `json:"email_verified_at"`
+	TwoFactorEnabledAt *time.Time `json:"two_factor_enabled_at"`
+}
+
+// Session is an exported login session.
+type Session struct {
+	SessionID  string     `json:"session_id"`
+	DeviceName string     `json:"device_name"`
+	UserAgent  string     `json:"user_agent"`
+	IP         string     `json:"ip"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastSeenAt time.Time  `json:"last_seen_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+}
+
+// Manifest describes an export archive.
+type Manifest struct {
+	UserID      int64     `json:"user_id"`
+	GeneratedAt time.Time `json:"generated_at"`
+	Files       []string  `json:"files"`
+}
+
+// Exporter collects everything held about a user into a zip archive.
+type Exporter struct {
+	DB         bun.IDB
+	Sources    []Source
+	HTTPClient *http.Client
+}
+
+// Export returns a zip archive with the user's data from this service and from
+// every source. It fails if any source cannot be reached, rather than returning
+// an incomplete archive. It returns sql.ErrNoRows if there is no such user.
+func (e *Exporter) Export(ctx context.Context, userID int64) ([]byte, error) {
+	var user models.User
+	if err := e.DB.NewSelect().Model(&user).Where("user_id = ?", userID).Scan(ctx); err != nil {
+		return nil, err
+	}
+	roles, err := rbac.UserRoles(ctx, e.DB, userID)
+	if err != nil {
+		return nil, err
+	}
+	var userSessions []models.Session
+	if err := e.DB.NewSelect().Model(&userSessions).Where("user_id = ?", userID).Order("created_at").Scan(ctx); err != nil {
+		return nil, err
+	}
+	addressBook := []models.Address{}
+	if err := e.DB.NewSelect().Model(&addressBook).Where("user_id = ?", userID).Order("address_id").Scan(ctx); err != nil {
+		return nil, err
+	}
+	sessions := make([]Session, len(userSessions))
+	for i, us := range userSessions {
+		sessions[i] = Session{
+			SessionID:  us.SessionID,
+			DeviceName: us.DeviceName,
+			UserAgent:  us.UserAgent,
+			IP:         us.IP,
+			CreatedAt:  us.CreatedAt,
+			LastSeenAt: us.LastSeenAt,
+			RevokedAt:  optional(us.RevokedAt),
+		}
+	}
+
+	files := map[string]interface{}{
+		"userservice/profile.json": Profile{
+			UserID:             user.UserID,
+			Name:               user.Name,
+			Email:              user.Email,
+			PhoneNo:            user.PhoneNo,
+			CreatedAt:          user.CreatedAt,
+			UpdatedAt:          user.UpdatedAt,
+			EmailVerifiedAt:    optional(user.EmailVerifiedAt),
+			TwoFactorEnabledAt: optional(user.TOTPEnabledAt),
+		},
+		"userservice/roles.json":     roles,
+		"userservice/sessions.json":  sessions,
+		"userservice/addresses.json": addressBook,
+	}
+	order := []string{"userservice/profile.json", "userservice/roles.json", "userservice/sessions.json", "userservice/addresses.json"}
+
+	if len(e.Sources) > 0 {
+		token, err := serviceToken()
+		if err != nil {
+			return nil, err
+		}
+		for _, source := range e.Sources {
+			data, err := e.fetch(ctx, source, userID, token)
+			if err != nil {
+				return nil, fmt.Errorf("failed to export from %s: %w", source.Name, err)
+			}
+			name := source.Name + "/personal-data.json"
+			files[name] = data
+			order = append(order, name)
+		}
+	}
+
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	write := func(name string, v interface{}) error {
+		f, err := archive.Create(name)
+		if err != nil {
+			return err
+		}
+		enc := json.NewEncoder(f)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	}
+	if err := write("manifest.json", Manifest{UserID: userID, GeneratedAt: time.Now(), Files: order}); err != nil {
+		return nil, err
+	}
+	for _, name := range order {
+		if err := write(name, files[name]); err != nil {
+			return nil, err
+		}
+	}
+	if err := archive.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// fetch asks a source for the user's data.
+func (e *Exporter) fetch(ctx context.Context, source Source, userID int64, token string) (json.RawMessage, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf(source.URL, userID), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	client := e.HTTPClient
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s returned %s", source.Name, resp.Status)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if !json.Valid(body) {
+		return nil, fmt.Errorf("%s returned invalid JSON", source.Name)
+	}
+	return body, nil
+}
+
+// optional returns nil for a zero time, which is exported as null.
+func optional(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+// serviceToken signs a short-lived token that lets this service read personal
+// data from the other services. As the token issuer, the User Service needs no
+// API client of its own for this: its keys are asymmetric and published in the
+// JWKS, so the other services verify the token like any other.
+func serviceToken() (string, error) {
+	return jwtutil.GenerateJWTToken(&jwtutil.Claims{
+		ClientID:         "userservice",
+		Scope:            Permission,
+		RegisteredClaims: jwt.RegisteredClaims{Subject: "client:userservice"},
+	})
+}
@@ -0,0 +1,129 @@
+// Package rbac loads and assigns the roles and permissions embedded in access tokens.
+package rbac
+
+import (
+	"context"
+	"errors"
+	"os"
+
+	"github.com/hari134/pratilipi/userservice/models"
+	"github.com/uptrace/bun"
+)
+
+// DefaultRole is assigned to every self-registered user.
+const DefaultRole = "user"
+
+// ErrUnknownRole is returned when assigning a role that does not exist.
+var ErrUnknownRole = errors.New("unknown role")
+
+// UserRoles returns the names of the roles held by the user.
+func UserRoles(ctx context.Context, db bun.IDB, userID int64) ([]string, error) {
+	roles := []string{}
+	err := db.NewSelect().
+		Model((*models.Role)(nil)).
+		Column("r.name").
+		Join("JOIN user_roles AS ur ON ur.role_id = r.role_id").
+		Where("ur.user_id = ?", userID).
+		Order("r.name").
+		Scan(ctx, &roles)
+	return roles, err
+}
+
+// UserPermissions returns the distinct permissions granted to the user through
+// their roles. Without includePrivileged, only non-privileged roles count.
+func UserPermissions(ctx context.Context, db bun.IDB, userID int64, includePrivileged bool) ([]string, error) {
+	permissions := []string{}
+	q := db.NewSelect().
+		Model((*models.Permission)(nil)).
+		Distinct().
+		Column("p.name").
+		Join("JOIN role_permissions AS rp ON rp.permission_id = p.permission_id").
+		Join("JOIN user_roles AS ur ON ur.role_id = rp.role_id").
+		Where("ur.user_id = ?", userID).
+		Order("p.name")
+	if !includePrivileged {
+		q = q.Join("JOIN roles AS r ON r.role_id = rp.role_id").Where("NOT r.privileged")
+	}
+	err := q.Scan(ctx, &permissions)
+	return permissions, err
+}
+
+// RolePermissions returns the permission names granted by each role, keyed by role ID.
+func RolePermissions(ctx context.Context, db bun.IDB) (map[int64][]string, error) {
+	var rows []struct {
+		RoleID int64  `bun:"role_id"`
+		Name   string `bun:"name"`
+	}
+	err := db.NewSelect().
+		Model((*models.Permission)(nil)).
+		Column("rp.role_id", "p.name").
+		Join("JOIN role_permissions AS rp ON rp.permission_id = p.permission_id").
+		Order("p.name").
+		Scan(ctx, &rows)
+	if err != nil {
+		return nil, err
+	}
+	permissions := make(map[int64][]string)
+	for _, row := range rows {
+		permissions[row.RoleID] = append(permissions[row.RoleID], row.Name)
+	}
+	return permissions, nil
+}
+
+// SetRoles replaces the user's roles with the named ones. assignedBy is the admin
+// making the change, or 0 for roles assigned by the system. Call it inside a
+// transaction so the user is never left without roles on failure.
+func SetRoles(ctx context.Context, db bun.IDB, userID int64, roleNames []string, assignedBy int64) error {
+	var roles []models.Role
+	if len(roleNames) > 0 {
+		if err := db.NewSelect().Model(&roles).Where("name IN (?)", bun.In(roleNames)).Scan(ctx); err != nil {
+			return err
+		}
+	}
+	if len(roles) != len(unique(roleNames)) {
+		return ErrUnknownRole
+	}
+
+	if _, err := db.NewDelete().Model((*models.UserRole)(nil)).Where("user_id = ?", userID).Exec(ctx); err != nil {
+		return err
+	}
+	if len(roles) == 0 {
+		return nil
+	}
+	userRoles := make([]models.UserRole, len(roles))
+	for i, role := range roles {
+		userRoles[i] = models.UserRole{UserID: userID, RoleID: role.RoleID, AssignedBy: assignedBy}
+	}
+	_, err := db.NewInsert().Model(&userRoles).Exec(ctx)
+	return err
+}
+
+// AssignDefaultRole gives a newly registered user the non-privileged default role.
+func AssignDefaultRole(ctx context.Context, db bun.IDB, userID int64) error {
+	return SetRoles(ctx, db, userID, []string{DefaultRole}, 0)
+}
+
+// EnsureBootstrapAdmin grants the admin role to the user whose email is in
+// BOOTSTRAP_ADMIN_EMAIL. Registration never assigns privileged roles, so this is
+// how the first admin is created. It does nothing if the variable is unset or
+// the user has not registered yet.
+func EnsureBootstrapAdmin(ctx context.Context, db bun.IDB) error {
+	email := os.Getenv("BOOTSTRAP_ADMIN_EMAIL")
+	if email == "" {
+		return nil
+	}
+	_, err := db.NewRaw(`
+		INSERT INTO user_roles (user_id, role_id)
+		SELECT u.user_id, r.role_id FROM users u, roles r
+		WHERE LOWER(u.email) = LOWER(?) AND u.deleted_at IS NULL AND r.name = 'admin'
+		ON CONFLICT DO NOTHING`, email).Exec(ctx)
+	return err
+}
+
+func unique(names []string) map[string]struct{} {
+	set := make(map[string]struct{}, len(names))
+	for _, name := range names {
+		set[name] = struct{}{}
+	}
+	return set
+}
@@ -0,0 +1,170 @@
+package tokenstore
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/hari134/pratilipi/userservice/models"
+	"github.com/uptrace/bun"
+)
+
+// ErrSessionNotFound is returned when revoking a session the user does not have.
+var ErrSessionNotFound = errors.New("session not found")
+
+// maxDeviceNameLength matches the sessions.device_name column, in characters.
+const maxDeviceNameLength = 100
+
+// Client describes where a session is used from.
+type Client struct {
+	DeviceName string // Chosen by the client at login; derived from UserAgent when empty
+	UserAgent  string
+	IP         string
+}
+
+// TouchSession records a login or refresh in the session with the given refresh
+// token family ID, creating the session on its first login.
+func TouchSession(ctx context.Context, db bun.IDB, userID int64, sessionID string, client Client) error {
+	deviceName := strings.TrimSpace(client.DeviceName)
+	if deviceName == "" {
+		deviceName = DeviceName(client.UserAgent)
+	}
+	deviceName = truncate(deviceName, maxDeviceNameLength)
+
+	now := time.Now()
+	session := &models.Session{
+		SessionID:  sessionID,
+		UserID:     userID,
+		DeviceName: deviceName,
+		UserAgent:  client.UserAgent,
+		IP:         client.IP,
+		CreatedAt:  now,
+		LastSeenAt: now,
+	}
+	_, err := db.NewInsert().
+		Model(session).
+		On("CONFLICT (session_id) DO UPDATE").
+		Set("last_seen_at = EXCLUDED.last_seen_at").
+		Set("ip = EXCLUDED.ip").
+		Exec(ctx)
+	return err
+}
+
+// truncate cuts s to at most n characters, never splitting one.
+func truncate(s string, n int) string {
+	for i := range s {
+		if n == 0 {
+			return s[:i]
+		}
+		n--
+	}
+	return s
+}
+
+// ActiveSessions returns the user's sessions that have not ended, most recently used first.
+func ActiveSessions(ctx context.Context, db bun.IDB, userID int64) ([]models.Session, error) {
+	sessions := []models.Session{}
+	err := db.NewSelect().
+		Model(&sessions).
+		Where("user_id = ?", userID).
+		Where("revoked_at IS NULL").
+		Where("last_seen_at > ?", time.Now().Add(-RefreshTokenTTL())).
+		Order("last_seen_at DESC").
+		Scan(ctx)
+	return sessions, err
+}
+
+// RevokeSession ends one of the user's sessions. Its refresh tokens stop working
+// and its access tokens are rejected.
+func RevokeSession(ctx context.Context, db bun.IDB, userID int64, sessionID string) error {
+	err := db.NewSelect().
+		Model((*models.Session)(nil)).
+		Column("session_id").
+		Where("session_id = ?", sessionID).
+		Where("user_id = ?", userID).
+		Where("revoked_at IS NULL").
+		Scan(ctx, new(string))
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrSessionNotFound
+	}
+	if err != nil {
+		return err
+	}
+	return RevokeFamily(ctx, db, sessionID)
+}
+
+// RevokeOtherSessions ends every session of the user except keepSessionID and
+// returns how many were ended.
+func RevokeOtherSessions(ctx context.Context, db bun.IDB, userID int64, keepSessionID string) (int, error) {
+	now := time.Now()
+	_, err := db.NewUpdate().
+		Model((*models.RefreshToken)(nil)).
+		Set("revoked_at = ?", now).
+		Where("user_id = ?", userID).
+		Where("family_id != ?", keepSessionID).
+		Where("revoked_at IS NULL").
+		Exec(ctx)
+	if err != nil {
+		return 0, err
+	}
+	res, err := db.NewUpdate().
+		Model((*models.Session)(nil)).
+		Set("revoked_at = ?", now).
+		Where("user_id = ?", userID).
+		Where("session_id != ?", keepSessionID).
+		Where("revoked_at IS NULL").
+		Exec(ctx)
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	return int(n), err
+}
+
+// DeviceName derives a readable device name such as "Firefox on Windows" from a
+// User-Agent header.
+func DeviceName(userAgent string) string {
+	var browser, os string
+	for _, b := range []struct{ token, name string }{
+		{"Edg/", "Edge"},
+		{"OPR/", "Opera"},
+		{"Firefox/", "Firefox"},
+		{"Chrome/", "Chrome"},
+		{"Safari/", "Safari"},
+	} {
+		if strings.Contains(userAgent, b.token) {
+			browser = b.name
+			break
+		}
+	}
+	for _, o := range []struct{ token, name string }{
+		{"Android", "Android"},
+		{"iPhone", "iOS"},
+		{"iPad", "iPadOS"},
+		{"CrOS", "ChromeOS"},
+		{"Windows", "Windows"},
+		{"Mac OS X", "macOS"},
+		{"Linux", "Linux"},
+	} {
+		if strings.Contains(userAgent, o.token) {
+			os = o.name
+			break
+		}
+	}
+
+	switch {
+	case browser != "" && os != "":
+		return browser + " on " + os
+	case browser != "":
+		return browser
+	case os != "":
+		return os
+	}
+	// Non-browser clients such as "curl/8.4.0" are named after their first product
+	if product, _, _ := strings.Cut(strings.TrimSpace(userAgent), "/"); product != "" && !strings.ContainsAny(product, " (") {
+		return product
+	}
+	return "Unknown device"
+}
@@ -0,0 +1,399 @@
+// Package tokenstore persists refresh tokens, the sessions they belong to, the
+// access token revocation list and the single-use tokens behind email
+// verification and password reset.
+package tokenstore
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"log"
+	"os"
+	"time"
+
+	"github.com/hari134/pratilipi/pkg/auth"
+	"github.com/hari134/pratilipi/userservice/models"
+	"github.com/uptrace/bun"
+)
+
+var (
+	// ErrInvalidRefreshToken is returned for unknown or expired refresh tokens.
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	// ErrRefreshTokenReused is returned when an already used or revoked token is
+	// presented again; the token's whole family has been revoked by then.
+	ErrRefreshTokenReused = errors.New("refresh token reuse detected")
+	// ErrInvalidUserToken is returned for unknown, expired or already used
+	// verification and password reset tokens.
+	ErrInvalidUserToken = errors.New("invalid or expired token")
+)
+
+// RefreshTokenTTL returns how long refresh tokens stay valid, from REFRESH_TOKEN_TTL (default 30 days).
+func RefreshTokenTTL() time.Duration {
+	if ttl, err := time.ParseDuration(os.Getenv("REFRESH_TOKEN_TTL")); err == nil && ttl > 0 {
+		return ttl
+	}
+	return 30 * 24 * time.Hour
+}
+
+// NewFamilyID returns a random ID for a new refresh token family.
+func NewFamilyID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// HashToken returns the SHA-256 hex digest under which an opaque token is stored.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// NewOpaqueToken returns a random URL-safe token with 256 bits of entropy.
+func NewOpaqueToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// IssueRefreshToken stores a new refresh token in the given family and returns its plain value.
+// twoFactor records whether the login that started the family passed 2FA.
+func IssueRefreshToken(ctx context.Context, db bun.IDB, userID int64, familyID string, twoFactor bool) (string, error) {
+	token, err := NewOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+
+	refreshToken := &models.RefreshToken{
+		UserID:    userID,
+		TokenHash: HashToken(token),
+		FamilyID:  familyID,
+		TwoFactor: twoFactor,
+		ExpiresAt: time.Now().Add(RefreshTokenTTL()),
+		CreatedAt: time.Now(),
+	}
+	if _, err := db.NewInsert().Model(refreshToken).Exec(ctx); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// RotateRefreshToken marks the presented refresh token as used and returns it.
+// The caller issues the replacement in the same family. Presenting a token that
+// was already used or revoked revokes its whole family and returns ErrRefreshTokenReused.
+func RotateRefreshToken(ctx context.Context, db bun.IDB, token string) (*models.RefreshToken, error) {
+	tokenHash := HashToken(token)
+	now := time.Now()
+
+	refreshToken := &models.RefreshToken{}
+	err := db.NewUpdate().
+		Model(refreshToken).
+		Set("used_at = ?", now).
+		Where("token_hash = ?", tokenHash).
+		Where("used_at IS NULL").
+		Where("revoked_at IS NULL").
+		Where("expires_at > ?", now).
+		Returning("*").
+		Scan(ctx)
+	if err == nil {
+		return refreshToken, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+
+	// The token was not usable. Find out whether it exists at all.
+	err = db.NewSelect().Model(refreshToken).Where("token_hash = ?", tokenHash).Scan(ctx)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrInvalidRefreshToken
+		}
+		return nil, err
+	}
+	if refreshToken.UsedAt.IsZero() && refreshToken.RevokedAt.IsZero() {
+		return nil, ErrInvalidRefreshToken // merely expired
+	}
+
+	log.Printf("Refresh token reuse detected for user %d, revoking family %s", refreshToken.UserID, refreshToken.FamilyID)
+	if err := RevokeFamily(ctx, db, refreshToken.FamilyID); err != nil {
+		return nil, err
+	}
+	return nil, ErrRefreshTokenReused
+}
+
+// RevokeRefreshToken revokes the family the given refresh token belongs to.
+// Unknown tokens are ignored so that logout is idempotent.
+func RevokeRefreshToken(ctx context.Context, db bun.IDB, token string) error {
+	refreshToken := &models.RefreshToken{}
+	err := db.NewSelect().Model(refreshToken).Where("token_hash = ?", HashToken(token)).Scan(ctx)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		return err
+	}
+	return RevokeFamily(ctx, db, refreshToken.FamilyID)
+}
+
+// RevokeFamily revokes every refresh token in a family and ends its session,
+// so the session's access tokens are rejected too.
+func RevokeFamily(ctx context.Context, db bun.IDB, familyID string) error {
+	now := time.Now()
+	_, err := db.NewUpdate().
+		Model((*models.RefreshToken)(nil)).
+		Set("revoked_at = ?", now).
+		Where("family_id = ?", familyID).
+		Where("revoked_at IS NULL").
+		Exec(ctx)
+	if err != nil {
+		return err
+	}
+	_, err = db.NewUpdate().
+		Model((*models.Session)(nil)).
+		Set("revoked_at = ?", now).
+		Where("session_id = ?", familyID).
+		Where("revoked_at IS NULL").
+		Exec(ctx)
+	return err
+}
+
+// RevokeAccessToken adds an access token to the revocation list until it expires.
+func RevokeAccessToken(ctx context.Context, db bun.IDB, jti string, expiresAt time.Time) error {
+	revoked := &models.RevokedToken{
+		JTI:       jti,
+		ExpiresAt: expiresAt,
+		RevokedAt: time.Now(),
+	}
+	_, err := db.NewInsert().Model(revoked).On("CONFLICT (jti) DO NOTHING").Exec(ctx)
+	return err
+}
+
+// IsAccessTokenRevoked reports whether the access token with the given ID was revoked.
+func IsAccessTokenRevoked(ctx context.Context, db bun.IDB, jti string) (bool, error) {
+	return db.NewSelect().Model((*models.RevokedToken)(nil)).Where("jti = ?", jti).Exists(ctx)
+}
+
+// IsRevoked reports whether an access token was revoked on its own, belongs to
+// a session that has ended, or belongs to a user who has since been disabled,
+// erased or had all their tokens revoked.
+func IsRevoked(ctx context.Context, db bun.IDB, claims *auth.Claims) (bool, error) {
+	revoked, err := IsAccessTokenRevoked(ctx, db, claims.ID)
+	if err != nil || revoked || claims.IsService() {
+		return revoked, err
+	}
+	if claims.SessionID != "" {
+		ended, err := db.NewSelect().
+			Model((*models.Session)(nil)).
+			Where("session_id = ?", claims.SessionID).
+			Where("revoked_at IS NOT NULL").
+			Exists(ctx)
+		if err != nil || ended {
+			return ended, err
+		}
+	}
+	var issuedAt time.Time
+	if claims.IssuedAt != nil {
+		issuedAt = claims.IssuedAt.Time
+	}
+	return db.NewSelect().
+		Model((*models.User)(nil)).
+		WhereAllWithDeleted().
+		Where("user_id = ?", claims.UserID).
+		Where("disabled_at IS NOT NULL OR deleted_at IS NOT NULL OR tokens_valid_after > ?", issuedAt).
+		Exists(ctx)
+}
+
+// Revocations lists the revocations of access tokens issued within the given
+// lifetime, for services that verify tokens locally. Older tokens have expired
+// anyway.
+func Revocations(ctx context.Context, db bun.IDB, lifetime time.Duration) (*auth.Revocations, error) {
+	now := time.Now()
+	since := now.Add(-lifetime)
+	list := &auth.Revocations{Tokens: []string{}, Sessions: []string{}, Users: []auth.UserRevocation{}}
+
+	err := db.NewSelect().Model((*models.RevokedToken)(nil)).
+		Column("jti").
+		Where("expires_at > ?", now).
+		Scan(ctx, &list.Tokens)
+	if err != nil {
+		return nil, err
+	}
+	err = db.NewSelect().Model((*models.Session)(nil)).
+		Column("session_id").
+		Where("revoked_at > ?", since).
+		Scan(ctx, &list.Sessions)
+	if err != nil {
+		return nil, err
+	}
+	// Disabling and erasing reject every earlier token, like revoking them all
+	err = db.NewSelect().Model((*models.User)(nil)).
+		WhereAllWithDeleted().
+		ColumnExpr("user_id").
+		ColumnExpr("GREATEST(tokens_valid_after, disabled_at, deleted_at) AS not_before").
+		Where("tokens_valid_after > ? OR disabled_at > ? OR deleted_at > ?", since, since, since).
+		Scan(ctx, &list.Users)
+	if err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// RevokeUserAccessTokens rejects every access token issued to a user so far.
+func RevokeUserAccessTokens(ctx context.Context, db bun.IDB, userID int64) error {
+	_, err := db.NewUpdate().
+		Model((*models.User)(nil)).
+		Set("tokens_valid_after = ?", time.Now()).
+		Where("user_id = ?", userID).
+		Exec(ctx)
+	return err
+}
+
+// RevokeUserRefreshTokens revokes every refresh token and session of a user, signing them out everywhere.
+func RevokeUserRefreshTokens(ctx context.Context, db bun.IDB, userID int64) error {
+	now := time.Now()
+	_, err := db.NewUpdate().
+		Model((*models.RefreshToken)(nil)).
+		Set("revoked_at = ?", now).
+		Where("user_id = ?", userID).
+		Where("revoked_at IS NULL").
+		Exec(ctx)
+	if err != nil {
+		return err
+	}
+	_, err = db.NewUpdate().
+		Model((*models.Session)(nil)).
+		Set("revoked_at = ?", now).
+		Where("user_id = ?", userID).
+		Where("revoked_at IS NULL").
+		Exec(ctx)
+	return err
+}
+
+// UserTokenTTL returns how long a token for the given purpose stays valid:
+// EMAIL_VERIFICATION_TOKEN_TTL (default 24 hours), PASSWORD_RESET_TOKEN_TTL
+// (default 1 hour) or TWO_FACTOR_CHALLENGE_TTL (default 5 minutes).
+func UserTokenTTL(purpose string) time.Duration {
+	env, def := "EMAIL_VERIFICATION_TOKEN_TTL", 24*time.Hour
+	switch purpose {
+	case models.PurposePasswordReset:
+		env, def = "PASSWORD_RESET_TOKEN_TTL", time.Hour
+	case models.PurposeTwoFactorChallenge:
+		env, def = "TWO_FACTOR_CHALLENGE_TTL", 5*time.Minute
+	}
+	if ttl, err := time.ParseDuration(os.Getenv(env)); err == nil && ttl > 0 {
+		return ttl
+	}
+	return def
+}
+
+// IssueUserToken stores a new single-use token for the purpose and returns it
+// with its plain value. Earlier unused tokens for the same purpose stop working,
+// so only the most recently mailed link is valid.
+func IssueUserToken(ctx context.Context, db bun.IDB, userID int64, purpose string) (*models.UserToken, string, error) {
+	token, err := NewOpaqueToken()
+	if err != nil {
+		return nil, "", err
+	}
+
+	now := time.Now()
+	_, err = db.NewUpdate().
+		Model((*models.UserToken)(nil)).
+		Set("used_at = ?", now).
+		Where("user_id = ?", userID).
+		Where("purpose = ?", purpose).
+		Where("used_at IS NULL").
+		Exec(ctx)
+	if err != nil {
+		return nil, "", err
+	}
+
+	userToken := &models.UserToken{
+		UserID:    userID,
+		Purpose:   purpose,
+		TokenHash: HashToken(token),
+		ExpiresAt: now.Add(UserTokenTTL(purpose)),
+		CreatedAt: now,
+	}
+	if _, err := db.NewInsert().Model(userToken).Exec(ctx); err != nil {
+		return nil, "", err
+	}
+	return userToken, token, nil
+}
+
+// ConsumeUserToken marks a token for the purpose as used and returns it. It is a
+// single conditional UPDATE, so a token cannot be used twice even concurrently.
+func ConsumeUserToken(ctx context.Context, db bun.IDB, token, purpose string) (*models.UserToken, error) {
+	now := time.Now()
+	userToken := &models.UserToken{}
+	err := db.NewUpdate().
+		Model(userToken).
+		Set("used_at = ?", now).
+		Where("token_hash = ?", HashToken(token)).
+		Where("purpose = ?", purpose).
+		Where("used_at IS NULL").
+		Where("expires_at > ?", now).
+		Returning("*").
+		Scan(ctx)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrInvalidUserToken
+		}
+		return nil, err
+	}
+	return userToken, nil
+}
+
+// FindUserToken returns the usable token for the purpose without using it up.
+func FindUserToken(ctx context.Context, db bun.IDB, token, purpose string) (*models.UserToken, error) {
+	userToken := &models.UserToken{}
+	err := db.NewSelect().
+		Model(userToken).
+		Where("token_hash = ?", HashToken(token)).
+		Where("purpose = ?", purpose).
+		Where("used_at IS NULL").
+		Where("expires_at > ?", time.Now()).
+		Scan(ctx)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrInvalidUserToken
+		}
+		return nil, err
+	}
+	return userToken, nil
+}
+
+// RecordFailedAttempt counts a failed attempt to use a token and uses it up
+// once maxAttempts is reached.
+func RecordFailedAttempt(ctx context.Context, db bun.IDB, userTokenID int64, maxAttempts int) error {
+	_, err := db.NewUpdate().
+		Model((*models.UserToken)(nil)).
+		Set("attempts = attempts + 1").
+		Set("used_at = CASE WHEN attempts + 1 >= ? THEN ? ELSE used_at END", maxAttempts, time.Now()).
+		Where("user_token_id = ?", userTokenID).
+		Exec(ctx)
+	return err
+}
+
+// PurgeExpired deletes revocation entries, refresh tokens and user tokens that
+// have expired anyway, and sessions whose last refresh token has expired.
+func PurgeExpired(ctx context.Context, db bun.IDB) error {
+	now := time.Now()
+	if _, err := db.NewDelete().Model((*models.Session)(nil)).Where("last_seen_at < ?", now.Add(-RefreshTokenTTL())).Exec(ctx); err != nil {
+		return err
+	}
+	if _, err := db.NewDelete().Model((*models.RevokedToken)(nil)).Where("expires_at < ?", now).Exec(ctx); err != nil {
+		return err
+	}
+	if _, err := db.NewDelete().Model((*models.UserToken)(nil)).Where("expires_at < ?", now).Exec(ctx); err != nil {
+		return err
+	}
+	_, err := db.NewDelete().Model((*models.RefreshToken)(nil)).Where("expires_at < ?", now).Exec(ctx)
+	return err
+}
@@ -0,0 +1,51 @@
+package totp
+
+import (
+	"testing"
+	"time"
+)
+
+// Test vectors from RFC 6238 Appendix B (SHA-1, 8 digits).
+func TestHOTPRFC6238Vectors(t *testing.T) {
+	key := []byte("12345678901234567890")
+	vectors := []struct {
+		unix int64
+		code string
+	}{
+		{59, "94287082"},
+		{1111111109, "07081804"},
+		{1111111111, "14050471"},
+		{1234567890, "89005924"},
+		{2000000000, "69279037"},
+		{20000000000, "65353130"},
+	}
+
+	for _, v := range vectors {
+		counter := Counter(time.Unix(v.unix, 0))
+		if got := hotp(key, uint64(counter), 8); got != v.code {
+			t.Errorf("time %d: expected %s, got %s", v.unix, v.code, got)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	secret, err := GenerateSecret()
+	if err != nil {
+		t.Fatalf("GenerateSecret: %v", err)
+	}
+	now := time.Unix(1700000000, 0)
+
+	code, err := Code(secret, now)
+	if err != nil {
+		t.Fatalf("Code: %v", err)
+	}
+	if counter, ok := Validate(secret, code, now.Add(Period)); !ok || counter != Counter(now) {
+		t.Errorf("expected code to be accepted one period later with counter %d, got %d, %v", Counter(now), counter, ok)
+	}
+	if _, ok := Validate(secret, code, now.Add(2*Period)); ok {
+		t.Error("expected code to be rejected two periods later")
+	}
+	if _, ok := Validate(secret, "abcdef", now); ok {
+		t.Error("expected malformed code to be rejected")
+	}
+}
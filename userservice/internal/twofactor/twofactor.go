@@ -0,0 +1,127 @@
+// Package twofactor stores TOTP state and recovery codes and checks second factors.
+package twofactor
+
+import (
+	"context"
+	"crypto/rand"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/hari134/pratilipi/userservice/internal/tokenstore"
+	"github.com/hari134/pratilipi/userservice/internal/totp"
+	"github.com/hari134/pratilipi/userservice/models"
+	"github.com/uptrace/bun"
+)
+
+const (
+	// recoveryCodeCount is how many recovery codes a user gets at a time.
+	recoveryCodeCount = 10
+	// MaxChallengeAttempts is how many wrong codes a login challenge survives.
+	MaxChallengeAttempts = 5
+)
+
+// Lowercase base32 without easily confused characters.
+const recoveryAlphabet = "abcdefghjkmnpqrstuvwxyz23456789"
+
+// RequiredForPrivilegedRoles reports whether permissions of privileged roles
+// are only granted after a 2FA login, from REQUIRE_2FA_FOR_PRIVILEGED_ROLES (default true).
+func RequiredForPrivilegedRoles() bool {
+	return os.Getenv("REQUIRE_2FA_FOR_PRIVILEGED_ROLES") != "false"
+}
+
+// Issuer returns the issuer shown by authenticator apps, from TOTP_ISSUER (default "Pratilipi").
+func Issuer() string {
+	if issuer := os.Getenv("TOTP_ISSUER"); issuer != "" {
+		return issuer
+	}
+	return "Pratilipi"
+}
+
+// VerifyTOTP checks a TOTP code against the user's secret and records its time
+// step, so the same code cannot be used twice.
+func VerifyTOTP(ctx context.Context, db bun.IDB, user *models.User, code string) (bool, error) {
+	if user.TOTPSecret == "" {
+		return false, nil
+	}
+	counter, ok := totp.Validate(user.TOTPSecret, code, time.Now())
+	if !ok {
+		return false, nil
+	}
+	res, err := db.NewUpdate().
+		Model((*models.User)(nil)).
+		Set("totp_last_counter = ?", counter).
+		Where("user_id = ?", user.UserID).
+		Where("totp_last_counter IS NULL OR totp_last_counter < ?", counter).
+		Exec(ctx)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+// VerifyCode accepts either a TOTP code or an unused recovery code, which is used up.
+func VerifyCode(ctx context.Context, db bun.IDB, user *models.User, code string) (bool, error) {
+	code = strings.TrimSpace(code)
+	if len(code) == totp.Digits {
+		return VerifyTOTP(ctx, db, user, code)
+	}
+	res, err := db.NewUpdate().
+		Model((*models.RecoveryCode)(nil)).
+		Set("used_at = ?", time.Now()).
+		Where("user_id = ?", user.UserID).
+		Where("code_hash = ?", tokenstore.HashToken(strings.ToLower(code))).
+		Where("used_at IS NULL").
+		Exec(ctx)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+// GenerateRecoveryCodes replaces the user's recovery codes and returns the new
+// ones. They are only shown once; just their hashes are stored.
+func GenerateRecoveryCodes(ctx context.Context, db bun.IDB, userID int64) ([]string, error) {
+	if err := DeleteRecoveryCodes(ctx, db, userID); err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, recoveryCodeCount)
+	rows := make([]models.RecoveryCode, recoveryCodeCount)
+	for i := range codes {
+		code, err := newRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		codes[i] = code
+		rows[i] = models.RecoveryCode{UserID: userID, CodeHash: tokenstore.HashToken(code), CreatedAt: time.Now()}
+	}
+	if _, err := db.NewInsert().Model(&rows).Exec(ctx); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// DeleteRecoveryCodes removes all of the user's recovery codes.
+func DeleteRecoveryCodes(ctx context.Context, db bun.IDB, userID int64) error {
+	_, err := db.NewDelete().Model((*models.RecoveryCode)(nil)).Where("user_id = ?", userID).Exec(ctx)
+	return err
+}
+
+// newRecoveryCode returns a code such as "k7m2p-x9q4t".
+func newRecoveryCode() (string, error) {
+	b := make([]byte, 10)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	code := make([]byte, 0, 11)
+	for i, c := range b {
+		if i == 5 {
+			code = append(code, '-')
+		}
+		code = append(code, recoveryAlphabet[int(c)%len(recoveryAlphabet)])
+	}
+	return string(code), nil
+}
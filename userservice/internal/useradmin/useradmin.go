@@ -0,0 +1,254 @@
+// Package useradmin lists users for admins and disables, enables and forces
+// password resets on their accounts.
+package useradmin
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hari134/pratilipi/userservice/internal/dto"
+	"github.com/hari134/pratilipi/userservice/internal/tokenstore"
+	"github.com/hari134/pratilipi/userservice/models"
+	"github.com/uptrace/bun"
+)
+
+// ImpersonatePermission allows acting as another user.
+const ImpersonatePermission = "user:impersonate"
+
+// Account states to filter users by.
+const (
+	StatusActive        = "active"
+	StatusDisabled      = "disabled"
+	StatusResetRequired = "reset_required"
+)
+
+const (
+	defaultLimit = 50
+	maxLimit     = 200
+)
+
+// Filter selects the users to list. Empty fields match every user.
+type Filter struct {
+	Email    string // Substring of the email, case-insensitive
+	Name     string // Substring of the name, case-insensitive
+	Role     string // Role the user holds
+	Status   string // StatusActive, StatusDisabled or StatusResetRequired
+	Verified *bool  // Whether the email address is verified
+	Limit    int
+	Offset   int
+}
+
+// FilterFromQuery reads a Filter from the query parameters email, name, role,
+// status, verified, limit and offset.
+func FilterFromQuery(q url.Values) (Filter, error) {
+	f := Filter{
+		Email:  strings.TrimSpace(q.Get("email")),
+		Name:   strings.TrimSpace(q.Get("name")),
+		Role:   strings.TrimSpace(q.Get("role")),
+		Status: q.Get("status"),
+		Limit:  defaultLimit,
+	}
+	switch f.Status {
+	case "", StatusActive, StatusDisabled, StatusResetRequired:
+	default:
+		return f, fmt.Errorf("status must be %s, %s or %s", StatusActive, StatusDisabled, StatusResetRequired)
+	}
+	if v := q.Get("verified"); v != "" {
+		verified, err := strconv.ParseBool(v)
+		if err != nil {
+			return f, fmt.Errorf("verified must be true or false")
+		}
+		f.Verified = &verified
+	}
+	if v := q.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 {
+			return f, fmt.Errorf("limit must be a positive number")
+		}
+		f.Limit = limit
+	}
+	if f.Limit > maxLimit {
+		f.Limit = maxLimit
+	}
+	if v := q.Get("offset"); v != "" {
+		offset, err := strconv.Atoi(v)
+		if err != nil || offset < 0 {
+			return f, fmt.Errorf("offset must not be negative")
+		}
+		f.Offset = offset
+	}
+	return f, nil
+}
+
+// List returns one page of users matching the filter, ordered by user ID, and
+// the number of matching users across all pages.
+func List(ctx context.Context, db bun.IDB, f Filter) (*dto.AdminUserList, error) {
+	var users []models.User
+	q := db.NewSelect().Model(&users).Order("u.user_id").Limit(f.Limit).Offset(f.Offset)
+	if f.Email != "" {
+		q = q.Where("u.email ILIKE ?", contains(f.Email))
+	}
+	if f.Name != "" {
+		q = q.Where("u.name ILIKE ?", contains(f.Name))
+	}
+	if f.Role != "" {
+		q = q.Where("u.user_id IN (SELECT ur.user_id FROM user_roles AS ur JOIN roles AS r ON r.role_id = ur.role_id WHERE r.name = ?)", f.Role)
+	}
+	switch f.Status {
+	case StatusActive:
+		q = q.Where("u.disabled_at IS NULL")
+	case StatusDisabled:
+		q = q.Where("u.disabled_at IS NOT NULL")
+	case StatusResetRequired:
+		q = q.Where("u.password_reset_required")
+	}
+	if f.Verified != nil {
+		if *f.Verified {
+			q = q.Where("u.email_verified_at IS NOT NULL")
+		} else {
+			q = q.Where("u.email_verified_at IS NULL")
+		}
+	}
+	total, err := q.ScanAndCount(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	roles, err := rolesOf(ctx, db, users)
+	if err != nil {
+		return nil, err
+	}
+	list := &dto.AdminUserList{Users: make([]dto.AdminUser, 0, len(users)), Total: total}
+	for i := range users {
+		list.Users = append(list.Users, View(&users[i], roles[users[i].UserID]))
+	}
+	return list, nil
+}
+
+// View returns the admin view of a user holding the given roles.
+func View(user *models.User, roles []string) dto.AdminUser {
+	if roles == nil {
+		roles = []string{}
+	}
+	view := dto.AdminUser{
+		UserID:                user.UserID,
+		Name:                  user.Name,
+		Email:                 user.Email,
+		PhoneNo:               user.PhoneNo,
+		Roles:                 roles,
+		EmailVerified:         !user.EmailVerifiedAt.IsZero(),
+		TwoFactorEnabled:      !user.TOTPEnabledAt.IsZero(),
+		DisabledReason:        user.DisabledReason,
+		PasswordResetRequired: user.PasswordResetRequired,
+		CreatedAt:             user.CreatedAt,
+	}
+	if !user.DisabledAt.IsZero() {
+		view.DisabledAt = &user.DisabledAt
+	}
+	return view
+}
+
+// rolesOf loads the role names of the given users in one query.
+func rolesOf(ctx context.Context, db bun.IDB, users []models.User) (map[int64][]string, error) {
+	roles := map[int64][]string{}
+	if len(users) == 0 {
+		return roles, nil
+	}
+	ids := make([]int64, len(users))
+	for i, u := range users {
+		ids[i] = u.UserID
+	}
+
+	var rows []struct {
+		UserID int64  `bun:"user_id"`
+		Name   string `bun:"name"`
+	}
+	err := db.NewSelect().
+		Model((*models.Role)(nil)).
+		Column("ur.user_id", "r.name").
+		Join("JOIN user_roles AS ur ON ur.role_id = r.role_id").
+		Where("ur.user_id IN (?)", bun.In(ids)).
+		Order("ur.user_id", "r.name").
+		Scan(ctx, &rows)
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		roles[row.UserID] = append(roles[row.UserID], row.Name)
+	}
+	return roles, nil
+}
+
+// contains returns an ILIKE pattern matching s anywhere, with LIKE wildcards in s escaped.
+func contains(s string) string {
+	s = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+	return "%" + s + "%"
+}
+
+// Disable bars the user from logging in and rejects their tokens until they are
+// enabled again. Run it in a transaction with the user row locked.
+func Disable(ctx context.Context, tx bun.Tx, user *models.User, reason string, adminID int64) error {
+	now := time.Now()
+	_, err := tx.NewUpdate().
+		Model((*models.User)(nil)).
+		Set("disabled_at = ?", now).
+		Set("disabled_reason = ?", reason).
+		Set("updated_at = ?", now).
+		Set("updated_by = ?", adminID).
+		Where("user_id = ?", user.UserID).
+		Exec(ctx)
+	if err != nil {
+		return err
+	}
+	if err := tokenstore.RevokeUserRefreshTokens(ctx, tx, user.UserID); err != nil {
+		return err
+	}
+	user.DisabledAt, user.DisabledReason = now, reason
+	return nil
+}
+
+// Enable lets a disabled user log in again. Tokens issued before the user was
+// disabled stay revoked.
+func Enable(ctx context.Context, tx bun.Tx, user *models.User, adminID int64) error {
+	now := time.Now()
+	_, err := tx.NewUpdate().
+		Model((*models.User)(nil)).
+		Set("disabled_at = NULL").
+		Set("disabled_reason = NULL").
+		Set("tokens_valid_after = GREATEST(tokens_valid_after, ?)", user.DisabledAt).
+		Set("updated_at = ?", now).
+		Set("updated_by = ?", adminID).
+		Where("user_id = ?", user.UserID).
+		Exec(ctx)
+	if err != nil {
+		return err
+	}
+	user.DisabledAt, user.DisabledReason = time.Time{}, ""
+	return nil
+}
+
+// RequirePasswordReset refuses the user's logins until they reset their
+// password, and signs them out everywhere.
+func RequirePasswordReset(ctx context.Context, tx bun.Tx, user *models.User, adminID int64) error {
+	now := time.Now()
+	_, err := tx.NewUpdate().
+		Model((*models.User)(nil)).
+		Set("password_reset_required = TRUE").
+		Set("tokens_valid_after = ?", now).
+		Set("updated_at = ?", now).
+		Set("updated_by = ?", adminID).
+		Where("user_id = ?", user.UserID).
+		Exec(ctx)
+	if err != nil {
+		return err
+	}
+	if err := tokenstore.RevokeUserRefreshTokens(ctx, tx, user.UserID); err != nil {
+		return err
+	}
+	user.PasswordResetRequired = true
+	return nil
+}
@@ -0,0 +1,49 @@
+package useradmin
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestFilterFromQuery(t *testing.T) {
+	f, err := FilterFromQuery(url.Values{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Limit != defaultLimit || f.Offset != 0 || f.Verified != nil {
+		t.Errorf("empty query gave %+v", f)
+	}
+
+	f, err = FilterFromQuery(url.Values{
+		"email":    {" @example.com "},
+		"role":     {"admin"},
+		"status":   {"disabled"},
+		"verified": {"false"},
+		"limit":    {"1000"},
+		"offset":   {"20"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Email != "@example.com" || f.Role != "admin" || f.Status != StatusDisabled ||
+		f.Verified == nil || *f.Verified || f.Limit != maxLimit || f.Offset != 20 {
+		t.Errorf("unexpected filter %+v", f)
+	}
+
+	for _, q := range []url.Values{
+		{"status": {"locked"}},
+		{"verified": {"maybe"}},
+		{"limit": {"0"}},
+		{"offset": {"-1"}},
+	} {
+		if _, err := FilterFromQuery(q); err == nil {
+			t.Errorf("FilterFromQuery(%v) succeeded, want an error", q)
+		}
+	}
+}
+
+func TestContainsEscapesWildcards(t *testing.T) {
+	if got, want := contains(`50%_off\`), `%50\%\_off\\%`; got != want {
+		t.Errorf("contains() = %q, want %q", got, want)
+	}
+}
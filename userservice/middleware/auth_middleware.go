@@ -4,15 +4,24 @@ import (
     "context"
     "net/http"
     "strings"
+
+    "github.com/hari134/pratilipi/pkg/auth"
+    "github.com/hari134/pratilipi/pkg/db"
     "github.com/hari134/pratilipi/userservice/internal/jwtutil"
+    "github.com/hari134/pratilipi/userservice/internal/tokenstore"
 )
 
 type contextKey string
 
 const UserIDKey = contextKey("userID")
 
-// TokenValidationMiddleware validates JWT token and extracts the user ID from it.
-func TokenValidationMiddleware(next http.Handler) http.Handler {
+// AuthMiddleware holds dependencies for validating access tokens.
+type AuthMiddleware struct {
+    DB *db.DB
+}
+
+// TokenValidationMiddleware validates JWT token, rejects revoked tokens and extracts the user ID from it.
+func (m *AuthMiddleware) TokenValidationMiddleware(next http.Handler) http.Handler {
     return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
         tokenStr := r.Header.Get("Authorization")
         if tokenStr == "" {
@@ -30,8 +39,20 @@ func TokenValidationMiddleware(next http.Handler) http.Handler {
             return
         }
 
-        // Add the userID to the context
+        // Reject tokens that were revoked before they expired
+        revoked, err := tokenstore.IsRevoked(r.Context(), m.DB, claims)
+        if err != nil {
+            http.Error(w, "Failed to validate token", http.StatusInternalServerError)
+            return
+        }
+        if revoked {
+            http.Error(w, "Token has been revoked", http.StatusUnauthorized)
+            return
+        }
+
+        // Add the userID and claims to the context; the claims are read by auth.RequirePermission
         ctx := context.WithValue(r.Context(), UserIDKey, claims.UserID)
+        ctx = auth.WithClaims(ctx, claims)
         next.ServeHTTP(w, r.WithContext(ctx))
     })
 }
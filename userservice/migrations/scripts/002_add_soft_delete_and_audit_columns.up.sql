@@ -0,0 +1,15 @@
+ALTER TABLE users
+    ADD COLUMN deleted_at TIMESTAMP,   -- Set when the user is soft-deleted
+    ADD COLUMN created_by INT,         -- User who created the account (NULL for self-registration)
+    ADD COLUMN updated_by INT;         -- User who last updated the account
+
+
+--bun:split
+
+-- Soft-deleted users keep their row, so the email only has to be unique among active users
+ALTER TABLE users DROP CONSTRAINT users_email_key;
+
+
+--bun:split
+
+CREATE UNIQUE INDEX users_email_active_key ON users (email) WHERE deleted_at IS NULL;
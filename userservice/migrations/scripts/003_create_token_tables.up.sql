@@ -0,0 +1,24 @@
+CREATE TABLE refresh_tokens (
+    refresh_token_id SERIAL PRIMARY KEY,                           -- Unique identifier for the refresh token
+    user_id INT NOT NULL REFERENCES users(user_id) ON DELETE CASCADE, -- Owner of the token
+    token_hash CHAR(64) UNIQUE NOT NULL,                           -- SHA-256 of the token; the token itself is never stored
+    family_id CHAR(32) NOT NULL,                                   -- Shared by all tokens rotated from one login
+    expires_at TIMESTAMP NOT NULL,                                 -- Token cannot be used after this
+    used_at TIMESTAMP,                                             -- Set when exchanged for a new token
+    revoked_at TIMESTAMP,                                          -- Set on logout or reuse detection
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP                 -- Issue timestamp
+);
+
+
+--bun:split
+
+CREATE INDEX refresh_tokens_family_id_idx ON refresh_tokens (family_id);
+
+
+--bun:split
+
+CREATE TABLE revoked_tokens (
+    jti CHAR(32) PRIMARY KEY,                       -- ID of the revoked access token
+    expires_at TIMESTAMP NOT NULL,                  -- Original expiry; the row can be purged after this
+    revoked_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP  -- Revocation timestamp
+);
@@ -0,0 +1,80 @@
+CREATE TABLE roles (
+    role_id SERIAL PRIMARY KEY,                      -- Unique identifier for the role
+    name VARCHAR(50) UNIQUE NOT NULL,                -- Role name, e.g. 'admin'
+    description TEXT,                                -- What the role is for
+    privileged BOOLEAN NOT NULL DEFAULT FALSE,       -- Privileged roles can only be assigned by an admin
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP   -- Role creation timestamp
+);
+
+
+--bun:split
+
+CREATE TABLE permissions (
+    permission_id SERIAL PRIMARY KEY,                -- Unique identifier for the permission
+    name VARCHAR(100) UNIQUE NOT NULL,               -- Permission name, e.g. 'product:write'
+    description TEXT                                 -- What the permission allows
+);
+
+
+--bun:split
+
+CREATE TABLE role_permissions (
+    role_id INT NOT NULL REFERENCES roles(role_id) ON DELETE CASCADE,
+    permission_id INT NOT NULL REFERENCES permissions(permission_id) ON DELETE CASCADE,
+    PRIMARY KEY (role_id, permission_id)
+);
+
+
+--bun:split
+
+CREATE TABLE user_roles (
+    user_id INT NOT NULL REFERENCES users(user_id) ON DELETE CASCADE,
+    role_id INT NOT NULL REFERENCES roles(role_id) ON DELETE CASCADE,
+    assigned_by INT,                                 -- Admin who assigned the role (NULL for defaults)
+    assigned_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP, -- Assignment timestamp
+    PRIMARY KEY (user_id, role_id)
+);
+
+
+--bun:split
+
+INSERT INTO roles (name, description, privileged) VALUES
+    ('user', 'Customer who can browse products and place orders', FALSE),
+    ('admin', 'Full administrative access', TRUE);
+
+
+--bun:split
+
+INSERT INTO permissions (name, description) VALUES
+    ('product:read', 'View products'),
+    ('product:write', 'Create, update, delete and restore products and change inventory'),
+    ('order:read', 'View all orders'),
+    ('order:write', 'Place orders'),
+    ('user:read', 'View all user profiles'),
+    ('user:admin', 'Manage users and assign roles');
+
+
+--bun:split
+
+-- Users read their own profile and orders without user:read or order:read,
+-- which grant access to everyone's
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.role_id, p.permission_id
+FROM roles r JOIN permissions p
+    ON r.name = 'admin'
+    OR p.name IN ('product:read', 'order:write');
+
+
+--bun:split
+
+-- Registration used to default to, and let anyone pick, 'admin', so the old
+-- role column cannot be trusted: every existing user gets 'user', and admins
+-- are promoted explicitly (BOOTSTRAP_ADMIN_EMAIL, then PUT /users/{id}/roles).
+-- The column is dropped together with its CHECK constraint.
+INSERT INTO user_roles (user_id, role_id)
+SELECT u.user_id, r.role_id FROM users u JOIN roles r ON r.name = 'user';
+
+
+--bun:split
+
+ALTER TABLE users DROP COLUMN role;
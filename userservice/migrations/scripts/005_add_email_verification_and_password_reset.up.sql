@@ -0,0 +1,20 @@
+ALTER TABLE users
+    ADD COLUMN email_verified_at TIMESTAMP;   -- Set once the user proves they own the email address
+
+
+--bun:split
+
+CREATE TABLE user_tokens (
+    user_token_id SERIAL PRIMARY KEY,                              -- Unique identifier for the token
+    user_id INT NOT NULL REFERENCES users(user_id) ON DELETE CASCADE, -- Owner of the token
+    purpose VARCHAR(32) NOT NULL CHECK (purpose IN ('email_verification', 'password_reset')), -- What the token may be used for
+    token_hash CHAR(64) UNIQUE NOT NULL,                           -- SHA-256 of the token; the token itself is never stored
+    expires_at TIMESTAMP NOT NULL,                                 -- Token cannot be used after this
+    used_at TIMESTAMP,                                             -- Set when the token is used or superseded
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP                 -- Issue timestamp
+);
+
+
+--bun:split
+
+CREATE INDEX user_tokens_user_id_purpose_idx ON user_tokens (user_id, purpose);
@@ -0,0 +1,39 @@
+ALTER TABLE users
+    ADD COLUMN totp_secret VARCHAR(64),        -- Base32 TOTP secret; set on enrollment, cleared when 2FA is disabled
+    ADD COLUMN totp_enabled_at TIMESTAMP,      -- Set once enrollment is confirmed with a valid code
+    ADD COLUMN totp_last_counter BIGINT;       -- Time step of the last accepted code, so a code cannot be replayed
+
+
+--bun:split
+
+CREATE TABLE recovery_codes (
+    recovery_code_id SERIAL PRIMARY KEY,                           -- Unique identifier for the code
+    user_id INT NOT NULL REFERENCES users(user_id) ON DELETE CASCADE, -- Owner of the code
+    code_hash CHAR(64) UNIQUE NOT NULL,                            -- SHA-256 of the code; the code itself is never stored
+    used_at TIMESTAMP,                                             -- Set when the code is used
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP                 -- Issue timestamp
+);
+
+
+--bun:split
+
+CREATE INDEX recovery_codes_user_id_idx ON recovery_codes (user_id);
+
+
+--bun:split
+
+-- Login challenges are single-use tokens exchanged for access tokens together with a 2FA code
+ALTER TABLE user_tokens DROP CONSTRAINT user_tokens_purpose_check;
+
+
+--bun:split
+
+ALTER TABLE user_tokens
+    ADD CONSTRAINT user_tokens_purpose_check CHECK (purpose IN ('email_verification', 'password_reset', 'two_factor_challenge')),
+    ADD COLUMN attempts INT NOT NULL DEFAULT 0;   -- Failed attempts; the token is used up after too many
+
+
+--bun:split
+
+ALTER TABLE refresh_tokens
+    ADD COLUMN two_factor BOOLEAN NOT NULL DEFAULT FALSE;   -- Whether the login that started the family passed 2FA
@@ -0,0 +1,6 @@
+CREATE TABLE login_attempts (
+    key VARCHAR(320) PRIMARY KEY,        -- 'account:<email>' or 'ip:<address>'
+    failures INT NOT NULL DEFAULT 0,     -- Consecutive failures within the failure window
+    last_failure_at TIMESTAMP NOT NULL,  -- Time of the most recent failure
+    locked_until TIMESTAMP               -- Set while locked out
+);
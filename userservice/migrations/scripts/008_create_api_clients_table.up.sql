@@ -0,0 +1,10 @@
+CREATE TABLE api_clients (
+    client_id VARCHAR(64) PRIMARY KEY,              -- Public identifier used with the client credentials grant
+    name VARCHAR(100) NOT NULL,                     -- What the client is, e.g. 'reporting job'
+    secret_hash CHAR(64) NOT NULL,                  -- SHA-256 of the client secret; the secret itself is never stored
+    scopes TEXT[] NOT NULL DEFAULT '{}',            -- Permissions the client may request, e.g. '{product:read}'
+    created_by INT,                                 -- Admin who created the client
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP, -- Creation timestamp
+    last_used_at TIMESTAMP,                         -- Last time a token was issued to the client
+    revoked_at TIMESTAMP                            -- Set when the client is revoked
+);
@@ -0,0 +1,10 @@
+INSERT INTO permissions (name, description) VALUES
+    ('user:privacy', 'Export and erase any user''s personal data in every service');
+
+
+--bun:split
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.role_id, p.permission_id
+FROM roles r JOIN permissions p
+    ON r.name = 'admin' AND p.name = 'user:privacy';
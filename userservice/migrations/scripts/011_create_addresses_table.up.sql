@@ -0,0 +1,41 @@
+CREATE TABLE addresses (
+    address_id SERIAL PRIMARY KEY,                   -- Unique identifier for the address
+    user_id INT NOT NULL REFERENCES users(user_id) ON DELETE CASCADE,
+    label VARCHAR(50),                               -- Optional name such as 'Home' or 'Office'
+    recipient_name VARCHAR(100) NOT NULL,            -- Person to deliver to
+    phone_no VARCHAR(20),                            -- Contact number for the courier
+    line1 VARCHAR(200) NOT NULL,                     -- Street and house number
+    line2 VARCHAR(200),                              -- Apartment, floor, landmark
+    city VARCHAR(100) NOT NULL,
+    state VARCHAR(100),                              -- State, province or county; required in some countries
+    postal_code VARCHAR(20),                         -- Required and checked in some countries
+    country CHAR(2) NOT NULL,                        -- ISO 3166-1 alpha-2 code, e.g. 'IN'
+    is_default BOOLEAN NOT NULL DEFAULT FALSE,       -- Used for orders that name no address
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,  -- Creation timestamp
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP   -- Timestamp for last update
+);
+
+
+--bun:split
+
+CREATE INDEX idx_addresses_user_id ON addresses (user_id);
+
+
+--bun:split
+
+-- At most one default address per user
+CREATE UNIQUE INDEX idx_addresses_default ON addresses (user_id) WHERE is_default;
+
+
+--bun:split
+
+INSERT INTO permissions (name, description) VALUES
+    ('address:read', 'View any user''s addresses');
+
+
+--bun:split
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.role_id, p.permission_id
+FROM roles r JOIN permissions p
+    ON r.name = 'admin' AND p.name = 'address:read';
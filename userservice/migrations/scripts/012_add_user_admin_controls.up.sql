@@ -0,0 +1,24 @@
+ALTER TABLE users
+    ADD COLUMN disabled_at TIMESTAMP,                                  -- Set while an admin has disabled the account
+    ADD COLUMN disabled_reason TEXT,                                   -- Why the account was disabled, shown to admins only
+    ADD COLUMN password_reset_required BOOLEAN NOT NULL DEFAULT FALSE, -- Login is refused until the password is reset
+    ADD COLUMN tokens_valid_after TIMESTAMP;                           -- Access tokens issued before this are rejected
+
+
+--bun:split
+
+CREATE INDEX users_disabled_at_idx ON users (disabled_at) WHERE disabled_at IS NOT NULL;
+
+
+--bun:split
+
+INSERT INTO permissions (name, description) VALUES
+    ('user:impersonate', 'Act as another user for support, with the impersonation recorded');
+
+
+--bun:split
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.role_id, p.permission_id
+FROM roles r JOIN permissions p
+    ON r.name = 'admin' AND p.name = 'user:impersonate';
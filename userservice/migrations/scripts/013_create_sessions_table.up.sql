@@ -0,0 +1,26 @@
+CREATE TABLE sessions (
+    session_id CHAR(32) PRIMARY KEY,                                  -- Family ID of the session's refresh tokens, the "sid" claim of its access tokens
+    user_id INT NOT NULL REFERENCES users(user_id) ON DELETE CASCADE, -- Owner of the session
+    device_name VARCHAR(100) NOT NULL,                                -- Given at login, or derived from the user agent
+    user_agent TEXT,                                                  -- User-Agent header of the login
+    ip VARCHAR(45),                                                   -- Client IP of the most recent login or refresh
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,                   -- Login timestamp
+    last_seen_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,                 -- Most recent login or refresh
+    revoked_at TIMESTAMP                                              -- Set on logout, revocation or reuse detection
+);
+
+
+--bun:split
+
+CREATE INDEX sessions_user_id_idx ON sessions (user_id);
+
+
+--bun:split
+
+-- Sessions for logins made before sessions were recorded, so they can be listed and revoked too
+INSERT INTO sessions (session_id, user_id, device_name, created_at, last_seen_at, revoked_at)
+SELECT family_id, user_id, 'Unknown device', MIN(created_at), MAX(created_at),
+       CASE WHEN BOOL_AND(revoked_at IS NOT NULL OR used_at IS NOT NULL) THEN MAX(COALESCE(revoked_at, used_at)) END
+FROM refresh_tokens
+WHERE expires_at > CURRENT_TIMESTAMP
+GROUP BY family_id, user_id;
@@ -0,0 +1,40 @@
+-- Emails are now stored and looked up in lower case. Active accounts whose
+-- emails only differ in case cannot all keep them: the one already in lower
+-- case, or else the oldest, keeps the address, and the others are disabled
+-- with a placeholder email and the original one in the reason, for an admin
+-- to sort out with the user.
+WITH ranked AS (
+    SELECT user_id, email,
+           FIRST_VALUE(user_id) OVER w AS kept_by,
+           ROW_NUMBER() OVER w AS rank
+    FROM users
+    WHERE deleted_at IS NULL
+    WINDOW w AS (PARTITION BY LOWER(email) ORDER BY email = LOWER(email) DESC, user_id)
+)
+UPDATE users u
+SET email = 'conflict-' || u.user_id || '@invalid',
+    disabled_at = CURRENT_TIMESTAMP,
+    disabled_reason = 'Email ' || r.email || ' differs only in case from the email of user ' || r.kept_by,
+    updated_at = CURRENT_TIMESTAMP
+FROM ranked r
+WHERE r.user_id = u.user_id
+  AND r.rank > 1;
+
+
+--bun:split
+
+-- The UNIQUE(email) constraint also covers soft-deleted accounts, so addresses
+-- clashing with one of those keep their case. Lookups use LOWER(email) anyway.
+UPDATE users u
+SET email = LOWER(u.email)
+WHERE u.email <> LOWER(u.email)
+  AND NOT EXISTS (
+      SELECT 1 FROM users o
+      WHERE o.user_id <> u.user_id
+        AND LOWER(o.email) = LOWER(u.email)
+  );
+
+
+--bun:split
+
+CREATE UNIQUE INDEX users_email_lower_idx ON users (LOWER(email)) WHERE deleted_at IS NULL;
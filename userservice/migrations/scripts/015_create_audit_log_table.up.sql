@@ -0,0 +1,68 @@
+CREATE TABLE audit_log (
+    audit_id BIGSERIAL PRIMARY KEY,                 -- Order in which entries were written
+    action VARCHAR(50) NOT NULL,                    -- What happened, e.g. 'login' or 'roles_change'
+    outcome VARCHAR(10) NOT NULL CHECK (outcome IN ('success', 'failure', 'denied')),
+    actor_id INT,                                   -- User who acted; unset for anonymous requests and service tokens
+    impersonator_id INT,                            -- Admin behind an impersonation token
+    actor_client_id VARCHAR(64),                    -- API client behind a service token
+    target_user_id INT,                             -- User the action was about
+    detail TEXT,                                    -- Why it failed, or what changed
+    ip VARCHAR(45),                                 -- Client IP of the request
+    user_agent TEXT,                                -- User-Agent header of the request
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+
+--bun:split
+
+CREATE INDEX audit_log_created_at_idx ON audit_log (created_at);
+
+
+--bun:split
+
+CREATE INDEX audit_log_actor_id_idx ON audit_log (actor_id, created_at) WHERE actor_id IS NOT NULL;
+
+
+--bun:split
+
+CREATE INDEX audit_log_target_user_id_idx ON audit_log (target_user_id, created_at) WHERE target_user_id IS NOT NULL;
+
+
+--bun:split
+
+-- Entries can be added but never changed or removed, not even by this service.
+-- The one exception is clearing the IP and user agent, which erasing a user
+-- does to the entries of their own requests.
+CREATE FUNCTION audit_log_append_only() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP = 'UPDATE'
+       AND NEW.ip IS NULL AND NEW.user_agent IS NULL
+       AND (NEW.audit_id, NEW.action, NEW.outcome, NEW.actor_id, NEW.impersonator_id, NEW.actor_client_id, NEW.target_user_id, NEW.detail, NEW.created_at)
+           IS NOT DISTINCT FROM
+           (OLD.audit_id, OLD.action, OLD.outcome, OLD.actor_id, OLD.impersonator_id, OLD.actor_client_id, OLD.target_user_id, OLD.detail, OLD.created_at) THEN
+        RETURN NEW;
+    END IF;
+    RAISE EXCEPTION 'audit_log is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+
+--bun:split
+
+CREATE TRIGGER audit_log_append_only
+    BEFORE UPDATE OR DELETE ON audit_log
+    FOR EACH ROW EXECUTE FUNCTION audit_log_append_only();
+
+
+--bun:split
+
+INSERT INTO permissions (name, description) VALUES
+    ('audit:read', 'View the authentication audit log');
+
+
+--bun:split
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.role_id, p.permission_id
+FROM roles r JOIN permissions p
+    ON r.name = 'admin' AND p.name = 'audit:read';
@@ -0,0 +1,28 @@
+ALTER TABLE api_clients
+    ADD COLUMN redirect_uris TEXT[] NOT NULL DEFAULT '{}',                 -- Where the authorization code flow may send users back to
+    ADD COLUMN grant_types TEXT[] NOT NULL DEFAULT '{client_credentials}', -- OAuth 2.0 grants the client may use
+    ADD COLUMN public BOOLEAN NOT NULL DEFAULT FALSE,                       -- Public clients have no secret and rely on PKCE alone
+    ALTER COLUMN secret_hash DROP NOT NULL;
+
+
+--bun:split
+
+CREATE TABLE oidc_authorization_codes (
+    code_hash CHAR(64) PRIMARY KEY,                 -- SHA-256 of the code; the code itself is never stored
+    client_id VARCHAR(64) NOT NULL REFERENCES api_clients(client_id),
+    user_id INT NOT NULL REFERENCES users(user_id) ON DELETE CASCADE,
+    redirect_uri TEXT NOT NULL,                     -- Must match the redirect_uri of the token request
+    scope TEXT NOT NULL,                            -- Granted scopes, e.g. 'openid email'
+    nonce TEXT,                                     -- Copied into the ID token
+    code_challenge VARCHAR(128) NOT NULL,           -- PKCE S256 challenge
+    amr TEXT[] NOT NULL DEFAULT '{}',               -- Authentication methods used, e.g. '{pwd,otp}'
+    auth_time TIMESTAMP NOT NULL,                   -- When the user authenticated
+    expires_at TIMESTAMP NOT NULL,                  -- Code cannot be exchanged after this
+    used_at TIMESTAMP,                              -- Set when exchanged for tokens
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP  -- Issue timestamp
+);
+
+
+--bun:split
+
+CREATE INDEX oidc_authorization_codes_expires_at_idx ON oidc_authorization_codes (expires_at);
@@ -0,0 +1,13 @@
+-- Meant for the Order Service, whose API client is created with this scope
+-- (see "Service Tokens" in the README). Admins get it too, to look into and
+-- release stuck reservations by hand.
+INSERT INTO permissions (name, description) VALUES
+    ('inventory:reserve', 'Hold, confirm and release product stock for orders');
+
+
+--bun:split
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.role_id, p.permission_id
+FROM roles r JOIN permissions p
+    ON r.name = 'admin' AND p.name = 'inventory:reserve';
@@ -0,0 +1,13 @@
+-- Recording payments confirms an order's stock reservation. It is meant for
+-- the API client of a payment provider integration; admins get it to record
+-- payments by hand.
+INSERT INTO permissions (name, description) VALUES
+    ('order:pay', 'Record payments of orders');
+
+
+--bun:split
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.role_id, p.permission_id
+FROM roles r JOIN permissions p
+    ON r.name = 'admin' AND p.name = 'order:pay';
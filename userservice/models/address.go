@@ -0,0 +1,27 @@
+package models
+
+import (
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+// Address is a shipping address in a user's address book.
+type Address struct {
+	bun.BaseModel `bun:"table:addresses,alias:a"`
+
+	AddressID     int64     `bun:"address_id,pk,autoincrement" json:"address_id"`                   // Primary key
+	UserID        int64     `bun:"user_id,notnull" json:"user_id"`                                  // Owner of the address
+	Label         string    `bun:"label,nullzero" json:"label"`                                     // Optional name, e.g. "Home"
+	RecipientName string    `bun:"recipient_name,notnull" json:"recipient_name"`                    // Person to deliver to
+	PhoneNo       string    `bun:"phone_no,nullzero" json:"phone_no"`                               // Contact number for the courier
+	Line1         string    `bun:"line1,notnull" json:"line1"`                                      // Street and house number
+	Line2         string    `bun:"line2,nullzero" json:"line2"`                                     // Apartment, floor, landmark
+	City          string    `bun:"city,notnull" json:"city"`                                        // City
+	State         string    `bun:"state,nullzero" json:"state"`                                     // State, province or county
+	PostalCode    string    `bun:"postal_code,nullzero" json:"postal_code"`                         // Postal code
+	Country       string    `bun:"country,notnull" json:"country"`                                  // ISO 3166-1 alpha-2 code
+	IsDefault     bool      `bun:"is_default,notnull" json:"is_default"`                            // Used for orders that name no address
+	CreatedAt     time.Time `bun:"created_at,nullzero,default:current_timestamp" json:"created_at"` // Creation timestamp
+	UpdatedAt     time.Time `bun:"updated_at,nullzero,default:current_timestamp" json:"updated_at"` // Timestamp for last update
+}
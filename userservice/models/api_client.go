@@ -0,0 +1,26 @@
+package models
+
+import (
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+// APIClient is a service that authenticates with the client credentials grant,
+// or an application that logs users in through OpenID Connect. Only the SHA-256
+// hash of its secret is stored; public clients have none.
+type APIClient struct {
+	bun.BaseModel `bun:"table:api_clients,alias:ac"`
+
+	ClientID     string    `bun:"client_id,pk" json:"client_id"`                                   // Public identifier
+	Name         string    `bun:"name,notnull" json:"name"`                                        // What the client is
+	SecretHash   string    `bun:"secret_hash,nullzero" json:"-"`                                   // SHA-256 hex digest of the secret
+	Scopes       []string  `bun:"scopes,array" json:"scopes"`                                      // Permissions the client may request
+	RedirectURIs []string  `bun:"redirect_uris,array" json:"redirect_uris"`                        // Allowed redirect_uri values of the authorization code flow
+	GrantTypes   []string  `bun:"grant_types,array" json:"grant_types"`                            // OAuth 2.0 grants the client may use
+	Public       bool      `bun:"public,notnull" json:"public"`                                    // No secret; the authorization code flow relies on PKCE alone
+	CreatedBy    int64     `bun:"created_by,nullzero" json:"created_by,omitempty"`                 // Admin who created the client
+	CreatedAt    time.Time `bun:"created_at,nullzero,default:current_timestamp" json:"created_at"` // Creation timestamp
+	LastUsedAt   time.Time `bun:"last_used_at,nullzero" json:"last_used_at"`                       // Last token issue
+	RevokedAt    time.Time `bun:"revoked_at,nullzero" json:"revoked_at"`                           // Set when revoked
+}
@@ -0,0 +1,25 @@
+package models
+
+import (
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+// AuditLog is an entry of the append-only record of logins, token use and
+// changes to accounts.
+type AuditLog struct {
+	bun.BaseModel `bun:"table:audit_log,alias:al"`
+
+	AuditID        int64     `bun:"audit_id,pk,autoincrement"`                     // Order in which entries were written
+	Action         string    `bun:"action,notnull"`                                // What happened, e.g. "login"
+	Outcome        string    `bun:"outcome,notnull"`                               // "success", "failure" or "denied"
+	ActorID        int64     `bun:"actor_id,nullzero"`                             // User who acted
+	ImpersonatorID int64     `bun:"impersonator_id,nullzero"`                      // Admin behind an impersonation token
+	ActorClientID  string    `bun:"actor_client_id,nullzero"`                      // API client behind a service token
+	TargetUserID   int64     `bun:"target_user_id,nullzero"`                       // User the action was about
+	Detail         string    `bun:"detail,nullzero"`                               // Why it failed, or what changed
+	IP             string    `bun:"ip,nullzero"`                                   // Client IP of the request
+	UserAgent      string    `bun:"user_agent,nullzero"`                           // User-Agent header of the request
+	CreatedAt      time.Time `bun:"created_at,nullzero,default:current_timestamp"` // When it happened
+}
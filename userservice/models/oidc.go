@@ -0,0 +1,26 @@
+package models
+
+import (
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+// OIDCAuthorizationCode is a single-use code handed to an OpenID Connect client
+// after the user logged in at /oauth/authorize. Only its SHA-256 hash is stored.
+type OIDCAuthorizationCode struct {
+	bun.BaseModel `bun:"table:oidc_authorization_codes,alias:oac"`
+
+	CodeHash      string    `bun:"code_hash,pk"`                                  // SHA-256 hex digest of the code
+	ClientID      string    `bun:"client_id,notnull"`                             // Client the code was issued to
+	UserID        int64     `bun:"user_id,notnull"`                               // User who logged in
+	RedirectURI   string    `bun:"redirect_uri,notnull"`                          // Must match the token request
+	Scope         string    `bun:"scope,notnull"`                                 // Granted scopes, space-separated
+	Nonce         string    `bun:"nonce,nullzero"`                                // Copied into the ID token
+	CodeChallenge string    `bun:"code_challenge,notnull"`                        // PKCE S256 challenge
+	AMR           []string  `bun:"amr,array"`                                     // Authentication methods used, e.g. "pwd" and "otp"
+	AuthTime      time.Time `bun:"auth_time,notnull"`                             // When the user authenticated
+	ExpiresAt     time.Time `bun:"expires_at,notnull"`                            // Code cannot be exchanged after this
+	UsedAt        time.Time `bun:"used_at,nullzero"`                              // Set when exchanged for tokens
+	CreatedAt     time.Time `bun:"created_at,nullzero,default:current_timestamp"` // Issue timestamp
+}
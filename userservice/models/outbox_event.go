@@ -0,0 +1,21 @@
+package models
+
+import (
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+// OutboxEvent is an event written in the same transaction as the change it
+// describes and published to Kafka afterwards.
+type OutboxEvent struct {
+	bun.BaseModel `bun:"table:outbox_events,alias:oe"`
+
+	ID          int64     `bun:"id,pk,autoincrement"`                           // Publication order
+	Topic       string    `bun:"topic,notnull"`                                 // Kafka topic
+	Payload     string    `bun:"payload,type:jsonb,notnull"`                    // Event body as JSON
+	CreatedAt   time.Time `bun:"created_at,nullzero,default:current_timestamp"` // Time of the change
+	PublishedAt time.Time `bun:"published_at,nullzero"`                         // Set once Kafka accepted the event
+	Attempts    int       `bun:"attempts,notnull"`                              // Failed publish attempts
+	LastError   string    `bun:"last_error,nullzero"`                           // Error of the last failed attempt
+}
@@ -0,0 +1,38 @@
+package models
+
+import (
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+// Role groups permissions that can be assigned to users.
+type Role struct {
+	bun.BaseModel `bun:"table:roles,alias:r"`
+
+	RoleID      int64     `bun:"role_id,pk,autoincrement"`                      // Primary key
+	Name        string    `bun:"name,unique,notnull"`                           // Role name, e.g. 'admin'
+	Description string    `bun:"description,nullzero"`                          // What the role is for
+	Privileged  bool      `bun:"privileged,notnull"`                            // Only assignable by an admin
+	CreatedAt   time.Time `bun:"created_at,nullzero,default:current_timestamp"` // Role creation timestamp
+	Permissions []string  `bun:"-"`                                             // Permission names, filled in by handlers
+}
+
+// Permission is a single capability such as "product:write".
+type Permission struct {
+	bun.BaseModel `bun:"table:permissions,alias:p"`
+
+	PermissionID int64  `bun:"permission_id,pk,autoincrement"` // Primary key
+	Name         string `bun:"name,unique,notnull"`            // Permission name
+	Description  string `bun:"description,nullzero"`           // What the permission allows
+}
+
+// UserRole assigns a role to a user.
+type UserRole struct {
+	bun.BaseModel `bun:"table:user_roles,alias:ur"`
+
+	UserID     int64     `bun:"user_id,pk"`                                     // Reference to the user
+	RoleID     int64     `bun:"role_id,pk"`                                     // Reference to the role
+	AssignedBy int64     `bun:"assigned_by,nullzero"`                           // Admin who assigned the role
+	AssignedAt time.Time `bun:"assigned_at,nullzero,default:current_timestamp"` // Assignment timestamp
+}
@@ -0,0 +1,22 @@
+package models
+
+import (
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+// Session is one login of a user on a device. Its ID is the family ID of the
+// refresh tokens rotated from the login, and the "sid" claim of its access tokens.
+type Session struct {
+	bun.BaseModel `bun:"table:sessions,alias:s"`
+
+	SessionID  string    `bun:"session_id,pk"`                                   // Refresh token family ID
+	UserID     int64     `bun:"user_id,notnull"`                                 // Owner of the session
+	DeviceName string    `bun:"device_name,notnull"`                             // Given at login, or derived from the user agent
+	UserAgent  string    `bun:"user_agent,nullzero"`                             // User-Agent header of the login
+	IP         string    `bun:"ip,nullzero"`                                     // Client IP of the most recent login or refresh
+	CreatedAt  time.Time `bun:"created_at,nullzero,default:current_timestamp"`   // Login timestamp
+	LastSeenAt time.Time `bun:"last_seen_at,nullzero,default:current_timestamp"` // Most recent login or refresh
+	RevokedAt  time.Time `bun:"revoked_at,nullzero"`                             // Set on logout, revocation or reuse detection
+}
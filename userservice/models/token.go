@@ -0,0 +1,79 @@
+package models
+
+import (
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+// RefreshToken is a single-use refresh token. Only its SHA-256 hash is stored.
+// Every token minted by rotating another shares the original login's FamilyID,
+// so the whole chain can be revoked when a used token is presented again.
+type RefreshToken struct {
+	bun.BaseModel `bun:"table:refresh_tokens,alias:rt"`
+
+	RefreshTokenID int64     `bun:"refresh_token_id,pk,autoincrement"`             // Primary key
+	UserID         int64     `bun:"user_id,notnull"`                               // Owner of the token
+	TokenHash      string    `bun:"token_hash,unique,notnull"`                     // SHA-256 hex digest of the token
+	FamilyID       string    `bun:"family_id,notnull"`                             // Shared by all tokens rotated from one login
+	ExpiresAt      time.Time `bun:"expires_at,notnull"`                            // Token cannot be used after this
+	UsedAt         time.Time `bun:"used_at,nullzero"`                              // Set when exchanged for a new token
+	RevokedAt      time.Time `bun:"revoked_at,nullzero"`                           // Set on logout or reuse detection
+	TwoFactor      bool      `bun:"two_factor,notnull"`                            // Whether the family's login passed 2FA
+	CreatedAt      time.Time `bun:"created_at,nullzero,default:current_timestamp"` // Issue timestamp
+}
+
+// RevokedToken records an access token that was revoked before it expired.
+type RevokedToken struct {
+	bun.BaseModel `bun:"table:revoked_tokens,alias:rvt"`
+
+	JTI       string    `bun:"jti,pk"`                                        // Token ID ("jti" claim)
+	ExpiresAt time.Time `bun:"expires_at,notnull"`                            // Original expiry; the row can be purged after this
+	RevokedAt time.Time `bun:"revoked_at,nullzero,default:current_timestamp"` // Revocation timestamp
+}
+
+// Purposes of single-use user tokens.
+const (
+	PurposeEmailVerification  = "email_verification"
+	PurposePasswordReset      = "password_reset"
+	PurposeTwoFactorChallenge = "two_factor_challenge"
+)
+
+// UserToken is a single-use, expiring token mailed to a user to verify their
+// email address or reset their password, or handed out by login when a 2FA code
+// is still needed. Only its SHA-256 hash is stored.
+type UserToken struct {
+	bun.BaseModel `bun:"table:user_tokens,alias:ut"`
+
+	UserTokenID int64     `bun:"user_token_id,pk,autoincrement"`                // Primary key
+	UserID      int64     `bun:"user_id,notnull"`                               // Owner of the token
+	Purpose     string    `bun:"purpose,notnull"`                               // PurposeEmailVerification or PurposePasswordReset
+	TokenHash   string    `bun:"token_hash,unique,notnull"`                     // SHA-256 hex digest of the token
+	ExpiresAt   time.Time `bun:"expires_at,notnull"`                            // Token cannot be used after this
+	UsedAt      time.Time `bun:"used_at,nullzero"`                              // Set when used or superseded by a newer token
+	Attempts    int       `bun:"attempts,notnull"`                              // Failed attempts to use the token
+	CreatedAt   time.Time `bun:"created_at,nullzero,default:current_timestamp"` // Issue timestamp
+}
+
+// RecoveryCode is a single-use code that replaces a TOTP code when the
+// authenticator is lost. Only its SHA-256 hash is stored.
+type RecoveryCode struct {
+	bun.BaseModel `bun:"table:recovery_codes,alias:rc"`
+
+	RecoveryCodeID int64     `bun:"recovery_code_id,pk,autoincrement"`             // Primary key
+	UserID         int64     `bun:"user_id,notnull"`                               // Owner of the code
+	CodeHash       string    `bun:"code_hash,unique,notnull"`                      // SHA-256 hex digest of the code
+	UsedAt         time.Time `bun:"used_at,nullzero"`                              // Set when the code is used
+	CreatedAt      time.Time `bun:"created_at,nullzero,default:current_timestamp"` // Issue timestamp
+}
+
+// LoginAttempt tracks failed logins for one account ("account:<email>") or
+// client IP ("ip:<address>").
+type LoginAttempt struct {
+	bun.BaseModel `bun:"table:login_attempts,alias:la"`
+
+	Key           string    `bun:"key,pk"`                  // "account:<email>" or "ip:<address>"
+	Failures      int       `bun:"failures,notnull"`        // Consecutive failures within the failure window
+	LastFailureAt time.Time `bun:"last_failure_at,notnull"` // Time of the most recent failure
+	LockedUntil   time.Time `bun:"locked_until,nullzero"`   // Set while locked out
+}
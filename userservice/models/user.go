@@ -2,6 +2,8 @@ package models
 
 import (
 	"time"
+
+	"github.com/hari134/pratilipi/pkg/db"
 	"github.com/uptrace/bun"
 )
 
@@ -12,8 +14,17 @@ type User struct {
 	Name         string    `bun:"name,notnull"`              // User's name
 	PhoneNo      string    `bun:"phone_no,notnull"`           // User's phone number
 	Email        string    `bun:"email,unique,notnull"`      // Unique email address
-	PasswordHash string    `bun:"password_hash,notnull"`     // Hashed password for authentication
-	Role         string    `bun:"role,default:'user'"`       // Role: 'admin' or 'user', defaults to 'user'
+	PasswordHash string    `bun:"password_hash,notnull" json:"-"` // Hashed password for authentication
 	CreatedAt    time.Time `bun:"created_at,nullzero,default:current_timestamp"` // User registration timestamp
 	UpdatedAt    time.Time `bun:"updated_at,nullzero,default:current_timestamp"` // Timestamp for last update
+	EmailVerifiedAt time.Time `bun:"email_verified_at,nullzero"`                 // Set once the email address is verified
+	TOTPSecret      string    `bun:"totp_secret,nullzero" json:"-"`             // Base32 TOTP secret, set on 2FA enrollment
+	TOTPEnabledAt   time.Time `bun:"totp_enabled_at,nullzero"`                   // Set once 2FA enrollment is confirmed
+	TOTPLastCounter int64     `bun:"totp_last_counter,nullzero" json:"-"`       // Time step of the last accepted code
+	DisabledAt            time.Time `bun:"disabled_at,nullzero"`                 // Set while an admin has disabled the account
+	DisabledReason        string    `bun:"disabled_reason,nullzero"`             // Why the account was disabled
+	PasswordResetRequired bool      `bun:"password_reset_required,notnull"`      // Login is refused until the password is reset
+	TokensValidAfter      time.Time `bun:"tokens_valid_after,nullzero" json:"-"` // Access tokens issued before this are rejected
+	db.SoftDelete                                                                 // deleted_at, hidden from default queries
+	db.Audit                                                                      // created_by and updated_by
 }
@@ -28,13 +28,24 @@ func (pm *ProducerManager) EmitUserRegisteredEvent(event *messaging.UserRegister
     return pm.producer.Emit("user-registered", eventBytes)
 }
 
-// EmitUserProfileUpdatedEvent emits a UserProfileUpdated event using the provided producer.
-func (pm *ProducerManager) EmitUserProfileUpdatedEvent(event *messaging.UserProfileUpdated) error {
+// EmitAccountLockedEvent emits an AccountLocked event using the provided producer.
+func (pm *ProducerManager) EmitAccountLockedEvent(event *messaging.AccountLocked) error {
     eventBytes, err := json.Marshal(event)
     if err != nil {
         return err
     }
 
-    log.Printf("Emitting UserProfileUpdated event: %s", eventBytes)
-    return pm.producer.Emit("user-profile-updated", eventBytes)
+    log.Printf("Emitting AccountLocked event: %s", eventBytes)
+    return pm.producer.Emit("account-locked", eventBytes)
+}
+
+// EmitAccountUnlockedEvent emits an AccountUnlocked event using the provided producer.
+func (pm *ProducerManager) EmitAccountUnlockedEvent(event *messaging.AccountUnlocked) error {
+    eventBytes, err := json.Marshal(event)
+    if err != nil {
+        return err
+    }
+
+    log.Printf("Emitting AccountUnlocked event: %s", eventBytes)
+    return pm.producer.Emit("account-unlocked", eventBytes)
 }